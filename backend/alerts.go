@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Alert states
+const (
+	alertStateActive       = "active"
+	alertStateAcknowledged = "acknowledged"
+	alertStateResolved     = "resolved"
+)
+
+// Alert kinds raised by the monitor
+const (
+	alertKindNetsplit     = "netsplit"
+	alertKindServicesDown = "services_down"
+	alertKindErrorRate    = "high_error_rate"
+)
+
+const (
+	alertCheckInterval  = 30 * time.Second
+	alertErrorWindow    = 5 * time.Minute
+	alertErrorThreshold = 20 // Backend errors within alertErrorWindow
+)
+
+// Alert is a detected network or panel problem
+type Alert struct {
+	ID             int64      `json:"id"`
+	Kind           string     `json:"kind"`
+	Message        string     `json:"message"`
+	State          string     `json:"state"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (a Alert) MarshalJSON() ([]byte, error) {
+	type plain Alert
+	return marshalWithLocalTimes(plain(a))
+}
+
+// alertCondition is the result of one check. An empty message means the
+// condition is clear.
+type alertCondition struct {
+	kind    string
+	message string
+}
+
+// alertMonitor remembers what it has seen so disappearances can be detected
+type alertMonitor struct {
+	knownServers map[string]bool
+	servicesSeen bool
+}
+
+func newAlertMonitor() *alertMonitor {
+	return &alertMonitor{knownServers: make(map[string]bool)}
+}
+
+// startAlertMonitor checks for problems now and then every alertCheckInterval
+func startAlertMonitor() {
+	monitor := newAlertMonitor()
+	go func() {
+		ticker := time.NewTicker(alertCheckInterval)
+		defer ticker.Stop()
+		for {
+			monitor.run()
+			<-ticker.C
+		}
+	}()
+}
+
+// run evaluates every condition and brings the alerts table in line with it
+func (m *alertMonitor) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, condition := range m.evaluate(ctx) {
+		if err := syncAlert(condition, time.Now()); err != nil {
+			log.Printf("⚠️ Failed to update %s alert: %v", condition.kind, err)
+		}
+	}
+}
+
+// evaluate runs the checks. Checks that cannot tell (e.g. the server list is
+// unavailable) are left out so their alerts keep their current state.
+func (m *alertMonitor) evaluate(ctx context.Context) []alertCondition {
+	conditions := []alertCondition{m.checkErrorRate(time.Now())}
+
+	var servers []rpc.ServerInfo
+	if config.UseMockData || rpcClient == nil {
+		servers = getMockServers()
+	} else {
+		var err error
+		if servers, err = rpcClient.GetServers(ctx); err != nil {
+			log.Printf("⚠️ Alert monitor could not get the server list: %v", err)
+			return conditions
+		}
+	}
+
+	return append(conditions, m.checkNetsplit(servers), m.checkServices(servers))
+}
+
+// checkNetsplit reports servers that were linked earlier and are now missing
+func (m *alertMonitor) checkNetsplit(servers []rpc.ServerInfo) alertCondition {
+	linked := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		linked[server.Name] = true
+		m.knownServers[server.Name] = true
+	}
+
+	var missing []string
+	for name := range m.knownServers {
+		if !linked[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	condition := alertCondition{kind: alertKindNetsplit}
+	if len(missing) > 0 {
+		condition.message = "Servers split from the network: " + strings.Join(missing, ", ")
+	}
+	return condition
+}
+
+// checkServices reports configured services servers that are not linked. Without
+// configuration, services are down once a U-lined server was seen and is now gone.
+func (m *alertMonitor) checkServices(servers []rpc.ServerInfo) alertCondition {
+	health := evaluateServices(servers, config.ServicesServers, 0)
+	condition := alertCondition{kind: alertKindServicesDown}
+
+	if len(config.ServicesServers) > 0 {
+		if health.Online < health.Expected {
+			var missing []string
+			for _, name := range config.ServicesServers {
+				if !containsFold(health.Servers, name) {
+					missing = append(missing, name)
+				}
+			}
+			condition.message = "Services not linked: " + strings.Join(missing, ", ")
+		}
+		return condition
+	}
+
+	if health.Online > 0 {
+		m.servicesSeen = true
+	} else if m.servicesSeen {
+		condition.message = "No services server is linked"
+	}
+	return condition
+}
+
+// checkErrorRate reports when the backend logs too many errors in a short time
+func (m *alertMonitor) checkErrorRate(now time.Time) alertCondition {
+	condition := alertCondition{kind: alertKindErrorRate}
+	if count := backendLogs.countSince(logLevelError, now.Add(-alertErrorWindow)); count >= alertErrorThreshold {
+		condition.message = fmt.Sprintf("Backend logged %d errors in the last %s", count, alertErrorWindow)
+	}
+	return condition
+}
+
+// syncAlert raises, updates or resolves the unresolved alert of a kind
+func syncAlert(condition alertCondition, now time.Time) error {
+	var id int64
+	var message string
+	err := db.QueryRow(
+		"SELECT id, message FROM alerts WHERE kind = ? AND state != ? ORDER BY id DESC LIMIT 1",
+		condition.kind, alertStateResolved,
+	).Scan(&id, &message)
+	open := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	err = nil
+
+	switch {
+	case condition.message != "" && !open:
+		err = db.QueryRow(
+			"INSERT INTO alerts (kind, message, state, created_at, updated_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+			condition.kind, condition.message, alertStateActive, now, now,
+		).Scan(&id)
+		if err == nil {
+			log.Printf("🚨 Alert %d raised: %s", id, condition.message)
+		}
+	case condition.message != "" && message != condition.message:
+		_, err = db.Exec("UPDATE alerts SET message = ?, updated_at = ? WHERE id = ?", condition.message, now, id)
+	case condition.message == "" && open:
+		_, err = db.Exec(
+			"UPDATE alerts SET state = ?, resolved_at = ?, updated_at = ? WHERE id = ?",
+			alertStateResolved, now, now, id,
+		)
+		if err == nil {
+			log.Printf("✅ Alert %d resolved", id)
+		}
+	}
+	return err
+}
+
+// getAlertsHandler lists alerts, newest first. By default only unresolved
+// alerts are returned; state takes a comma-separated list of states.
+func getAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	states := splitList(r.URL.Query().Get("state"))
+	if len(states) == 0 {
+		states = []string{alertStateActive, alertStateAcknowledged}
+	}
+	args := make([]interface{}, 0, len(states)+1)
+	for _, state := range states {
+		if state != alertStateActive && state != alertStateAcknowledged && state != alertStateResolved {
+			http.Error(w, "state must be active, acknowledged or resolved", http.StatusBadRequest)
+			return
+		}
+		args = append(args, state)
+	}
+	limit := parseBoundedInt(r.URL.Query().Get("limit"), 50, 1, 500)
+
+	rows, err := db.Query(
+		"SELECT id, kind, message, state, created_at, updated_at, acknowledged_by, acknowledged_at, resolved_at FROM alerts"+
+			" WHERE state IN (?"+strings.Repeat(", ?", len(states)-1)+") ORDER BY id DESC LIMIT ?",
+		append(args, limit)...,
+	)
+	if err != nil {
+		log.Printf("❌ Failed to query alerts: %v", err)
+		http.Error(w, "Failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			log.Printf("❌ Failed to scan alert: %v", err)
+			http.Error(w, "Failed to load alerts", http.StatusInternalServerError)
+			return
+		}
+		alerts = append(alerts, alert)
+	}
+
+	json.NewEncoder(w).Encode(alerts)
+}
+
+type alertScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(row alertScanner) (Alert, error) {
+	var alert Alert
+	var acknowledgedAt, resolvedAt sql.NullTime
+	err := row.Scan(&alert.ID, &alert.Kind, &alert.Message, &alert.State, &alert.CreatedAt, &alert.UpdatedAt,
+		&alert.AcknowledgedBy, &acknowledgedAt, &resolvedAt)
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		alert.ResolvedAt = &resolvedAt.Time
+	}
+	return alert, err
+}
+
+// ackAlertHandler acknowledges an active alert. It stays open until the
+// condition clears, but no longer counts as needing attention.
+func ackAlertHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	alert, err := scanAlert(db.QueryRow(
+		"UPDATE alerts SET state = ?, acknowledged_by = ?, acknowledged_at = ?, updated_at = ? WHERE id = ? AND state = ?"+
+			" RETURNING id, kind, message, state, created_at, updated_at, acknowledged_by, acknowledged_at, resolved_at",
+		alertStateAcknowledged, actorName(r), now, now, id, alertStateActive,
+	))
+	if err == sql.ErrNoRows {
+		var state string
+		err := db.QueryRow("SELECT state FROM alerts WHERE id = ?", id).Scan(&state)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Failed to look up alert %d: %v", id, err)
+			http.Error(w, "Failed to acknowledge alert", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Alert is already "+state, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to acknowledge alert %d: %v", id, err)
+		http.Error(w, "Failed to acknowledge alert", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "alert.ack", strconv.FormatInt(id, 10), map[string]string{"kind": alert.Kind})
+	json.NewEncoder(w).Encode(alert)
+}
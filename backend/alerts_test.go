@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+// listAlerts calls getAlertsHandler with the given query string
+func listAlerts(t *testing.T, query string) []Alert {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	getAlertsHandler(w, httptest.NewRequest("GET", "/api/alerts"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list alerts%s: status %d %s", query, w.Code, w.Body)
+	}
+	var alerts []Alert
+	if err := json.NewDecoder(w.Body).Decode(&alerts); err != nil {
+		t.Fatalf("decode alerts: %v", err)
+	}
+	return alerts
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+
+	monitor := newAlertMonitor()
+	linked := []rpc.ServerInfo{{Name: "hub.example.net"}, {Name: "leaf.example.net"}}
+	split := linked[:1]
+	now := time.Now()
+
+	sync := func(servers []rpc.ServerInfo) {
+		t.Helper()
+		if err := syncAlert(monitor.checkNetsplit(servers), now); err != nil {
+			t.Fatalf("syncAlert: %v", err)
+		}
+	}
+
+	sync(linked)
+	if alerts := listAlerts(t, ""); len(alerts) != 0 {
+		t.Fatalf("alerts with every server linked = %+v, want none", alerts)
+	}
+
+	// The leaf splits: the condition raises an active alert
+	sync(split)
+	alerts := listAlerts(t, "")
+	if len(alerts) != 1 || alerts[0].Kind != alertKindNetsplit || alerts[0].State != alertStateActive ||
+		alerts[0].Message != "Servers split from the network: leaf.example.net" {
+		t.Fatalf("alerts after split = %+v, want one active netsplit alert", alerts)
+	}
+	id := alerts[0].ID
+
+	ack := func(id int64) *httptest.ResponseRecorder {
+		r := asUser("POST", "/api/alerts/x/ack", "", adminID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.FormatInt(id, 10)})
+		w := httptest.NewRecorder()
+		ackAlertHandler(w, r)
+		return w
+	}
+
+	w := ack(id)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ack: status %d %s", w.Code, w.Body)
+	}
+	var acked Alert
+	if err := json.NewDecoder(w.Body).Decode(&acked); err != nil {
+		t.Fatalf("decode ack: %v", err)
+	}
+	if acked.State != alertStateAcknowledged || acked.AcknowledgedBy != "boss" || acked.AcknowledgedAt == nil {
+		t.Errorf("acknowledged alert = %+v", acked)
+	}
+	if w := ack(id); w.Code != http.StatusConflict {
+		t.Errorf("second ack: status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := ack(id + 100); w.Code != http.StatusNotFound {
+		t.Errorf("ack of a missing alert: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// The condition persists: the alert stays open and acknowledged
+	sync(split)
+	if alerts := listAlerts(t, ""); len(alerts) != 1 || alerts[0].ID != id || alerts[0].State != alertStateAcknowledged {
+		t.Errorf("alerts while still split = %+v, want the acknowledged alert", alerts)
+	}
+
+	// The leaf relinks: the alert resolves and drops out of the default list
+	sync(linked)
+	if alerts := listAlerts(t, ""); len(alerts) != 0 {
+		t.Errorf("unresolved alerts after relink = %+v, want none", alerts)
+	}
+	resolved := listAlerts(t, "?state=resolved")
+	if len(resolved) != 1 || resolved[0].ID != id || resolved[0].ResolvedAt == nil {
+		t.Errorf("resolved alerts = %+v, want the netsplit alert", resolved)
+	}
+	if w := ack(id); w.Code != http.StatusConflict {
+		t.Errorf("ack of a resolved alert: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// A new split raises a new alert rather than reopening the old one
+	sync(split)
+	if alerts := listAlerts(t, ""); len(alerts) != 1 || alerts[0].ID == id || alerts[0].State != alertStateActive {
+		t.Errorf("alerts after a second split = %+v, want a new active alert", alerts)
+	}
+
+	if got := auditCount(t, "alert.ack"); got != 1 {
+		t.Errorf("alert.ack audit entries = %d, want 1", got)
+	}
+}
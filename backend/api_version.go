@@ -0,0 +1,45 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// API response versions. Version 1 returns bare arrays, version 2 wraps list
+// responses in a paginated envelope. Version 1 stays the default for one release.
+const (
+	apiVersionArray    = 1
+	apiVersionEnvelope = 2
+)
+
+// envelopeProfile is the Accept profile that opts into the envelope,
+// e.g. Accept: application/json; profile="envelope"
+const envelopeProfile = "envelope"
+
+// requestedAPIVersion picks the response version from the X-API-Version
+// header or an Accept profile parameter, falling back to version 1
+func requestedAPIVersion(r *http.Request) int {
+	if value := strings.TrimSpace(r.Header.Get("X-API-Version")); value != "" {
+		if version, err := strconv.Atoi(value); err == nil && version >= apiVersionEnvelope {
+			return apiVersionEnvelope
+		}
+		return apiVersionArray
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && params["profile"] == envelopeProfile {
+			return apiVersionEnvelope
+		}
+	}
+
+	return apiVersionArray
+}
+
+// setAPIVersionHeaders tells clients and caches which response shape was served
+func setAPIVersionHeaders(w http.ResponseWriter, version int) {
+	w.Header().Set("X-API-Version", strconv.Itoa(version))
+	w.Header().Add("Vary", "Accept, X-API-Version")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEntry records an action performed through the panel
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Username  string          `json:"username"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (a AuditEntry) MarshalJSON() ([]byte, error) {
+	type plain AuditEntry
+	return marshalWithLocalTimes(plain(a))
+}
+
+// AuditLogResponse is a page of audit log entries
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// recordAudit stores an audit entry for the requesting user and broadcasts it
+// to subscribed WebSocket clients. Failures are logged but never fail the request.
+func recordAudit(r *http.Request, action, target string, details interface{}) {
+	userID, username, _ := getUserFromContext(r)
+	writeAudit(userID, username, action, target, details)
+}
+
+// writeAudit stores and broadcasts an audit entry for the given panel user.
+// Actions the panel takes on its own are recorded with user ID 0.
+func writeAudit(userID int, username, action, target string, details interface{}) {
+	raw, err := json.Marshal(details)
+	if err != nil || details == nil {
+		raw = []byte("{}")
+	}
+
+	entry := AuditEntry{
+		UserID:    userID,
+		Username:  username,
+		Action:    action,
+		Target:    target,
+		Details:   raw,
+		CreatedAt: time.Now(),
+	}
+
+	err = db.QueryRow(
+		"INSERT INTO audit_log (user_id, username, action, target, details, created_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id",
+		entry.UserID, entry.Username, entry.Action, entry.Target, string(entry.Details), entry.CreatedAt,
+	).Scan(&entry.ID)
+	if err != nil {
+		log.Printf("⚠️ Failed to record audit entry %s on %s: %v", action, target, err)
+		return
+	}
+
+	broadcastAudit(entry)
+}
+
+// getAuditLogHandler returns a page of audit entries, optionally filtered by action
+func getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "logs.view") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := parseBoundedInt(query.Get("limit"), defaultAuditLimit, 1, maxAuditLimit)
+	offset := parseBoundedInt(query.Get("offset"), 0, 0, -1)
+
+	where := ""
+	var args []interface{}
+	if actions := splitList(query.Get("action")); len(actions) > 0 {
+		where = " WHERE action IN (?" + strings.Repeat(", ?", len(actions)-1) + ")"
+		for _, action := range actions {
+			args = append(args, action)
+		}
+	}
+
+	response, err := queryAuditLog(where, args, limit, offset)
+	if err != nil {
+		log.Printf("Failed to load audit log: %v", err)
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryAuditLog loads a page of audit entries, newest first. where is either
+// empty or a " WHERE ..." clause using args as its placeholders.
+func queryAuditLog(where string, args []interface{}, limit, offset int) (AuditLogResponse, error) {
+	response := AuditLogResponse{Entries: []AuditEntry{}, Limit: limit, Offset: offset}
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&response.Total); err != nil {
+		return response, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	rows, err := db.Query(
+		"SELECT id, user_id, username, action, target, details, created_at FROM audit_log"+where+
+			" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return response, fmt.Errorf("failed to query audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var details string
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Username, &entry.Action, &entry.Target, &details, &entry.CreatedAt); err != nil {
+			return response, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.Details = json.RawMessage(details)
+		response.Entries = append(response.Entries, entry)
+	}
+	return response, rows.Err()
+}
+
+// parseBoundedInt parses an integer query value, falling back to def when it is
+// missing or invalid and clamping it to [min, max]. A negative max means unbounded.
+func parseBoundedInt(value string, def, min, max int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	if n < min {
+		return min
+	}
+	if max >= 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
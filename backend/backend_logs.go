@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backendLogCapacity bounds how many warning/error lines are kept in memory
+const backendLogCapacity = 200
+
+// Backend log levels captured by the ring buffer
+const (
+	logLevelError = "error"
+	logLevelWarn  = "warn"
+)
+
+// BackendLogEntry is a captured warning or error log line
+type BackendLogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (b BackendLogEntry) MarshalJSON() ([]byte, error) {
+	type plain BackendLogEntry
+	return marshalWithLocalTimes(plain(b))
+}
+
+// logRing keeps the most recent warning and error log lines. ringHandler
+// adds them as slog records pass through it, log.Printf lines included.
+type logRing struct {
+	mutex   sync.Mutex
+	entries []BackendLogEntry
+	next    int
+	full    bool
+}
+
+var backendLogs = newLogRing(backendLogCapacity)
+
+func newLogRing(capacity int) *logRing {
+	return &logRing{entries: make([]BackendLogEntry, capacity)}
+}
+
+// add stores a warning or error
+func (l *logRing) add(t time.Time, level, message string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries[l.next] = BackendLogEntry{Time: t, Level: level, Message: scrubSecrets(message)}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns up to limit entries, newest first, optionally filtered by level
+func (l *logRing) recent(level string, limit int) []BackendLogEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	entries := []BackendLogEntry{}
+	for i := 1; i <= count && len(entries) < limit; i++ {
+		entry := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if level == "" || entry.Level == level {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// countSince counts the entries of a level logged at or after since
+func (l *logRing) countSince(level string, since time.Time) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count := 0
+	for _, entry := range l.entries {
+		if entry.Level == level && !entry.Time.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(password|secret|token)(["']?\s*[:=]\s*["']?)[^\s"',}]+`),
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), // JWTs
+}
+
+// scrubSecrets redacts configured secrets and credential-looking values
+func scrubSecrets(line string) string {
+	for _, secret := range []string{config.UnrealRPCPassword, config.JWTSecret} {
+		if secret != "" {
+			line = strings.ReplaceAll(line, secret, "[REDACTED]")
+		}
+	}
+
+	line = secretPatterns[0].ReplaceAllString(line, "${1}${2}[REDACTED]")
+	line = secretPatterns[1].ReplaceAllString(line, "Bearer [REDACTED]")
+	line = secretPatterns[2].ReplaceAllString(line, "[REDACTED]")
+	return line
+}
+
+// getBackendLogsHandler returns recent backend warnings and errors
+func getBackendLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	level := r.URL.Query().Get("level")
+	if level == "warning" {
+		level = logLevelWarn
+	}
+	if level != "" && level != logLevelError && level != logLevelWarn {
+		http.Error(w, "level must be error or warn", http.StatusBadRequest)
+		return
+	}
+
+	limit := parseBoundedInt(r.URL.Query().Get("limit"), 50, 1, backendLogCapacity)
+
+	json.NewEncoder(w).Encode(backendLogs.recent(level, limit))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggedErrorsCanBeFetched(t *testing.T) {
+	config = loadConfig()
+
+	for _, format := range []string{logFormatText, logFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			savedRing, savedLogger := backendLogs, slog.Default()
+			savedOutput, savedFlags := log.Writer(), log.Flags()
+			t.Cleanup(func() {
+				backendLogs = savedRing
+				slog.SetDefault(savedLogger)
+				log.SetOutput(savedOutput)
+				log.SetFlags(savedFlags)
+			})
+			backendLogs = newLogRing(10)
+			initLogging(format, "error")
+
+			slog.Error("database unreachable", "driver", "sqlite3")
+			slog.Warn("rpc call failed", "method", "user.list")
+			slog.Info("http request", "path", "/api/users")
+			log.Printf("❌ Failed to ban user: timeout")
+			log.Printf("👥 Getting user list...")
+
+			fetch := func(level string) []BackendLogEntry {
+				w := httptest.NewRecorder()
+				getBackendLogsHandler(w, httptest.NewRequest("GET", "/api/admin/logs/backend?level="+level, nil))
+				var entries []BackendLogEntry
+				if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+					t.Fatalf("decode %s logs: %v", level, err)
+				}
+				return entries
+			}
+
+			failures := fetch(logLevelError)
+			if len(failures) != 2 || failures[0].Message != "❌ Failed to ban user: timeout" || failures[1].Message != "database unreachable" {
+				t.Errorf("error entries = %+v, want the Printf error then the slog error, newest first", failures)
+			}
+			// Warnings are kept even though LOG_LEVEL=error drops them from the output
+			if warnings := fetch(logLevelWarn); len(warnings) != 1 || warnings[0].Message != "rpc call failed" {
+				t.Errorf("warn entries = %+v, want the slog warning", warnings)
+			}
+			if all := fetch(""); len(all) != 3 {
+				t.Errorf("all entries = %+v, want no info records", all)
+			}
+		})
+	}
+}
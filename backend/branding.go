@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Branding is the public display configuration the SPA renders before login.
+// It must only ever carry display values, never anything from the server config.
+type Branding struct {
+	Name        string `json:"name"`
+	NetworkName string `json:"networkName,omitempty"`
+	LogoURL     string `json:"logoUrl,omitempty"`
+}
+
+// safeLogoURL accepts http(s) URLs and same-origin paths, so a misconfigured
+// value can't inject javascript: or data: URLs into the login page
+func safeLogoURL(raw string) string {
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return raw
+}
+
+// getBrandingHandler serves the panel branding without authentication
+func getBrandingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	json.NewEncoder(w).Encode(Branding{
+		Name:        config.PanelName,
+		NetworkName: config.NetworkName,
+		LogoURL:     safeLogoURL(config.PanelLogoURL),
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ChannelAgeBucket counts the channels created within MaxAge of now and not
+// in an earlier bucket. MaxAge is 0 for the "older" and "unknown" buckets.
+type ChannelAgeBucket struct {
+	Label  string `json:"label"`
+	MaxAge int64  `json:"max_age_seconds,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// ChannelAgeDistribution groups the visible channels by age
+type ChannelAgeDistribution struct {
+	Buckets []ChannelAgeBucket `json:"buckets"`
+	Total   int                `json:"total"`
+}
+
+// channelAgeLimits are the upper bounds of the age buckets, youngest first
+var channelAgeLimits = []struct {
+	label  string
+	maxAge time.Duration
+}{
+	{"<1h", time.Hour},
+	{"<1d", 24 * time.Hour},
+	{"<1w", 7 * 24 * time.Hour},
+}
+
+// buildChannelAgeDistribution buckets channels by how long before now they
+// were created. Channels without a usable creation time count as "unknown";
+// ones created in the future, from clock skew between servers, as the youngest.
+func buildChannelAgeDistribution(channels []Channel, now time.Time) ChannelAgeDistribution {
+	buckets := make([]ChannelAgeBucket, 0, len(channelAgeLimits)+2)
+	for _, limit := range channelAgeLimits {
+		buckets = append(buckets, ChannelAgeBucket{Label: limit.label, MaxAge: int64(limit.maxAge.Seconds())})
+	}
+	older := len(buckets)
+	buckets = append(buckets, ChannelAgeBucket{Label: "older"}, ChannelAgeBucket{Label: "unknown"})
+	unknown := older + 1
+
+	for _, channel := range channels {
+		created, err := time.Parse(channelCreatedLayout, channel.Created)
+		if err != nil || created.IsZero() {
+			buckets[unknown].Count++
+			continue
+		}
+
+		bucket := older
+		age := now.Sub(created)
+		for i, limit := range channelAgeLimits {
+			if age < limit.maxAge {
+				bucket = i
+				break
+			}
+		}
+		buckets[bucket].Count++
+	}
+
+	return ChannelAgeDistribution{Buckets: buckets, Total: len(channels)}
+}
+
+// getChannelAgeDistributionHandler groups the channels the panel user may see by age
+func getChannelAgeDistributionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var channels []Channel
+	if config.UseMockData || rpcClient == nil {
+		channels = getMockChannels()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rpcChannels, err := rpcClient.GetChannels(ctx)
+		if err != nil {
+			log.Printf("RPC error getting channels for age distribution: %v", err)
+			writeRPCError(w, err, "Failed to get channels")
+			return
+		}
+		channels = make([]Channel, len(rpcChannels))
+		for i, rpcChannel := range rpcChannels {
+			channels[i] = toAPIChannel(rpcChannel)
+		}
+	}
+
+	channels = filterHiddenChannels(r, channels)
+	json.NewEncoder(w).Encode(buildChannelAgeDistribution(channels, time.Now().UTC()))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuildChannelAgeDistribution(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	created := func(age time.Duration) Channel {
+		return Channel{Created: now.Add(-age).Format(channelCreatedLayout)}
+	}
+
+	tests := []struct {
+		name     string
+		channels []Channel
+		counts   [5]int // <1h, <1d, <1w, older, unknown
+	}{
+		{"no channels", nil, [5]int{}},
+		{"one per bucket",
+			[]Channel{created(time.Minute), created(2 * time.Hour), created(3 * 24 * time.Hour), created(30 * 24 * time.Hour), {Created: "yesterday"}},
+			[5]int{1, 1, 1, 1, 1}},
+		{"bucket bounds are exclusive",
+			[]Channel{created(time.Hour - time.Second), created(time.Hour), created(24 * time.Hour), created(7 * 24 * time.Hour)},
+			[5]int{1, 1, 1, 1, 0}},
+		{"created in the future counts as youngest",
+			[]Channel{created(-10 * time.Minute)},
+			[5]int{1, 0, 0, 0, 0}},
+		{"missing or zero creation time",
+			[]Channel{{}, {Created: time.Time{}.Format(channelCreatedLayout)}},
+			[5]int{0, 0, 0, 0, 2}},
+	}
+	for _, tt := range tests {
+		dist := buildChannelAgeDistribution(tt.channels, now)
+		if dist.Total != len(tt.channels) || len(dist.Buckets) != len(tt.counts) {
+			t.Errorf("%s: total %d with %d buckets, want %d with %d", tt.name, dist.Total, len(dist.Buckets), len(tt.channels), len(tt.counts))
+			continue
+		}
+		for i, bucket := range dist.Buckets {
+			if bucket.Count != tt.counts[i] {
+				t.Errorf("%s: bucket %s = %d, want %d", tt.name, bucket.Label, bucket.Count, tt.counts[i])
+			}
+		}
+	}
+}
+
+func TestChannelAgeDistributionSkipsHiddenChannels(t *testing.T) {
+	setupTestDB(t)
+	config.HideSecretChans = true
+	recent := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	startFakeRPC(t, map[string]interface{}{"channel.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"name": "#lobby", "modes": "nt", "creation_time": recent},
+		{"name": "#opers", "modes": "nts", "creation_time": recent},
+	}}})
+
+	tests := []struct {
+		name, role string
+		total      int
+	}{
+		{"vic", "viewer", 1},
+		{"boss", "admin", 2},
+	}
+	for _, tt := range tests {
+		id := createTestUser(t, tt.name, tt.role)
+		w := httptest.NewRecorder()
+		getChannelAgeDistributionHandler(w, asUser("GET", "/api/channels/age-distribution", "", id, tt.name, tt.role))
+
+		var dist ChannelAgeDistribution
+		if err := json.NewDecoder(w.Body).Decode(&dist); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if dist.Total != tt.total || dist.Buckets[0].Count != tt.total {
+			t.Errorf("%s: %+v, want %d channels under an hour old", tt.name, dist, tt.total)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ChannelModerator grants a panel user moderation rights on a single channel
+type ChannelModerator struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Channel   string    `json:"channel"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (c ChannelModerator) MarshalJSON() ([]byte, error) {
+	type plain ChannelModerator
+	return marshalWithLocalTimes(plain(c))
+}
+
+// canModerateChannel checks if the user holds the global channels.moderate
+// permission or a per-channel moderator grant for the channel
+func canModerateChannel(r *http.Request, channel string) bool {
+	if hasPermission(r, "channels.moderate") {
+		return true
+	}
+
+	if channel == "" {
+		return false
+	}
+
+	userID, _, _ := getUserFromContext(r)
+	granted, err := hasChannelGrant(userID, channel)
+	if err != nil {
+		log.Printf("⚠️ Failed to check channel grant for user %d on %s: %v", userID, channel, err)
+		return false
+	}
+	return granted
+}
+
+// channelGrants returns the lowercased channels a user has per-channel moderator grants for
+func channelGrants(userID int) (map[string]bool, error) {
+	rows, err := db.Query("SELECT channel FROM channel_moderators WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make(map[string]bool)
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, err
+		}
+		grants[strings.ToLower(channel)] = true
+	}
+	return grants, rows.Err()
+}
+
+// hasChannelGrant checks if a user has a per-channel moderator grant
+func hasChannelGrant(userID int, channel string) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM channel_moderators WHERE user_id = ? AND channel = ?",
+		userID, strings.ToLower(channel),
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func getChannelModeratorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rows, err := db.Query(`
+		SELECT cm.id, cm.user_id, u.username, cm.channel, cm.created_at
+		FROM channel_moderators cm
+		JOIN webpanel_users u ON u.id = cm.user_id
+		ORDER BY cm.channel, u.username
+	`)
+	if err != nil {
+		log.Printf("Failed to list channel moderators: %v", err)
+		http.Error(w, "Failed to list channel moderators", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	moderators := []ChannelModerator{}
+	for rows.Next() {
+		var m ChannelModerator
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Username, &m.Channel, &m.CreatedAt); err != nil {
+			log.Printf("Failed to scan channel moderator: %v", err)
+			http.Error(w, "Failed to list channel moderators", http.StatusInternalServerError)
+			return
+		}
+		moderators = append(moderators, m)
+	}
+
+	json.NewEncoder(w).Encode(moderators)
+}
+
+func createChannelModeratorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		UserID  int    `json:"user_id"`
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	channel := strings.ToLower(strings.TrimSpace(req.Channel))
+	if req.UserID <= 0 || !strings.HasPrefix(channel, "#") {
+		http.Error(w, "A user_id and a channel starting with # are required", http.StatusBadRequest)
+		return
+	}
+
+	var moderator ChannelModerator
+	err := db.QueryRow("SELECT username FROM webpanel_users WHERE id = ?", req.UserID).Scan(&moderator.Username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Failed to look up user %d: %v", req.UserID, err)
+		http.Error(w, "Failed to create channel moderator", http.StatusInternalServerError)
+		return
+	}
+
+	granted, err := hasChannelGrant(req.UserID, channel)
+	if err != nil {
+		log.Printf("Failed to check channel grant: %v", err)
+		http.Error(w, "Failed to create channel moderator", http.StatusInternalServerError)
+		return
+	}
+	if granted {
+		http.Error(w, "User already moderates this channel", http.StatusConflict)
+		return
+	}
+
+	moderator.UserID = req.UserID
+	moderator.Channel = channel
+	moderator.CreatedAt = time.Now()
+
+	err = db.QueryRow(
+		"INSERT INTO channel_moderators (user_id, channel, created_at) VALUES (?, ?, ?) RETURNING id",
+		moderator.UserID, moderator.Channel, moderator.CreatedAt,
+	).Scan(&moderator.ID)
+	if err != nil {
+		log.Printf("Failed to create channel moderator: %v", err)
+		http.Error(w, "Failed to create channel moderator", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(moderator)
+}
+
+func deleteChannelModeratorHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel moderator ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM channel_moderators WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Failed to delete channel moderator %d: %v", id, err)
+		http.Error(w, "Failed to delete channel moderator", http.StatusInternalServerError)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Channel moderator not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestChannelGrantAllowsOnlyItsChannel(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+
+	viewer := createTestUser(t, "helper", "viewer")
+	w := httptest.NewRecorder()
+	createChannelModeratorHandler(w, asUser("POST", "/api/admin/channel-moderators",
+		fmt.Sprintf(`{"user_id": %d, "channel": "#Help"}`, viewer), 1, "admin", "admin"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("grant #help: %d %s", w.Code, w.Body)
+	}
+
+	kick := func(channel string) int {
+		w := httptest.NewRecorder()
+		kickUserHandler(w, asUser("POST", "/api/channels/kick",
+			`{"channel": "`+channel+`", "nick": "Guest0", "reason": "test"}`, viewer, "helper", "viewer"))
+		return w.Code
+	}
+	setTopic := func(channel string) int {
+		r := asUser("POST", "/api/channels/x/topic", `{"topic": "hello"}`, viewer, "helper", "viewer")
+		w := httptest.NewRecorder()
+		setChannelTopicHandler(w, mux.SetURLVars(r, map[string]string{"channel": channel}))
+		return w.Code
+	}
+
+	for _, channel := range []string{"#help", "#HELP"} {
+		if code := kick(channel); code != http.StatusOK {
+			t.Errorf("kick on granted %s = %d, want 200", channel, code)
+		}
+		if code := setTopic(channel); code != http.StatusOK {
+			t.Errorf("topic on granted %s = %d, want 200", channel, code)
+		}
+	}
+	if code := kick("#general"); code != http.StatusForbidden {
+		t.Errorf("kick on #general = %d, want 403", code)
+	}
+	if code := setTopic("#general"); code != http.StatusForbidden {
+		t.Errorf("topic on #general = %d, want 403", code)
+	}
+
+	// The global permission covers every channel
+	moderator := createTestUser(t, "mod", "moderator")
+	w = httptest.NewRecorder()
+	kickUserHandler(w, asUser("POST", "/api/channels/kick", `{"channel": "#general", "nick": "Guest0"}`, moderator, "mod", "moderator"))
+	if w.Code != http.StatusOK {
+		t.Errorf("kick by moderator on #general = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// auditActionMode is the audit action recorded for channel mode changes.
+// Its details hold {"modes": "+m", "params": [...]}.
+const auditActionMode = "mode"
+
+// ModeChange is a single mode change on a channel
+type ModeChange struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Modes  string    `json:"modes"`
+	Params []string  `json:"params,omitempty"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (m ModeChange) MarshalJSON() ([]byte, error) {
+	type plain ModeChange
+	return marshalWithLocalTimes(plain(m))
+}
+
+// ModeHistoryResponse is a page of mode changes for one channel, newest first
+type ModeHistoryResponse struct {
+	Channel string       `json:"channel"`
+	Changes []ModeChange `json:"changes"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+// getChannelModeHistoryHandler returns the mode changes recorded in the audit log for a channel
+func getChannelModeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channel := mux.Vars(r)["channel"]
+	if channel == "" {
+		http.Error(w, "Channel name required", http.StatusBadRequest)
+		return
+	}
+
+	if !canViewHiddenChannels(r) && isHiddenChannelName(r.Context(), channel) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := parseBoundedInt(query.Get("limit"), defaultAuditLimit, 1, maxAuditLimit)
+	offset := parseBoundedInt(query.Get("offset"), 0, 0, -1)
+
+	entries, err := queryAuditLog(" WHERE action = ? AND LOWER(target) = LOWER(?)", []interface{}{auditActionMode, channel}, limit, offset)
+	if err != nil {
+		log.Printf("Failed to load mode history for %s: %v", channel, err)
+		http.Error(w, "Failed to load mode history", http.StatusInternalServerError)
+		return
+	}
+
+	response := ModeHistoryResponse{
+		Channel: channel,
+		Changes: make([]ModeChange, 0, len(entries.Entries)),
+		Total:   entries.Total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, entry := range entries.Entries {
+		var details struct {
+			Modes  string   `json:"modes"`
+			Params []string `json:"params"`
+		}
+		if err := json.Unmarshal(entry.Details, &details); err != nil {
+			log.Printf("⚠️ Skipping malformed mode audit entry %d: %v", entry.ID, err)
+			continue
+		}
+
+		response.Changes = append(response.Changes, ModeChange{
+			Time:   entry.CreatedAt,
+			Actor:  entry.Username,
+			Modes:  details.Modes,
+			Params: details.Params,
+		})
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// listChannelModes take a parameter whether set or unset: the ban, exemption
+// and invite lists, and the member status modes
+const listChannelModes = "beIqaohv"
+
+// parseModeChange validates a mode change such as "+m", "-t+l 50" or "-k key"
+// and splits it into the mode letters and their parameters. Every mode that
+// takes a parameter must have one and no parameters may be left over.
+func parseModeChange(change string) (string, []string, error) {
+	fields := strings.Fields(change)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("modes are required")
+	}
+	modes, params := fields[0], fields[1:]
+	if modes[0] != '+' && modes[0] != '-' {
+		return "", nil, fmt.Errorf("modes must start with + or -")
+	}
+
+	adding := true
+	next := 0
+	for i := 0; i < len(modes); i++ {
+		c := modes[i]
+		switch {
+		case c == '+' || c == '-':
+			if i+1 == len(modes) || modes[i+1] == '+' || modes[i+1] == '-' {
+				return "", nil, fmt.Errorf("%q has a sign without mode letters", modes)
+			}
+			adding = c == '+'
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			if !modeTakesParam(c, adding) {
+				continue
+			}
+			if next == len(params) {
+				return "", nil, fmt.Errorf("mode %c needs a parameter", c)
+			}
+			if c == 'l' && adding {
+				if limit, err := strconv.Atoi(params[next]); err != nil || limit < 1 {
+					return "", nil, fmt.Errorf("limit %q is not a positive number", params[next])
+				}
+			}
+			next++
+		default:
+			return "", nil, fmt.Errorf("%q is not a mode letter", c)
+		}
+	}
+
+	if next < len(params) {
+		return "", nil, fmt.Errorf("%d parameter(s) left over for %s", len(params)-next, modes)
+	}
+	if next > maxModesPerCall {
+		return "", nil, fmt.Errorf("at most %d parameterised modes can be changed at once", maxModesPerCall)
+	}
+	return modes, params, nil
+}
+
+// modeTakesParam reports whether setting (adding) or unsetting a channel mode takes a parameter
+func modeTakesParam(letter byte, adding bool) bool {
+	switch {
+	case strings.IndexByte(listChannelModes, letter) >= 0:
+		return true
+	case letter == 'k':
+		return true // The key is needed to remove it too
+	case adding:
+		return strings.IndexByte(paramChannelModes, letter) >= 0
+	}
+	return false
+}
+
+// applyModeChange returns the channel mode string after a validated change,
+// for mock data. List and member status modes are not part of the string.
+func applyModeChange(current, modes string, params []string) string {
+	set := parseChannelModes(current)
+	letters, _, _ := strings.Cut(strings.TrimPrefix(current, "+"), " ")
+	order := []byte(letters)
+
+	adding := true
+	for i := 0; i < len(modes); i++ {
+		letter := modes[i]
+		switch {
+		case letter == '+' || letter == '-':
+			adding = letter == '+'
+			continue
+		case !modeTakesParam(letter, adding):
+		case strings.IndexByte(listChannelModes, letter) >= 0:
+			params = params[1:]
+			continue
+		default:
+			set[letter], params = params[0], params[1:]
+		}
+
+		if !adding {
+			delete(set, letter)
+			continue
+		}
+		if _, ok := set[letter]; !ok {
+			set[letter] = ""
+		}
+		if !strings.ContainsRune(string(order), rune(letter)) {
+			order = append(order, letter)
+		}
+	}
+
+	var kept []byte
+	var values []string
+	for _, letter := range order {
+		value, ok := set[letter]
+		if !ok {
+			continue
+		}
+		kept = append(kept, letter)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{"+" + string(kept)}, values...), " ")
+}
+
+// setChannelModesHandler applies a mode change to a channel and returns the
+// channel as it is afterwards. Body: {"modes": "+l 50"}, parameters following
+// the mode letters as in IRC's MODE command.
+func setChannelModesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if !strings.HasPrefix(channelName, "#") {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+	if !canModerateChannel(r, channelName) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Modes string `json:"modes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	modes, params, err := parseModeChange(req.Modes)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "field": "modes"})
+		return
+	}
+
+	var details *rpc.ChannelDetails
+	if config.UseMockData || rpcClient == nil {
+		details = getMockChannelDetails(channelName)
+		if details == nil {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+		details.Modes = strings.TrimPrefix(applyModeChange(details.Modes, modes, params), "+")
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := rpcClient.SetChannelMode(ctx, channelName, modes, params); err != nil {
+			log.Printf("RPC error setting modes %s on %s: %v", modes, channelName, err)
+			writeRPCError(w, err, "Failed to set channel modes")
+			return
+		}
+
+		details, err = rpcClient.GetChannel(rpc.Fresh(ctx), channelName)
+		if err != nil {
+			// The modes are set; only reading the channel back failed
+			log.Printf("RPC error reloading channel %s after setting modes: %v", channelName, err)
+			details = &rpc.ChannelDetails{Name: channelName}
+		}
+	}
+
+	recordAudit(r, auditActionMode, channelName, map[string]interface{}{"modes": modes, "params": params})
+	json.NewEncoder(w).Encode(details)
+}
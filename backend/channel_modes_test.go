@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseModeChange(t *testing.T) {
+	tests := []struct {
+		change string
+		modes  string
+		params []string
+		valid  bool
+	}{
+		{"+m", "+m", nil, true},
+		{"  -t+l 50 ", "-t+l", []string{"50"}, true},
+		{"-l", "-l", nil, true},
+		{"-k secret", "-k", []string{"secret"}, true},
+		{"+b-o *!*@spam.example Valware", "+b-o", []string{"*!*@spam.example", "Valware"}, true},
+		{"+kl key 10", "+kl", []string{"key", "10"}, true},
+		{"+vvvvvv a b c d e f", "+vvvvvv", []string{"a", "b", "c", "d", "e", "f"}, true},
+		{"", "", nil, false},
+		{"m", "", nil, false},
+		{"+", "", nil, false},
+		{"+-m", "", nil, false},
+		{"+m-", "", nil, false},
+		{"+k", "", nil, false},
+		{"+l many", "", nil, false},
+		{"+l 0", "", nil, false},
+		{"+m extra", "", nil, false},
+		{"+m1", "", nil, false},
+		{"+vvvvvvv a b c d e f g", "", nil, false},
+	}
+	for _, tt := range tests {
+		modes, params, err := parseModeChange(tt.change)
+		if (err == nil) != tt.valid {
+			t.Errorf("parseModeChange(%q) error = %v, want valid %t", tt.change, err, tt.valid)
+			continue
+		}
+		if tt.valid && (modes != tt.modes || !slices.Equal(params, tt.params)) {
+			t.Errorf("parseModeChange(%q) = %q %q, want %q %q", tt.change, modes, params, tt.modes, tt.params)
+		}
+	}
+}
+
+func TestApplyModeChange(t *testing.T) {
+	tests := []struct {
+		current, change, want string
+	}{
+		{"+nt", "+m", "+ntm"},
+		{"+nt", "-t", "+n"},
+		{"+nt", "-nt", ""},
+		{"", "+l 50", "+l 50"},
+		{"+ntl 50", "+l 100", "+ntl 100"},
+		{"+ntkl key 50", "-k key", "+ntl 50"},
+		{"+ntkl key 50", "-l", "+ntk key"},
+		{"+nt", "+b-t *!*@spam.example", "+n"},
+		{"+nt", "+o Valware", "+nt"},
+	}
+	for _, tt := range tests {
+		modes, params, err := parseModeChange(tt.change)
+		if err != nil {
+			t.Fatalf("parseModeChange(%q): %v", tt.change, err)
+		}
+		if got := applyModeChange(tt.current, modes, params); got != tt.want {
+			t.Errorf("apply %q to %q = %q, want %q", tt.change, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestStripModeLettersKeepsVisibleParams(t *testing.T) {
+	tests := []struct {
+		modes, hidden, want string
+	}{
+		{"+ntkl key 50", "", "+ntkl key 50"},
+		{"+ntkl key 50", "k", "+ntl 50"},
+		{"+ntkl key 50", "l", "+ntk key"},
+		{"+ntkl key 50", "kl", "+nt"},
+		{"+s", "s", ""},
+	}
+	for _, tt := range tests {
+		if got := stripModeLetters(tt.modes, tt.hidden); got != tt.want {
+			t.Errorf("stripModeLetters(%q, %q) = %q, want %q", tt.modes, tt.hidden, got, tt.want)
+		}
+	}
+}
+
+// setModes calls setChannelModesHandler as an admin
+func setModes(t *testing.T, channel, body string, userID int) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := asUser("POST", "/api/channels/x/modes", body, userID, "boss", "admin")
+	r = mux.SetURLVars(r, map[string]string{"channel": channel})
+	w := httptest.NewRecorder()
+	setChannelModesHandler(w, r)
+	return w
+}
+
+func TestSetChannelModesHandler(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	tests := []struct {
+		channel, body string
+		want          int
+		modes         string // Channel modes afterwards
+	}{
+		{"#general", `{"modes":"-k+l hijacked 50"}`, http.StatusOK, "ntil 50"},
+		{"#general", `{"modes":"+l"}`, http.StatusBadRequest, ""},
+		{"#general", `modes`, http.StatusBadRequest, ""},
+		{"general", `{"modes":"+m"}`, http.StatusBadRequest, ""},
+		{"#nowhere", `{"modes":"+m"}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := setModes(t, tt.channel, tt.body, adminID)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status %d %s, want %d", tt.channel, tt.body, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		var details rpc.ChannelDetails
+		if err := json.NewDecoder(w.Body).Decode(&details); err != nil || details.Modes != tt.modes {
+			t.Errorf("%s %s: modes %q, want %q", tt.channel, tt.body, details.Modes, tt.modes)
+		}
+	}
+
+	history := httptest.NewRecorder()
+	getChannelModeHistoryHandler(history, mux.SetURLVars(asUser("GET", "/api/channels/x/mode-history", "", adminID, "boss", "admin"),
+		map[string]string{"channel": "#GENERAL"}))
+	var resp ModeHistoryResponse
+	if err := json.NewDecoder(history.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode mode history: %v", err)
+	}
+	if resp.Total != 1 || resp.Changes[0].Modes != "-k+l" || strings.Join(resp.Changes[0].Params, " ") != "hijacked 50" || resp.Changes[0].Actor != "boss" {
+		t.Errorf("mode history = %+v, want the one change by boss", resp)
+	}
+}
+
+func TestSetChannelModesOverRPC(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	startFakeRPC(t, map[string]interface{}{
+		"channel.set_mode": true,
+		"channel.get":      map[string]interface{}{"name": "#help", "modes": "ntl 50"},
+	})
+
+	w := setModes(t, "#help", `{"modes":"+l 50"}`, adminID)
+	var details rpc.ChannelDetails
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&details) != nil || details.Modes != "ntl 50" {
+		t.Errorf("set modes = %d %+v, want 200 with the reloaded channel", w.Code, details)
+	}
+}
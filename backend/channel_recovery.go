@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// recoveryLockModes are the channel modes a takeover uses to keep staff out:
+// invite only, key and user limit
+const recoveryLockModes = "ikl"
+
+// maxModesPerCall is how many parameterised modes go in one MODE change,
+// staying under the MAXMODES servers advertise
+const maxModesPerCall = 6
+
+// Channel step actions
+const (
+	channelStepMode = "mode"
+	channelStepKick = "kick"
+)
+
+// RecoverChannelRequest is the body accepted by the channel recovery endpoint.
+// All fields are optional; Trusted defaults to CHANNEL_RECOVERY_OPS.
+type RecoverChannelRequest struct {
+	Trusted []string `json:"trusted"` // Nicks to op and unban
+	Kick    []string `json:"kick"`    // Nicks to remove, e.g. whoever took the channel
+	Reason  string   `json:"reason"`
+}
+
+// ChannelStep is one RPC call made while changing a channel in several steps,
+// such as a recovery or a snapshot restore
+type ChannelStep struct {
+	Action string   `json:"action"` // "mode" or "kick"
+	Modes  string   `json:"modes,omitempty"`
+	Params []string `json:"params,omitempty"`
+	Nick   string   `json:"nick,omitempty"`
+	OK     bool     `json:"ok"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// ChannelStepReport is the outcome of a sequence of channel steps
+type ChannelStepReport struct {
+	Channel   string        `json:"channel"`
+	Status    string        `json:"status"` // "success", "partial", "failed" or "nothing_to_do"
+	Steps     []ChannelStep `json:"steps"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+// channelActions carries out channel steps. *rpc.RPCClient implements it;
+// mock data mode uses mockChannelActions.
+type channelActions interface {
+	SetChannelMode(ctx context.Context, channel, modes string, params []string) error
+	KickUser(ctx context.Context, channel, nick, reason string) error
+}
+
+// mockChannelActions accepts every step without doing anything
+type mockChannelActions struct{}
+
+func (mockChannelActions) SetChannelMode(ctx context.Context, channel, modes string, params []string) error {
+	return nil
+}
+
+func (mockChannelActions) KickUser(ctx context.Context, channel, nick, reason string) error {
+	return nil
+}
+
+// getMockChannelDetails returns a mock channel in a taken-over state: locked,
+// with a ban on staff and an op nobody trusts
+func getMockChannelDetails(channel string) *rpc.ChannelDetails {
+	for _, c := range getMockChannels() {
+		if !strings.EqualFold(c.Name, channel) {
+			continue
+		}
+		details := &rpc.ChannelDetails{
+			Name:  c.Name,
+			Modes: "ntik hijacked",
+			Topic: c.Topic,
+			Bans:  []rpc.ChannelBan{{Name: "*!*@valware.uk", SetBy: "Intruder", SetAt: "2024-06-09T16:00:00.000Z"}},
+			Users: []rpc.ChannelUser{{Nick: "Intruder", Modes: []string{"o"}}},
+		}
+		for _, nick := range getMockChannelMembers()[c.Name] {
+			details.Users = append(details.Users, rpc.ChannelUser{Nick: nick, Modes: []string{}})
+		}
+		return details
+	}
+	return nil
+}
+
+// modeChunks groups parameterised mode changes of one letter into calls of
+// at most maxModesPerCall, e.g. "-b" over three masks becomes "-bbb"
+func modeChunks(sign string, letter byte, params []string) []ChannelStep {
+	var steps []ChannelStep
+	for len(params) > 0 {
+		n := min(len(params), maxModesPerCall)
+		steps = append(steps, ChannelStep{
+			Action: channelStepMode,
+			Modes:  sign + strings.Repeat(string(letter), n),
+			Params: params[:n],
+		})
+		params = params[n:]
+	}
+	return steps
+}
+
+// planChannelRecovery works out the calls that return a channel to its
+// trusted users, in order: lift the lock modes, remove bans matching a trusted
+// user, deop everyone else, op the trusted users present and kick the given nicks
+func planChannelRecovery(channel *rpc.ChannelDetails, users []rpc.UserInfo, trusted, kick []string) []ChannelStep {
+	isTrusted := func(nick string) bool {
+		for _, t := range trusted {
+			if strings.EqualFold(t, nick) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var steps []ChannelStep
+
+	// The mode string may carry parameters after the letters, e.g. "ntk secret"
+	letters, _, _ := strings.Cut(strings.TrimPrefix(channel.Modes, "+"), " ")
+	var unlock string
+	var unlockParams []string
+	for _, mode := range recoveryLockModes {
+		if !strings.ContainsRune(letters, mode) {
+			continue
+		}
+		unlock += string(mode)
+		if mode == 'k' {
+			// Servers accept any key when removing one
+			unlockParams = append(unlockParams, "*")
+		}
+	}
+	if unlock != "" {
+		steps = append(steps, ChannelStep{Action: channelStepMode, Modes: "-" + unlock, Params: unlockParams})
+	}
+
+	var unban []string
+	for _, ban := range channel.Bans {
+		if strings.HasPrefix(ban.Name, "~") {
+			// Extended bans match on things other than the user's mask
+			continue
+		}
+		mask := parseBanMask(ban.Name)
+		for _, user := range users {
+			if isTrusted(user.Nick) && mask.matches(user) {
+				unban = append(unban, ban.Name)
+				break
+			}
+		}
+	}
+	steps = append(steps, modeChunks("-", 'b', unban)...)
+
+	var deop, op []string
+	for _, member := range channel.Users {
+		isOp := false
+		for _, mode := range member.Modes {
+			isOp = isOp || mode == "o"
+		}
+		switch {
+		case isTrusted(member.Nick) && !isOp:
+			op = append(op, member.Nick)
+		case !isTrusted(member.Nick) && isOp:
+			deop = append(deop, member.Nick)
+		}
+	}
+	steps = append(steps, modeChunks("-", 'o', deop)...)
+	steps = append(steps, modeChunks("+", 'o', op)...)
+
+	for _, nick := range kick {
+		for _, member := range channel.Users {
+			if strings.EqualFold(member.Nick, nick) && !isTrusted(nick) {
+				steps = append(steps, ChannelStep{Action: channelStepKick, Nick: member.Nick})
+				break
+			}
+		}
+	}
+
+	return steps
+}
+
+// runChannelSteps carries out the steps in order. A failed step is
+// reported and the rest still run, so one refused change does not leave the
+// channel half recovered.
+func runChannelSteps(ctx context.Context, actions channelActions, channel, reason string, steps []ChannelStep) ChannelStepReport {
+	report := ChannelStepReport{Channel: channel, Steps: steps}
+	for i := range steps {
+		step := &steps[i]
+		var err error
+		switch step.Action {
+		case channelStepMode:
+			err = actions.SetChannelMode(ctx, channel, step.Modes, step.Params)
+		case channelStepKick:
+			err = actions.KickUser(ctx, channel, step.Nick, reason)
+		}
+
+		if err != nil {
+			step.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		step.OK = true
+		report.Succeeded++
+	}
+
+	switch {
+	case len(steps) == 0:
+		report.Status = "nothing_to_do"
+	case report.Failed == 0:
+		report.Status = "success"
+	case report.Succeeded == 0:
+		report.Status = "failed"
+	default:
+		report.Status = "partial"
+	}
+	if report.Steps == nil {
+		report.Steps = []ChannelStep{}
+	}
+	return report
+}
+
+// recordChannelSteps adds each successful mode step to the channel's mode
+// history and announces each kick, as the single-action endpoints do
+func recordChannelSteps(r *http.Request, channel, reason string, report ChannelStepReport) {
+	for _, step := range report.Steps {
+		if !step.OK {
+			continue
+		}
+		if step.Action == channelStepKick {
+			broadcastChannelEvent(ChannelEvent{Channel: channel, Event: "kick", Nick: step.Nick, Actor: actorName(r), Reason: reason})
+			continue
+		}
+		recordAudit(r, auditActionMode, channel, map[string]interface{}{"modes": step.Modes, "params": step.Params})
+	}
+}
+
+// recoverChannelHandler restores a taken-over channel in one action: it
+// unlocks the channel, unbans and ops the trusted users, deops everyone else
+// and kicks the given nicks, then reports what each call did
+func recoverChannelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if channelName == "" {
+		http.Error(w, "Channel name required", http.StatusBadRequest)
+		return
+	}
+
+	var req RecoverChannelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Trusted == nil {
+		req.Trusted = config.RecoveryTrustedNicks
+	}
+	if len(req.Trusted) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "No trusted nicks given and CHANNEL_RECOVERY_OPS is not set",
+			"field": "trusted",
+		})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Channel recovery"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	channel := loadChannelDetails(ctx, w, channelName)
+	if channel == nil {
+		return
+	}
+
+	var actions channelActions
+	var users []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		actions = mockChannelActions{}
+		users = getMockUserInfos()
+	} else {
+		actions = rpcClient
+
+		var err error
+		users, err = rpcClient.GetUsers(rpc.Fresh(ctx))
+		if err != nil {
+			log.Printf("RPC error loading users for recovery of %s: %v", channelName, err)
+			writeRPCError(w, err, "Failed to load users")
+			return
+		}
+	}
+
+	steps := planChannelRecovery(channel, users, req.Trusted, req.Kick)
+	report := runChannelSteps(ctx, actions, channelName, req.Reason, steps)
+	log.Printf("🛟 Recovered %s: %d steps succeeded, %d failed", channelName, report.Succeeded, report.Failed)
+
+	recordChannelSteps(r, channelName, req.Reason, report)
+	recordAudit(r, "channel.recover", channelName, map[string]interface{}{
+		"trusted":   req.Trusted,
+		"kick":      req.Kick,
+		"reason":    req.Reason,
+		"status":    report.Status,
+		"steps":     report.Steps,
+		"succeeded": report.Succeeded,
+		"failed":    report.Failed,
+	})
+
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+// describeSteps renders steps compactly, e.g. "-ik *" or "kick Intruder"
+func describeSteps(steps []ChannelStep) []string {
+	var out []string
+	for _, step := range steps {
+		if step.Action == channelStepKick {
+			out = append(out, "kick "+step.Nick)
+			continue
+		}
+		out = append(out, strings.TrimSpace(step.Modes+" "+strings.Join(step.Params, " ")))
+	}
+	return out
+}
+
+func TestPlanChannelRecovery(t *testing.T) {
+	users := []rpc.UserInfo{
+		{Nick: "Valware", Hostname: "valware.uk", IP: "192.0.2.10"},
+		{Nick: "Intruder", Hostname: "evil.example", IP: "198.51.100.1"},
+	}
+	op := []string{"o"}
+
+	tests := []struct {
+		name    string
+		channel rpc.ChannelDetails
+		trusted []string
+		kick    []string
+		want    []string
+	}{
+		{"taken over",
+			rpc.ChannelDetails{Modes: "ntikl secret 5",
+				Bans:  []rpc.ChannelBan{{Name: "*!*@valware.uk"}, {Name: "*!*@other.example"}, {Name: "~account:Valware"}},
+				Users: []rpc.ChannelUser{{Nick: "Intruder", Modes: op}, {Nick: "Valware"}}},
+			[]string{"valware"}, []string{"Intruder"},
+			[]string{"-ikl *", "-b *!*@valware.uk", "-o Intruder", "+o Valware", "kick Intruder"}},
+		{"already fine",
+			rpc.ChannelDetails{Modes: "nt", Users: []rpc.ChannelUser{{Nick: "Valware", Modes: op}}},
+			[]string{"Valware"}, nil, nil},
+		{"trusted nicks are never kicked, absent ones skipped",
+			rpc.ChannelDetails{Modes: "+i", Users: []rpc.ChannelUser{{Nick: "Valware", Modes: op}}},
+			[]string{"Valware"}, []string{"Valware", "Nobody"},
+			[]string{"-i"}},
+		{"deops in chunks",
+			rpc.ChannelDetails{Users: []rpc.ChannelUser{
+				{Nick: "a", Modes: op}, {Nick: "b", Modes: op}, {Nick: "c", Modes: op}, {Nick: "d", Modes: op},
+				{Nick: "e", Modes: op}, {Nick: "f", Modes: op}, {Nick: "g", Modes: op},
+			}},
+			[]string{"Valware"}, nil,
+			[]string{"-oooooo a b c d e f", "-o g"}},
+	}
+	for _, tt := range tests {
+		got := describeSteps(planChannelRecovery(&tt.channel, users, tt.trusted, tt.kick))
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: steps %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// failingActions refuses kicks and accepts mode changes
+type failingActions struct{}
+
+func (failingActions) SetChannelMode(ctx context.Context, channel, modes string, params []string) error {
+	return nil
+}
+
+func (failingActions) KickUser(ctx context.Context, channel, nick, reason string) error {
+	return errors.New("permission denied")
+}
+
+func TestRunChannelStepsStatus(t *testing.T) {
+	mode := ChannelStep{Action: channelStepMode, Modes: "-i"}
+	kick := ChannelStep{Action: channelStepKick, Nick: "Intruder"}
+
+	tests := []struct {
+		steps     []ChannelStep
+		status    string
+		succeeded int
+		failed    int
+	}{
+		{nil, "nothing_to_do", 0, 0},
+		{[]ChannelStep{mode}, "success", 1, 0},
+		{[]ChannelStep{mode, kick}, "partial", 1, 1},
+		{[]ChannelStep{kick, kick}, "failed", 0, 2},
+	}
+	for _, tt := range tests {
+		report := runChannelSteps(context.Background(), failingActions{}, "#x", "reason", append([]ChannelStep{}, tt.steps...))
+		if report.Status != tt.status || report.Succeeded != tt.succeeded || report.Failed != tt.failed || report.Steps == nil {
+			t.Errorf("%q: %+v, want %s with %d/%d", describeSteps(tt.steps), report, tt.status, tt.succeeded, tt.failed)
+		}
+		for _, step := range report.Steps {
+			if step.OK == (step.Error != "") {
+				t.Errorf("%q: step %+v reports both or neither of ok and error", describeSteps(tt.steps), step)
+			}
+		}
+	}
+}
+
+func TestRecoverChannelHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		body    string
+		config  []string // CHANNEL_RECOVERY_OPS
+		want    int
+		steps   []string
+	}{
+		{"trusted from the body", "#general", `{"trusted":["Valware"],"kick":["Intruder"]}`, nil, http.StatusOK,
+			[]string{"-ik *", "-b *!*@valware.uk", "-o Intruder", "+o Valware", "kick Intruder"}},
+		{"trusted from the config", "#general", "", []string{"Valware"}, http.StatusOK,
+			[]string{"-ik *", "-b *!*@valware.uk", "-o Intruder", "+o Valware"}},
+		{"no trusted nicks", "#general", `{}`, nil, http.StatusBadRequest, nil},
+		{"unknown channel", "#nowhere", `{"trusted":["Valware"]}`, nil, http.StatusNotFound, nil},
+		{"invalid body", "#general", `not json`, nil, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.UseMockData = true
+			config.RecoveryTrustedNicks = tt.config
+			adminID := createTestUser(t, "boss", "admin")
+
+			r := asUser("POST", "/api/channels/x/recover", tt.body, adminID, "boss", "admin")
+			r = mux.SetURLVars(r, map[string]string{"channel": tt.channel})
+			w := httptest.NewRecorder()
+			recoverChannelHandler(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var report ChannelStepReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("decode report: %v", err)
+			}
+			if got := describeSteps(report.Steps); report.Status != "success" || strings.Join(got, "|") != strings.Join(tt.steps, "|") {
+				t.Errorf("report %s with steps %q, want success with %q", report.Status, got, tt.steps)
+			}
+			if got := auditCount(t, "channel.recover"); got != 1 {
+				t.Errorf("channel.recover audit entries = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// paramChannelModes are the channel modes that carry a parameter in a
+// channel's mode string: key, limit, link, flood, flood profile and history
+const paramChannelModes = "kLlfFH"
+
+// maxSnapshotNameLength is the longest snapshot name accepted
+const maxSnapshotNameLength = 64
+
+// ChannelSnapshot is a channel's modes and lists, either as they are now or as
+// saved under a name for restoring later
+type ChannelSnapshot struct {
+	ID               int        `json:"id,omitempty"`
+	Channel          string     `json:"channel"`
+	Name             string     `json:"name,omitempty"`
+	Modes            string     `json:"modes"` // Letters then parameters, e.g. "ntlk 50 secret"
+	Bans             []string   `json:"bans"`
+	BanExemptions    []string   `json:"ban_exemptions"`
+	InviteExceptions []string   `json:"invite_exceptions"`
+	CreatedBy        string     `json:"created_by,omitempty"`
+	CreatedAt        *time.Time `json:"created_at,omitempty"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (s ChannelSnapshot) MarshalJSON() ([]byte, error) {
+	type plain ChannelSnapshot
+	return marshalWithLocalTimes(plain(s))
+}
+
+// snapshotOf captures the modes and lists of a channel
+func snapshotOf(channel *rpc.ChannelDetails) ChannelSnapshot {
+	masks := func(list []rpc.ChannelBan) []string {
+		names := make([]string, 0, len(list))
+		for _, entry := range list {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	return ChannelSnapshot{
+		Channel:          channel.Name,
+		Modes:            strings.TrimPrefix(channel.Modes, "+"),
+		Bans:             masks(channel.Bans),
+		BanExemptions:    masks(channel.BanExemptions),
+		InviteExceptions: masks(channel.InviteExceptions),
+	}
+}
+
+// parseChannelModes splits a mode string such as "ntlk 50 secret" into its
+// letters, each with its parameter or "" for modes without one
+func parseChannelModes(modes string) map[byte]string {
+	parsed := map[byte]string{}
+	fields := strings.Fields(strings.TrimPrefix(modes, "+"))
+	if len(fields) == 0 {
+		return parsed
+	}
+
+	params := fields[1:]
+	for i := 0; i < len(fields[0]); i++ {
+		letter := fields[0][i]
+		parsed[letter] = ""
+		if strings.IndexByte(paramChannelModes, letter) >= 0 && len(params) > 0 {
+			parsed[letter] = params[0]
+			params = params[1:]
+		}
+	}
+	return parsed
+}
+
+// missingMasks returns the masks in from that are not in other, ignoring case
+func missingMasks(from, other []string) []string {
+	have := make(map[string]bool, len(other))
+	for _, mask := range other {
+		have[strings.ToLower(mask)] = true
+	}
+
+	var missing []string
+	for _, mask := range from {
+		if !have[strings.ToLower(mask)] {
+			missing = append(missing, mask)
+		}
+	}
+	return missing
+}
+
+// diffChannelSnapshot works out the mode changes that turn a channel in the
+// current state into the target one: removed modes, then added or changed
+// modes, then the list entries to remove and to add
+func diffChannelSnapshot(current, target ChannelSnapshot) []ChannelStep {
+	have := parseChannelModes(current.Modes)
+	want := parseChannelModes(target.Modes)
+
+	letters := func(modes map[byte]string) []byte {
+		sorted := make([]byte, 0, len(modes))
+		for letter := range modes {
+			sorted = append(sorted, letter)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		return sorted
+	}
+
+	var remove, add string
+	var removeParams, addParams []string
+	for _, letter := range letters(have) {
+		value, kept := want[letter]
+		// A key cannot be changed in place, so a different one is removed first
+		if !kept || (letter == 'k' && value != have[letter]) {
+			remove += string(letter)
+			if letter == 'k' {
+				removeParams = append(removeParams, "*")
+			}
+		}
+	}
+	for _, letter := range letters(want) {
+		if value, set := have[letter]; set && value == want[letter] {
+			continue
+		}
+		add += string(letter)
+		if want[letter] != "" {
+			addParams = append(addParams, want[letter])
+		}
+	}
+
+	var steps []ChannelStep
+	if remove != "" {
+		steps = append(steps, ChannelStep{Action: channelStepMode, Modes: "-" + remove, Params: removeParams})
+	}
+	if add != "" {
+		steps = append(steps, ChannelStep{Action: channelStepMode, Modes: "+" + add, Params: addParams})
+	}
+
+	lists := []struct {
+		letter          byte
+		current, target []string
+	}{
+		{'b', current.Bans, target.Bans},
+		{'e', current.BanExemptions, target.BanExemptions},
+		{'I', current.InviteExceptions, target.InviteExceptions},
+	}
+	for _, list := range lists {
+		steps = append(steps, modeChunks("-", list.letter, missingMasks(list.current, list.target))...)
+	}
+	for _, list := range lists {
+		steps = append(steps, modeChunks("+", list.letter, missingMasks(list.target, list.current))...)
+	}
+	return steps
+}
+
+// loadChannelDetails fetches a channel's live state, bypassing the RPC cache.
+// On failure it writes the error response and returns nil.
+func loadChannelDetails(ctx context.Context, w http.ResponseWriter, channel string) *rpc.ChannelDetails {
+	if config.UseMockData || rpcClient == nil {
+		details := getMockChannelDetails(channel)
+		if details == nil {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+		}
+		return details
+	}
+
+	details, err := rpcClient.GetChannel(rpc.Fresh(ctx), channel)
+	if err != nil {
+		log.Printf("RPC error loading channel %s: %v", channel, err)
+		writeRPCError(w, err, "Failed to load channel")
+		return nil
+	}
+	return details
+}
+
+// scanChannelSnapshot reads a channel_snapshots row
+func scanChannelSnapshot(row alertScanner) (*ChannelSnapshot, error) {
+	var snapshot ChannelSnapshot
+	var bans, exemptions, invites string
+	var createdAt time.Time
+	err := row.Scan(&snapshot.ID, &snapshot.Channel, &snapshot.Name, &snapshot.Modes,
+		&bans, &exemptions, &invites, &snapshot.CreatedBy, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.CreatedAt = &createdAt
+
+	for _, list := range []struct {
+		raw  string
+		dest *[]string
+	}{{bans, &snapshot.Bans}, {exemptions, &snapshot.BanExemptions}, {invites, &snapshot.InviteExceptions}} {
+		if err := json.Unmarshal([]byte(list.raw), list.dest); err != nil {
+			return nil, err
+		}
+		*list.dest = emptyIfNil(*list.dest)
+	}
+	return &snapshot, nil
+}
+
+// channelSnapshotColumns are the channel_snapshots columns read by scanChannelSnapshot
+const channelSnapshotColumns = "id, channel, name, modes, bans, ban_exemptions, invite_exceptions, created_by, created_at"
+
+// getChannelSnapshotHandler returns a channel's current modes and lists
+func getChannelSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if !canViewHiddenChannels(r) && isHiddenChannelName(ctx, channelName) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	details := loadChannelDetails(ctx, w, channelName)
+	if details == nil {
+		return
+	}
+
+	json.NewEncoder(w).Encode(snapshotOf(details))
+}
+
+// getChannelSnapshotsHandler lists the snapshots saved for a channel
+func getChannelSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if !canViewHiddenChannels(r) && isHiddenChannelName(r.Context(), channelName) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+channelSnapshotColumns+" FROM channel_snapshots WHERE channel = ? ORDER BY name",
+		strings.ToLower(channelName))
+	if err != nil {
+		log.Printf("Failed to list snapshots for %s: %v", channelName, err)
+		http.Error(w, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	snapshots := []*ChannelSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanChannelSnapshot(rows)
+		if err != nil {
+			log.Printf("Failed to scan channel snapshot: %v", err)
+			http.Error(w, "Failed to list snapshots", http.StatusInternalServerError)
+			return
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// saveChannelSnapshotHandler saves a channel's current modes and lists under
+// a name, replacing any snapshot of that channel with the same name
+func saveChannelSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if !canModerateChannel(r, channelName) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxSnapshotNameLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Snapshot name must be 1 to 64 characters", "field": "name"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	details := loadChannelDetails(ctx, w, channelName)
+	if details == nil {
+		return
+	}
+	current := snapshotOf(details)
+
+	bans, _ := json.Marshal(current.Bans)
+	exemptions, _ := json.Marshal(current.BanExemptions)
+	invites, _ := json.Marshal(current.InviteExceptions)
+	snapshot, err := scanChannelSnapshot(db.QueryRow(`
+		INSERT INTO channel_snapshots (channel, name, modes, bans, ban_exemptions, invite_exceptions, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (channel, name) DO UPDATE SET
+			modes = excluded.modes, bans = excluded.bans, ban_exemptions = excluded.ban_exemptions,
+			invite_exceptions = excluded.invite_exceptions, created_by = excluded.created_by, created_at = excluded.created_at
+		RETURNING `+channelSnapshotColumns,
+		strings.ToLower(channelName), req.Name, current.Modes, string(bans), string(exemptions), string(invites),
+		actorName(r), time.Now(),
+	))
+	if err != nil {
+		log.Printf("Failed to save snapshot %s of %s: %v", req.Name, channelName, err)
+		http.Error(w, "Failed to save snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "channel.snapshot.save", channelName, map[string]string{"name": req.Name, "modes": snapshot.Modes})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// deleteChannelSnapshotHandler deletes a saved snapshot
+func deleteChannelSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channelName := vars["channel"]
+	if !canModerateChannel(r, channelName) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM channel_snapshots WHERE channel = ? AND name = ?", strings.ToLower(channelName), vars["name"])
+	if err != nil {
+		log.Printf("Failed to delete snapshot %s of %s: %v", vars["name"], channelName, err)
+		http.Error(w, "Failed to delete snapshot", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	recordAudit(r, "channel.snapshot.delete", channelName, map[string]string{"name": vars["name"]})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreChannelSnapshotHandler applies a saved snapshot, changing only the
+// modes and list entries that differ from the channel's current state
+func restoreChannelSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if !canModerateChannel(r, channelName) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target, err := scanChannelSnapshot(db.QueryRow("SELECT "+channelSnapshotColumns+" FROM channel_snapshots WHERE channel = ? AND name = ?",
+		strings.ToLower(channelName), req.Name))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load snapshot %s of %s: %v", req.Name, channelName, err)
+		http.Error(w, "Failed to load snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	details := loadChannelDetails(ctx, w, channelName)
+	if details == nil {
+		return
+	}
+
+	var actions channelActions = mockChannelActions{}
+	if !config.UseMockData && rpcClient != nil {
+		actions = rpcClient
+	}
+
+	steps := diffChannelSnapshot(snapshotOf(details), *target)
+	report := runChannelSteps(ctx, actions, channelName, "", steps)
+	log.Printf("📸 Restored snapshot %s of %s: %d steps succeeded, %d failed", req.Name, channelName, report.Succeeded, report.Failed)
+
+	recordChannelSteps(r, channelName, "", report)
+	recordAudit(r, "channel.snapshot.restore", channelName, map[string]interface{}{
+		"name":      req.Name,
+		"status":    report.Status,
+		"steps":     report.Steps,
+		"succeeded": report.Succeeded,
+		"failed":    report.Failed,
+	})
+
+	json.NewEncoder(w).Encode(report)
+}
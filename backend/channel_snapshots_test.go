@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDiffChannelSnapshot(t *testing.T) {
+	tests := []struct {
+		name            string
+		current, target ChannelSnapshot
+		want            []string
+	}{
+		{"unchanged", ChannelSnapshot{Modes: "ntk secret", Bans: []string{"*!*@a"}}, ChannelSnapshot{Modes: "+ntk secret", Bans: []string{"*!*@A"}}, nil},
+		{"mode swapped", ChannelSnapshot{Modes: "ntk secret"}, ChannelSnapshot{Modes: "ntl 50"}, []string{"-k *", "+l 50"}},
+		{"key changed", ChannelSnapshot{Modes: "ntk old"}, ChannelSnapshot{Modes: "ntk new"}, []string{"-k *", "+k new"}},
+		{"limit changed in place", ChannelSnapshot{Modes: "nl 10"}, ChannelSnapshot{Modes: "nl 20"}, []string{"+l 20"}},
+		{"lists", ChannelSnapshot{
+			Bans:             []string{"*!*@keep", "*!*@drop"},
+			InviteExceptions: []string{"*!*@old"},
+		}, ChannelSnapshot{
+			Bans:             []string{"*!*@KEEP", "*!*@new"},
+			BanExemptions:    []string{"*!*@friend"},
+			InviteExceptions: []string{},
+		}, []string{"-b *!*@drop", "-I *!*@old", "+b *!*@new", "+e *!*@friend"}},
+	}
+	for _, tt := range tests {
+		got := describeSteps(diffChannelSnapshot(tt.current, tt.target))
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: steps %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChannelSnapshotSaveRestoreDelete(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+	viewerID := createTestUser(t, "viewer1", "viewer")
+
+	call := func(handler http.HandlerFunc, method, body string, userID int, username string, vars map[string]string) *httptest.ResponseRecorder {
+		r := mux.SetURLVars(asUser(method, "/api/channels/x/snapshots", body, userID, username, "admin"), vars)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	general := map[string]string{"channel": "#general"}
+	named := map[string]string{"channel": "#General", "name": "before"}
+
+	steps := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+		userID  int
+		vars    map[string]string
+		want    int
+	}{
+		{"save", saveChannelSnapshotHandler, "POST", `{"name":"before"}`, adminID, general, http.StatusCreated},
+		{"save again replaces it", saveChannelSnapshotHandler, "POST", `{"name":"before"}`, adminID, general, http.StatusCreated},
+		{"save without a name", saveChannelSnapshotHandler, "POST", `{"name":" "}`, adminID, general, http.StatusBadRequest},
+		{"save without moderation rights", saveChannelSnapshotHandler, "POST", `{"name":"mine"}`, viewerID, general, http.StatusForbidden},
+		{"save for an unknown channel", saveChannelSnapshotHandler, "POST", `{"name":"x"}`, adminID, map[string]string{"channel": "#nowhere"}, http.StatusNotFound},
+		{"restore", restoreChannelSnapshotHandler, "POST", `{"name":"before"}`, adminID, general, http.StatusOK},
+		{"restore a missing snapshot", restoreChannelSnapshotHandler, "POST", `{"name":"after"}`, adminID, general, http.StatusNotFound},
+		{"delete without moderation rights", deleteChannelSnapshotHandler, "DELETE", "", viewerID, named, http.StatusForbidden},
+		{"delete", deleteChannelSnapshotHandler, "DELETE", "", adminID, named, http.StatusNoContent},
+		{"delete again", deleteChannelSnapshotHandler, "DELETE", "", adminID, named, http.StatusNotFound},
+	}
+	for _, tt := range steps {
+		username := "boss"
+		if tt.userID == viewerID {
+			username = "viewer1"
+		}
+		w := call(tt.handler, tt.method, tt.body, tt.userID, username, tt.vars)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+
+		switch tt.name {
+		case "save":
+			var snapshot ChannelSnapshot
+			if err := json.NewDecoder(w.Body).Decode(&snapshot); err != nil {
+				t.Fatalf("decode snapshot: %v", err)
+			}
+			if snapshot.Modes != "ntik hijacked" || len(snapshot.Bans) != 1 || snapshot.CreatedBy != "boss" {
+				t.Errorf("saved snapshot = %+v, want the mock channel's state", snapshot)
+			}
+		case "save again replaces it":
+			w := call(getChannelSnapshotsHandler, "GET", "", adminID, "boss", general)
+			var list []ChannelSnapshot
+			if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list) != 1 {
+				t.Errorf("snapshots after saving twice = %+v (%v), want one", list, err)
+			}
+		case "restore":
+			// The mock channel has not changed since it was saved
+			var report ChannelStepReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil || report.Status != "nothing_to_do" {
+				t.Errorf("restore report = %+v (%v), want nothing to do", report, err)
+			}
+		}
+	}
+}
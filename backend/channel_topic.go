@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// maxTopicLength is UnrealIRCd's default topic length limit
+const maxTopicLength = 360
+
+// setChannelTopicHandler sets or, with an empty topic, clears a channel's
+// topic and returns the channel as it is afterwards. Body: {"topic": "..."}.
+// The channel comes URL-encoded in the path, e.g. /api/channels/%23help/topic.
+func setChannelTopicHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	channelName := mux.Vars(r)["channel"]
+	if !strings.HasPrefix(channelName, "#") {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+	if !canModerateChannel(r, channelName) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Topic *string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Topic == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Topic is required; send \"\" to clear it", "field": "topic"})
+		return
+	}
+	topic := *req.Topic
+	if len(topic) > maxTopicLength || strings.ContainsAny(topic, "\r\n") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Topic must be one line of at most 360 characters", "field": "topic"})
+		return
+	}
+
+	var details *rpc.ChannelDetails
+	if config.UseMockData || rpcClient == nil {
+		details = getMockChannelDetails(channelName)
+		if details == nil {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+		details.Topic = topic
+		details.TopicSetBy = actorName(r)
+		details.TopicSetAt = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err := rpcClient.SetTopic(ctx, channelName, topic); err != nil {
+			log.Printf("RPC error setting topic of %s: %v", channelName, err)
+			writeRPCError(w, err, "Failed to set topic")
+			return
+		}
+
+		var err error
+		details, err = rpcClient.GetChannel(rpc.Fresh(ctx), channelName)
+		if err != nil {
+			// The topic is set; only reading the channel back failed
+			log.Printf("RPC error reloading channel %s after setting its topic: %v", channelName, err)
+			details = &rpc.ChannelDetails{Name: channelName, Topic: topic}
+		}
+	}
+
+	recordAudit(r, "channel.topic", channelName, map[string]string{"topic": topic})
+	json.NewEncoder(w).Encode(details)
+}
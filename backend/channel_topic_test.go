@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+// setTopic calls setChannelTopicHandler as the given panel user
+func setTopic(channel, body string, userID int, username, role string) *httptest.ResponseRecorder {
+	r := asUser("POST", "/api/channels/x/topic", body, userID, username, role)
+	r = mux.SetURLVars(r, map[string]string{"channel": channel})
+	w := httptest.NewRecorder()
+	setChannelTopicHandler(w, r)
+	return w
+}
+
+func TestSetChannelTopic(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	users := map[string]struct {
+		id   int
+		role string
+	}{
+		"boss": {createTestUser(t, "boss", "admin"), "admin"},
+		"vic":  {createTestUser(t, "vic", "viewer"), "viewer"},
+	}
+
+	tests := []struct {
+		name    string
+		channel string
+		body    string
+		user    string
+		want    int
+		field   string // Set for validation errors
+	}{
+		{"set", "#general", `{"topic":"Welcome to the network"}`, "boss", http.StatusOK, ""},
+		{"clear", "#general", `{"topic":""}`, "boss", http.StatusOK, ""},
+		{"longest allowed", "#general", `{"topic":"` + strings.Repeat("a", maxTopicLength) + `"}`, "boss", http.StatusOK, ""},
+		{"too long", "#general", `{"topic":"` + strings.Repeat("a", maxTopicLength+1) + `"}`, "boss", http.StatusBadRequest, "topic"},
+		{"two lines", "#general", `{"topic":"one\ntwo"}`, "boss", http.StatusBadRequest, "topic"},
+		{"missing topic", "#general", `{}`, "boss", http.StatusBadRequest, "topic"},
+		{"bad body", "#general", `topic`, "boss", http.StatusBadRequest, ""},
+		{"not a channel", "general", `{"topic":"x"}`, "boss", http.StatusBadRequest, ""},
+		{"unknown channel", "#nowhere", `{"topic":"x"}`, "boss", http.StatusNotFound, ""},
+		{"viewer", "#general", `{"topic":"x"}`, "vic", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		user := users[tt.user]
+		w := setTopic(tt.channel, tt.body, user.id, tt.user, user.role)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.field != "" {
+			var body map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["field"] != tt.field {
+				t.Errorf("%s: body %v, want field %q", tt.name, body, tt.field)
+			}
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		var details rpc.ChannelDetails
+		if err := json.NewDecoder(w.Body).Decode(&details); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		var req struct{ Topic string }
+		json.Unmarshal([]byte(tt.body), &req)
+		if details.Topic != req.Topic || details.TopicSetBy != "boss" {
+			t.Errorf("%s: topic %q set by %q, want %q set by boss", tt.name, details.Topic, details.TopicSetBy, req.Topic)
+		}
+	}
+
+	if got := auditCount(t, "channel.topic"); got != 3 {
+		t.Errorf("channel.topic audit entries = %d, want 3", got)
+	}
+}
+
+func TestSetChannelTopicOverRPC(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]interface{}
+		want    int
+		topic   string
+	}{
+		{"set and reloaded", map[string]interface{}{
+			"channel.set_topic": true,
+			"channel.get":       map[string]interface{}{"name": "#help", "topic": "Ask away", "topic_set_by": "RPC:panel"},
+		}, http.StatusOK, "Ask away"},
+		{"set, reload failed", map[string]interface{}{"channel.set_topic": true}, http.StatusOK, "Ask away"},
+		{"no such channel", map[string]interface{}{
+			"channel.set_topic": &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Channel not found"},
+		}, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		setupTestDB(t)
+		adminID := createTestUser(t, "boss", "admin")
+		startFakeRPC(t, tt.results)
+
+		w := setTopic("#help", `{"topic":"Ask away"}`, adminID, "boss", "admin")
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK {
+			var details rpc.ChannelDetails
+			if err := json.NewDecoder(w.Body).Decode(&details); err != nil || details.Name != "#help" || details.Topic != tt.topic {
+				t.Errorf("%s: channel %+v, want #help with topic %q", tt.name, details, tt.topic)
+			}
+		}
+		audited := auditCount(t, "channel.topic") == 1
+		if audited != (tt.want == http.StatusOK) {
+			t.Errorf("%s: audited %t, want it only when the topic was set", tt.name, audited)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the parsed TRUSTED_PROXIES, set in main
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses TRUSTED_PROXIES entries, each an IP address or
+// a CIDR range such as 10.0.0.0/8
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP address or CIDR range", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP address or CIDR range", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// isTrustedProxy reports whether ip is one of the TRUSTED_PROXIES
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client making the request. X-Forwarded-For
+// is only believed when the connection comes from a trusted proxy; the client
+// is then the last address in it that is not itself a trusted proxy, as
+// addresses further left could have been made up by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote := net.ParseIP(host)
+	if remote == nil || !isTrustedProxy(remote) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// Whatever came before this was not written by a trusted proxy
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+		host = ip.String()
+	}
+	return host
+}
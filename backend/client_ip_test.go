@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := trustedProxies
+	trustedProxies = proxies
+	t.Cleanup(func() { trustedProxies = previous })
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+		{"10.1.2.3:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"[2001:db8::1]:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		// Addresses left of the nearest untrusted one may be forged
+		{"10.1.2.3:1234", []string{"203.0.113.1, 198.51.100.7, 10.9.9.9"}, "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"203.0.113.1", "198.51.100.7"}, "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"198.51.100.7, garbage, 10.9.9.9"}, "10.9.9.9"},
+		{"10.1.2.3:1234", []string{"10.9.9.9"}, "10.9.9.9"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("clientIP(%s, %q) = %s, want %s", tt.remoteAddr, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"proxy.example.net", "10.0.0.0/33", "10.0.0"} {
+		if _, err := parseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("parseTrustedProxies accepted %q", entry)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Database drivers accepted by DB_DRIVER
+const (
+	dbDriverSQLite   = "sqlite3"
+	dbDriverPostgres = "postgres"
+)
+
+// defaultSQLiteDSN is the database file used when DB_DSN is not set
+const defaultSQLiteDSN = "./data/webpanel.db"
+
+// panelDB is the panel database. Queries are written for SQLite with ?
+// placeholders; on PostgreSQL they are rewritten to $1, $2, ... on the way in.
+type panelDB struct {
+	*sql.DB
+	postgres bool
+}
+
+// panelTx is a transaction on a panelDB, rewriting placeholders the same way
+type panelTx struct {
+	*sql.Tx
+	db *panelDB
+}
+
+// openDatabase opens the database for a DB_DRIVER and DB_DSN
+func openDatabase(driver, dsn string) (*panelDB, error) {
+	switch driver {
+	case dbDriverSQLite:
+		if dsn == "" {
+			if err := os.MkdirAll("./data", 0755); err != nil {
+				return nil, fmt.Errorf("failed to create data directory: %w", err)
+			}
+			dsn = defaultSQLiteDSN
+		}
+	case dbDriverPostgres:
+		if dsn == "" {
+			return nil, fmt.Errorf("DB_DSN is required with DB_DRIVER=%s", dbDriverPostgres)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", driver)
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &panelDB{DB: conn, postgres: driver == dbDriverPostgres}, nil
+}
+
+// rebind rewrites ? placeholders outside string literals for the driver
+func (d *panelDB) rebind(query string) string {
+	if !d.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+var (
+	autoIncrementColumn = regexp.MustCompile(`(?i)\bINTEGER PRIMARY KEY AUTOINCREMENT\b`)
+	datetimeColumn      = regexp.MustCompile(`(?i)\bDATETIME\b`)
+)
+
+// schema adapts a CREATE TABLE or column definition written for SQLite to
+// the driver. Booleans are written as TRUE/FALSE, which both accept.
+func (d *panelDB) schema(ddl string) string {
+	if !d.postgres {
+		return ddl
+	}
+	ddl = autoIncrementColumn.ReplaceAllString(ddl, "SERIAL PRIMARY KEY")
+	return datetimeColumn.ReplaceAllString(ddl, "TIMESTAMPTZ")
+}
+
+// hasColumn reports whether a table already has a column
+func (d *panelDB) hasColumn(table, column string) (bool, error) {
+	if d.postgres {
+		var exists bool
+		err := d.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?)",
+			table, column,
+		).Scan(&exists)
+		return exists, err
+	}
+
+	rows, err := d.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func (d *panelDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.DB.Exec(d.rebind(query), args...)
+}
+
+func (d *panelDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.Query(d.rebind(query), args...)
+}
+
+func (d *panelDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRow(d.rebind(query), args...)
+}
+
+func (d *panelDB) Begin() (*panelTx, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &panelTx{Tx: tx, db: d}, nil
+}
+
+func (t *panelTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.db.rebind(query), args...)
+}
+
+func (t *panelTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(t.db.rebind(query), args...)
+}
+
+func (t *panelTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(t.db.rebind(query), args...)
+}
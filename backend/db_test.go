@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRebindPlaceholders(t *testing.T) {
+	postgres := &panelDB{postgres: true}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"UPDATE t SET note = 'why?' WHERE id = ?", "UPDATE t SET note = 'why?' WHERE id = $1"},
+		{"SELECT 'it''s?', ? FROM t", "SELECT 'it''s?', $1 FROM t"},
+	}
+	for _, tt := range tests {
+		if got := postgres.rebind(tt.query); got != tt.want {
+			t.Errorf("postgres rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	sqlite := &panelDB{}
+	if query := "SELECT * FROM t WHERE a = ?"; sqlite.rebind(query) != query {
+		t.Errorf("sqlite rebind changed %q to %q", query, sqlite.rebind(query))
+	}
+}
+
+func TestSchemaTranslation(t *testing.T) {
+	ddl := "CREATE TABLE t (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, active BOOLEAN DEFAULT TRUE)"
+
+	want := "CREATE TABLE t (id SERIAL PRIMARY KEY, created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, active BOOLEAN DEFAULT TRUE)"
+	if got := (&panelDB{postgres: true}).schema(ddl); got != want {
+		t.Errorf("postgres schema = %q, want %q", got, want)
+	}
+	if got := (&panelDB{}).schema(ddl); got != ddl {
+		t.Errorf("sqlite schema changed the DDL to %q", got)
+	}
+}
+
+func TestOpenDatabaseRejectsBadConfig(t *testing.T) {
+	if _, err := openDatabase("mysql", "panel@/panel"); err == nil {
+		t.Error("openDatabase accepted an unsupported driver")
+	}
+	if _, err := openDatabase(dbDriverPostgres, ""); err == nil {
+		t.Error("openDatabase accepted postgres without a DSN")
+	}
+}
+
+// legacyUsersTable is webpanel_users as created before sessions and
+// two-factor authentication added columns to it
+const legacyUsersTable = `
+CREATE TABLE webpanel_users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'user',
+	permissions TEXT DEFAULT '[]',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_login DATETIME NULL,
+	active BOOLEAN DEFAULT TRUE
+);`
+
+// TestSchemaAppliesOnEachDriver creates the schema over a database from
+// before the added user columns, twice, and uses it. PostgreSQL is only
+// tested when TEST_POSTGRES_DSN points at a server; the test works in a
+// schema of its own and drops it afterwards.
+func TestSchemaAppliesOnEachDriver(t *testing.T) {
+	t.Run(dbDriverSQLite, func(t *testing.T) {
+		testSchema(t, dbDriverSQLite, filepath.Join(t.TempDir(), "webpanel.db"))
+	})
+
+	t.Run(dbDriverPostgres, func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_DSN not set")
+		}
+
+		admin, err := openDatabase(dbDriverPostgres, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer admin.Close()
+
+		schema := fmt.Sprintf("webpanel_test_%d", time.Now().UnixNano())
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		separator := " "
+		if strings.Contains(dsn, "://") {
+			separator = "?"
+			if strings.Contains(dsn, "?") {
+				separator = "&"
+			}
+		}
+		testSchema(t, dbDriverPostgres, dsn+separator+"search_path="+schema)
+	})
+}
+
+func testSchema(t *testing.T, driver, dsn string) {
+	t.Helper()
+
+	legacy, err := openDatabase(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(legacy.schema(legacyUsersTable))
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("create legacy users table: %v", err)
+	}
+
+	config = loadConfig()
+	config.BcryptCost = bcrypt.MinCost
+	config.DBDriver = driver
+	config.DBDSN = dsn
+	for i := 0; i < 2; i++ {
+		if err := initDatabase(); err != nil {
+			t.Fatalf("initDatabase run %d: %v", i+1, err)
+		}
+		if i == 0 {
+			db.Close()
+		}
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, column := range []string{"token_epoch", "must_change_password", "totp_secret", "totp_enabled", "totp_last_step"} {
+		if ok, err := db.hasColumn("webpanel_users", column); err != nil || !ok {
+			t.Errorf("webpanel_users.%s missing after migration (%v)", column, err)
+		}
+	}
+	for _, table := range []string{"webpanel_roles", "channel_moderators", "channel_snapshots", "audit_log", "sessions", "alerts", "temporary_grants", "oper_activity", "settings"} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Errorf("table %s: %v", table, err)
+		}
+	}
+
+	// The seeded accounts and roles work through the driver
+	if _, err := authenticateUser("admin", "admin"); err != nil {
+		t.Errorf("default admin cannot log in: %v", err)
+	}
+	id := createTestUser(t, "moderator1", "moderator", "logs.view")
+	permissions, err := getUserPermissions(id)
+	if err != nil || !permissionGranted(permissions, "logs.view") || !permissionGranted(permissions, "channels.moderate") {
+		t.Errorf("moderator permissions = %v, %v, want own and role permissions", permissions, err)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Longest deny channel mask and redirect channel accepted
+const (
+	maxDenyChannelMaskLength = 64
+	maxChannelNameLength     = 32
+)
+
+// DenyChannelRequest is the body accepted when adding a deny channel entry
+type DenyChannelRequest struct {
+	Channel  string `json:"channel"`
+	Reason   string `json:"reason"`
+	Redirect string `json:"redirect,omitempty"`
+}
+
+// mockDenyChannels stands in for the server's deny channel entries in mock data mode
+var mockDenyChannels = struct {
+	sync.Mutex
+	list []rpc.DenyChannel
+}{list: []rpc.DenyChannel{
+	{
+		Channel: "#*warez*",
+		Reason:  "Piracy is not allowed on this network",
+		SetBy:   "admin",
+		SetAt:   "2024-01-01T00:00:00.000Z",
+	},
+	{
+		Channel:  "#opers-*",
+		Reason:   "Reserved for network staff",
+		Redirect: "#help",
+		SetBy:    "admin",
+		SetAt:    "2024-01-01T00:00:00.000Z",
+	},
+}}
+
+// hasChannelNameSpecials reports whether s contains characters IRC never
+// allows in a channel name: spaces, commas, BELs and other control characters
+func hasChannelNameSpecials(s string) bool {
+	for _, c := range s {
+		if c == ' ' || c == ',' || c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDenyChannel checks the mask and redirect of a deny channel entry,
+// returning the offending field and an error message when they are invalid
+func validateDenyChannel(req DenyChannelRequest) (string, string) {
+	if req.Channel == "" {
+		return "channel", "Channel mask is required"
+	}
+	if !strings.HasPrefix(req.Channel, "#") && !strings.HasPrefix(req.Channel, "*") {
+		return "channel", "Channel mask must start with # or *"
+	}
+	if len(req.Channel) > maxDenyChannelMaskLength || hasChannelNameSpecials(req.Channel) {
+		return "channel", "Channel mask is not valid"
+	}
+	if strings.Trim(req.Channel, "#*?") == "" {
+		return "channel", "Channel mask would forbid every channel"
+	}
+
+	if req.Redirect == "" {
+		return "", ""
+	}
+	if !strings.HasPrefix(req.Redirect, "#") || len(req.Redirect) > maxChannelNameLength ||
+		hasChannelNameSpecials(req.Redirect) || strings.ContainsAny(req.Redirect, "*?") {
+		return "redirect", "Redirect must be a channel name such as #help"
+	}
+	if matchMask(req.Channel, req.Redirect) {
+		// Users would be redirected into a channel they may not join either
+		return "redirect", "Redirect channel is itself forbidden by the mask"
+	}
+	return "", ""
+}
+
+// writeDenyChannelsUnsupported answers with 501 when the server does not offer
+// deny channel management over RPC, returning true if it did
+func writeDenyChannelsUnsupported(w http.ResponseWriter, method string) bool {
+	if rpcClient.HasMethod(method) {
+		return false
+	}
+	http.Error(w, "Deny channel management is not supported by this server", http.StatusNotImplemented)
+	return true
+}
+
+func getDenyChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		mockDenyChannels.Lock()
+		list := append([]rpc.DenyChannel{}, mockDenyChannels.list...)
+		mockDenyChannels.Unlock()
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	if writeDenyChannelsUnsupported(w, "deny_channel.list") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	list, err := rpcClient.GetDenyChannels(ctx)
+	if err != nil {
+		log.Printf("RPC error getting deny channel entries: %v", err)
+		writeRPCError(w, err, "Failed to get deny channel entries")
+		return
+	}
+	if list == nil {
+		list = []rpc.DenyChannel{}
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func addDenyChannelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DenyChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Channel = strings.TrimSpace(req.Channel)
+	req.Redirect = strings.TrimSpace(req.Redirect)
+	if field, msg := validateDenyChannel(req); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": field})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "No reason"
+	}
+
+	details := map[string]string{"reason": req.Reason, "redirect": req.Redirect}
+
+	if config.UseMockData || rpcClient == nil {
+		entry := rpc.DenyChannel{
+			Channel:  req.Channel,
+			Reason:   req.Reason,
+			Redirect: req.Redirect,
+			SetBy:    actorName(r),
+			SetAt:    time.Now().UTC().Format(time.RFC3339),
+		}
+
+		mockDenyChannels.Lock()
+		for _, existing := range mockDenyChannels.list {
+			if strings.EqualFold(existing.Channel, req.Channel) {
+				mockDenyChannels.Unlock()
+				http.Error(w, "Deny channel entry already exists", http.StatusConflict)
+				return
+			}
+		}
+		mockDenyChannels.list = append(mockDenyChannels.list, entry)
+		mockDenyChannels.Unlock()
+
+		recordAudit(r, "deny_channel.add", req.Channel, details)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+		return
+	}
+
+	if writeDenyChannelsUnsupported(w, "deny_channel.add") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.AddDenyChannel(ctx, req.Channel, req.Reason, req.Redirect)
+	if err != nil {
+		log.Printf("RPC error adding deny channel entry: %v", err)
+		writeRPCError(w, err, "Failed to add deny channel entry")
+		return
+	}
+
+	recordAudit(r, "deny_channel.add", req.Channel, details)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deleteDenyChannelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Masks start with '#', which cannot travel unescaped in a path, so they use a query parameter
+	channel := strings.TrimSpace(r.URL.Query().Get("channel"))
+	if channel == "" {
+		http.Error(w, "Channel mask is required", http.StatusBadRequest)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		mockDenyChannels.Lock()
+		found := false
+		for i, entry := range mockDenyChannels.list {
+			if strings.EqualFold(entry.Channel, channel) {
+				mockDenyChannels.list = append(mockDenyChannels.list[:i], mockDenyChannels.list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		mockDenyChannels.Unlock()
+
+		if !found {
+			http.Error(w, "Deny channel entry not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(r, "deny_channel.del", channel, nil)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	if writeDenyChannelsUnsupported(w, "deny_channel.del") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.DeleteDenyChannel(ctx, channel)
+	if err != nil {
+		log.Printf("RPC error deleting deny channel entry: %v", err)
+		writeRPCError(w, err, "Failed to delete deny channel entry")
+		return
+	}
+
+	recordAudit(r, "deny_channel.del", channel, nil)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestDenyChannelValidation(t *testing.T) {
+	tests := []struct {
+		channel, redirect string
+		field             string // "" when valid
+	}{
+		{"#*warez*", "", ""},
+		{"*spam*", "#help", ""},
+		{"", "", "channel"},
+		{"warez", "", "channel"},
+		{"#bad name", "", "channel"},
+		{"#a,b", "", "channel"},
+		{"#*", "", "channel"},
+		{"*?", "", "channel"},
+		{"#" + strings.Repeat("a", maxDenyChannelMaskLength), "", "channel"},
+		{"#*warez*", "help", "redirect"},
+		{"#*warez*", "#he*p", "redirect"},
+		{"#*warez*", "#warez-help", "redirect"},
+	}
+	for _, tt := range tests {
+		if field, _ := validateDenyChannel(DenyChannelRequest{Channel: tt.channel, Redirect: tt.redirect}); field != tt.field {
+			t.Errorf("validate %q redirect %q: field %q, want %q", tt.channel, tt.redirect, field, tt.field)
+		}
+	}
+}
+
+func TestDenyChannelAddAndRemove(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	mockDenyChannels.Lock()
+	saved := append([]rpc.DenyChannel{}, mockDenyChannels.list...)
+	mockDenyChannels.Unlock()
+	t.Cleanup(func() {
+		mockDenyChannels.Lock()
+		mockDenyChannels.list = saved
+		mockDenyChannels.Unlock()
+	})
+
+	steps := []struct {
+		method string
+		arg    string // Body for POST, mask for DELETE
+		want   int
+	}{
+		{"POST", `{"channel":"#*casino*","reason":"Gambling spam","redirect":"#help"}`, http.StatusCreated},
+		{"POST", `{"channel":"#*CASINO*"}`, http.StatusConflict},
+		{"POST", `{"channel":"casino"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"DELETE", "#*Casino*", http.StatusOK},
+		{"DELETE", "#*casino*", http.StatusNotFound},
+		{"DELETE", "", http.StatusBadRequest},
+	}
+	for _, tt := range steps {
+		w := httptest.NewRecorder()
+		if tt.method == "POST" {
+			addDenyChannelHandler(w, asUser("POST", "/api/deny-channels", tt.arg, adminID, "boss", "admin"))
+		} else {
+			deleteDenyChannelHandler(w, asUser("DELETE", "/api/deny-channels?channel="+url.QueryEscape(tt.arg), "", adminID, "boss", "admin"))
+		}
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.arg, w.Code, w.Body, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getDenyChannelsHandler(w, httptest.NewRequest("GET", "/api/deny-channels", nil))
+	var list []rpc.DenyChannel
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list) != len(saved) {
+		t.Errorf("%d entries after adding and removing one, want %d", len(list), len(saved))
+	}
+	if adds, dels := auditCount(t, "deny_channel.add"), auditCount(t, "deny_channel.del"); adds != 1 || dels != 1 {
+		t.Errorf("audit entries: %d adds, %d removals; want one each", adds, dels)
+	}
+}
+
+func TestDenyChannelsUnsupportedOverRPC(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{
+		"rpc.info": map[string]interface{}{"methods": map[string]interface{}{"user.list": map[string]string{}}},
+	})
+	if _, err := rpcClient.DetectCapabilities(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	adminID := createTestUser(t, "boss", "admin")
+
+	for name, call := range map[string]func(w http.ResponseWriter){
+		"list": func(w http.ResponseWriter) {
+			getDenyChannelsHandler(w, httptest.NewRequest("GET", "/api/deny-channels", nil))
+		},
+		"add": func(w http.ResponseWriter) {
+			addDenyChannelHandler(w, asUser("POST", "/api/deny-channels", `{"channel":"#*casino*"}`, adminID, "boss", "admin"))
+		},
+		"delete": func(w http.ResponseWriter) {
+			deleteDenyChannelHandler(w, asUser("DELETE", "/api/deny-channels?channel=%23x", "", adminID, "boss", "admin"))
+		},
+	} {
+		w := httptest.NewRecorder()
+		call(w)
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("%s = %d, want 501", name, w.Code)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// elineTypes are the ban exception type letters UnrealIRCd understands:
+// k=kline G=gline z=zline Z=gzline Q=qline s=shun F=spamfilter b=blacklist
+// c=connect-flood d=handshake-data-flood m=maxperip r=antirandom
+// 8=antimixedutf8 v=versionresponse
+const elineTypes = "kGzZQsFbcdmr8v"
+
+// ELineRequest is the body accepted when adding an ELINE
+type ELineRequest struct {
+	Mask     string `json:"mask"`
+	Flags    string `json:"flags"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"` // e.g. "1d", empty for permanent
+}
+
+// mockELines stands in for the server's ban exceptions in mock data mode
+var mockELines = struct {
+	sync.Mutex
+	list []rpc.BanException
+}{list: []rpc.BanException{
+	{
+		Name:           "*@127.0.0.1",
+		ExceptionTypes: "kGzZs",
+		Reason:         "Localhost",
+		SetBy:          "admin",
+		SetAt:          "2024-01-01T00:00:00.000Z",
+	},
+}}
+
+// validateELineFlags checks that flags is a non-empty set of known exception
+// types without repeats, returning an error message when it is not
+func validateELineFlags(flags string) string {
+	if flags == "" {
+		return "Flags are required"
+	}
+	seen := make(map[rune]bool)
+	for _, f := range flags {
+		if !strings.ContainsRune(elineTypes, f) {
+			return "Unknown exception flag '" + string(f) + "', valid flags are " + elineTypes
+		}
+		if seen[f] {
+			return "Duplicate exception flag '" + string(f) + "'"
+		}
+		seen[f] = true
+	}
+	return ""
+}
+
+func getELinesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		mockELines.Lock()
+		list := append([]rpc.BanException{}, mockELines.list...)
+		mockELines.Unlock()
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	list, err := rpcClient.GetBanExceptions(ctx)
+	if err != nil {
+		log.Printf("RPC error getting ban exceptions: %v", err)
+		writeRPCError(w, err, "Failed to get ban exceptions")
+		return
+	}
+	if list == nil {
+		list = []rpc.BanException{}
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func addELineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ELineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Mask = strings.TrimSpace(req.Mask)
+	if req.Mask == "" {
+		http.Error(w, "Mask is required", http.StatusBadRequest)
+		return
+	}
+	if msg := validateELineFlags(req.Flags); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "No reason"
+	}
+
+	details := map[string]string{"flags": req.Flags, "reason": req.Reason, "duration": req.Duration}
+
+	if config.UseMockData || rpcClient == nil {
+		eline := rpc.BanException{
+			Name:           req.Mask,
+			ExceptionTypes: req.Flags,
+			Reason:         req.Reason,
+			SetBy:          actorName(r),
+			SetAt:          time.Now().UTC().Format(time.RFC3339),
+			DurationString: req.Duration,
+		}
+
+		mockELines.Lock()
+		for _, e := range mockELines.list {
+			if strings.EqualFold(e.Name, req.Mask) {
+				mockELines.Unlock()
+				http.Error(w, "Ban exception already exists", http.StatusConflict)
+				return
+			}
+		}
+		mockELines.list = append(mockELines.list, eline)
+		mockELines.Unlock()
+
+		recordAudit(r, "eline.add", req.Mask, details)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(eline)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.AddBanException(ctx, req.Mask, req.Flags, req.Reason, req.Duration)
+	if err != nil {
+		log.Printf("RPC error adding ban exception: %v", err)
+		writeRPCError(w, err, "Failed to add ban exception")
+		return
+	}
+
+	recordAudit(r, "eline.add", req.Mask, details)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deleteELineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Masks routinely contain '/' (CIDR), so they travel as a query parameter
+	mask := strings.TrimSpace(r.URL.Query().Get("mask"))
+	if mask == "" {
+		http.Error(w, "Mask is required", http.StatusBadRequest)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		mockELines.Lock()
+		found := false
+		for i, e := range mockELines.list {
+			if strings.EqualFold(e.Name, mask) {
+				mockELines.list = append(mockELines.list[:i], mockELines.list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		mockELines.Unlock()
+
+		if !found {
+			http.Error(w, "Ban exception not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(r, "eline.del", mask, nil)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.DeleteBanException(ctx, mask)
+	if err != nil {
+		log.Printf("RPC error deleting ban exception: %v", err)
+		writeRPCError(w, err, "Failed to delete ban exception")
+		return
+	}
+
+	recordAudit(r, "eline.del", mask, nil)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// countBanExceptions returns the number of ban exceptions for the dashboard
+// stats, 0 when the list can't be fetched
+func countBanExceptions(ctx context.Context) int {
+	list, err := rpcClient.GetBanExceptions(ctx)
+	if err != nil {
+		log.Printf("⚠️ Failed to count ban exceptions: %v", err)
+		return 0
+	}
+	return len(list)
+}
+
+// countMockBanExceptions returns the number of ban exceptions in mock data mode
+func countMockBanExceptions() int {
+	mockELines.Lock()
+	defer mockELines.Unlock()
+	return len(mockELines.list)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// checkExportFormat validates the format parameter; CSV is the only (and default) format
+func checkExportFormat(w http.ResponseWriter, r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		http.Error(w, "Unsupported export format", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// startCSV sets the download headers and returns a writer for the response body
+func startCSV(w http.ResponseWriter, name string) *csv.Writer {
+	filename := fmt.Sprintf("%s-%s.csv", name, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return csv.NewWriter(w)
+}
+
+// csvText guards a free-text cell, such as a realname or topic that anyone on
+// IRC can set, against spreadsheet formula injection by prefixing cells that
+// start with a formula character with a quote
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportUsersHandler streams the connected users as CSV. Real hosts and IPs
+// are only filled in for panel users with users.view_realhost.
+func exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r, "users.view") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+	if !checkExportFormat(w, r) {
+		return
+	}
+
+	var rpcUsers []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		rpcUsers, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error exporting users: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+	}
+
+	showReal := hasPermission(r, "users.view_realhost")
+
+	cw := startCSV(w, "users")
+	cw.Write([]string{"nick", "account", "realname", "host", "real_host", "real_ip", "country", "server", "oper", "modes", "connected_at", "secure", "reputation"})
+	for _, rpcUser := range rpcUsers {
+		user := toAPIUser(rpcUser, showReal)
+		host := buildUserHost(rpcUser, showReal)
+		cw.Write([]string{
+			user.Nick,
+			user.Account,
+			csvText(rpcUser.Realname),
+			host.DisplayHost,
+			host.RealHost,
+			host.RealIP,
+			user.Country,
+			user.ConnectedTo,
+			user.Oper,
+			user.Modes,
+			time.Unix(rpcUser.ConnectTime, 0).UTC().Format(time.RFC3339),
+			strconv.FormatBool(user.Secure),
+			strconv.Itoa(user.Reputation),
+		})
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("⚠️ Failed to write users export: %v", err)
+	}
+}
+
+// exportChannelsHandler streams the visible channels as CSV
+func exportChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r, "channels.view") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+	if !checkExportFormat(w, r) {
+		return
+	}
+
+	var channels []Channel
+	if config.UseMockData || rpcClient == nil {
+		channels = getMockChannels()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rpcChannels, err := rpcClient.GetChannels(ctx)
+		if err != nil {
+			log.Printf("RPC error exporting channels: %v", err)
+			writeRPCError(w, err, "Failed to get channels")
+			return
+		}
+		for _, rpcChannel := range rpcChannels {
+			channels = append(channels, toAPIChannel(rpcChannel))
+		}
+	}
+
+	cw := startCSV(w, "channels")
+	cw.Write([]string{"name", "users", "modes", "topic", "created"})
+	for _, channel := range filterHiddenChannels(r, channels) {
+		cw.Write([]string{
+			channel.Name,
+			strconv.Itoa(channel.Users),
+			channel.Modes,
+			csvText(channel.Topic),
+			channel.Created,
+		})
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("⚠️ Failed to write channels export: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+)
+
+// exportRows runs an export handler as an admin and parses the CSV it writes
+func exportRows(t *testing.T, handler func(w *httptest.ResponseRecorder)) [][]string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler(w)
+	if w.Code != 200 {
+		t.Fatalf("export: status %d %s", w.Code, w.Body)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse export: %v", err)
+	}
+	return rows
+}
+
+func TestExportUsersEscapesRealname(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+
+	tests := []struct {
+		realname string
+		want     string
+	}{
+		{"Plain Name", "Plain Name"},
+		{"Smith, John", "Smith, John"},
+		{`The "Real" One`, `The "Real" One`},
+		{"two\nlines", "two\nlines"},
+		{`=HYPERLINK("http://evil.example","x")`, `'=HYPERLINK("http://evil.example","x")`},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+	}
+	users := make([]map[string]interface{}, len(tests))
+	for i, tt := range tests {
+		users[i] = map[string]interface{}{"nick": "nick" + string(rune('a'+i)), "realname": tt.realname}
+	}
+	startFakeRPC(t, map[string]interface{}{"user.list": map[string]interface{}{"list": users}})
+
+	rows := exportRows(t, func(w *httptest.ResponseRecorder) {
+		exportUsersHandler(w, asUser("GET", "/api/users/export", "", adminID, "boss", "admin"))
+	})
+	if len(rows) != len(tests)+1 {
+		t.Fatalf("export has %d rows, want a header and %d users", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		row := rows[i+1]
+		if got := row[2]; got != tt.want {
+			t.Errorf("realname %q exported as %q, want %q", tt.realname, got, tt.want)
+		}
+		if len(row) != len(rows[0]) {
+			t.Errorf("row for %q has %d cells, want %d", tt.realname, len(row), len(rows[0]))
+		}
+	}
+}
+
+func TestExportChannelsEscapesTopic(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	startFakeRPC(t, map[string]interface{}{"channel.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"name": "#safe", "topic": "Welcome, all"},
+		{"name": "#evil", "topic": "=cmd|' /C calc'!A0"},
+	}}})
+
+	rows := exportRows(t, func(w *httptest.ResponseRecorder) {
+		exportChannelsHandler(w, asUser("GET", "/api/channels/export", "", adminID, "boss", "admin"))
+	})
+	want := map[string]string{"#safe": "Welcome, all", "#evil": "'=cmd|' /C calc'!A0"}
+	for _, row := range rows[1:] {
+		if row[3] != want[row[0]] {
+			t.Errorf("topic of %s exported as %q, want %q", row[0], row[3], want[row[0]])
+		}
+	}
+	if len(rows) != 3 {
+		t.Errorf("export has %d rows, want a header and 2 channels", len(rows))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countryCoords maps two-letter country codes to a [longitude, latitude]
+// point, loaded from GEOIP_COUNTRY_COORDS. Nil when GeoIP is not configured.
+var countryCoords map[string][2]float64
+
+// GeoFeature is a GeoJSON point feature for the users of one country
+type GeoFeature struct {
+	Type     string `json:"type"` // Always "Feature"
+	Geometry struct {
+		Type        string     `json:"type"`        // Always "Point"
+		Coordinates [2]float64 `json:"coordinates"` // Longitude, latitude
+	} `json:"geometry"`
+	Properties struct {
+		Country string `json:"country"`
+		Users   int    `json:"users"`
+	} `json:"properties"`
+}
+
+// GeoFeatureCollection is the GeoJSON document served by /api/stats/geojson.
+// Unlocated counts users with no country, or one missing from the coordinates file.
+type GeoFeatureCollection struct {
+	Type      string       `json:"type"` // Always "FeatureCollection"
+	Features  []GeoFeature `json:"features"`
+	Unlocated int          `json:"unlocated"`
+}
+
+// loadCountryCoords reads a CSV of country code, latitude and longitude. Rows
+// whose coordinates are not numbers, such as a header, are skipped.
+func loadCountryCoords(path string) (map[string][2]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	coords := make(map[string][2]float64)
+	for _, record := range records {
+		if len(record) < 3 {
+			continue
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		coords[strings.ToUpper(strings.TrimSpace(record[0]))] = [2]float64{lon, lat}
+	}
+	if len(coords) == 0 {
+		return nil, fmt.Errorf("no coordinates found")
+	}
+	return coords, nil
+}
+
+// initGeoIP loads the country coordinates when GEOIP_COUNTRY_COORDS is set
+func initGeoIP() {
+	if config.GeoIPCountryCoords == "" {
+		return
+	}
+
+	coords, err := loadCountryCoords(config.GeoIPCountryCoords)
+	if err != nil {
+		log.Printf("⚠️ Failed to load GeoIP country coordinates from %s: %v", config.GeoIPCountryCoords, err)
+		return
+	}
+	countryCoords = coords
+	log.Printf("🌍 Loaded coordinates for %d countries", len(coords))
+}
+
+// buildGeoFeatures groups users by country into one point per country,
+// largest first. Individual users are never placed on the map.
+func buildGeoFeatures(users []User, coords map[string][2]float64) GeoFeatureCollection {
+	collection := GeoFeatureCollection{Type: "FeatureCollection", Features: []GeoFeature{}}
+
+	counts := make(map[string]int)
+	for _, user := range users {
+		country := strings.ToUpper(user.Country)
+		if _, ok := coords[country]; !ok {
+			collection.Unlocated++
+			continue
+		}
+		counts[country]++
+	}
+
+	for country, users := range counts {
+		var feature GeoFeature
+		feature.Type = "Feature"
+		feature.Geometry.Type = "Point"
+		feature.Geometry.Coordinates = coords[country]
+		feature.Properties.Country = country
+		feature.Properties.Users = users
+		collection.Features = append(collection.Features, feature)
+	}
+	sort.Slice(collection.Features, func(i, j int) bool {
+		a, b := collection.Features[i].Properties, collection.Features[j].Properties
+		if a.Users != b.Users {
+			return a.Users > b.Users
+		}
+		return a.Country < b.Country
+	})
+	return collection
+}
+
+// getGeoJSONHandler serves the connected users per country as a GeoJSON
+// FeatureCollection for map views. Countries come from the server's GeoIP
+// lookups; the coordinates from GEOIP_COUNTRY_COORDS.
+func getGeoJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if countryCoords == nil {
+		http.Error(w, "GeoIP is not configured (set GEOIP_COUNTRY_COORDS)", http.StatusNotImplemented)
+		return
+	}
+
+	var users []User
+	if config.UseMockData || rpcClient == nil {
+		users = getMockUsers()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rpcUsers, err := rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting users for GeoJSON: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+		for _, rpcUser := range rpcUsers {
+			users = append(users, toAPIUser(rpcUser, false))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(buildGeoFeatures(users, countryCoords))
+}
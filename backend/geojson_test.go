@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCountryCoords(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    map[string][2]float64
+		wantErr bool
+	}{
+		{"with a header", "country,latitude,longitude\nGB,54.0,-2.0\nnl, 52.5 ,5.75\n",
+			map[string][2]float64{"GB": {-2, 54}, "NL": {5.75, 52.5}}, false},
+		{"short and invalid rows skipped", "US,38\nDE,x,9\nFR,46,2\n",
+			map[string][2]float64{"FR": {2, 46}}, false},
+		{"no coordinates", "country,latitude,longitude\n", nil, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "coords.csv")
+		if err := os.WriteFile(path, []byte(tt.csv), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadCountryCoords(path)
+		if (err != nil) != tt.wantErr || len(got) != len(tt.want) {
+			t.Errorf("%s: %v, %v; want %v", tt.name, got, err, tt.want)
+			continue
+		}
+		for country, point := range tt.want {
+			if got[country] != point {
+				t.Errorf("%s: %s = %v, want %v", tt.name, country, got[country], point)
+			}
+		}
+	}
+
+	if _, err := loadCountryCoords(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("missing file loaded without an error")
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	saved := countryCoords
+	t.Cleanup(func() { countryCoords = saved })
+
+	setupTestDB(t)
+	countryCoords = nil
+	w := httptest.NewRecorder()
+	getGeoJSONHandler(w, httptest.NewRequest("GET", "/api/stats/geojson", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("without coordinates = %d, want 501", w.Code)
+	}
+
+	countryCoords = map[string][2]float64{"GB": {-2, 54}, "NL": {5.75, 52.5}, "DE": {9, 51}}
+	startFakeRPC(t, map[string]interface{}{"user.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"nick": "a", "country": "NL"},
+		{"nick": "b", "country": "gb"},
+		{"nick": "c", "country": "GB"},
+		{"nick": "d", "country": "DE"},
+		{"nick": "e", "country": "ZZ"},
+		{"nick": "f"},
+	}}})
+
+	w = httptest.NewRecorder()
+	getGeoJSONHandler(w, httptest.NewRequest("GET", "/api/stats/geojson", nil))
+	if got := w.Header().Get("Content-Type"); got != "application/geo+json" {
+		t.Errorf("Content-Type = %q, want application/geo+json", got)
+	}
+	var collection GeoFeatureCollection
+	if err := json.NewDecoder(w.Body).Decode(&collection); err != nil {
+		t.Fatalf("decode GeoJSON: %v", err)
+	}
+
+	want := []struct {
+		country string
+		users   int
+	}{{"GB", 2}, {"DE", 1}, {"NL", 1}}
+	if collection.Type != "FeatureCollection" || collection.Unlocated != 2 || len(collection.Features) != len(want) {
+		t.Fatalf("collection = %+v, want %d features and 2 unlocated users", collection, len(want))
+	}
+	for i, feature := range collection.Features {
+		if feature.Properties.Country != want[i].country || feature.Properties.Users != want[i].users ||
+			feature.Geometry.Type != "Point" || feature.Geometry.Coordinates != countryCoords[want[i].country] {
+			t.Errorf("feature %d = %+v, want %s with %d users", i, feature, want[i].country, want[i].users)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// RPC probe outcomes reported by /health
+const (
+	rpcProbeOK     = "ok"
+	rpcProbeSlow   = "slow"
+	rpcProbeFailed = "failed"
+	rpcProbeMock   = "mock"
+)
+
+const (
+	// healthProbeTimeout caps how long /health waits on the stats.get probe
+	healthProbeTimeout = 2 * time.Second
+	// healthProbeInterval is how long a probe result is reused, so frequent
+	// monitoring probes don't each cost an RPC round-trip
+	healthProbeInterval = 5 * time.Second
+)
+
+// RPCProbe is the result of timing a stats.get round-trip
+type RPCProbe struct {
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+	Degraded  bool      `json:"degraded"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"-"`
+}
+
+// healthProber shares one probe between concurrent /health requests
+type healthProber struct {
+	mutex sync.Mutex
+	last  *RPCProbe
+}
+
+var rpcHealthProbe = &healthProber{}
+
+// get returns the last probe while it is fresh, probing again otherwise
+func (p *healthProber) get() RPCProbe {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.last != nil && time.Since(p.last.CheckedAt) < healthProbeInterval {
+		return *p.last
+	}
+
+	probe := probeRPC(config.HealthLatencyWarn)
+	p.last = &probe
+	return probe
+}
+
+// probeRPC times a fresh stats.get. A failed call or one at or above
+// threshold marks the RPC as degraded.
+func probeRPC(threshold time.Duration) RPCProbe {
+	// Not the request context: the result is shared with other callers
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := rpcClient.GetNetworkInfo(rpc.Fresh(ctx))
+	rtt := time.Since(start)
+
+	probe := RPCProbe{
+		Status:    rpcProbeOK,
+		LatencyMs: float64(rtt.Microseconds()) / 1000,
+		CheckedAt: time.Now(),
+	}
+	switch {
+	case err != nil:
+		log.Printf("⚠️ Health probe failed after %v: %v", rtt, err)
+		probe.Status = rpcProbeFailed
+		probe.Degraded = true
+		probe.Error = err.Error()
+	case rtt >= threshold:
+		log.Printf("🐢 Health probe took %v (threshold %v)", rtt, threshold)
+		probe.Status = rpcProbeSlow
+		probe.Degraded = true
+	}
+	return probe
+}
+
+// healthHandler reports service health for monitoring probes. Outside mock
+// mode it times a stats.get, so a connected but unresponsive RPC shows up as
+// degraded rather than healthy.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	rpcState := currentRPCStatus()
+	status := map[string]interface{}{
+		"status":                       "ok",
+		"rpc_connected":                rpcState.Connected,
+		"rpc_state":                    rpcState.State,
+		"rpc_reconnecting":             rpcState.Reconnecting,
+		"rpc_reconnect_attempts_total": rpcState.ReconnectAttemptsTotal,
+		"ws_clients":                   wsHub.count(),
+		"ws_dropped_clients_total":     wsDroppedClients.Load(),
+		"mock_data":                    config.UseMockData,
+		"degraded":                     false,
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		status["rpc_probe"] = rpcProbeMock
+	} else {
+		probe := rpcHealthProbe.get()
+		status["rpc_probe"] = probe.Status
+		status["rpc_latency_ms"] = probe.LatencyMs
+		status["degraded"] = probe.Degraded
+		if probe.Status == rpcProbeFailed {
+			// Connected but not answering is as good as disconnected
+			status["rpc_connected"] = false
+			status["rpc_probe_error"] = probe.Error
+		}
+		if probe.Degraded {
+			status["status"] = "degraded"
+		}
+	}
+
+	if rpcState.LastError != "" {
+		status["rpc_error"] = rpcState.LastError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(status)
+}
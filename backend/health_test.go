@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// resetHealthProbe forgets the shared probe result for the rest of the test
+func resetHealthProbe(t *testing.T) {
+	rpcHealthProbe.mutex.Lock()
+	saved := rpcHealthProbe.last
+	rpcHealthProbe.last = nil
+	rpcHealthProbe.mutex.Unlock()
+	t.Cleanup(func() {
+		rpcHealthProbe.mutex.Lock()
+		rpcHealthProbe.last = saved
+		rpcHealthProbe.mutex.Unlock()
+	})
+}
+
+func TestHealthReportsRPCLatency(t *testing.T) {
+	stats := map[string]interface{}{"users": 12, "channels": 4, "servers": 2, "opers": 3}
+
+	tests := []struct {
+		name      string
+		mock      bool
+		results   map[string]interface{}
+		threshold time.Duration
+		status    string
+		probe     string
+		degraded  bool
+		connected bool
+	}{
+		{"mock data", true, nil, time.Second, "ok", rpcProbeMock, false, false},
+		{"fast", false, map[string]interface{}{"stats.get": stats}, time.Minute, "ok", rpcProbeOK, false, true},
+		{"slow", false, map[string]interface{}{"stats.get": stats}, 0, "degraded", rpcProbeSlow, true, true},
+		{"failed", false, map[string]interface{}{}, time.Minute, "degraded", rpcProbeFailed, true, false},
+	}
+	for _, tt := range tests {
+		setupTestDB(t)
+		resetHealthProbe(t)
+		if !tt.mock {
+			startFakeRPC(t, tt.results)
+		}
+		config.UseMockData = tt.mock
+		config.HealthLatencyWarn = tt.threshold
+
+		w := httptest.NewRecorder()
+		healthHandler(w, httptest.NewRequest("GET", "/health", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: status %d, Cache-Control %q; want 200, no-store", tt.name, w.Code, w.Header().Get("Cache-Control"))
+		}
+
+		var health map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if health["status"] != tt.status || health["rpc_probe"] != tt.probe || health["degraded"] != tt.degraded {
+			t.Errorf("%s: status %v, probe %v, degraded %v; want %s, %s, %t",
+				tt.name, health["status"], health["rpc_probe"], health["degraded"], tt.status, tt.probe, tt.degraded)
+		}
+		if !tt.mock && health["rpc_connected"] != tt.connected {
+			t.Errorf("%s: rpc_connected %v, want %t", tt.name, health["rpc_connected"], tt.connected)
+		}
+		if _, timed := health["rpc_latency_ms"]; timed == tt.mock {
+			t.Errorf("%s: rpc_latency_ms reported %t, want %t", tt.name, timed, !tt.mock)
+		}
+		if _, reported := health["rpc_probe_error"]; reported != (tt.probe == rpcProbeFailed) {
+			t.Errorf("%s: rpc_probe_error reported %t", tt.name, reported)
+		}
+	}
+}
+
+func TestHealthProbeIsReused(t *testing.T) {
+	setupTestDB(t)
+	resetHealthProbe(t)
+	startFakeRPC(t, map[string]interface{}{"stats.get": map[string]interface{}{"users": 1}})
+
+	config.HealthLatencyWarn = time.Minute
+	first := rpcHealthProbe.get()
+
+	// A lower threshold only applies once the cached probe is stale
+	config.HealthLatencyWarn = 0
+	if again := rpcHealthProbe.get(); again != first {
+		t.Errorf("probe within %v = %+v, want the cached %+v", healthProbeInterval, again, first)
+	}
+
+	rpcHealthProbe.mutex.Lock()
+	rpcHealthProbe.last.CheckedAt = time.Now().Add(-healthProbeInterval)
+	rpcHealthProbe.mutex.Unlock()
+	if stale := rpcHealthProbe.get(); stale.Status != rpcProbeSlow {
+		t.Errorf("probe after %v = %+v, want a fresh slow probe", healthProbeInterval, stale)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Hub keeps the set of connected WebSocket clients and sends them all the same
+// networkStats, polled once per ws_update_interval however many clients there
+// are. Nothing is polled while no client is connected. The hub is the only
+// poller: new clients get their first frame from its latest snapshot.
+type Hub struct {
+	mutex   sync.RWMutex
+	clients map[*wsClient]bool
+	poll    func() interface{} // Fetches the stats to broadcast, with snapshotMutex held
+
+	snapshotMutex sync.Mutex // Held while polling, so concurrent polls are shared
+	snapshot      interface{}
+	snapshotAt    time.Time
+}
+
+var wsHub = newHub(pollNetworkStats)
+
+func newHub(poll func() interface{}) *Hub {
+	return &Hub{clients: make(map[*wsClient]bool), poll: poll}
+}
+
+func (h *Hub) register(client *wsClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.clients[client] = true
+}
+
+func (h *Hub) unregister(client *wsClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.clients, client)
+}
+
+// count returns the number of connected clients
+func (h *Hub) count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
+// forEach calls fn for every connected client. fn must not block, so it
+// should only enqueue messages.
+func (h *Hub) forEach(fn func(client *wsClient)) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for client := range h.clients {
+		fn(client)
+	}
+}
+
+// endSession disconnects the clients connected with a session's token
+func (h *Hub) endSession(jti string) {
+	h.forEach(func(client *wsClient) {
+		if client.sessionID == jti {
+			client.endSession()
+		}
+	})
+}
+
+// endUserSessions disconnects every client of a user
+func (h *Hub) endUserSessions(userID int) {
+	h.forEach(func(client *wsClient) {
+		if client.userID == userID {
+			client.endSession()
+		}
+	})
+}
+
+// pollOnce fetches the stats once and queues them for every client
+func (h *Hub) pollOnce() {
+	if h.count() == 0 {
+		return
+	}
+
+	h.snapshotMutex.Lock()
+	h.snapshot, h.snapshotAt = h.poll(), time.Now()
+	data := h.snapshot
+	h.snapshotMutex.Unlock()
+
+	msg := map[string]interface{}{"type": "networkStats", "data": data}
+	h.forEach(func(client *wsClient) {
+		client.enqueue(msg)
+	})
+}
+
+// latest returns the stats of the last poll for a new client's first frame.
+// It polls only when that is older than ws_update_interval, as after a time
+// without clients, so a burst of connections shares one poll.
+func (h *Hub) latest() interface{} {
+	h.snapshotMutex.Lock()
+	defer h.snapshotMutex.Unlock()
+
+	if h.snapshot == nil || time.Since(h.snapshotAt) >= liveSettings.get().WSUpdateInterval {
+		h.snapshot, h.snapshotAt = h.poll(), time.Now()
+	}
+	return h.snapshot
+}
+
+// start polls every ws_update_interval, following changes to the setting
+// made from the moment it returns
+func (h *Hub) start() {
+	settingsChanged := liveSettings.watch()
+	ticker := time.NewTicker(liveSettings.get().WSUpdateInterval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-settingsChanged:
+				settingsChanged = liveSettings.watch()
+				ticker.Reset(liveSettings.get().WSUpdateInterval)
+			case <-ticker.C:
+				h.pollOnce()
+			}
+		}
+	}()
+}
+
+// pollNetworkStats returns the network stats for WebSocket clients, the same
+// as GET /api/network/stats, falling back to the mock stats when the server
+// can't be asked
+func pollNetworkStats() interface{} {
+	if config.UseMockData || rpcClient == nil {
+		return getMockNetworkStats()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	networkInfo, err := rpcClient.GetNetworkInfo(ctx)
+	if err != nil {
+		return getMockNetworkStats()
+	}
+	return networkStatsFromRPC(ctx, networkInfo)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebSocketStatsMatchNetworkStatsEndpoint(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{
+		"stats.get":                 map[string]interface{}{"users": 12, "channels": 4, "servers": 2, "opers": 3},
+		"server_ban.list":           map[string]interface{}{"list": []map[string]string{{"type": "gline", "name": "*@192.0.2.1"}}},
+		"server_ban_exception.list": map[string]interface{}{"list": []map[string]string{{"name": "*@127.0.0.1"}, {"name": "*@::1"}}},
+		"spamfilter.list":           map[string]interface{}{"list": []map[string]string{}},
+		"server.list":               map[string]interface{}{"list": []map[string]interface{}{{"name": "irc.example.net"}}},
+	})
+
+	w := httptest.NewRecorder()
+	getNetworkStatsHandler(w, httptest.NewRequest("GET", "/api/network/stats", nil))
+	var rest NetworkStats
+	if err := json.NewDecoder(w.Body).Decode(&rest); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if rest.UsersOnline != 12 || rest.ServerBans != 1 || rest.ServerBanExceptions != 2 {
+		t.Fatalf("REST stats = %+v, want the fake server's counts", rest)
+	}
+
+	polled, ok := pollNetworkStats().(NetworkStats)
+	if !ok {
+		t.Fatalf("pollNetworkStats returned %T", polled)
+	}
+	if !reflect.DeepEqual(polled, rest) {
+		t.Errorf("WebSocket stats = %+v, want %+v as from /api/network/stats", polled, rest)
+	}
+}
+
+func TestInitialWebSocketFrameHasLiveStats(t *testing.T) {
+	setupWSTest(t)
+	startFakeRPC(t, map[string]interface{}{
+		"stats.get": map[string]interface{}{"users": 12, "channels": 4, "servers": 2, "opers": 3},
+	})
+	token, _ := loginForWS(t, "frank", "viewer", time.Hour)
+	conn := dialPanelWS(t, token)
+
+	var frame struct {
+		Type string       `json:"type"`
+		Data NetworkStats `json:"data"`
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("read initial frame: %v", err)
+	}
+	if frame.Type != "networkStats" || frame.Data.UsersOnline != 12 || frame.Data.Operators != 3 {
+		t.Errorf("initial frame = %+v, want the server's stats", frame)
+	}
+}
+
+func TestFirstFramesComeFromHubSnapshot(t *testing.T) {
+	setupWSTest(t)
+	var polls atomic.Int32
+	wsHub.snapshotMutex.Lock()
+	saved := wsHub.poll
+	wsHub.poll = func() interface{} { return polls.Add(1) }
+	wsHub.snapshotMutex.Unlock()
+	t.Cleanup(func() {
+		wsHub.snapshotMutex.Lock()
+		wsHub.poll = saved
+		wsHub.snapshotMutex.Unlock()
+	})
+
+	firstFrame := func(username string) int {
+		token, _ := loginForWS(t, username, "viewer", time.Hour)
+		conn := dialPanelWS(t, token)
+		var frame struct {
+			Type string `json:"type"`
+			Data int    `json:"data"`
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read first frame of %s: %v", username, err)
+		}
+		return frame.Data
+	}
+
+	// The first client finds no snapshot, so the hub polls once for all three
+	for _, username := range []string{"amy", "ben", "cal"} {
+		if got := firstFrame(username); got != 1 {
+			t.Errorf("first frame of %s = poll %d, want the shared first poll", username, got)
+		}
+	}
+
+	// A scheduled poll replaces the snapshot new clients get
+	wsHub.pollOnce()
+	if got := firstFrame("dee"); got != 2 {
+		t.Errorf("first frame after a scheduled poll = poll %d, want 2", got)
+	}
+	if polls.Load() != 2 {
+		t.Errorf("stats polled %d times, want 2", polls.Load())
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Log formats for LOG_FORMAT
+const (
+	logFormatText = "text" // The log package's "2006/01/02 15:04:05 message" lines
+	logFormatJSON = "json" // One JSON object per line, for log aggregators
+)
+
+// logLevels maps LOG_LEVEL values to slog levels
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// initLogging sends both log.Printf lines and structured slog records to
+// stderr in the configured format, dropping those below the configured
+// level. Every record passes through ringHandler, so warnings and errors
+// reach the backend log ring whatever the level.
+func initLogging(format, level string) {
+	minLevel := logLevels[level]
+
+	var handler slog.Handler
+	if format == logFormatJSON {
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: minLevel})
+	} else {
+		handler = &textHandler{out: log.New(os.Stderr, "", log.LstdFlags), level: minLevel}
+	}
+	logger := slog.New(&ringHandler{Handler: handler})
+	slog.SetDefault(logger)
+
+	// Plain log.Printf lines become records whose level comes from their wording
+	log.SetFlags(0)
+	log.SetOutput(&lineLogger{logger: logger})
+}
+
+// logLineLevel gives a log.Printf line, which has no level of its own, the
+// level of the emoji and wording the backend logs warnings and errors with
+func logLineLevel(line string) slog.Level {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(line, "❌"), strings.Contains(lower, "error"), strings.Contains(lower, "failed"):
+		return slog.LevelError
+	case strings.Contains(line, "⚠️"), strings.Contains(lower, "warning"):
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// lineLogger turns log.Printf lines into slog records
+type lineLogger struct {
+	logger *slog.Logger
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	l.logger.Log(context.Background(), logLineLevel(line), line)
+	return len(p), nil
+}
+
+// textHandler writes records as readable lines in the log package's format:
+// "2006/01/02 15:04:05 LEVEL message key=value ..."
+type textHandler struct {
+	out    *log.Logger
+	level  slog.Level
+	prefix string // Names of the open groups, each followed by "."
+	attrs  string // Attributes added with WithAttrs, already formatted
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	b.WriteString(record.Level.String())
+	b.WriteString(" ")
+	b.WriteString(record.Message)
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendTextAttr(&b, h.prefix, attr)
+		return true
+	})
+	return h.out.Output(0, b.String())
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, attr := range attrs {
+		appendTextAttr(&b, h.prefix, attr)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// appendTextAttr writes " key=value", flattening groups into dotted keys and
+// quoting values that would otherwise be ambiguous
+func appendTextAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			appendTextAttr(b, prefix, member)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(" " + prefix + attr.Key + "=" + value)
+}
+
+// ringHandler also keeps the warning and error records in the backend log ring
+type ringHandler struct {
+	slog.Handler
+}
+
+func (h *ringHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.Handler.Enabled(ctx, level)
+}
+
+func (h *ringHandler) Handle(ctx context.Context, record slog.Record) error {
+	switch {
+	case record.Level >= slog.LevelError:
+		backendLogs.add(record.Time, logLevelError, record.Message)
+	case record.Level >= slog.LevelWarn:
+		backendLogs.add(record.Time, logLevelWarn, record.Message)
+	}
+	if !h.Handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ringHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	return &ringHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// validRequestID limits the X-Request-ID values taken from clients
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Hijack lets the WebSocket handler take over the connection
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// requestLogMiddleware gives each request an ID, taken from X-Request-ID
+// when the client or a proxy sent a usable one, and logs the request once it
+// is answered. The ID is returned in X-Request-ID and passed on to the RPC
+// calls made for the request.
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(rpc.WithRequestID(r.Context(), requestID)))
+
+		slog.Info("http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"request_id", requestID,
+			"remote", clientIP(r),
+		)
+	})
+}
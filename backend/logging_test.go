@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestLogLineLevel(t *testing.T) {
+	tests := []struct {
+		line string
+		want slog.Level
+	}{
+		{"❌ Failed to ban user: timeout", slog.LevelError},
+		{"RPC error getting users: EOF", slog.LevelError},
+		{"Failed to load mode history", slog.LevelError},
+		{"⚠️ Invalid duration for WS_IDLE_TIMEOUT", slog.LevelWarn},
+		{"Warning: no JWT_SECRET set", slog.LevelWarn},
+		{"👥 Getting user list...", slog.LevelInfo},
+		{"✅ Rehash finished", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := logLineLevel(tt.line); got != tt.want {
+			t.Errorf("logLineLevel(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestTextHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(&textHandler{out: log.New(&out, "", 0), level: slog.LevelInfo})
+
+	tests := []struct {
+		log  func()
+		want string // "" when the record is dropped
+	}{
+		{func() { logger.Info("http request", "method", "GET", "status", 200) }, "INFO http request method=GET status=200"},
+		{func() { logger.Warn("rpc call failed", "error", "read: connection reset") }, `WARN rpc call failed error="read: connection reset"`},
+		{func() { logger.Info("empty", "reason", "") }, `INFO empty reason=""`},
+		{func() { logger.Debug("polling", "interval", "30s") }, ""},
+		{func() { logger.With("request_id", "abc").WithGroup("rpc").Info("call", "method", "user.list") }, "INFO call request_id=abc rpc.method=user.list"},
+		{func() { logger.Info("grouped", slog.Group("tls", "cipher", "TLSv1.3")) }, "INFO grouped tls.cipher=TLSv1.3"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		tt.log()
+		if got := strings.TrimSuffix(out.String(), "\n"); got != tt.want {
+			t.Errorf("text line = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	config = loadConfig()
+	var out bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&out, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	tests := []struct {
+		name     string
+		incoming string // X-Request-ID sent by the client
+		kept     bool
+	}{
+		{"client ID", "req-42.a_b", true},
+		{"no ID", "", false},
+		{"ID with spaces", "not valid", false},
+		{"ID too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		var seen string
+		handler := requestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = rpc.RequestID(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+		r := httptest.NewRequest("POST", "/api/servers/rehash", nil)
+		if tt.incoming != "" {
+			r.Header.Set("X-Request-ID", tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get("X-Request-ID")
+		if !validRequestID.MatchString(id) || (id == tt.incoming) != tt.kept || seen != id {
+			t.Errorf("%s: response ID %q, RPC context ID %q; want the same valid ID, kept from the client %t", tt.name, id, seen, tt.kept)
+		}
+
+		var record struct {
+			Msg       string `json:"msg"`
+			Method    string `json:"method"`
+			Path      string `json:"path"`
+			Status    int    `json:"status"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatalf("%s: decode log record %q: %v", tt.name, out.String(), err)
+		}
+		if record.Msg != "http request" || record.Method != "POST" || record.Path != "/api/servers/rehash" ||
+			record.Status != http.StatusTeapot || record.RequestID != id {
+			t.Errorf("%s: logged %+v, want the request with status %d and ID %q", tt.name, record, http.StatusTeapot, id)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLockoutEntries bounds the tracker; beyond it, entries that no longer
+// matter are pruned. Failures are tracked for any username, existing or not,
+// so the response never reveals which accounts exist.
+const maxLockoutEntries = 10000
+
+// loginFailures is the failure streak of one username
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginLockout locks a username for LOGIN_LOCKOUT_DURATION after
+// LOGIN_MAX_FAILURES consecutive failed logins. A streak is forgotten once
+// the lockout duration passes without another failure.
+type loginLockout struct {
+	mutex   sync.Mutex
+	entries map[string]*loginFailures
+}
+
+var loginLockouts = &loginLockout{entries: make(map[string]*loginFailures)}
+
+// locked returns how long the username remains locked, if it is
+func (l *loginLockout) locked(username string, now time.Time) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry, ok := l.entries[strings.ToLower(username)]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0, false
+	}
+	return entry.lockedUntil.Sub(now), true
+}
+
+// fail records a failed login, returning true if it locked the username
+func (l *loginLockout) fail(username string, now time.Time) bool {
+	if config.LoginMaxFailures <= 0 {
+		return false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := strings.ToLower(username)
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) >= config.LoginLockoutDuration {
+		if len(l.entries) >= maxLockoutEntries {
+			l.prune(now)
+		}
+		entry = &loginFailures{}
+		l.entries[key] = entry
+	}
+
+	entry.count++
+	entry.lastFailure = now
+	if entry.count < config.LoginMaxFailures {
+		return false
+	}
+	entry.count = 0
+	entry.lockedUntil = now.Add(config.LoginLockoutDuration)
+	return true
+}
+
+// succeed ends the username's failure streak
+func (l *loginLockout) succeed(username string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.entries, strings.ToLower(username))
+}
+
+// prune drops entries that are neither locked nor part of a recent streak
+func (l *loginLockout) prune(now time.Time) {
+	for key, entry := range l.entries {
+		if !now.Before(entry.lockedUntil) && now.Sub(entry.lastFailure) >= config.LoginLockoutDuration {
+			delete(l.entries, key)
+		}
+	}
+}
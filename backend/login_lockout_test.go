@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func freshLockout(t *testing.T, maxFailures int, duration time.Duration) *loginLockout {
+	t.Helper()
+
+	config = loadConfig()
+	config.LoginMaxFailures = maxFailures
+	config.LoginLockoutDuration = duration
+	return &loginLockout{entries: make(map[string]*loginFailures)}
+}
+
+func TestLockoutAfterMaxFailures(t *testing.T) {
+	lockout := freshLockout(t, 3, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	for i := 1; i < 3; i++ {
+		if lockout.fail("Alice", now) {
+			t.Fatalf("failure %d locked the account, want 3 failures", i)
+		}
+		if _, locked := lockout.locked("alice", now); locked {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	if !lockout.fail("ALICE", now) {
+		t.Fatal("third failure did not lock the account")
+	}
+
+	// Usernames are matched case-insensitively; other accounts are unaffected
+	if wait, locked := lockout.locked("alice", now.Add(10*time.Second)); !locked || wait != 50*time.Second {
+		t.Errorf("locked = %t with %v left, want true with 50s", locked, wait)
+	}
+	if _, locked := lockout.locked("bob", now); locked {
+		t.Error("an account without failures is locked")
+	}
+}
+
+func TestLockoutExpiresAfterDuration(t *testing.T) {
+	lockout := freshLockout(t, 2, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	lockout.fail("alice", now)
+	lockout.fail("alice", now)
+	if _, locked := lockout.locked("alice", now.Add(time.Minute)); locked {
+		t.Error("still locked once the lockout duration passed")
+	}
+
+	// A failure after the lockout starts a new streak rather than relocking
+	later := now.Add(time.Minute)
+	if lockout.fail("alice", later) {
+		t.Error("first failure after the lockout locked the account again")
+	}
+
+	// A streak is also forgotten when failures are spaced out by the duration
+	if lockout.fail("alice", later.Add(time.Minute)) {
+		t.Error("failures a lockout duration apart were counted as one streak")
+	}
+}
+
+func TestLockoutStreakResetBySuccess(t *testing.T) {
+	lockout := freshLockout(t, 3, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	lockout.fail("alice", now)
+	lockout.fail("alice", now)
+	lockout.succeed("Alice")
+	if lockout.fail("alice", now) || lockout.fail("alice", now) {
+		t.Error("failures before a successful login still counted")
+	}
+	if !lockout.fail("alice", now) {
+		t.Error("three failures after the reset did not lock the account")
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	lockout := freshLockout(t, 0, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 20; i++ {
+		if lockout.fail("alice", now) {
+			t.Fatal("an account was locked with LOGIN_MAX_FAILURES=0")
+		}
+	}
+}
+
+func TestLoginRefusedWhileLocked(t *testing.T) {
+	setupTestDB(t)
+	config.LoginMaxFailures = 2
+	config.LoginLockoutDuration = time.Minute
+	previous := loginLockouts
+	loginLockouts = &loginLockout{entries: make(map[string]*loginFailures)}
+	t.Cleanup(func() { loginLockouts = previous })
+	createTestUser(t, "carol", "viewer")
+
+	for i := 0; i < 2; i++ {
+		if status, _ := login(t, LoginRequest{Username: "carol", Password: "wrong"}); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password: status %d, want 401", status)
+		}
+	}
+
+	// Even the right password is refused until the lockout ends
+	w := httptest.NewRecorder()
+	loginHandler(w, httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(`{"username":"carol","password":"Correct-Horse-7"}`)))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login while locked: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// Unknown usernames lock the same way, so lockouts reveal no accounts
+	for i := 0; i < 2; i++ {
+		login(t, LoginRequest{Username: "nobody", Password: "wrong"})
+	}
+	if status, _ := login(t, LoginRequest{Username: "nobody", Password: "wrong"}); status != http.StatusTooManyRequests {
+		t.Errorf("unknown username after failures: status %d, want 429", status)
+	}
+}
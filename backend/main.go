@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,26 +24,63 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/cors"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Configuration for the server
 type Config struct {
-	Port              string `json:"port"`
-	UnrealRPCURL      string `json:"unreal_rpc_url"`
-	UnrealRPCUsername string `json:"unreal_rpc_username"`
-	UnrealRPCPassword string `json:"unreal_rpc_password"`
-	UseMockData       bool   `json:"use_mock_data"`
-	JWTSecret         string `json:"jwt_secret"`
+	Port                 string                   `json:"port"`
+	BindAddress          string                   `json:"bind_address"`
+	UnrealRPCURL         string                   `json:"unreal_rpc_url"`
+	UnrealRPCUsername    string                   `json:"unreal_rpc_username"`
+	UnrealRPCPassword    string                   `json:"unreal_rpc_password"`
+	UseMockData          bool                     `json:"use_mock_data"`
+	JWTSecret            string                   `json:"jwt_secret"`
+	HiddenChannels       []string                 `json:"hidden_channels"`
+	HideSecretChans      bool                     `json:"hide_secret_channels"`
+	Debug                bool                     `json:"debug"`
+	ListHiddenUModes     string                   `json:"list_hidden_user_modes"`
+	ListHiddenCModes     string                   `json:"list_hidden_channel_modes"`
+	ServicesServers      []string                 `json:"services_servers"`
+	WSIdleTimeout        time.Duration            `json:"ws_idle_timeout"`
+	WSUpdateInterval     time.Duration            `json:"ws_update_interval"`
+	RPCCacheTTLs         map[string]time.Duration `json:"rpc_cache_ttls"`
+	MaxSessionsPerUser   int                      `json:"max_sessions_per_user"`
+	SessionLimitStrategy string                   `json:"session_limit_strategy"`
+	PanelName            string                   `json:"panel_name"`
+	NetworkName          string                   `json:"network_name"`
+	PanelLogoURL         string                   `json:"panel_logo_url"`
+	RoleRateLimits       map[string]int           `json:"role_rate_limits"`
+	RateLimitExempt      []string                 `json:"rate_limit_exempt_roles"`
+	DisplayLocation      *time.Location           `json:"display_timezone"`
+	RecoveryTrustedNicks []string                 `json:"channel_recovery_ops"`
+	TokenRefreshGrace    time.Duration            `json:"token_refresh_grace"`
+	LinkLatencyWarn      time.Duration            `json:"link_latency_warn"`
+	HealthLatencyWarn    time.Duration            `json:"health_latency_warn"`
+	SearchMaxResults     int                      `json:"search_max_results"`
+	LoginMaxFailures     int                      `json:"login_max_failures"`
+	LoginLockoutDuration time.Duration            `json:"login_lockout_duration"`
+	GeoIPCountryCoords   string                   `json:"geoip_country_coords"`
+	OperClassRoles       map[string]string        `json:"oper_class_roles"`
+	ReadOnly             bool                     `json:"read_only"`
+	AllowedOrigins       []string                 `json:"allowed_origins"`
+	BcryptCost           int                      `json:"bcrypt_cost"`
+	LoginRateLimit       int                      `json:"login_rate_limit"`
+	LoginRateBurst       int                      `json:"login_rate_burst"`
+	TrustedProxies       []string                 `json:"trusted_proxies"`
+	LogFormat            string                   `json:"log_format"`
+	LogLevel             string                   `json:"log_level"`
+	RPCDebug             bool                     `json:"rpc_debug"`
+	DBDriver             string                   `json:"db_driver"`
+	DBDSN                string                   `json:"db_dsn"`
 }
 
 // Global variables
 var (
 	config    *Config
 	rpcClient *rpc.RPCClient
-	db        *sql.DB
+	db        *panelDB
 )
 
 // WebpanelUser represents a webpanel user account
@@ -51,20 +95,33 @@ type WebpanelUser struct {
 	UpdatedAt    time.Time  `json:"updated_at"`
 	LastLogin    *time.Time `json:"last_login"`
 	Active       bool       `json:"active"`
+	TokenEpoch   int        `json:"-"`
+	MustChange   bool       `json:"must_change_password"`
+	TOTPEnabled  bool       `json:"two_factor_enabled"`
+	TOTPSecret   string     `json:"-"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (w WebpanelUser) MarshalJSON() ([]byte, error) {
+	type plain WebpanelUser
+	return marshalWithLocalTimes(plain(w))
 }
 
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	TOTPCode string `json:"totp_code,omitempty"` // Required when the account has two-factor authentication
 }
 
 // LoginResponse represents a login response
 type LoginResponse struct {
-	Success bool          `json:"success"`
-	User    *WebpanelUser `json:"user,omitempty"`
-	Token   string        `json:"token,omitempty"`
-	Error   string        `json:"error,omitempty"`
+	Success            bool          `json:"success"`
+	User               *WebpanelUser `json:"user,omitempty"`
+	Token              string        `json:"token,omitempty"`
+	MustChangePassword bool          `json:"must_change_password,omitempty"` // Token only allows changing the password
+	TwoFactorRequired  bool          `json:"two_factor_required,omitempty"`  // Send the login again with totp_code
+	Error              string        `json:"error,omitempty"`
 }
 
 // NetworkStats represents the current network statistics
@@ -100,16 +157,15 @@ type User struct {
 	Reputation  int    `json:"reputation"`
 	Modes       string `json:"modes"`
 	ConnectTime string `json:"connectTime"`
+	Secure      bool   `json:"secure"`
 }
 
-// Role represents a user role with permissions
-type Role struct {
-	ID          int      `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Permissions []string `json:"permissions"`
-	CreatedAt   string   `json:"created_at"`
-	UpdatedAt   string   `json:"updated_at"`
+// SecurityStats counts users by connection security
+type SecurityStats struct {
+	Secure   int `json:"secure"`
+	Insecure int `json:"insecure"`
+	Unknown  int `json:"unknown"` // No TLS or mode details from the server
+	Total    int `json:"total"`
 }
 
 // Permission represents a permission that can be assigned to roles
@@ -120,6 +176,17 @@ type Permission struct {
 	Category    string `json:"category"`
 }
 
+// UserHost represents the host details of an IRC user. The real host and IP
+// are only filled in for panel users with the users.view_realhost permission.
+type UserHost struct {
+	Nick        string `json:"nick"`
+	DisplayHost string `json:"displayHost"`
+	CloakedHost string `json:"cloakedHost"`
+	RealHost    string `json:"realHost,omitempty"`
+	RealIP      string `json:"realIP,omitempty"`
+	Redacted    bool   `json:"redacted"`
+}
+
 // Channel represents a channel for API responses
 type Channel struct {
 	Name     string            `json:"name"`
@@ -130,23 +197,65 @@ type Channel struct {
 	UserList []rpc.ChannelUser `json:"userList,omitempty"`
 }
 
+// minWSUpdateInterval is the shortest WS_UPDATE_INTERVAL accepted. The panel
+// polls the RPC server for WebSocket network stats at this interval.
+const minWSUpdateInterval = 5 * time.Second
+
+// defaultAllowedOrigins are the frontend dev servers, allowed unless ALLOWED_ORIGINS is set
+var defaultAllowedOrigins = []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174"}
+
 // WebSocket upgrader
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for development
-		return true
-	},
+	CheckOrigin: checkWSOrigin,
 }
 
 // loadConfig loads configuration from environment variables
 func loadConfig() *Config {
 	return &Config{
-		Port:              getEnv("PORT", "8080"),
-		UnrealRPCURL:      getEnv("UNREAL_RPC_URL", ""),
-		UnrealRPCUsername: getEnv("UNREAL_RPC_USERNAME", ""),
-		UnrealRPCPassword: getEnv("UNREAL_RPC_PASSWORD", ""),
-		UseMockData:       getEnvBool("USE_MOCK_DATA", true),
-		JWTSecret:         getEnv("JWT_SECRET", "default-secret-change-me"),
+		Port:                 getEnv("PORT", "8080"),
+		BindAddress:          getEnv("BIND_ADDRESS", ""),
+		UnrealRPCURL:         getEnv("UNREAL_RPC_URL", ""),
+		UnrealRPCUsername:    getEnv("UNREAL_RPC_USERNAME", ""),
+		UnrealRPCPassword:    getEnv("UNREAL_RPC_PASSWORD", ""),
+		UseMockData:          getEnvBool("USE_MOCK_DATA", true),
+		JWTSecret:            getEnv("JWT_SECRET", ""),
+		HiddenChannels:       getEnvList("HIDDEN_CHANNELS", nil),
+		HideSecretChans:      getEnvBool("HIDE_SECRET_CHANNELS", false),
+		Debug:                getEnvBool("DEBUG", false),
+		ListHiddenUModes:     getEnv("LIST_HIDDEN_USER_MODES", ""),
+		ListHiddenCModes:     getEnv("LIST_HIDDEN_CHANNEL_MODES", ""),
+		ServicesServers:      getEnvList("SERVICES_SERVERS", nil),
+		WSIdleTimeout:        getEnvDuration("WS_IDLE_TIMEOUT", 60*time.Second),
+		WSUpdateInterval:     getEnvDurationAtLeast("WS_UPDATE_INTERVAL", 30*time.Second, minWSUpdateInterval),
+		RPCCacheTTLs:         getEnvDurationMap("RPC_CACHE_TTLS"),
+		MaxSessionsPerUser:   getEnvInt("MAX_SESSIONS_PER_USER", 0),
+		SessionLimitStrategy: getEnvChoice("SESSION_LIMIT_STRATEGY", sessionLimitEvict, sessionLimitReject),
+		PanelName:            getEnv("PANEL_NAME", "UnrealIRCd Admin Panel"),
+		NetworkName:          getEnv("NETWORK_NAME", ""),
+		PanelLogoURL:         getEnv("PANEL_LOGO_URL", ""),
+		RoleRateLimits:       getEnvIntMap("ROLE_RATE_LIMITS"),
+		RateLimitExempt:      getEnvList("RATE_LIMIT_EXEMPT_ROLES", []string{"admin"}),
+		DisplayLocation:      getEnvLocation("DISPLAY_TIMEZONE", time.UTC),
+		RecoveryTrustedNicks: getEnvList("CHANNEL_RECOVERY_OPS", nil),
+		TokenRefreshGrace:    getEnvDuration("TOKEN_REFRESH_GRACE", 15*time.Minute),
+		LinkLatencyWarn:      getEnvDuration("LINK_LATENCY_WARN", 500*time.Millisecond),
+		HealthLatencyWarn:    getEnvDuration("HEALTH_LATENCY_WARN", 500*time.Millisecond),
+		SearchMaxResults:     getEnvInt("SEARCH_MAX_RESULTS", 100),
+		LoginMaxFailures:     getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginLockoutDuration: getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		GeoIPCountryCoords:   getEnv("GEOIP_COUNTRY_COORDS", ""),
+		OperClassRoles:       getEnvStringMap("OPER_CLASS_ROLES"),
+		ReadOnly:             getEnvBool("READ_ONLY", false),
+		AllowedOrigins:       getEnvList("ALLOWED_ORIGINS", defaultAllowedOrigins),
+		BcryptCost:           getEnvIntInRange("BCRYPT_COST", bcrypt.DefaultCost, bcrypt.MinCost, bcrypt.MaxCost),
+		LoginRateLimit:       getEnvInt("LOGIN_RATE_LIMIT", 10),
+		LoginRateBurst:       getEnvIntInRange("LOGIN_RATE_BURST", 5, 1, math.MaxInt32),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES", nil),
+		LogFormat:            getEnvChoice("LOG_FORMAT", logFormatText, logFormatJSON),
+		LogLevel:             getEnvChoice("LOG_LEVEL", "info", "debug", "warn", "error"),
+		RPCDebug:             getEnvBool("RPC_DEBUG", false),
+		DBDriver:             getEnvChoice("DB_DRIVER", dbDriverSQLite, dbDriverPostgres),
+		DBDSN:                getEnv("DB_DSN", ""),
 	}
 }
 
@@ -166,19 +275,174 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			return parsed
+		}
+		log.Printf("⚠️ Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvIntInRange is getEnvInt clamped to [min, max]
+func getEnvIntInRange(key string, defaultValue, min, max int) int {
+	value := getEnvInt(key, defaultValue)
+	clamped := value
+	if clamped < min {
+		clamped = min
+	} else if clamped > max {
+		clamped = max
+	}
+	if clamped != value {
+		log.Printf("⚠️ %s of %d is outside %d-%d, using %d", key, value, min, max, clamped)
+	}
+	return clamped
+}
+
+// getEnvChoice returns the variable if it is one of the allowed values, else the default
+func getEnvChoice(key, defaultValue string, allowed ...string) string {
+	value := os.Getenv(key)
+	if value == "" || value == defaultValue {
+		return defaultValue
+	}
+	for _, choice := range allowed {
+		if value == choice {
+			return value
+		}
+	}
+	log.Printf("⚠️ Invalid value for %s: %q, using default %q", key, value, defaultValue)
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("⚠️ Invalid duration for %s: %q, using default %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvDurationAtLeast is getEnvDuration with a floor; shorter values are raised to min
+func getEnvDurationAtLeast(key string, defaultValue, min time.Duration) time.Duration {
+	value := getEnvDuration(key, defaultValue)
+	if value < min {
+		log.Printf("⚠️ %s of %v is below the minimum, using %v", key, value, min)
+		return min
+	}
+	return value
+}
+
+// getEnvLocation loads an IANA timezone name such as "Europe/Amsterdam"
+func getEnvLocation(key string, defaultValue *time.Location) *time.Location {
+	if value := os.Getenv(key); value != "" {
+		if loc, err := time.LoadLocation(value); err == nil {
+			return loc
+		}
+		log.Printf("⚠️ Invalid timezone for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvDurationMap parses "key=duration" pairs, e.g. "user.list=5s,channel.list=0".
+// It returns nil when the variable is unset.
+func getEnvDurationMap(key string) map[string]time.Duration {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return nil
+	}
+
+	values := make(map[string]time.Duration, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("⚠️ Ignoring %s entry without '=': %q", key, item)
+			continue
+		}
+		if value == "0" {
+			values[strings.TrimSpace(name)] = 0
+			continue
+		}
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || parsed < 0 {
+			log.Printf("⚠️ Invalid duration in %s: %q", key, item)
+			continue
+		}
+		values[strings.TrimSpace(name)] = parsed
+	}
+	return values
+}
+
+// getEnvStringMap parses "name=value,..." into a map. It returns nil when the variable is unset.
+func getEnvStringMap(key string) map[string]string {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return nil
+	}
+
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			log.Printf("⚠️ Ignoring %s entry not of the form name=value: %q", key, item)
+			continue
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// getEnvIntMap parses "name=n,..." into a map of non-negative integers
+func getEnvIntMap(key string) map[string]int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return nil
+	}
+
+	values := make(map[string]int, len(items))
+	for _, item := range items {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("⚠️ Ignoring %s entry without '=': %q", key, item)
+			continue
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || parsed < 0 {
+			log.Printf("⚠️ Invalid integer in %s: %q", key, item)
+			continue
+		}
+		values[strings.TrimSpace(name)] = parsed
+	}
+	return values
+}
+
+// getEnvList parses a comma-separated environment variable into a list
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 // Initialize database
 func initDatabase() error {
 	var err error
-	db, err = sql.Open("sqlite3", "./data/webpanel.db")
+	db, err = openDatabase(config.DBDriver, config.DBDSN)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll("./data", 0755); err != nil {
-		return fmt.Errorf("failed to create data directory: %w", err)
-	}
-
 	// Create users table
 	createUsersTable := `
 	CREATE TABLE IF NOT EXISTS webpanel_users (
@@ -191,13 +455,185 @@ func initDatabase() error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		last_login DATETIME NULL,
-		active BOOLEAN DEFAULT 1
+		active BOOLEAN DEFAULT TRUE,
+		token_epoch INTEGER NOT NULL DEFAULT 0,
+		must_change_password BOOLEAN NOT NULL DEFAULT FALSE,
+		totp_secret TEXT NOT NULL DEFAULT '',
+		totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		totp_last_step INTEGER NOT NULL DEFAULT 0
 	);`
 
-	if _, err := db.Exec(createUsersTable); err != nil {
+	if _, err := db.Exec(db.schema(createUsersTable)); err != nil {
 		return fmt.Errorf("failed to create users table: %w", err)
 	}
 
+	// Columns added after the first release
+	if err := ensureColumn("webpanel_users", "token_epoch", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn("webpanel_users", "must_change_password", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := ensureColumn("webpanel_users", "totp_secret", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn("webpanel_users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := ensureColumn("webpanel_users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Create roles table
+	createRolesTable := `
+	CREATE TABLE IF NOT EXISTS webpanel_roles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		permissions TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(db.schema(createRolesTable)); err != nil {
+		return fmt.Errorf("failed to create roles table: %w", err)
+	}
+	if err := seedDefaultRoles(); err != nil {
+		return err
+	}
+
+	// Create per-channel moderator grants table
+	createChannelModeratorsTable := `
+	CREATE TABLE IF NOT EXISTS channel_moderators (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		channel TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, channel)
+	);`
+
+	if _, err := db.Exec(db.schema(createChannelModeratorsTable)); err != nil {
+		return fmt.Errorf("failed to create channel moderators table: %w", err)
+	}
+
+	// Create saved channel mode/list snapshots table
+	createChannelSnapshotsTable := `
+	CREATE TABLE IF NOT EXISTS channel_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel TEXT NOT NULL,
+		name TEXT NOT NULL,
+		modes TEXT NOT NULL DEFAULT '',
+		bans TEXT NOT NULL DEFAULT '[]',
+		ban_exemptions TEXT NOT NULL DEFAULT '[]',
+		invite_exceptions TEXT NOT NULL DEFAULT '[]',
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		UNIQUE(channel, name)
+	);`
+
+	if _, err := db.Exec(db.schema(createChannelSnapshotsTable)); err != nil {
+		return fmt.Errorf("failed to create channel snapshots table: %w", err)
+	}
+
+	// Create audit log table
+	createAuditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(db.schema(createAuditLogTable)); err != nil {
+		return fmt.Errorf("failed to create audit log table: %w", err)
+	}
+
+	// Create login sessions table (one row per issued JWT, keyed by its jti)
+	createSessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		jti TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME NULL,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT ''
+	);`
+
+	if _, err := db.Exec(db.schema(createSessionsTable)); err != nil {
+		return fmt.Errorf("failed to create sessions table: %w", err)
+	}
+
+	// Create alerts table (at most one unresolved alert per kind)
+	createAlertsTable := `
+	CREATE TABLE IF NOT EXISTS alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		message TEXT NOT NULL,
+		state TEXT NOT NULL DEFAULT 'active',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		acknowledged_by TEXT NOT NULL DEFAULT '',
+		acknowledged_at DATETIME NULL,
+		resolved_at DATETIME NULL
+	);`
+
+	if _, err := db.Exec(db.schema(createAlertsTable)); err != nil {
+		return fmt.Errorf("failed to create alerts table: %w", err)
+	}
+
+	// Create temporary grants table (permissions added to a panel user until expires_at)
+	createTemporaryGrantsTable := `
+	CREATE TABLE IF NOT EXISTS temporary_grants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		permissions TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		granted_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(db.schema(createTemporaryGrantsTable)); err != nil {
+		return fmt.Errorf("failed to create temporary grants table: %w", err)
+	}
+
+	// Create oper activity table (oper logins and commands streamed from the server)
+	createOperActivityTable := `
+	CREATE TABLE IF NOT EXISTS oper_activity (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		oper TEXT NOT NULL,
+		source TEXT NOT NULL,
+		subsystem TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(db.schema(createOperActivityTable)); err != nil {
+		return fmt.Errorf("failed to create oper activity table: %w", err)
+	}
+
+	// Create settings table (runtime settings, seeded from the environment)
+	createSettingsTable := `
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_by TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(db.schema(createSettingsTable)); err != nil {
+		return fmt.Errorf("failed to create settings table: %w", err)
+	}
+	if err := initSettings(); err != nil {
+		return err
+	}
+
 	// Create default admin user if no users exist
 	var count int
 	err = db.QueryRow("SELECT COUNT(*) FROM webpanel_users").Scan(&count)
@@ -210,42 +646,39 @@ func initDatabase() error {
 		if err := createDefaultAdmin(); err != nil {
 			return fmt.Errorf("failed to create default admin: %w", err)
 		}
-		log.Println("Created default admin user: admin/admin")
+		log.Println("Created default admin user: admin/admin (password change required on first login)")
 	}
 
 	return nil
 }
 
-// Create default admin user
-func createDefaultAdmin() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
+// ensureColumn adds a column to an existing table if it is missing
+func ensureColumn(table, column, definition string) error {
+	exists, err := db.hasColumn(table, column)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to inspect %s: %w", table, err)
+	}
+	if exists {
+		return nil
 	}
 
-	_, err = db.Exec(`
-		INSERT INTO webpanel_users (username, email, password_hash, role, permissions, active)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, "admin", "admin@localhost", string(hashedPassword), "admin", `["*"]`, true)
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, db.schema(definition))); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
+	}
+	log.Printf("🔧 Added column %s.%s", table, column)
+	return nil
+}
 
+// createDefaultAdmin seeds the admin/admin account, which must change its
+// password on first login
+func createDefaultAdmin() error {
+	_, err := createWebpanelUser("admin", "admin@localhost", "admin", "admin", []string{"*"}, true)
 	return err
 }
 
 // authenticateUser validates user credentials
 func authenticateUser(username, password string) (*WebpanelUser, error) {
-	var user WebpanelUser
-	var passwordHash string
-
-	err := db.QueryRow(`
-		SELECT id, username, email, password_hash, role, permissions, created_at, updated_at, last_login, active
-		FROM webpanel_users
-		WHERE username = ? AND active = 1
-	`, username).Scan(
-		&user.ID, &user.Username, &user.Email, &passwordHash,
-		&user.Role, &user.Permissions, &user.CreatedAt, &user.UpdatedAt,
-		&user.LastLogin, &user.Active,
-	)
-
+	user, passwordHash, err := loadWebpanelUser("username = ?", username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("invalid credentials")
@@ -258,15 +691,47 @@ func authenticateUser(username, password string) (*WebpanelUser, error) {
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	// Update last login
+	return user, nil
+}
+
+// failedLogin counts a failed login towards the username's lockout
+func failedLogin(username string) {
+	if loginLockouts.fail(username, time.Now()) {
+		log.Printf("🔒 Locking logins for %s for %v after %d failures", username, config.LoginLockoutDuration, config.LoginMaxFailures)
+	}
+}
+
+// recordLogin updates the user's last login time once every login step has passed
+func recordLogin(user *WebpanelUser) {
 	now := time.Now()
-	_, err = db.Exec("UPDATE webpanel_users SET last_login = ? WHERE id = ?", now, user.ID)
+	_, err := db.Exec("UPDATE webpanel_users SET last_login = ? WHERE id = ?", now, user.ID)
 	if err != nil {
 		log.Printf("Failed to update last login: %v", err)
 	}
 	user.LastLogin = &now
+}
+
+// loadWebpanelUser loads an active panel user and their password hash by the given condition
+func loadWebpanelUser(where string, arg interface{}) (*WebpanelUser, string, error) {
+	var user WebpanelUser
+	var passwordHash string
+
+	err := db.QueryRow(`
+		SELECT id, username, email, password_hash, role, permissions, created_at, updated_at, last_login, active,
+			token_epoch, must_change_password, totp_enabled, totp_secret
+		FROM webpanel_users
+		WHERE `+where+` AND active = TRUE
+	`, arg).Scan(
+		&user.ID, &user.Username, &user.Email, &passwordHash,
+		&user.Role, &user.Permissions, &user.CreatedAt, &user.UpdatedAt,
+		&user.LastLogin, &user.Active, &user.TokenEpoch, &user.MustChange,
+		&user.TOTPEnabled, &user.TOTPSecret,
+	)
+	if err != nil {
+		return nil, "", err
+	}
 
-	return &user, nil
+	return &user, passwordHash, nil
 }
 
 // Initialize RPC client if configuration is available
@@ -279,18 +744,34 @@ func initRPCClient() {
 	if config.UnrealRPCURL != "" && config.UnrealRPCUsername != "" && !config.UseMockData {
 		log.Printf("🚀 Creating RPC client with real connection...")
 		rpcClient = rpc.NewRPCClient(config.UnrealRPCURL, config.UnrealRPCUsername, config.UnrealRPCPassword)
+		rpcClient.SetDebug(config.Debug || config.RPCDebug)
+		rpcClient.SetStateHandler(onRPCStateChange)
+		applyRPCCacheTTLs(liveSettings.get())
 
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 
 		log.Printf("⏰ Attempting connection with 15 second timeout...")
 		if err := rpcClient.Connect(ctx); err != nil {
-			log.Printf("❌ Failed to connect to UnrealIRCd RPC: %v", err)
+			if rpc.IsAuthError(err) {
+				log.Printf("🔐❌ UnrealIRCd rejected the RPC credentials: %v", err)
+				log.Printf("   %s", rpcAuthRemediation)
+				rpcStatus.set(rpcStateAuthFailed, err)
+			} else {
+				log.Printf("❌ Failed to connect to UnrealIRCd RPC: %v", err)
+				rpcStatus.set(rpcStateUnreachable, err)
+			}
 			log.Printf("🔄 Falling back to mock data mode")
 			rpcClient = nil
 			config.UseMockData = true
 		} else {
 			log.Printf("✅ RPC client connected successfully!")
+			rpcStatus.set(rpcStateConnected, nil)
+
+			if _, err := rpcClient.DetectCapabilities(ctx); err != nil {
+				log.Printf("⚠️ Capability detection failed, assuming all methods are available: %v", err)
+			}
+			subscribeRPCEvents(ctx)
 
 			// Send startup log message to UnrealIRCd
 			log.Printf("📝 Sending startup log message to UnrealIRCd...")
@@ -306,6 +787,7 @@ func initRPCClient() {
 		log.Printf("   Missing Username: %t", config.UnrealRPCUsername == "")
 		log.Printf("   Force Mock: %t", config.UseMockData)
 		config.UseMockData = true
+		rpcStatus.set(rpcStateMock, nil)
 	}
 }
 
@@ -316,12 +798,12 @@ func getMockNetworkStats() NetworkStats {
 		Channels:            21,
 		Servers:             1,
 		Operators:           1,
-		ServerBans:          9,
-		Spamfilters:         0,
-		ServerBanExceptions: 4,
-		ServicesOnline:      "0/0",
+		ServerBans:          countMockServerBans(),
+		Spamfilters:         countMockSpamfilters(),
+		ServerBanExceptions: countMockBanExceptions(),
+		ServicesOnline:      evaluateServices(getMockServers(), config.ServicesServers, 0).ServicesOnline(),
 		PanelAccounts:       1,
-		Plugins:             3,
+		Plugins:             countPlugins(getMockModules()),
 	}
 }
 
@@ -334,18 +816,49 @@ func getMockNetworkHealth() NetworkHealth {
 	}
 }
 
+// getMockUsers returns the mock users with their real hosts redacted
 func getMockUsers() []User {
-	return []User{
+	rpcUsers := getMockUserInfos()
+	users := make([]User, len(rpcUsers))
+	for i, rpcUser := range rpcUsers {
+		users[i] = toAPIUser(rpcUser, false)
+	}
+	return users
+}
+
+// getMockUserInfos returns mock RPC-level user info, including real and cloaked hosts
+func getMockUserInfos() []rpc.UserInfo {
+	return []rpc.UserInfo{
 		{
 			Nick:        "Guest0",
-			Country:     "",
-			HostIP:      "localhost (127.0.0.1)",
+			Hostname:    "localhost",
+			IP:          "127.0.0.1",
+			CloakedHost: "Clk-9A2C41F0",
+			Account:     "Valware",
+			Realname:    "Guest User",
+			Server:      "irc.valware.uk",
+			ConnectTime: time.Now().Unix() - 120,
+			IsOper:      true,
+			OperClass:   "V",
+			Modes:       []string{"i"},
+			Reputation:  intPtr(2),
+		},
+		{
+			Nick:        "Valware",
+			Hostname:    "valware.uk",
+			IP:          "192.0.2.10",
+			CloakedHost: "Clk-4E7B12AA",
+			Country:     "GB",
 			Account:     "Valware",
-			Oper:        "V",
-			ConnectedTo: "irc.valware.uk",
-			Reputation:  0,
-			Modes:       "+i",
-			ConnectTime: "2 min ago",
+			Realname:    "Valerie",
+			Server:      "irc.valware.uk",
+			ConnectTime: time.Now().Unix() - 7200,
+			Modes:       []string{"i", "w", "x", "z"},
+			TLS: &rpc.TLSInfo{
+				Cipher: "TLSv1.3-TLS_CHACHA20_POLY1305_SHA256",
+				CertFP: "3c1f5a9e0b7d24c86e1f0a3b5d7c9e2f4a6b8d0c2e4f6a8b0d2c4e6f8a0b2d4c",
+			},
+			Reputation: intPtr(512),
 		},
 	}
 }
@@ -366,45 +879,91 @@ func getMockChannels() []Channel {
 			Topic:   "Get help and support here",
 			Created: "2024-06-09 16:00:00",
 		},
+		{
+			Name:    "#opers",
+			Users:   1,
+			Modes:   "+nts",
+			Topic:   "Network staff only",
+			Created: "2024-06-09 15:45:00",
+		},
 	}
 }
 
-// JWT secret key - in production, use environment variable
-var jwtSecret = []byte("your-secret-key") // Change this in production!
+// jwtSecret signs panel tokens. main sets it from resolveJWTSecret.
+var jwtSecret []byte
+
+// resolveJWTSecret returns the key panel tokens are signed with. Outside mock
+// data mode JWT_SECRET must be set to something other than the old default.
+// In mock data mode a missing secret is replaced by a random one, so tokens
+// only last until the panel restarts.
+func resolveJWTSecret(cfg *Config) ([]byte, error) {
+	if cfg.JWTSecret != "" && cfg.JWTSecret != defaultJWTSecret {
+		if len(cfg.JWTSecret) < minJWTSecretLength {
+			log.Printf("⚠️ JWT_SECRET is only %d characters; use at least %d", len(cfg.JWTSecret), minJWTSecretLength)
+		}
+		return []byte(cfg.JWTSecret), nil
+	}
+
+	if !cfg.UseMockData {
+		return nil, errors.New("JWT_SECRET must be set, and not to the default, unless USE_MOCK_DATA is true")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	log.Printf("⚠️ JWT_SECRET is not set; using a random secret, so logins end when the panel restarts")
+	return secret, nil
+}
 
 // JWTClaims represents JWT token claims
 type JWTClaims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	Epoch    int    `json:"epoch"`           // Must match webpanel_users.token_epoch
+	Scope    string `json:"scope,omitempty"` // tokenScopePasswordChange restricts the token
 	jwt.RegisteredClaims
 }
 
-// generateJWT creates a JWT token for the user
-func generateJWT(user *WebpanelUser) (string, error) {
-	claims := JWTClaims{
+// generateJWT creates a JWT token for the user. The token's jti identifies its session.
+func generateJWT(user *WebpanelUser) (string, *JWTClaims, error) {
+	jti, err := newSessionID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := &JWTClaims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Role:     user.Role,
+		Epoch:    user.TokenEpoch,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(sessionTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   fmt.Sprintf("%d", user.ID),
 		},
 	}
 
+	if user.MustChange {
+		claims.Scope = tokenScopePasswordChange
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	signed, err := token.SignedString(jwtSecret)
+	return signed, claims, err
 }
 
-// validateJWT validates and parses a JWT token
-func validateJWT(tokenString string) (*JWTClaims, error) {
+// validateJWT validates and parses a JWT token. Options such as
+// jwt.WithLeeway adjust the validation.
+func validateJWT(tokenString string, options ...jwt.ParserOption) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return jwtSecret, nil
-	})
+	}, options...)
 
 	if err != nil {
 		return nil, err
@@ -417,6 +976,17 @@ func validateJWT(tokenString string) (*JWTClaims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
+// contextKey is the type of the request context keys set by authMiddleware,
+// so they cannot collide with keys set by other packages
+type contextKey int
+
+const (
+	userIDKey    contextKey = iota // int
+	usernameKey                    // string
+	roleKey                        // string
+	sessionIDKey                   // string, the token's jti
+)
+
 // authMiddleware validates JWT tokens and protects API endpoints
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -436,32 +1006,66 @@ func authMiddleware(next http.Handler) http.Handler {
 
 		tokenString := authHeader[len(bearerPrefix):]
 
-		// Validate the JWT token
-		claims, err := validateJWT(tokenString)
-		if err != nil {
-			log.Printf("JWT validation failed: %v", err)
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		claims, status, message := checkToken(tokenString, r)
+		if claims == nil {
+			http.Error(w, message, status)
 			return
 		}
 
 		// Add user info to request context for use in handlers
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		ctx = context.WithValue(ctx, "username", claims.Username)
-		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, usernameKey, claims.Username)
+		ctx = context.WithValue(ctx, roleKey, claims.Role)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.ID)
 
 		// Continue to the next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// checkToken validates a JWT and the session behind it. When the token may not
+// be used for this request it returns nil claims, with the status and message
+// to reject the request with.
+func checkToken(tokenString string, r *http.Request) (*JWTClaims, int, string) {
+	// Validate the JWT token
+	claims, err := validateJWT(tokenString)
+	if err != nil {
+		log.Printf("JWT validation failed: %v", err)
+		return nil, http.StatusUnauthorized, "Invalid or expired token"
+	}
+
+	// Reject tokens whose session was revoked or evicted, or issued before a password reset
+	active, err := sessions.check(claims, r)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, "Authentication temporarily unavailable"
+	}
+	if !active {
+		return nil, http.StatusUnauthorized, "Session is no longer active"
+	}
+
+	// Accounts flagged to change their password may only do that
+	if claims.Scope == tokenScopePasswordChange && r.URL.Path != changePasswordPath &&
+		r.URL.Path != passwordStrengthPath && r.URL.Path != logoutPath {
+		return nil, http.StatusForbidden, "Password change required"
+	}
+
+	return claims, 0, ""
+}
+
 // getUserFromContext extracts user info from request context
 func getUserFromContext(r *http.Request) (int, string, string) {
-	userID, _ := r.Context().Value("user_id").(int)
-	username, _ := r.Context().Value("username").(string)
-	role, _ := r.Context().Value("role").(string)
+	userID, _ := r.Context().Value(userIDKey).(int)
+	username, _ := r.Context().Value(usernameKey).(string)
+	role, _ := r.Context().Value(roleKey).(string)
 	return userID, username, role
 }
 
+// actorName returns the panel username behind a request
+func actorName(r *http.Request) string {
+	_, username, _ := getUserFromContext(r)
+	return username
+}
+
 // requireRole middleware to check user roles
 func requireRole(allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -503,22 +1107,23 @@ func getNetworkStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert RPC response to API format
-	stats := NetworkStats{
-		UsersOnline: networkInfo.UsersOnline,
-		Channels:    networkInfo.Channels,
-		Servers:     networkInfo.Servers,
-		Operators:   networkInfo.Operators,
-		// These would need additional RPC calls or different endpoints
-		ServerBans:          9,     // placeholder
-		Spamfilters:         0,     // placeholder
-		ServerBanExceptions: 4,     // placeholder
-		ServicesOnline:      "0/0", // placeholder
-		PanelAccounts:       1,     // placeholder
-		Plugins:             3,     // placeholder
-	}
+	json.NewEncoder(w).Encode(networkStatsFromRPC(ctx, networkInfo))
+}
 
-	json.NewEncoder(w).Encode(stats)
+// networkStatsFromRPC converts RPC network info to the API format
+func networkStatsFromRPC(ctx context.Context, networkInfo *rpc.NetworkInfo) NetworkStats {
+	return NetworkStats{
+		UsersOnline:         networkInfo.UsersOnline,
+		Channels:            networkInfo.Channels,
+		Servers:             networkInfo.Servers,
+		Operators:           networkInfo.Operators,
+		ServerBans:          countServerBans(ctx),
+		Spamfilters:         countSpamfilters(ctx),
+		ServerBanExceptions: countBanExceptions(ctx),
+		ServicesOnline:      checkServicesHealth(ctx).ServicesOnline(),
+		PanelAccounts:       1, // placeholder
+		Plugins:             countLocalPlugins(ctx),
+	}
 }
 
 func getNetworkHealthHandler(w http.ResponseWriter, r *http.Request) {
@@ -561,9 +1166,15 @@ func getNetworkHealthHandler(w http.ResponseWriter, r *http.Request) {
 func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	filters, err := parseUserListFilters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	showReal := hasPermission(r, "users.view_realhost")
 	if config.UseMockData || rpcClient == nil {
-		users := getMockUsers()
-		json.NewEncoder(w).Encode(users)
+		writeUsers(w, r, filterWho(getMockUserInfos(), filters, showReal))
 		return
 	}
 
@@ -573,120 +1184,607 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 	rpcUsers, err := rpcClient.GetUsers(ctx)
 	if err != nil {
 		log.Printf("RPC error getting users: %v", err)
-		users := getMockUsers()
-		json.NewEncoder(w).Encode(users)
-		return
+		rpcUsers = getMockUserInfos()
 	}
 
-	// Convert RPC users to API format
-	users := make([]User, len(rpcUsers))
-	for i, rpcUser := range rpcUsers {
-		connectTime := time.Unix(rpcUser.ConnectTime, 0)
-		timeSince := time.Since(connectTime)
+	writeUsers(w, r, filterWho(rpcUsers, filters, showReal))
+}
 
-		var timeStr string
-		if timeSince.Hours() >= 1 {
-			timeStr = fmt.Sprintf("%.0fh ago", timeSince.Hours())
-		} else {
-			timeStr = fmt.Sprintf("%.0fm ago", timeSince.Minutes())
-		}
+// UserList is the paginated envelope returned for API version 2
+type UserList struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
 
-		operClass := ""
-		if rpcUser.IsOper {
-			operClass = rpcUser.OperClass
-			if operClass == "" {
-				operClass = "O"
-			}
-		}
+// writeUsers encodes users as a bare array (version 1) or as a paginated
+// envelope using the limit and offset parameters (version 2)
+func writeUsers(w http.ResponseWriter, r *http.Request, users []User) {
+	version := requestedAPIVersion(r)
+	setAPIVersionHeaders(w, version)
 
-		users[i] = User{
-			Nick:        rpcUser.Nick,
-			Country:     rpcUser.Country,
-			HostIP:      fmt.Sprintf("%s (%s)", rpcUser.Hostname, rpcUser.IP),
-			Account:     rpcUser.Account,
-			Oper:        operClass,
-			ConnectedTo: rpcUser.Server,
-			Reputation:  0, // Not available in RPC
-			Modes:       fmt.Sprintf("+%s", joinStrings(rpcUser.Modes)),
-			ConnectTime: timeStr,
-		}
+	if version == apiVersionArray {
+		json.NewEncoder(w).Encode(users)
+		return
 	}
 
-	json.NewEncoder(w).Encode(users)
+	limit, offset := pageParams(r)
+	json.NewEncoder(w).Encode(UserList{
+		Users:  paginate(users, limit, offset),
+		Total:  len(users),
+		Limit:  limit,
+		Offset: offset,
+	})
 }
 
-func getChannelsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// Page sizes of version 2 envelopes
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
 
-	if config.UseMockData || rpcClient == nil {
-		channels := getMockChannels()
-		json.NewEncoder(w).Encode(channels)
-		return
+// pageParams reads the limit and offset parameters of a version 2 envelope
+func pageParams(r *http.Request) (int, int) {
+	query := r.URL.Query()
+	limit := parseBoundedInt(query.Get("limit"), defaultPageLimit, 1, maxPageLimit)
+	offset := parseBoundedInt(query.Get("offset"), 0, 0, -1)
+	return limit, offset
+}
+
+// paginate returns the page of items starting at offset, empty past the end
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
 	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+// toAPIUser converts an RPC user into the API format. Without showReal the
+// host shown is the cloaked or virtual host, as for users.view_realhost.
+func toAPIUser(rpcUser rpc.UserInfo, showReal bool) User {
+	connectTime := time.Unix(rpcUser.ConnectTime, 0)
+	timeSince := time.Since(connectTime)
 
-	rpcChannels, err := rpcClient.GetChannels(ctx)
-	if err != nil {
-		log.Printf("RPC error getting channels: %v", err)
-		channels := getMockChannels()
-		json.NewEncoder(w).Encode(channels)
-		return
+	var timeStr string
+	if timeSince.Hours() >= 1 {
+		timeStr = fmt.Sprintf("%.0fh ago", timeSince.Hours())
+	} else {
+		timeStr = fmt.Sprintf("%.0fm ago", timeSince.Minutes())
 	}
 
-	// Convert RPC channels to API format
-	channels := make([]Channel, len(rpcChannels))
-	for i, rpcChannel := range rpcChannels {
-		// Parse the ISO timestamp string (not Unix timestamp)
-		creationTime := parseRPCTimestamp(rpcChannel.CreationTime)
+	reputation := 0
+	if rpcUser.Reputation != nil {
+		reputation = *rpcUser.Reputation
+	}
 
-		// Parse modes string directly (it's already a string, not []string)
-		modeStr := parseModeString(rpcChannel.Modes)
+	hostIP := buildUserHost(rpcUser, false).DisplayHost
+	if showReal {
+		hostIP = fmt.Sprintf("%s (%s)", rpcUser.Hostname, rpcUser.IP)
+	}
 
-		channels[i] = Channel{
-			Name:     rpcChannel.Name,
-			Users:    rpcChannel.UserCount,
-			Modes:    modeStr,
-			Topic:    rpcChannel.Topic,
-			Created:  creationTime.Format("2006-01-02 15:04:05"),
-			UserList: rpcChannel.Users,
-		}
+	return User{
+		Nick:        rpcUser.Nick,
+		Country:     rpcUser.Country,
+		HostIP:      hostIP,
+		Account:     rpcUser.Account,
+		Oper:        getOperClass(rpcUser),
+		ConnectedTo: rpcUser.Server,
+		Reputation:  reputation,
+		Modes:       parseModeString(strings.Join(rpcUser.Modes, "")),
+		ConnectTime: timeStr,
+		Secure:      rpcUser.IsSecure(),
 	}
+}
 
-	json.NewEncoder(w).Encode(channels)
+// ReputationResponse lists users at or below a reputation threshold
+type ReputationResponse struct {
+	Max     int    `json:"max"`
+	Users   []User `json:"users"`
+	Warning string `json:"warning,omitempty"`
 }
 
-// Helper function to parse RPC timestamps
-func parseRPCTimestamp(isoTime string) time.Time {
-	if isoTime == "" {
-		return time.Time{}
-	}
+// getUsersByReputationHandler lists users with reputation <= max, lowest first
+func getUsersByReputationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	t, err := time.Parse("2006-01-02T15:04:05.000Z", isoTime)
+	max := 10
+	if value := r.URL.Query().Get("max"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "max must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		max = n
+	}
+
+	var rpcUsers []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		rpcUsers, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting users by reputation: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(filterByReputation(rpcUsers, max, hasPermission(r, "users.view_realhost")))
+}
+
+// filterByReputation keeps users with a reputation score at or below max,
+// sorted ascending. Users without a score are skipped.
+func filterByReputation(rpcUsers []rpc.UserInfo, max int, showReal bool) ReputationResponse {
+	response := ReputationResponse{Max: max, Users: []User{}}
+
+	scored := 0
+	for _, rpcUser := range rpcUsers {
+		if rpcUser.Reputation == nil {
+			continue
+		}
+		scored++
+		if *rpcUser.Reputation <= max {
+			response.Users = append(response.Users, toAPIUser(rpcUser, showReal))
+		}
+	}
+
+	if scored == 0 && len(rpcUsers) > 0 {
+		response.Warning = "Server does not provide reputation scores"
+	}
+
+	sort.SliceStable(response.Users, func(i, j int) bool {
+		return response.Users[i].Reputation < response.Users[j].Reputation
+	})
+	return response
+}
+
+// getSecurityStatsHandler counts users connected over TLS vs plaintext
+func getSecurityStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var rpcUsers []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		rpcUsers, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting users for security stats: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(countSecurity(rpcUsers))
+}
+
+// countSecurity tallies secure and insecure connections. A user is secure
+// with TLS details or user mode z, insecure when the server reported their
+// modes without z, and unknown when it reported neither.
+func countSecurity(users []rpc.UserInfo) SecurityStats {
+	stats := SecurityStats{Total: len(users)}
+	for _, user := range users {
+		modes := strings.Join(user.Modes, "")
+		switch {
+		case user.IsSecure() || strings.Contains(modes, "z"):
+			stats.Secure++
+		case modes != "":
+			stats.Insecure++
+		default:
+			stats.Unknown++
+		}
+	}
+	return stats
+}
+
+// getUserHostHandler returns the host details for a single user, redacting the
+// real host unless the panel user may see it
+func getUserHostHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	nick := mux.Vars(r)["nick"]
+	if nick == "" {
+		http.Error(w, "Nick required", http.StatusBadRequest)
+		return
+	}
+
+	var rpcUsers []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		rpcUsers, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting users: %v", err)
+			writeRPCError(w, err, "Failed to get user")
+			return
+		}
+	}
+
+	for _, rpcUser := range rpcUsers {
+		if strings.EqualFold(rpcUser.Nick, nick) {
+			json.NewEncoder(w).Encode(buildUserHost(rpcUser, hasPermission(r, "users.view_realhost")))
+			return
+		}
+	}
+
+	http.Error(w, "User not found", http.StatusNotFound)
+}
+
+// UserWhois is the full record of one user. The real host and IP are
+// blanked, and Redacted set, unless the panel user may see them. Likewise
+// the certificate fingerprint and SASL mechanism need users.view_security.
+type UserWhois struct {
+	rpc.UserInfo
+	Redacted         bool `json:"redacted"`
+	SecurityRedacted bool `json:"security_redacted"`
+}
+
+// getUserWhoisHandler returns everything the server knows about one user
+func getUserWhoisHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	nick := mux.Vars(r)["nick"]
+	var user *rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		user = getMockUserDetails(nick)
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		user, err = rpcClient.GetUser(ctx, nick)
+		if err != nil {
+			// Unknown nicks come back as rpc.ErrCodeNotFound, answered with 404
+			log.Printf("RPC error getting user %s: %v", nick, err)
+			writeRPCError(w, err, "User not found")
+			return
+		}
+	}
+
+	whois := UserWhois{UserInfo: *user, Redacted: !hasPermission(r, "users.view_realhost")}
+	if whois.Redacted {
+		whois.Hostname = ""
+		whois.IP = ""
+	}
+	whois.SecurityRedacted = !hasPermission(r, "users.view_security")
+	if whois.SecurityRedacted {
+		whois.SASLMechanism = ""
+		if whois.TLS != nil {
+			tls := *whois.TLS
+			tls.CertFP = ""
+			whois.TLS = &tls
+		}
+	}
+	if !canViewHiddenChannels(r) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		hidden := hiddenChannelChecker(ctx)
+		var visible []string
+		for _, channel := range whois.Channels {
+			if !hidden(channel) {
+				visible = append(visible, channel)
+			}
+		}
+		whois.Channels = visible
+	}
+	json.NewEncoder(w).Encode(whois)
+}
+
+// getMockUserDetails returns a mock user with the details user.get adds
+func getMockUserDetails(nick string) *rpc.UserInfo {
+	for _, user := range getMockUserInfos() {
+		if !strings.EqualFold(user.Nick, nick) {
+			continue
+		}
+		for channel, members := range getMockChannelMembers() {
+			if containsFold(members, user.Nick) {
+				user.Channels = append(user.Channels, channel)
+			}
+		}
+		sort.Strings(user.Channels)
+		user.IdleSince = time.Now().Add(-3 * time.Minute).UTC().Format("2006-01-02T15:04:05.000Z")
+		user.SecurityGroups = []string{"known-users"}
+		if user.TLS != nil {
+			user.SecurityGroups = append(user.SecurityGroups, "tls-users")
+		}
+		if user.Account != "" {
+			// Pretend users with a client certificate logged in with it
+			user.SASLMechanism = "PLAIN"
+			if user.TLS != nil && user.TLS.CertFP != "" {
+				user.SASLMechanism = "EXTERNAL"
+			}
+		}
+		return &user
+	}
+	return nil
+}
+
+// buildUserHost converts RPC user info into host details, optionally including the real host
+func buildUserHost(user rpc.UserInfo, showReal bool) UserHost {
+	cloaked := user.CloakedHost
+	if cloaked == "" {
+		cloaked = user.Hostname
+	}
+
+	display := user.VHost
+	if display == "" {
+		display = cloaked
+	}
+
+	host := UserHost{
+		Nick:        user.Nick,
+		DisplayHost: display,
+		CloakedHost: cloaked,
+		Redacted:    !showReal,
+	}
+	if showReal {
+		host.RealHost = user.Hostname
+		host.RealIP = user.IP
+	}
+	return host
+}
+
+func getChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sortBy, descending, err := parseChannelSort(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var channels []Channel
+	if config.UseMockData || rpcClient == nil {
+		channels = getMockChannels()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rpcChannels, err := rpcClient.GetChannels(ctx)
+		if err != nil {
+			log.Printf("RPC error getting channels: %v", err)
+			channels = getMockChannels()
+		} else {
+			// Convert RPC channels to API format
+			channels = make([]Channel, len(rpcChannels))
+			for i, rpcChannel := range rpcChannels {
+				channels[i] = toAPIChannel(rpcChannel)
+			}
+		}
+	}
+
+	channels = channelsForList(filterHiddenChannels(r, channels))
+	sortChannels(channels, sortBy, descending)
+	writeChannels(w, r, channels)
+}
+
+// ChannelList is the paginated envelope returned for API version 2
+type ChannelList struct {
+	Channels []Channel `json:"channels"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// parseChannelSort reads the sort (users or name) and order (asc or desc)
+// parameters. Channels are listed by name unless asked otherwise; sorting by
+// users defaults to the biggest channels first.
+func parseChannelSort(query url.Values) (string, bool, error) {
+	sortBy := query.Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = "name"
+	case "name", "users":
+	default:
+		return "", false, fmt.Errorf("sort must be users or name")
+	}
+
+	switch query.Get("order") {
+	case "":
+		return sortBy, sortBy == "users", nil
+	case "asc":
+		return sortBy, false, nil
+	case "desc":
+		return sortBy, true, nil
+	default:
+		return "", false, fmt.Errorf("order must be asc or desc")
+	}
+}
+
+// sortChannels orders channels by user count or name. Channels with the same
+// user count are listed by name, so pages stay stable between requests.
+func sortChannels(channels []Channel, sortBy string, descending bool) {
+	byName := func(a, b Channel) int {
+		if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	}
+
+	sort.SliceStable(channels, func(i, j int) bool {
+		a, b := channels[i], channels[j]
+		if sortBy == "users" {
+			if a.Users != b.Users {
+				return (a.Users > b.Users) == descending
+			}
+			return byName(a, b) < 0
+		}
+		if descending {
+			return byName(a, b) > 0
+		}
+		return byName(a, b) < 0
+	})
+}
+
+// writeChannels encodes channels as a bare array (version 1) or as a
+// paginated envelope using the limit and offset parameters (version 2)
+func writeChannels(w http.ResponseWriter, r *http.Request, channels []Channel) {
+	version := requestedAPIVersion(r)
+	setAPIVersionHeaders(w, version)
+
+	if version == apiVersionArray {
+		json.NewEncoder(w).Encode(channels)
+		return
+	}
+
+	limit, offset := pageParams(r)
+	json.NewEncoder(w).Encode(ChannelList{
+		Channels: paginate(channels, limit, offset),
+		Total:    len(channels),
+		Limit:    limit,
+		Offset:   offset,
+	})
+}
+
+// toAPIChannel converts an RPC channel into the API format
+func toAPIChannel(rpcChannel rpc.ChannelInfo) Channel {
+	// Parse the ISO timestamp string (not Unix timestamp)
+	creationTime := parseRPCTimestamp(rpcChannel.CreationTime)
+
+	return Channel{
+		Name:     rpcChannel.Name,
+		Users:    rpcChannel.UserCount,
+		Modes:    parseModeString(rpcChannel.Modes), // Already a string, not []string
+		Topic:    rpcChannel.Topic,
+		Created:  creationTime.Format(channelCreatedLayout),
+		UserList: rpcChannel.Users,
+	}
+}
+
+// isHiddenChannel reports whether a channel should be hidden from non-admin panel users
+func isHiddenChannel(name, modes string) bool {
+	for _, mask := range config.HiddenChannels {
+		if matchMask(mask, name) {
+			return true
+		}
+	}
+
+	if config.HideSecretChans {
+		// Only the first token holds mode letters, e.g. "+nts" or "ntsl 50"
+		parts := strings.Fields(modes)
+		if len(parts) > 0 && strings.ContainsAny(strings.TrimPrefix(parts[0], "+"), "sp") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hiddenChannelChecker returns a check for channels known only by name. When
+// secret and private channels are hidden, their modes come from the channel
+// list, which the RPC client caches, so checking many names costs one call. If
+// the list can't be fetched every channel counts as hidden.
+func hiddenChannelChecker(ctx context.Context) func(name string) bool {
+	if !config.HideSecretChans {
+		return func(name string) bool { return isHiddenChannel(name, "") }
+	}
+
+	modes := make(map[string]string)
+	if config.UseMockData || rpcClient == nil {
+		for _, channel := range getMockChannels() {
+			modes[strings.ToLower(channel.Name)] = channel.Modes
+		}
+	} else {
+		channels, err := rpcClient.GetChannels(ctx)
+		if err != nil {
+			log.Printf("⚠️ Failed to get channel modes for hidden channel check: %v", err)
+			return func(string) bool { return true }
+		}
+		for _, channel := range channels {
+			modes[strings.ToLower(channel.Name)] = channel.Modes
+		}
+	}
+
+	return func(name string) bool {
+		return isHiddenChannel(name, modes[strings.ToLower(name)])
+	}
+}
+
+// isHiddenChannelName is isHiddenChannel for a single channel known only by name
+func isHiddenChannelName(ctx context.Context, name string) bool {
+	return hiddenChannelChecker(ctx)(name)
+}
+
+// canViewHiddenChannels reports whether the requesting user may see hidden
+// channels, which takes channels.view_hidden
+func canViewHiddenChannels(r *http.Request) bool {
+	return hasPermission(r, "channels.view_hidden")
+}
+
+// filterHiddenChannels removes hidden channels unless the user may see them
+func filterHiddenChannels(r *http.Request, channels []Channel) []Channel {
+	if canViewHiddenChannels(r) {
+		return channels
+	}
+
+	visible := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !isHiddenChannel(channel.Name, channel.Modes) {
+			visible = append(visible, channel)
+		}
+	}
+	return visible
+}
+
+// channelCreatedLayout is the format of Channel.Created, in UTC
+const channelCreatedLayout = "2006-01-02 15:04:05"
+
+// parseRPCTimestamp parses a timestamp from UnrealIRCd, which sends
+// "2006-01-02T15:04:05.000Z"; other RFC 3339 forms are accepted too. An empty
+// or unparseable timestamp gives the zero time.
+func parseRPCTimestamp(isoTime string) time.Time {
+	if isoTime == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse("2006-01-02T15:04:05.000Z", isoTime)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339Nano, isoTime)
+	}
 	if err != nil {
 		log.Printf("⚠️ Failed to parse timestamp %s: %v", isoTime, err)
 		return time.Time{}
 	}
 
-	return t
+	return t.UTC()
 }
 
-// Helper function to parse mode strings from UnrealIRCd
+// parseModeString renders a mode string from UnrealIRCd as "+letters params".
+// Channel modes come with their parameters, like "ntCHP 50:30d", which are
+// kept so a limit or key shows. User mode letters are concatenated into one
+// string first, as IRC shows them. No modes gives "" rather than a bare "+".
 func parseModeString(modes string) string {
-	if modes == "" {
-		return ""
-	}
-
-	// UnrealIRCd returns modes like "ntCHP 50:30d"
-	// We want to extract just the mode letters part
 	parts := strings.Fields(modes)
 	if len(parts) == 0 {
 		return ""
 	}
 
-	// Return the first part with a + prefix
-	return "+" + parts[0]
+	letters := strings.TrimPrefix(parts[0], "+")
+	if letters == "" {
+		return ""
+	}
+	return strings.Join(append([]string{"+" + letters}, parts[1:]...), " ")
 }
 
 func getChannelUsersHandler(w http.ResponseWriter, r *http.Request) {
@@ -700,6 +1798,14 @@ func getChannelUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if !canViewHiddenChannels(r) && isHiddenChannelName(ctx, channelName) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
 	if config.UseMockData || rpcClient == nil {
 		// Return mock channel users
 		users := []rpc.ChannelUser{
@@ -710,17 +1816,18 @@ func getChannelUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
 	users, err := rpcClient.GetChannelUsers(ctx, channelName)
 	if err != nil {
 		log.Printf("RPC error getting channel users: %v", err)
-		http.Error(w, "Failed to get channel users", http.StatusInternalServerError)
+		writeRPCError(w, err, "Failed to get channel users")
 		return
 	}
 
-	json.NewEncoder(w).Encode(users)
+	for i := range users {
+		users[i].Modes = emptyIfNil(users[i].Modes)
+	}
+
+	json.NewEncoder(w).Encode(emptyIfNil(users))
 }
 
 // Channel moderation handlers
@@ -741,8 +1848,118 @@ func kickUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !canModerateChannel(r, req.Channel) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		// Mock success response
+		recordAudit(r, "kick", req.Channel, map[string]string{"nick": req.Nick, "reason": req.Reason})
+		broadcastChannelEvent(ChannelEvent{Channel: req.Channel, Event: "kick", Nick: req.Nick, Actor: actorName(r), Reason: req.Reason})
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.KickUser(ctx, req.Channel, req.Nick, req.Reason)
+	if err != nil {
+		log.Printf("RPC error kicking user: %v", err)
+		writeRPCError(w, err, "Failed to kick user")
+		return
+	}
+
+	recordAudit(r, "kick", req.Channel, map[string]string{"nick": req.Nick, "reason": req.Reason})
+	broadcastChannelEvent(ChannelEvent{Channel: req.Channel, Event: "kick", Nick: req.Nick, Actor: actorName(r), Reason: req.Reason})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func banUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Channel string `json:"channel"`
+		Mask    string `json:"mask"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !canModerateChannel(r, req.Channel) {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		// Mock success response
+		recordAudit(r, "ban", req.Channel, map[string]string{"mask": req.Mask, "reason": req.Reason})
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.BanUser(ctx, req.Channel, req.Mask, req.Reason)
+	if err != nil {
+		log.Printf("RPC error banning user: %v", err)
+		writeRPCError(w, err, "Failed to ban user")
+		return
+	}
+
+	recordAudit(r, "ban", req.Channel, map[string]string{"mask": req.Mask, "reason": req.Reason})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// maxKillReasonLength caps kill reasons, which the server sends to the
+// user and the network in a single line
+const maxKillReasonLength = 300
+
+// killUserHandler disconnects a user from the network
+func killUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Nick   string `json:"nick"`
+		Reason string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Nick = strings.TrimSpace(req.Nick)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Nick == "" || strings.ContainsAny(req.Nick, " ,") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A single nick is required", "field": "nick"})
+		return
+	}
+	if len(req.Reason) > maxKillReasonLength {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Reason must be at most %d characters", maxKillReasonLength), "field": "reason"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Disconnected by " + actorName(r)
+	}
+
 	if config.UseMockData || rpcClient == nil {
 		// Mock success response
+		recordAudit(r, "kill", req.Nick, map[string]string{"reason": req.Reason})
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 		return
@@ -751,26 +1968,70 @@ func kickUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	err := rpcClient.KickUser(ctx, req.Channel, req.Nick, req.Reason)
+	err := rpcClient.KillUser(ctx, req.Nick, req.Reason)
 	if err != nil {
-		log.Printf("RPC error kicking user: %v", err)
-		http.Error(w, "Failed to kick user", http.StatusInternalServerError)
+		log.Printf("RPC error killing user: %v", err)
+		writeRPCError(w, err, "Failed to kill user")
 		return
 	}
 
+	recordAudit(r, "kill", req.Nick, map[string]string{"reason": req.Reason})
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-func banUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// routeMethods are the methods probed when deciding between a 404 and a 405
+var routeMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// allowedMethods lists the methods router would accept for the request's path
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		if method == r.Method {
+			continue
+		}
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// notFoundHandler answers requests to unregistered paths with the JSON error
+// shape. mux reports a method mismatch as a 404 once a later prefix subrouter
+// has matched the path, so known paths are re-checked here and get a 405.
+func notFoundHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if allowed := allowedMethods(router, r); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			methodNotAllowedHandler(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not found", "path": r.URL.Path})
 	}
+}
+
+// methodNotAllowedHandler answers requests to a known path with an unsupported method
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed", "method": r.Method, "path": r.URL.Path})
+}
+
+// partUserHandler silently parts a user from a channel via services (SVSPART)
+func partUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	nick := mux.Vars(r)["nick"]
 
 	var req struct {
 		Channel string `json:"channel"`
-		Mask    string `json:"mask"`
 		Reason  string `json:"reason"`
 	}
 
@@ -779,27 +2040,52 @@ func banUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if nick == "" || req.Channel == "" {
+		http.Error(w, "Nick and channel are required", http.StatusBadRequest)
+		return
+	}
+
 	if config.UseMockData || rpcClient == nil {
-		// Mock success response
-		w.WriteHeader(http.StatusOK)
+		if !mockUserInChannel(nick, req.Channel) {
+			http.Error(w, "User not found in that channel", http.StatusNotFound)
+			return
+		}
+		recordAudit(r, "part", req.Channel, map[string]string{"nick": nick, "reason": req.Reason})
+		broadcastChannelEvent(ChannelEvent{Channel: req.Channel, Event: "part", Nick: nick, Actor: actorName(r), Reason: req.Reason})
 		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 		return
 	}
 
+	if !rpcClient.HasMethod("user.part") {
+		http.Error(w, "Forced part is not supported by this server", http.StatusNotImplemented)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	err := rpcClient.BanUser(ctx, req.Channel, req.Mask, req.Reason)
+	err := rpcClient.PartUser(ctx, nick, req.Channel, req.Reason)
 	if err != nil {
-		log.Printf("RPC error banning user: %v", err)
-		http.Error(w, "Failed to ban user", http.StatusInternalServerError)
+		log.Printf("RPC error parting user: %v", err)
+		writeRPCError(w, err, "Failed to part user")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	recordAudit(r, "part", req.Channel, map[string]string{"nick": nick, "reason": req.Reason})
+	broadcastChannelEvent(ChannelEvent{Channel: req.Channel, Event: "part", Nick: nick, Actor: actorName(r), Reason: req.Reason})
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
+// mockUserInChannel checks that a nick is a member of a channel in the mock data
+func mockUserInChannel(nick, channel string) bool {
+	for name, members := range getMockChannelMembers() {
+		if strings.EqualFold(name, channel) {
+			return containsFold(members, nick)
+		}
+	}
+	return false
+}
+
 // SearchResult represents a search result item
 type SearchResult struct {
 	Type        string      `json:"type"`        // "user", "channel", "server"
@@ -808,11 +2094,20 @@ type SearchResult struct {
 	Data        interface{} `json:"data"`        // full object data
 }
 
+// SearchWarning notes a search category that could not be queried
+type SearchWarning struct {
+	Category string `json:"category"` // "users", "channels"
+	Message  string `json:"message"`
+}
+
 // SearchResponse represents the search API response
 type SearchResponse struct {
-	Query   string         `json:"query"`
-	Results []SearchResult `json:"results"`
-	Total   int            `json:"total"`
+	Query        string          `json:"query"`
+	Results      []SearchResult  `json:"results"`
+	Total        int             `json:"total"`
+	TotalMatches int             `json:"total_matches"` // Before SEARCH_MAX_RESULTS was applied
+	Truncated    bool            `json:"truncated"`
+	Warnings     []SearchWarning `json:"warnings"`
 }
 
 // searchHandler handles search requests across users, channels, and servers
@@ -826,40 +2121,84 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var results []SearchResult
+	var warnings []SearchWarning
 
 	if config.UseMockData || rpcClient == nil {
 		// Mock search results
-		results = getMockSearchResults(query)
+		results = getMockSearchResults(query, canViewHiddenChannels(r), hasPermission(r, "users.view_realhost"))
 	} else {
 		// Real search using RPC
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		results = getSearchResults(ctx, query)
+		results, warnings = getSearchResults(ctx, query, canViewHiddenChannels(r), hasPermission(r, "users.view_realhost"))
 	}
 
+	matches := len(results)
+	results, truncated := capSearchResults(results, config.SearchMaxResults)
+
 	response := SearchResponse{
-		Query:   query,
-		Results: results,
-		Total:   len(results),
+		Query:        query,
+		Results:      emptyIfNil(results),
+		Total:        len(results),
+		TotalMatches: matches,
+		Truncated:    truncated,
+		Warnings:     emptyIfNil(warnings),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// capSearchResults keeps at most max results (0 or less means no limit),
+// sharing them fairly between result types: each type gets a turn in
+// round-robin, so a flood of matching users cannot crowd out channels. The
+// kept results stay in their original order.
+func capSearchResults(results []SearchResult, max int) ([]SearchResult, bool) {
+	if max <= 0 || len(results) <= max {
+		return results, false
+	}
+
+	var types []string
+	byType := map[string][]int{}
+	for i, result := range results {
+		if _, ok := byType[result.Type]; !ok {
+			types = append(types, result.Type)
+		}
+		byType[result.Type] = append(byType[result.Type], i)
+	}
+
+	keep := make([]bool, len(results))
+	for kept, round := 0, 0; kept < max; round++ {
+		for _, t := range types {
+			if round < len(byType[t]) && kept < max {
+				keep[byType[t][round]] = true
+				kept++
+			}
+		}
+	}
+
+	capped := make([]SearchResult, 0, max)
+	for i, result := range results {
+		if keep[i] {
+			capped = append(capped, result)
+		}
+	}
+	return capped, true
+}
+
 // getMockSearchResults returns mock search results for development
-func getMockSearchResults(query string) []SearchResult {
+func getMockSearchResults(query string, showHidden, showReal bool) []SearchResult {
 	var results []SearchResult
 
 	// Mock users
-	users := getMockUsers()
-	for _, user := range users {
+	for _, rpcUser := range getMockUserInfos() {
+		user := toAPIUser(rpcUser, showReal)
 		if matchesSearchQuery(user.Nick, query) || matchesSearchQuery(user.Account, query) {
 			results = append(results, SearchResult{
 				Type:        "user",
 				Name:        user.Nick,
 				Description: fmt.Sprintf("Account: %s, Connected to: %s", user.Account, user.ConnectedTo),
-				Data:        user,
+				Data:        userForList(user),
 			})
 		}
 	}
@@ -867,12 +2206,15 @@ func getMockSearchResults(query string) []SearchResult {
 	// Mock channels
 	channels := getMockChannels()
 	for _, channel := range channels {
+		if !showHidden && isHiddenChannel(channel.Name, channel.Modes) {
+			continue
+		}
 		if matchesSearchQuery(channel.Name, query) || matchesSearchQuery(channel.Topic, query) {
 			results = append(results, SearchResult{
 				Type:        "channel",
 				Name:        channel.Name,
 				Description: fmt.Sprintf("%d users - %s", channel.Users, channel.Topic),
-				Data:        channel,
+				Data:        channelForList(channel),
 			})
 		}
 	}
@@ -880,52 +2222,17 @@ func getMockSearchResults(query string) []SearchResult {
 	return results
 }
 
-// getMockRoles returns mock roles for development
-func getMockRoles() []Role {
-	return []Role{
-		{
-			ID:          1,
-			Name:        "admin",
-			Description: "Full administrative access",
-			Permissions: []string{"*"},
-			CreatedAt:   "2024-06-01 10:00:00",
-			UpdatedAt:   "2024-06-01 10:00:00",
-		},
-		{
-			ID:          2,
-			Name:        "moderator",
-			Description: "Channel moderation and user management",
-			Permissions: []string{"channels.view", "channels.moderate", "users.view", "users.kick", "users.ban"},
-			CreatedAt:   "2024-06-01 10:00:00",
-			UpdatedAt:   "2024-06-01 10:00:00",
-		},
-		{
-			ID:          3,
-			Name:        "operator",
-			Description: "Server operations and advanced features",
-			Permissions: []string{"channels.view", "users.view", "server.view", "server.manage", "bans.manage"},
-			CreatedAt:   "2024-06-01 10:00:00",
-			UpdatedAt:   "2024-06-01 10:00:00",
-		},
-		{
-			ID:          4,
-			Name:        "viewer",
-			Description: "Read-only access to most features",
-			Permissions: []string{"channels.view", "users.view", "server.view", "logs.view"},
-			CreatedAt:   "2024-06-01 10:00:00",
-			UpdatedAt:   "2024-06-01 10:00:00",
-		},
-	}
-}
-
 // getMockPermissions returns mock permissions for development
 func getMockPermissions() []Permission {
 	return []Permission{
 		{ID: "*", Name: "All Permissions", Description: "Full administrative access to all features", Category: "admin"},
 		{ID: "channels.view", Name: "View Channels", Description: "View channel list and information", Category: "channels"},
+		{ID: "channels.view_hidden", Name: "View Hidden Channels", Description: "See channels hidden by HIDDEN_CHANNELS and HIDE_SECRET_CHANNELS", Category: "channels"},
 		{ID: "channels.moderate", Name: "Moderate Channels", Description: "Moderate channels (kick, ban, topic)", Category: "channels"},
 		{ID: "channels.manage", Name: "Manage Channels", Description: "Create, delete, and configure channels", Category: "channels"},
 		{ID: "users.view", Name: "View Users", Description: "View user list and information", Category: "users"},
+		{ID: "users.view_realhost", Name: "View Real Hosts", Description: "View uncloaked hostnames and IPs", Category: "users"},
+		{ID: "users.view_security", Name: "View Login Security", Description: "View certificate fingerprints and SASL mechanisms", Category: "users"},
 		{ID: "users.kick", Name: "Kick Users", Description: "Kick users from channels", Category: "users"},
 		{ID: "users.ban", Name: "Ban Users", Description: "Ban users from channels or server", Category: "users"},
 		{ID: "users.manage", Name: "Manage Users", Description: "Full user management including accounts", Category: "users"},
@@ -940,51 +2247,43 @@ func getMockPermissions() []Permission {
 	}
 }
 
-// getSearchResults performs real search using RPC
-func getSearchResults(ctx context.Context, query string) []SearchResult {
+// getSearchResults searches users and channels over RPC. A category whose RPC
+// call fails is reported as a warning while the other results are still returned.
+func getSearchResults(ctx context.Context, query string, showHidden, showReal bool) ([]SearchResult, []SearchWarning) {
 	var results []SearchResult
+	var warnings []SearchWarning
 
 	// Search users
-	if rpcUsers, err := rpcClient.GetUsers(ctx); err == nil {
+	if rpcUsers, err := rpcClient.GetUsers(ctx); err != nil {
+		log.Printf("RPC error searching users: %v", err)
+		warnings = append(warnings, SearchWarning{Category: "users", Message: "User search unavailable"})
+	} else {
 		for _, rpcUser := range rpcUsers {
 			if matchesSearchQuery(rpcUser.Nick, query) ||
 				matchesSearchQuery(rpcUser.Account, query) ||
 				matchesSearchQuery(rpcUser.Realname, query) {
 
-				connectTime := time.Unix(rpcUser.ConnectTime, 0)
-				timeSince := time.Since(connectTime)
-				var timeStr string
-				if timeSince.Hours() >= 1 {
-					timeStr = fmt.Sprintf("%.0fh ago", timeSince.Hours())
-				} else {
-					timeStr = fmt.Sprintf("%.0fm ago", timeSince.Minutes())
-				}
-
-				user := User{
-					Nick:        rpcUser.Nick,
-					Country:     rpcUser.Country,
-					HostIP:      fmt.Sprintf("%s (%s)", rpcUser.Hostname, rpcUser.IP),
-					Account:     rpcUser.Account,
-					Oper:        getOperClass(rpcUser),
-					ConnectedTo: rpcUser.Server,
-					Reputation:  0,
-					Modes:       fmt.Sprintf("+%s", joinStrings(rpcUser.Modes)),
-					ConnectTime: timeStr,
-				}
+				user := toAPIUser(rpcUser, showReal)
 
 				results = append(results, SearchResult{
 					Type:        "user",
 					Name:        rpcUser.Nick,
 					Description: fmt.Sprintf("Account: %s, Connected to: %s", rpcUser.Account, rpcUser.Server),
-					Data:        user,
+					Data:        userForList(user),
 				})
 			}
 		}
 	}
 
 	// Search channels - Fix the modes handling here too
-	if rpcChannels, err := rpcClient.GetChannels(ctx); err == nil {
+	if rpcChannels, err := rpcClient.GetChannels(ctx); err != nil {
+		log.Printf("RPC error searching channels: %v", err)
+		warnings = append(warnings, SearchWarning{Category: "channels", Message: "Channel search unavailable"})
+	} else {
 		for _, rpcChannel := range rpcChannels {
+			if !showHidden && isHiddenChannel(rpcChannel.Name, rpcChannel.Modes) {
+				continue
+			}
 			if matchesSearchQuery(rpcChannel.Name, query) ||
 				matchesSearchQuery(rpcChannel.Topic, query) {
 
@@ -994,9 +2293,9 @@ func getSearchResults(ctx context.Context, query string) []SearchResult {
 				channel := Channel{
 					Name:     rpcChannel.Name,
 					Users:    rpcChannel.UserCount,
-					Modes:    parseModeString(rpcChannel.Modes), // Use parseModeString instead of joinStrings
+					Modes:    parseModeString(rpcChannel.Modes),
 					Topic:    rpcChannel.Topic,
-					Created:  createdTime.Format("2006-01-02 15:04:05"),
+					Created:  createdTime.Format(channelCreatedLayout),
 					UserList: rpcChannel.Users,
 				}
 
@@ -1004,13 +2303,13 @@ func getSearchResults(ctx context.Context, query string) []SearchResult {
 					Type:        "channel",
 					Name:        rpcChannel.Name,
 					Description: fmt.Sprintf("%d users - %s", rpcChannel.UserCount, rpcChannel.Topic),
-					Data:        channel,
+					Data:        channelForList(channel),
 				})
 			}
 		}
 	}
 
-	return results
+	return results, warnings
 }
 
 // matchesSearchQuery checks if a string matches the search query with wildcard support
@@ -1047,12 +2346,43 @@ func matchesSearchQuery(text, query string) bool {
 	return strings.Contains(text, query)
 }
 
+// matchMask checks if text matches an IRC-style mask ('*' and '?' wildcards), case-insensitively
+func matchMask(mask, text string) bool {
+	mask = strings.ToLower(mask)
+	text = strings.ToLower(text)
+
+	m, t := 0, 0
+	star, next := -1, 0
+	for t < len(text) {
+		switch {
+		case m < len(mask) && (mask[m] == '?' || mask[m] == text[t]):
+			m++
+			t++
+		case m < len(mask) && mask[m] == '*':
+			// Remember the star so we can backtrack to it on a mismatch
+			star, next = m, t
+			m++
+		case star != -1:
+			m = star + 1
+			next++
+			t = next
+		default:
+			return false
+		}
+	}
+
+	for m < len(mask) && mask[m] == '*' {
+		m++
+	}
+	return m == len(mask)
+}
+
 // loginHandler handles user login
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Log the request
-	log.Printf("🔐 Login request from %s", r.RemoteAddr)
+	log.Printf("🔐 Login request from %s", clientIP(r))
 
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1067,9 +2397,23 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("🔐 Login attempt for user: %s", req.Username)
 
+	// Checked before the password, and the same for unknown usernames, so a
+	// locked account cannot be probed
+	if wait, locked := loginLockouts.locked(req.Username, time.Now()); locked {
+		log.Printf("🔒 Login for %s refused: locked for another %v", req.Username, wait.Round(time.Second))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(LoginResponse{
+			Success: false,
+			Error:   "Account temporarily locked after too many failed logins",
+		})
+		return
+	}
+
 	user, err := authenticateUser(req.Username, req.Password)
 	if err != nil {
 		log.Printf("❌ Authentication failed for %s: %v", req.Username, err)
+		failedLogin(req.Username)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(LoginResponse{
 			Success: false,
@@ -1078,14 +2422,62 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := generateJWT(user)
+	// The password was right; accounts with two-factor authentication also need a code
+	if user.TOTPEnabled {
+		if req.TOTPCode == "" {
+			log.Printf("🔐 Two-factor code required for %s", user.Username)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(LoginResponse{
+				Success:           false,
+				TwoFactorRequired: true,
+				Error:             "2fa_required",
+			})
+			return
+		}
+
+		ok, err := useTOTPCode(user, req.TOTPCode, time.Now())
+		if err != nil {
+			log.Printf("❌ Failed to check two-factor code for %s: %v", user.Username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(LoginResponse{
+				Success: false,
+				Error:   "Failed to start session",
+			})
+			return
+		}
+		if !ok {
+			log.Printf("❌ Invalid two-factor code for %s", user.Username)
+			failedLogin(req.Username)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(LoginResponse{
+				Success:           false,
+				TwoFactorRequired: true,
+				Error:             "Invalid two-factor code",
+			})
+			return
+		}
+	}
+	loginLockouts.succeed(req.Username)
+	recordLogin(user)
+
+	// Generate JWT token and record its session
+	token, err := issueSession(user, r)
 	if err != nil {
-		log.Printf("❌ Failed to generate JWT for %s: %v", user.Username, err)
+		if errors.Is(err, errSessionLimit) {
+			log.Printf("⚠️ Login for %s rejected: session limit of %d reached", user.Username, config.MaxSessionsPerUser)
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(LoginResponse{
+				Success: false,
+				Error:   "Too many active sessions",
+			})
+			return
+		}
+
+		log.Printf("❌ Failed to start session for %s: %v", user.Username, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(LoginResponse{
 			Success: false,
-			Error:   "Failed to generate token",
+			Error:   "Failed to start session",
 		})
 		return
 	}
@@ -1095,91 +2487,51 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	// Return 200 OK with the response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(LoginResponse{
-		Success: true,
-		User:    user,
-		Token:   token,
+		Success:            true,
+		User:               user,
+		Token:              token,
+		MustChangePassword: user.MustChange,
 	})
 }
 
-// Role and Permission API handlers
-func getRolesHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// For now, always return mock data since we don't have a roles table in the database yet
-	roles := getMockRoles()
-	json.NewEncoder(w).Encode(roles)
-}
-
-func createRoleHandler(w http.ResponseWriter, r *http.Request) {
+// Permission API handlers
+func getPermissionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var role Role
-	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
-		return
-	}
-
-	// For mock implementation, generate an ID and timestamps
-	role.ID = int(time.Now().Unix()) // Simple ID generation
-	role.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
-	role.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
-
-	// In a real implementation, you would save to database here
-	// For now, just return the created role
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(role)
+	permissions := getMockPermissions()
+	json.NewEncoder(w).Encode(permissions)
 }
 
-func updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+// getRPCMethodsHandler lists the RPC methods advertised by the connected server
+func getRPCMethodsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	roleID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid role ID"})
+	if config.UseMockData || rpcClient == nil {
+		json.NewEncoder(w).Encode(getMockCapabilities())
 		return
 	}
 
-	var role Role
-	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+	caps := rpcClient.Capabilities()
+	if caps == nil {
+		http.Error(w, "RPC capabilities have not been detected", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Set the ID from URL and update timestamp
-	role.ID = roleID
-	role.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
-
-	// In a real implementation, you would update in database here
-	// For now, just return the updated role
-	json.NewEncoder(w).Encode(role)
+	json.NewEncoder(w).Encode(caps)
 }
 
-func deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	roleID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid role ID"})
-		return
+// getMockCapabilities returns mock RPC capabilities for development
+func getMockCapabilities() *rpc.Capabilities {
+	return &rpc.Capabilities{
+		Methods: []rpc.RPCMethod{
+			{Name: "channel.list", Module: "rpc/channel", Version: "1.0.4"},
+			{Name: "log.send", Module: "rpc/log", Version: "1.0.1"},
+			{Name: "rpc.info", Module: "rpc/rpc", Version: "1.0.2"},
+			{Name: "stats.get", Module: "rpc/stats", Version: "1.0.0"},
+			{Name: "user.list", Module: "rpc/user", Version: "1.0.6"},
+		},
+		DetectedAt: time.Now(),
 	}
-
-	// In a real implementation, you would delete from database here
-	// For now, just return success
-	w.WriteHeader(http.StatusNoContent)
-	_ = roleID // Avoid unused variable warning
-}
-
-func getPermissionsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	permissions := getMockPermissions()
-	json.NewEncoder(w).Encode(permissions)
 }
 
 // getOperClass helper function to get operator class
@@ -1193,19 +2545,68 @@ func getOperClass(user rpc.UserInfo) string {
 	return ""
 }
 
-// WebSocket handler for real-time updates
+// websocketHandler serves real-time updates. A reader goroutine blocks on
+// ReadMessage to take subscriptions and notice disconnects, closing done when
+// it stops; the handler itself only writes, woken by messages queued by
+// wsHub and the event broadcasts, or by done, so an idle connection uses no CPU.
 func websocketHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Browsers cannot set headers on the upgrade request, so the token comes in
+	// the query string or as a subprotocol, and is checked before upgrading
+	tokenString, responseHeader := wsToken(r)
+	if tokenString == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+	claims, status, message := checkToken(tokenString, r)
+	if claims == nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
 	}
 	defer conn.Close()
 
-	log.Println("Client connected to WebSocket")
+	log.Printf("Client %s connected to WebSocket", claims.Username)
+
+	// Clients must answer pings within the idle timeout or the read below fails
+	idleTimeout := config.WSIdleTimeout
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	})
+
+	client := newWSClient(claims.UserID, claims.Username, claims.Role)
+	client.sessionID = claims.ID
+	client.viewAudit = userHasPermission(claims.UserID, "logs.view")
+	client.viewHidden = userHasPermission(claims.UserID, "channels.view_hidden")
+	client.viewChannels = userHasPermission(claims.UserID, "channels.view")
+	if !client.viewChannels {
+		if client.channelGrants, err = channelGrants(claims.UserID); err != nil {
+			log.Printf("⚠️ Failed to load channel grants for %s: %v", claims.Username, err)
+		}
+	}
+
+	// The session is re-checked with every ping, so a revocation the hub
+	// missed still closes the connection
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go pingWebSocket(conn, idleTimeout/2, stopPing, func() {
+		if !wsSessionActive(claims, r) {
+			client.endSession()
+		}
+	})
+
+	// The token's expiry ends the connection as well
+	expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+	defer expiry.Stop()
 
 	// Send initial data
-	stats := getMockNetworkStats()
+	stats := wsHub.latest()
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 	if err := conn.WriteJSON(map[string]interface{}{
 		"type": "networkStats",
 		"data": stats,
@@ -1214,76 +2615,211 @@ func websocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Keep connection alive and send periodic updates
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	wsHub.register(client)
+	defer wsHub.unregister(client)
 
-	for {
-		select {
-		case <-ticker.C:
-			// Send updated stats
-			var stats interface{}
-			if config.UseMockData || rpcClient == nil {
-				stats = getMockNetworkStats()
-			} else {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				if networkInfo, err := rpcClient.GetNetworkInfo(ctx); err == nil {
-					stats = NetworkStats{
-						UsersOnline: networkInfo.UsersOnline,
-						Channels:    networkInfo.Channels,
-						Servers:     networkInfo.Servers,
-						Operators:   networkInfo.Operators,
-					}
-				} else {
-					stats = getMockNetworkStats()
-				}
-				cancel()
+	// Read client messages (subscriptions) until the connection fails
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				log.Println("WebSocket read error:", err)
+				return
 			}
+			conn.SetReadDeadline(time.Now().Add(idleTimeout))
+			client.handleMessage(data)
+		}
+	}()
 
-			if err := conn.WriteJSON(map[string]interface{}{
-				"type": "networkStats",
-				"data": stats,
-			}); err != nil {
+	// Write queued messages: stats from wsHub, events and replies
+	for {
+		select {
+		case msg := <-client.send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
 				log.Println("WebSocket write error:", err)
 				return
 			}
-		default:
-			// Check if connection is still alive
-			if _, _, err := conn.ReadMessage(); err != nil {
-				log.Println("WebSocket read error:", err)
+		case <-client.dropped:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(time.Second))
+			return
+		case <-client.ended:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"), time.Now().Add(time.Second))
+			return
+		case <-expiry.C:
+			client.endSession()
+		case <-done:
+			return
+		}
+	}
+}
+
+// wsSessionActive re-checks the session of a connected WebSocket client. The
+// connection was authenticated at upgrade, so a database outage leaves it open;
+// only a session known to be revoked or expired closes it.
+func wsSessionActive(claims *JWTClaims, r *http.Request) bool {
+	active, err := sessions.check(claims, r)
+	if err != nil {
+		log.Printf("⚠️ Could not re-check WebSocket session of %s: %v", claims.Username, err)
+		return true
+	}
+	return active
+}
+
+// wsToken returns the JWT of a WebSocket upgrade request, from the "token"
+// query parameter or from the subprotocols "bearer, <token>". A token sent as a
+// subprotocol comes with the header that accepts the "bearer" subprotocol,
+// which browsers require before they complete the handshake.
+func wsToken(r *http.Request) (string, http.Header) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, nil
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.EqualFold(protocols[i], "bearer") {
+			return protocols[i+1], http.Header{"Sec-WebSocket-Protocol": {protocols[i]}}
+		}
+	}
+	return "", nil
+}
+
+// pingWebSocket sends periodic pings until stop is closed or a ping fails,
+// calling beforePing ahead of each one
+func pingWebSocket(conn *websocket.Conn, interval time.Duration, stop <-chan struct{}, beforePing func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			beforePing()
+			// WriteControl is safe to call concurrently with the handler's writes
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				log.Println("WebSocket ping error:", err)
 				return
 			}
+		case <-stop:
+			return
 		}
 	}
 }
 
-// Utility function to join string slices
-func joinStrings(strs []string) string {
-	if len(strs) == 0 {
-		return ""
+// stripModeLetters removes the hidden mode letters from a "+modes params"
+// string, along with the parameters of hidden channel modes
+func stripModeLetters(modes, hidden string) string {
+	if hidden == "" || modes == "" {
+		return modes
+	}
+
+	fields := strings.Fields(modes)
+	params := fields[1:]
+	var letters []byte
+	var kept []string
+	for i := 0; i < len(fields[0]); i++ {
+		mode := fields[0][i]
+		var param []string
+		if len(params) > 0 && strings.IndexByte(paramChannelModes, mode) >= 0 {
+			param, params = params[:1], params[1:]
+		}
+		if strings.IndexByte(hidden, mode) < 0 {
+			letters = append(letters, mode)
+			kept = append(kept, param...)
+		}
+	}
+
+	if stripped := string(letters); stripped != "+" {
+		return strings.Join(append([]string{stripped}, append(kept, params...)...), " ")
+	}
+	return ""
+}
+
+// userForList hides the configured user modes for list views. Detail views keep full modes.
+func userForList(user User) User {
+	user.Modes = stripModeLetters(user.Modes, config.ListHiddenUModes)
+	return user
+}
+
+// channelForList hides the configured channel modes for list views. Detail views keep full modes.
+func channelForList(channel Channel) Channel {
+	channel.Modes = stripModeLetters(channel.Modes, config.ListHiddenCModes)
+	return channel
+}
+
+func usersForList(users []User) []User {
+	listed := make([]User, len(users))
+	for i, user := range users {
+		listed[i] = userForList(user)
+	}
+	return listed
+}
+
+func channelsForList(channels []Channel) []Channel {
+	listed := make([]Channel, len(channels))
+	for i, channel := range channels {
+		listed[i] = channelForList(channel)
 	}
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += strs[i]
+	return listed
+}
+
+// intPtr returns a pointer to n
+func intPtr(n int) *int {
+	return &n
+}
+
+// emptyIfNil returns an empty slice for nil input so list responses encode as [] rather than null
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
 	}
-	return result
+	return items
 }
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "check the configuration, database and RPC connection, print a report and exit")
+	flag.Parse()
+
 	// Load configuration
 	config = loadConfig()
 
-	// Set JWT secret from config
-	jwtSecret = []byte(config.JWTSecret)
+	// Log in LOG_FORMAT, keeping recent warnings and errors for the admin UI
+	initLogging(config.LogFormat, config.LogLevel)
+
+	if *selfTest {
+		os.Exit(runSelfTest(os.Stdout))
+	}
+	if err := validateOrigins(config.AllowedOrigins); err != nil {
+		log.Fatalf("Invalid allowed origins: %v", err)
+	}
+	proxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	trustedProxies = proxies
+
+	secret, err := resolveJWTSecret(config)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	jwtSecret = secret
 
 	// Initialize database
 	if err := initDatabase(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	log.Printf("🔄 WebSocket stats update interval: %v", liveSettings.get().WSUpdateInterval)
+	if containsFold(config.AllowedOrigins, allowAllOrigins) {
+		log.Printf("⚠️ ALLOWED_ORIGINS allows every origin; use this for development only")
+	}
+
 	// Verify admin user exists
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM webpanel_users WHERE username = 'admin'").Scan(&count)
+	err = db.QueryRow("SELECT COUNT(*) FROM webpanel_users WHERE username = 'admin'").Scan(&count)
 	if err == nil && count == 0 {
 		log.Println("🔧 Creating missing admin user...")
 		if err := createDefaultAdmin(); err != nil {
@@ -1293,8 +2829,24 @@ func main() {
 		}
 	}
 
+	// Load country coordinates for the GeoJSON map data
+	initGeoIP()
+
 	// Initialize RPC client
 	initRPCClient()
+	if rpcClient != nil {
+		watchRPCCacheSettings()
+	}
+
+	// Poll network stats once for all WebSocket clients
+	wsHub.start()
+
+	// Watch for netsplits, missing services and error bursts
+	startAlertMonitor()
+
+	// Delete sessions that can no longer be used or refreshed
+	startSessionPurger()
+	startGrantExpiry()
 
 	// Ensure RPC client is closed on exit
 	defer func() {
@@ -1305,45 +2857,100 @@ func main() {
 
 	// Create router
 	r := mux.NewRouter()
+	r.NotFoundHandler = notFoundHandler(r)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 
 	// Public routes (no authentication required)
-	r.HandleFunc("/api/auth/login", loginHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		status := map[string]interface{}{
-			"status":        "ok",
-			"rpc_connected": rpcClient != nil && rpcClient.IsConnected(),
-			"mock_data":     config.UseMockData,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(status)
-	}).Methods("GET", "OPTIONS")
+	r.Handle("/api/auth/login", loginRateLimitMiddleware(http.HandlerFunc(loginHandler))).Methods("POST", "OPTIONS")
+	// Outside authMiddleware, which would turn away the recently expired tokens it accepts
+	r.HandleFunc("/api/auth/refresh", refreshTokenHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/branding", getBrandingHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/health", healthHandler).Methods("GET", "OPTIONS")
 
 	// Protected API routes
 	api := r.PathPrefix("/api").Subrouter()
 	api.Use(authMiddleware) // Apply authentication to all /api routes except login
-
-	// Network endpoints (require user role or higher)
+	api.Use(rateLimitMiddleware)
+	api.Use(readOnlyMiddleware)
+	api.HandleFunc("/auth/change-password", changePasswordHandler).Methods("POST")
+	api.HandleFunc("/auth/logout", logoutHandler).Methods("POST")
+	api.HandleFunc("/auth/2fa/setup", setupTOTPHandler).Methods("POST")
+	api.HandleFunc("/auth/2fa/verify", verifyTOTPHandler).Methods("POST")
+	api.HandleFunc("/auth/2fa/disable", disableTOTPHandler).Methods("POST")
+	api.HandleFunc("/auth/password-strength", passwordStrengthHandler).Methods("POST")
+
+	// Network endpoints (require any dashboard permission)
 	networkRouter := api.PathPrefix("/network").Subrouter()
-	networkRouter.Use(requireRole("user", "moderator", "admin"))
+	networkRouter.Use(requireAnyPermission(dashboardPermissions...))
 	networkRouter.HandleFunc("/stats", getNetworkStatsHandler).Methods("GET")
 	networkRouter.HandleFunc("/health", getNetworkHealthHandler).Methods("GET")
 
-	// User management (require user role or higher)
+	// User management (require users.view)
 	userRouter := api.PathPrefix("/users").Subrouter()
-	userRouter.Use(requireRole("user", "moderator", "admin"))
+	userRouter.Use(requirePermission("users.view"))
 	userRouter.HandleFunc("", getUsersHandler).Methods("GET")
-
-	// Channel management (require user role or higher)
+	userRouter.HandleFunc("/by-reputation", getUsersByReputationHandler).Methods("GET")
+	userRouter.HandleFunc("/export", exportUsersHandler).Methods("GET")
+	userRouter.HandleFunc("/who", getUsersWhoHandler).Methods("GET")
+	userRouter.Handle("/kill", requirePermission("users.manage")(http.HandlerFunc(killUserHandler))).Methods("POST")
+	userRouter.HandleFunc("/{nick}/host", getUserHostHandler).Methods("GET")
+	userRouter.HandleFunc("/{nick}", getUserWhoisHandler).Methods("GET")
+
+	// User statistics (require users.view)
+	statsRouter := api.PathPrefix("/stats").Subrouter()
+	statsRouter.Use(requirePermission("users.view"))
+	statsRouter.HandleFunc("/security", getSecurityStatsHandler).Methods("GET")
+	statsRouter.HandleFunc("/geojson", getGeoJSONHandler).Methods("GET")
+
+	// Server links (require any dashboard permission, server.view for details)
+	serversRouter := api.PathPrefix("/servers").Subrouter()
+	serversRouter.Use(requireAnyPermission(dashboardPermissions...))
+	serversRouter.Handle("", requirePermission("server.view")(http.HandlerFunc(getServersHandler))).Methods("GET")
+	serversRouter.HandleFunc("/latency", getServerLatencyHandler).Methods("GET")
+	serversRouter.Handle("/rehash", requirePermission("server.manage")(http.HandlerFunc(rehashServerHandler))).Methods("POST")
+	serversRouter.Handle("/{server}/rehash", requirePermission("server.manage")(http.HandlerFunc(rehashServerHandler))).Methods("POST")
+	serversRouter.Handle("/{server}/modules", requirePermission("server.view")(http.HandlerFunc(getServerModulesHandler))).Methods("GET")
+
+	// Services routes
+	servicesRouter := api.PathPrefix("/services").Subrouter()
+	servicesRouter.Use(requireAnyPermission(dashboardPermissions...))
+	servicesRouter.HandleFunc("/health", getServicesHealthHandler).Methods("GET")
+
+	// Alerts (require any dashboard permission to view, channels.moderate or server.manage to acknowledge)
+	alertsRouter := api.PathPrefix("/alerts").Subrouter()
+	alertsRouter.Use(requireAnyPermission(dashboardPermissions...))
+	alertsRouter.HandleFunc("", getAlertsHandler).Methods("GET")
+
+	alertAckRouter := api.PathPrefix("/alerts").Subrouter()
+	alertAckRouter.Use(requireAnyPermission("channels.moderate", "server.manage"))
+	alertAckRouter.HandleFunc("/{id}/ack", ackAlertHandler).Methods("POST")
+
+	// Ban mask impact (require channels.view)
+	masksRouter := api.PathPrefix("/masks").Subrouter()
+	masksRouter.Use(requirePermission("channels.view"))
+	masksRouter.HandleFunc("/affected-channels", getAffectedChannelsHandler).Methods("GET")
+
+	// Channel management (require channels.view)
 	channelRouter := api.PathPrefix("/channels").Subrouter()
-	channelRouter.Use(requireRole("user", "moderator", "admin"))
+	channelRouter.Use(requirePermission("channels.view"))
 	channelRouter.HandleFunc("", getChannelsHandler).Methods("GET")
+	channelRouter.HandleFunc("/export", exportChannelsHandler).Methods("GET")
+	channelRouter.HandleFunc("/age-distribution", getChannelAgeDistributionHandler).Methods("GET")
 	channelRouter.HandleFunc("/{channel}/users", getChannelUsersHandler).Methods("GET")
+	channelRouter.HandleFunc("/{channel}/mode-history", getChannelModeHistoryHandler).Methods("GET")
+	channelRouter.HandleFunc("/{channel}/snapshot", getChannelSnapshotHandler).Methods("GET")
+	channelRouter.HandleFunc("/{channel}/snapshots", getChannelSnapshotsHandler).Methods("GET")
 
-	// Channel moderation (require moderator role or higher)
+	// Channel moderation. Not behind requirePermission: the handlers accept
+	// channels.moderate or a per-channel moderator grant for the target channel.
 	moderationRouter := api.PathPrefix("/channels").Subrouter()
-	moderationRouter.Use(requireRole("moderator", "admin"))
 	moderationRouter.HandleFunc("/kick", kickUserHandler).Methods("POST")
 	moderationRouter.HandleFunc("/ban", banUserHandler).Methods("POST")
+	moderationRouter.HandleFunc("/{channel}/snapshots", saveChannelSnapshotHandler).Methods("POST")
+	moderationRouter.HandleFunc("/{channel}/snapshots/{name}", deleteChannelSnapshotHandler).Methods("DELETE")
+	moderationRouter.HandleFunc("/{channel}/restore", restoreChannelSnapshotHandler).Methods("POST")
+	moderationRouter.HandleFunc("/{channel}/topic", setChannelTopicHandler).Methods("POST")
+	moderationRouter.HandleFunc("/{channel}/modes", setChannelModesHandler).Methods("POST")
 
 	// Admin-only routes
 	adminRouter := api.PathPrefix("").Subrouter()
@@ -1353,31 +2960,137 @@ func main() {
 	adminRouter.HandleFunc("/roles/{id}", updateRoleHandler).Methods("PUT")
 	adminRouter.HandleFunc("/roles/{id}", deleteRoleHandler).Methods("DELETE")
 	adminRouter.HandleFunc("/permissions", getPermissionsHandler).Methods("GET")
-
-	// Search (require user role or higher)
-	api.HandleFunc("/search", searchHandler).Methods("GET")
-
-	// WebSocket endpoint (could add auth here too if needed)
+	adminRouter.HandleFunc("/admin/role-drift", getRoleDriftHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/settings", getSettingsHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/settings", updateSettingsHandler).Methods("PUT")
+	adminRouter.HandleFunc("/admin/rpc/methods", getRPCMethodsHandler).Methods("GET")
+	adminRouter.HandleFunc("/users/{nick}/part", partUserHandler).Methods("POST")
+	adminRouter.HandleFunc("/admin/rpc/status", getRPCStatusHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/rpc/ping", getRPCPingHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/rpc/cache", getRPCCacheStatsHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/rpc/inflight", getRPCInFlightHandler).Methods("GET")
+	adminRouter.HandleFunc("/admin/rpc/inflight/{id}", cancelRPCInFlightHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/admin/logs/backend", getBackendLogsHandler).Methods("GET")
+	adminRouter.HandleFunc("/stats/recount", recountStatsHandler).Methods("POST")
+	adminRouter.HandleFunc("/server/throttle", getThrottleHandler).Methods("GET")
+	adminRouter.HandleFunc("/server/throttle", updateThrottleHandler).Methods("PUT")
+	adminRouter.HandleFunc("/deny-channels", getDenyChannelsHandler).Methods("GET")
+	adminRouter.HandleFunc("/deny-channels", addDenyChannelHandler).Methods("POST")
+	adminRouter.HandleFunc("/deny-channels", deleteDenyChannelHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/channels/{channel}/recover", recoverChannelHandler).Methods("POST")
+
+	// Panel user accounts (require panel.users)
+	api.HandleFunc("/panel-users", getPanelUsersHandler).Methods("GET")
+	api.HandleFunc("/panel-users", createPanelUserHandler).Methods("POST")
+	api.HandleFunc("/panel-users/bulk-role", bulkRolePanelUsersHandler).Methods("POST")
+	api.HandleFunc("/panel-users/{id}", updatePanelUserHandler).Methods("PUT")
+	api.HandleFunc("/panel-users/{id}", deletePanelUserHandler).Methods("DELETE")
+
+	// Audit log (requires logs.view)
+	api.HandleFunc("/audit-log", getAuditLogHandler).Methods("GET")
+	api.Handle("/opers/activity", requirePermission("logs.view")(http.HandlerFunc(getOperActivityHandler))).Methods("GET")
+
+	// Server bans and ban exceptions (require bans.view to list, bans.manage to change)
+	bansViewRouter := api.PathPrefix("").Subrouter()
+	bansViewRouter.Use(requirePermission("bans.view"))
+	bansViewRouter.HandleFunc("/server-bans", getServerBansHandler).Methods("GET")
+	bansViewRouter.HandleFunc("/elines", getELinesHandler).Methods("GET")
+
+	bansManageRouter := api.PathPrefix("").Subrouter()
+	bansManageRouter.Use(requirePermission("bans.manage"))
+	bansManageRouter.HandleFunc("/server-bans", addServerBanHandler).Methods("POST")
+	bansManageRouter.HandleFunc("/server-bans", deleteServerBanHandler).Methods("DELETE")
+	bansManageRouter.HandleFunc("/elines", addELineHandler).Methods("POST")
+	bansManageRouter.HandleFunc("/elines", deleteELineHandler).Methods("DELETE")
+	bansManageRouter.HandleFunc("/spamfilters", getSpamfiltersHandler).Methods("GET")
+	bansManageRouter.HandleFunc("/spamfilters", addSpamfilterHandler).Methods("POST")
+	bansManageRouter.HandleFunc("/spamfilters", deleteSpamfilterHandler).Methods("DELETE")
+	bansManageRouter.HandleFunc("/name-bans", getNameBansHandler).Methods("GET")
+	bansManageRouter.HandleFunc("/name-bans", addNameBanHandler).Methods("POST")
+	bansManageRouter.HandleFunc("/name-bans", deleteNameBanHandler).Methods("DELETE")
+
+	adminRouter.HandleFunc("/panel-users/{id}/reset-password", resetPanelUserPasswordHandler).Methods("POST")
+	adminRouter.HandleFunc("/panel-users/{id}/elevate", elevatePanelUserHandler).Methods("POST")
+	adminRouter.HandleFunc("/panel-users/{id}/elevate/{grantId}", revokeGrantHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/channel-moderators", getChannelModeratorsHandler).Methods("GET")
+	adminRouter.HandleFunc("/channel-moderators", createChannelModeratorHandler).Methods("POST")
+	adminRouter.HandleFunc("/channel-moderators/{id}", deleteChannelModeratorHandler).Methods("DELETE")
+
+	// Search (require any dashboard permission)
+	api.Handle("/search", requireAnyPermission(dashboardPermissions...)(http.HandlerFunc(searchHandler))).Methods("GET")
+
+	// WebSocket endpoint; websocketHandler checks the token from the query
+	// string or subprotocol, as authMiddleware does, before upgrading
 	r.HandleFunc("/ws", websocketHandler)
 
 	// CORS configuration - USE THIS INSTEAD
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:5173", "http://localhost:5174"}, // All possible React dev servers
+		AllowedOrigins:   config.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"X-API-Version", "X-Request-ID"},
 		AllowCredentials: true,
-		Debug:           true, // Enable debug logging
+		Debug:            true, // Enable debug logging
+		Logger:           log.Default(),
 	})
 
-	// Wrap router with CORS
-	handler := c.Handler(r)
+	// Wrap router with CORS, logging every request
+	handler := requestLogMiddleware(c.Handler(r))
 
-	fmt.Printf("🚀 UnrealIRCd Admin Panel API server starting on port %s\n", config.Port)
-	fmt.Printf("🔗 Frontend should be at: http://localhost:5173\n")
-	fmt.Printf("🔗 Backend API at: http://localhost:%s\n", config.Port)
-	fmt.Printf("🔗 Health check: http://localhost:%s/health\n", config.Port)
+	addr, err := listenAddress(config.BindAddress, config.Port)
+	if err != nil {
+		log.Fatalf("Invalid listen address: %v", err)
+	}
+	if config.BindAddress == "" {
+		log.Printf("🚀 UnrealIRCd Admin Panel API server listening on %s (all interfaces)", addr)
+	} else {
+		log.Printf("🚀 UnrealIRCd Admin Panel API server listening on %s", addr)
+	}
+	log.Printf("🔗 Frontend should be at: http://localhost:5173")
+	log.Printf("🔗 Backend API at: http://localhost:%s", config.Port)
+	log.Printf("🔗 Health check: http://localhost:%s/health", config.Port)
 
-	if err := http.ListenAndServe(":"+config.Port, handler); err != nil {
+	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// listenAddress joins BIND_ADDRESS and PORT into the address to listen on.
+// An empty bind address listens on all interfaces; otherwise it must be an IP
+// address or a host name that resolves.
+func listenAddress(bindAddress, port string) (string, error) {
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", fmt.Errorf("PORT %q is not a port number", port)
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(bindAddress), "["), "]")
+	if host != "" && net.ParseIP(host) == nil {
+		if _, err := net.LookupHost(host); err != nil {
+			return "", fmt.Errorf("BIND_ADDRESS %q is not an IP address or resolvable host name: %v", bindAddress, err)
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// validateOrigins checks that each ALLOWED_ORIGINS entry is "*" or an origin
+// as browsers send it: http or https, a host and optional port, nothing more.
+// A trailing slash or path would never match, so it is refused rather than ignored.
+func validateOrigins(origins []string) error {
+	for _, origin := range origins {
+		if origin == allowAllOrigins {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("ALLOWED_ORIGINS entry %q is not an origin like https://panel.example.net", origin)
+		}
+		if port := u.Port(); port != "" {
+			if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+				return fmt.Errorf("ALLOWED_ORIGINS entry %q has an invalid port", origin)
+			}
+		}
+	}
+	return nil
+}
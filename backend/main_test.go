@@ -0,0 +1,870 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// setupTestDB points the panel at a fresh SQLite database in a temporary
+// directory, with the default roles and admin account
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	config = loadConfig()
+	config.BcryptCost = bcrypt.MinCost
+	config.DBDSN = filepath.Join(t.TempDir(), "webpanel.db")
+	if err := initDatabase(); err != nil {
+		t.Fatalf("initDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+}
+
+// createTestUser adds a panel user and returns its ID
+func createTestUser(t *testing.T, username, role string, permissions ...string) int {
+	t.Helper()
+
+	user, err := createWebpanelUser(username, username+"@example.net", "Correct-Horse-7", role, permissions, false)
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user.ID
+}
+
+// asUser makes an API request as if authMiddleware had accepted a token for the user
+func asUser(method, target, body string, userID int, username, role string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	ctx := context.WithValue(r.Context(), userIDKey, userID)
+	ctx = context.WithValue(ctx, usernameKey, username)
+	ctx = context.WithValue(ctx, roleKey, role)
+	return r.WithContext(ctx)
+}
+
+func TestSecretChannelsHiddenByName(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	config.HideSecretChans = true
+
+	viewer := createTestUser(t, "viewer1", "viewer")
+	admin := createTestUser(t, "admin1", "admin")
+	watcher := createTestUser(t, "watcher1", "custom", "channels.view", "channels.view_hidden")
+
+	// #opers is +s in the mock data; seeing it takes channels.view_hidden, not a role
+	for _, test := range []struct {
+		channel string
+		user    int
+		name    string
+		want    int
+	}{
+		{"#general", viewer, "viewer1", http.StatusOK},
+		{"#opers", viewer, "viewer1", http.StatusNotFound},
+		{"#OPERS", viewer, "viewer1", http.StatusNotFound},
+		{"#opers", admin, "admin1", http.StatusOK},
+		{"#opers", watcher, "watcher1", http.StatusOK},
+	} {
+		for route, handler := range map[string]http.HandlerFunc{
+			"users":        getChannelUsersHandler,
+			"snapshot":     getChannelSnapshotHandler,
+			"snapshots":    getChannelSnapshotsHandler,
+			"mode-history": getChannelModeHistoryHandler,
+		} {
+			r := mux.SetURLVars(asUser("GET", "/api/channels/x/"+route, "", test.user, test.name, "viewer"), map[string]string{"channel": test.channel})
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != test.want {
+				t.Errorf("%s %s as %s = %d, want %d", route, test.channel, test.name, w.Code, test.want)
+			}
+		}
+	}
+
+	// Valware is in #general and #opers
+	r := mux.SetURLVars(asUser("GET", "/api/users/Valware", "", viewer, "viewer1", "viewer"), map[string]string{"nick": "Valware"})
+	w := httptest.NewRecorder()
+	getUserWhoisHandler(w, r)
+	var whois UserWhois
+	if err := json.NewDecoder(w.Body).Decode(&whois); err != nil {
+		t.Fatalf("decode whois: %v", err)
+	}
+	if len(whois.Channels) != 1 || whois.Channels[0] != "#general" {
+		t.Errorf("whois channels = %v, want only #general", whois.Channels)
+	}
+}
+
+// fakeNoReply is a startFakeRPC result for methods that never get an answer
+type fakeNoReply struct{}
+
+// startFakeRPC points the panel at a WebSocket RPC server answering each
+// method with its entry in results, as an error when that is an
+// *rpc.RPCError, not at all when it is fakeNoReply, and "method not found"
+// otherwise
+func startFakeRPC(t *testing.T, results map[string]interface{}) {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req rpc.RPCRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if _, ok := results[req.Method].(fakeNoReply); ok {
+				continue
+			}
+			reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			if rpcErr, ok := results[req.Method].(*rpc.RPCError); ok {
+				reply["error"] = rpcErr
+			} else if result, ok := results[req.Method]; ok {
+				reply["result"] = result
+			} else {
+				reply["error"] = map[string]interface{}{"code": rpc.ErrCodeMethodNotFound, "message": "Method not found"}
+			}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := rpc.NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect to fake RPC: %v", err)
+	}
+	saved := rpcClient
+	rpcClient = client
+	config.UseMockData = false
+	t.Cleanup(func() {
+		client.Disconnect()
+		rpcClient = saved
+	})
+}
+
+// login posts credentials to loginHandler and decodes the response
+func login(t *testing.T, req LoginRequest) (int, LoginResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	loginHandler(w, httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(string(body))))
+
+	var resp LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode login response: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestSecurityStatsCountsUnknown(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"user.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"nick": "tls", "modes": []string{"i", "x"}, "tls": map[string]string{"cipher": "TLSv1.3"}},
+		{"nick": "modez", "modes": []string{"i", "z"}},
+		{"nick": "plain", "modes": []string{"i", "w"}},
+		{"nick": "bare"},
+		{"nick": "empty", "modes": []string{}},
+	}}})
+
+	w := httptest.NewRecorder()
+	getSecurityStatsHandler(w, httptest.NewRequest("GET", "/api/stats/security", nil))
+	var stats SecurityStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode security stats: %v", err)
+	}
+
+	want := SecurityStats{Secure: 2, Insecure: 1, Unknown: 2, Total: 5}
+	if stats != want {
+		t.Errorf("security stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestPartUserRequiresMembership(t *testing.T) {
+	alice := map[string]interface{}{"client": map[string]interface{}{"nick": "alice", "channels": []string{"#help"}}}
+	allMethods := map[string]interface{}{"user.get": alice, "user.part": map[string]interface{}{}}
+
+	tests := []struct {
+		name    string
+		results map[string]interface{} // nil uses the mock data
+		nick    string
+		channel string
+		want    int
+	}{
+		{"mock member", nil, "Guest0", "#help", http.StatusOK},
+		{"mock member, other case", nil, "guest0", "#HELP", http.StatusOK},
+		{"mock user not in channel", nil, "Guest0", "#opers", http.StatusNotFound},
+		{"mock unknown nick", nil, "nobody", "#general", http.StatusNotFound},
+		{"mock unknown channel", nil, "Valware", "#nowhere", http.StatusNotFound},
+		{"member", allMethods, "alice", "#help", http.StatusOK},
+		{"not in channel", allMethods, "alice", "#opers", http.StatusNotFound},
+		{"unknown nick", map[string]interface{}{
+			"user.get":  &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Nickname not found"},
+			"user.part": map[string]interface{}{},
+		}, "nobody", "#help", http.StatusNotFound},
+		{"server without user.part", map[string]interface{}{
+			"rpc.info": map[string]interface{}{"methods": map[string]interface{}{"user.get": map[string]string{"name": "user.get"}}},
+			"user.get": alice,
+		}, "alice", "#help", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.UseMockData = true
+			if tt.results != nil {
+				startFakeRPC(t, tt.results)
+				if _, ok := tt.results["rpc.info"]; ok {
+					if _, err := rpcClient.DetectCapabilities(context.Background()); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			adminID := createTestUser(t, "boss", "admin")
+
+			r := asUser("POST", "/api/users/"+tt.nick+"/part", `{"channel":"`+tt.channel+`"}`, adminID, "boss", "admin")
+			r = mux.SetURLVars(r, map[string]string{"nick": tt.nick})
+			w := httptest.NewRecorder()
+			partUserHandler(w, r)
+			if w.Code != tt.want {
+				t.Errorf("part %s from %s: status %d %s, want %d", tt.nick, tt.channel, w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveJWTSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		mock    bool
+		wantErr bool
+	}{
+		{"production without a secret", "", false, true},
+		{"production with the old default", defaultJWTSecret, false, true},
+		{"production with a secret", "a-production-secret-0123456789abcdef", false, false},
+		{"short secret is used with a warning", "short", false, false},
+		{"mock data without a secret", "", true, false},
+		{"mock data with the old default", defaultJWTSecret, true, false},
+	}
+	for _, tt := range tests {
+		secret, err := resolveJWTSecret(&Config{JWTSecret: tt.secret, UseMockData: tt.mock})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		switch {
+		case tt.secret != "" && tt.secret != defaultJWTSecret && string(secret) != tt.secret:
+			t.Errorf("%s: secret %q, want the configured one", tt.name, secret)
+		case (tt.secret == "" || tt.secret == defaultJWTSecret) && (len(secret) != 32 || string(secret) == defaultJWTSecret):
+			t.Errorf("%s: secret %q, want 32 random bytes", tt.name, secret)
+		}
+	}
+}
+
+func TestRPCMethodsListsAdvertisedMethods(t *testing.T) {
+	info := map[string]interface{}{"methods": map[string]interface{}{
+		"user.list":   map[string]string{"name": "user.list", "module": "rpc/user", "version": "1.0.6"},
+		"channel.get": map[string]string{"module": "rpc/channel"}, // Name filled in from the key
+		"rpc.info":    map[string]string{"name": "rpc.info"},
+	}}
+
+	tests := []struct {
+		name    string
+		mock    bool
+		detect  bool
+		want    int
+		methods []string
+	}{
+		{"mock data", true, false, http.StatusOK, []string{"channel.list", "log.send", "rpc.info", "stats.get", "user.list"}},
+		{"before detection", false, false, http.StatusServiceUnavailable, nil},
+		{"detected", false, true, http.StatusOK, []string{"channel.get", "rpc.info", "user.list"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.UseMockData = true
+			if !tt.mock {
+				startFakeRPC(t, map[string]interface{}{"rpc.info": info})
+				if tt.detect {
+					if _, err := rpcClient.DetectCapabilities(context.Background()); err != nil {
+						t.Fatalf("DetectCapabilities: %v", err)
+					}
+				}
+			}
+
+			w := httptest.NewRecorder()
+			getRPCMethodsHandler(w, httptest.NewRequest("GET", "/api/admin/rpc/methods", nil))
+			if w.Code != tt.want {
+				t.Fatalf("status %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var caps rpc.Capabilities
+			if err := json.NewDecoder(w.Body).Decode(&caps); err != nil {
+				t.Fatalf("decode methods: %v", err)
+			}
+			var names []string
+			for _, method := range caps.Methods {
+				names = append(names, method.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.methods, ",") || caps.DetectedAt.IsZero() {
+				t.Errorf("methods = %v detected at %v, want %v", names, caps.DetectedAt, tt.methods)
+			}
+		})
+	}
+}
+
+func TestEmptyListsEncodeAsArrays(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	startFakeRPC(t, map[string]interface{}{
+		"channel.get":  map[string]interface{}{"users": []map[string]interface{}{{"nick": "alice"}}},
+		"user.list":    map[string]interface{}{"list": nil},
+		"channel.list": map[string]interface{}{"list": nil},
+		"server.list":  map[string]interface{}{"list": nil},
+	})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request *http.Request
+		want    string
+	}{
+		{"member without modes", getChannelUsersHandler,
+			mux.SetURLVars(asUser("GET", "/api/channels/x/users", "", adminID, "boss", "admin"), map[string]string{"channel": "#help"}),
+			`"modes":[]`},
+		{"search without matches", searchHandler,
+			asUser("GET", "/api/search?q=nothing", "", adminID, "boss", "admin"),
+			`"results":[]`},
+		{"search without warnings", searchHandler,
+			asUser("GET", "/api/search?q=nothing", "", adminID, "boss", "admin"),
+			`"warnings":[]`},
+		{"role without permissions", createRoleHandler,
+			asUser("POST", "/api/roles", `{"name":"empty"}`, adminID, "boss", "admin"),
+			`"permissions":[]`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, tt.request)
+		if w.Code >= 300 {
+			t.Errorf("%s: status %d %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		if body := w.Body.String(); !strings.Contains(body, tt.want) || strings.Contains(body, "null") {
+			t.Errorf("%s: body %s, want %s and no null", tt.name, body, tt.want)
+		}
+	}
+}
+
+func TestSearchReturnsPartialResults(t *testing.T) {
+	users := map[string]interface{}{"list": []map[string]interface{}{{"nick": "helper"}}}
+	channels := map[string]interface{}{"list": []map[string]interface{}{{"name": "#help", "num_users": 1}}}
+	failure := &rpc.RPCError{Code: rpc.ErrCodeInternal, Message: "Internal error"}
+
+	tests := []struct {
+		name     string
+		results  map[string]interface{}
+		found    []string
+		warnings []string
+	}{
+		{"both succeed", map[string]interface{}{"user.list": users, "channel.list": channels}, []string{"helper", "#help"}, nil},
+		{"users fail", map[string]interface{}{"user.list": failure, "channel.list": channels}, []string{"#help"}, []string{"users"}},
+		{"channels fail", map[string]interface{}{"user.list": users, "channel.list": failure}, []string{"helper"}, []string{"channels"}},
+		{"both fail", map[string]interface{}{"user.list": failure, "channel.list": failure}, nil, []string{"users", "channels"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			startFakeRPC(t, tt.results)
+			adminID := createTestUser(t, "boss", "admin")
+
+			w := httptest.NewRecorder()
+			searchHandler(w, asUser("GET", "/api/search?q=help", "", adminID, "boss", "admin"))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d %s, want 200", w.Code, w.Body)
+			}
+			var resp SearchResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode search: %v", err)
+			}
+
+			var found, warnings []string
+			for _, result := range resp.Results {
+				found = append(found, result.Name)
+			}
+			for _, warning := range resp.Warnings {
+				warnings = append(warnings, warning.Category)
+			}
+			if strings.Join(found, ",") != strings.Join(tt.found, ",") || strings.Join(warnings, ",") != strings.Join(tt.warnings, ",") {
+				t.Errorf("results %v warnings %v, want %v and %v", found, warnings, tt.found, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestUnknownRoutesAnswerJSON(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r := mux.NewRouter()
+	r.NotFoundHandler = notFoundHandler(r)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
+	r.HandleFunc("/health", ok).Methods("GET", "OPTIONS")
+	api := r.PathPrefix("/api").Subrouter()
+	users := api.PathPrefix("/users").Subrouter()
+	users.HandleFunc("", ok).Methods("GET")
+	users.HandleFunc("/kill", ok).Methods("POST")
+	// A later subrouter with the same prefix, as the alert routes use
+	alerts := api.PathPrefix("/alerts").Subrouter()
+	alerts.HandleFunc("", ok).Methods("GET")
+	api.PathPrefix("/alerts").Subrouter().HandleFunc("/{id}/ack", ok).Methods("POST")
+
+	tests := []struct {
+		method, path string
+		want         int
+		allow        string
+	}{
+		{"GET", "/api/users", http.StatusOK, ""},
+		{"GET", "/api/nothing", http.StatusNotFound, ""},
+		{"GET", "/nothing", http.StatusNotFound, ""},
+		{"DELETE", "/api/users", http.StatusMethodNotAllowed, ""},
+		{"GET", "/api/users/kill", http.StatusMethodNotAllowed, "POST"},
+		{"GET", "/api/alerts/3/ack", http.StatusMethodNotAllowed, ""},
+		{"POST", "/health", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			continue
+		}
+		if tt.want == http.StatusOK {
+			continue
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["error"] == "" || body["path"] != tt.path {
+			t.Errorf("%s %s: body %v (%v), want a JSON error naming the path", tt.method, tt.path, body, err)
+		}
+		if allow := w.Header().Get("Allow"); tt.allow != "" && allow != tt.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+func TestCapSearchResults(t *testing.T) {
+	results := func(spec string) []SearchResult {
+		var list []SearchResult
+		for i, c := range spec {
+			kind := map[rune]string{'u': "user", 'c': "channel", 's': "server"}[c]
+			list = append(list, SearchResult{Type: kind, Name: strconv.Itoa(i)})
+		}
+		return list
+	}
+	kinds := func(list []SearchResult) string {
+		var out string
+		for _, result := range list {
+			out += result.Type[:1]
+		}
+		return out
+	}
+
+	tests := []struct {
+		spec      string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{"uuucc", 0, "uuucc", false}, // No limit
+		{"uuucc", 5, "uuucc", false},
+		{"uuucc", 10, "uuucc", false},
+		{"uuuuuuc", 3, "uuc", true}, // Users cannot crowd out the channel
+		{"uuuuccs", 3, "ucs", true},
+		{"ucucuc", 4, "ucuc", true},
+		{"uuuu", 2, "uu", true},
+	}
+	for _, tt := range tests {
+		got, truncated := capSearchResults(results(tt.spec), tt.max)
+		if kinds(got) != tt.want || truncated != tt.truncated {
+			t.Errorf("cap %s to %d = %s (truncated %t), want %s (truncated %t)", tt.spec, tt.max, kinds(got), truncated, tt.want, tt.truncated)
+		}
+		for i := 1; i < len(got); i++ {
+			a, _ := strconv.Atoi(got[i-1].Name)
+			b, _ := strconv.Atoi(got[i].Name)
+			if a >= b {
+				t.Errorf("cap %s to %d: results out of their original order", tt.spec, tt.max)
+			}
+		}
+	}
+}
+
+func TestSearchReportsTruncation(t *testing.T) {
+	setupTestDB(t)
+	users := []map[string]interface{}{}
+	for i := 0; i < 5; i++ {
+		users = append(users, map[string]interface{}{"nick": "help" + strconv.Itoa(i)})
+	}
+	startFakeRPC(t, map[string]interface{}{
+		"user.list":    map[string]interface{}{"list": users},
+		"channel.list": map[string]interface{}{"list": []map[string]interface{}{{"name": "#help"}}},
+	})
+	config.SearchMaxResults = 3
+	adminID := createTestUser(t, "boss", "admin")
+
+	w := httptest.NewRecorder()
+	searchHandler(w, asUser("GET", "/api/search?q=help", "", adminID, "boss", "admin"))
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode search: %v", err)
+	}
+	if !resp.Truncated || resp.Total != 3 || resp.TotalMatches != 6 || len(resp.Results) != 3 || resp.Results[2].Name != "#help" {
+		t.Errorf("search = %+v, want 3 of 6 matches including #help, truncated", resp)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		bind, port string
+		want       string
+		wantErr    bool
+	}{
+		{"", "8080", ":8080", false},
+		{"127.0.0.1", "8080", "127.0.0.1:8080", false},
+		{" 0.0.0.0 ", "80", "0.0.0.0:80", false},
+		{"::1", "8080", "[::1]:8080", false},
+		{"[::1]", "8080", "[::1]:8080", false},
+		{"localhost", "8080", "localhost:8080", false},
+		{"", "http", "", true},
+		{"", "0", "", true},
+		{"", "65536", "", true},
+		{"not a host!", "8080", "", true},
+	}
+	for _, tt := range tests {
+		got, err := listenAddress(tt.bind, tt.port)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("listenAddress(%q, %q) = %q, %v; want %q, error %t", tt.bind, tt.port, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestKillUser(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"user.kill": map[string]interface{}{}})
+	adminID := createTestUser(t, "boss", "admin")
+
+	tests := []struct {
+		body   string
+		want   int
+		field  string
+		reason string // Audited reason for a successful kill
+	}{
+		{`{"nick":"Spammer","reason":"Flooding"}`, http.StatusOK, "", "Flooding"},
+		{`{"nick":" Spammer2 "}`, http.StatusOK, "", "Disconnected by boss"},
+		{`{"nick":""}`, http.StatusBadRequest, "nick", ""},
+		{`{"nick":"a,b"}`, http.StatusBadRequest, "nick", ""},
+		{`{"nick":"a b"}`, http.StatusBadRequest, "nick", ""},
+		{`{"nick":"Spammer","reason":"` + strings.Repeat("x", maxKillReasonLength+1) + `"}`, http.StatusBadRequest, "reason", ""},
+		{`not json`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		killUserHandler(w, asUser("POST", "/api/users/kill", tt.body, adminID, "boss", "admin"))
+		if w.Code != tt.want {
+			t.Errorf("kill %.40s = %d %s, want %d", tt.body, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.field != "" {
+			var resp map[string]string
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp["field"] != tt.field {
+				t.Errorf("kill %.40s: body %v, want field %s", tt.body, resp, tt.field)
+			}
+		}
+	}
+
+	var reasons []string
+	rows, err := db.Query("SELECT details FROM audit_log WHERE action = 'kill' ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var details string
+		rows.Scan(&details)
+		var parsed map[string]string
+		json.Unmarshal([]byte(details), &parsed)
+		reasons = append(reasons, parsed["reason"])
+	}
+	if strings.Join(reasons, "|") != "Flooding|Disconnected by boss" {
+		t.Errorf("audited kill reasons = %q, want the given and the default one", reasons)
+	}
+}
+
+func TestKillUnknownUser(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"user.kill": &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Nickname not found"}})
+	adminID := createTestUser(t, "boss", "admin")
+
+	w := httptest.NewRecorder()
+	killUserHandler(w, asUser("POST", "/api/users/kill", `{"nick":"nobody"}`, adminID, "boss", "admin"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("kill of an unknown nick = %d %s, want 404", w.Code, w.Body)
+	}
+	if got := auditCount(t, "kill"); got != 0 {
+		t.Errorf("kill audit entries = %d, want none for a failed kill", got)
+	}
+}
+
+func TestAuthMiddlewareSetsTypedContextKeys(t *testing.T) {
+	setupTestDB(t)
+
+	tests := []struct {
+		name, role string
+	}{
+		{"ada", "admin"},
+		{"olly", "operator"},
+		{"vic", "viewer"},
+	}
+	for _, tt := range tests {
+		id := createTestUser(t, tt.name, tt.role)
+		_, resp := login(t, LoginRequest{Username: tt.name, Password: "Correct-Horse-7"})
+
+		var gotID int
+		var gotName, gotRole, gotSession string
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotID, gotName, gotRole = getUserFromContext(r)
+			gotSession, _ = r.Context().Value(sessionIDKey).(string)
+		})
+		if w := authed(handler, "GET", "/api/channels", resp.Token); w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d %s", tt.name, w.Code, w.Body)
+		}
+		if gotID != id || gotName != tt.name || gotRole != tt.role || gotSession == "" {
+			t.Errorf("%s: context holds (%d, %q, %q, session %q), want (%d, %q, %q, a session id)",
+				tt.name, gotID, gotName, gotRole, gotSession, id, tt.name, tt.role)
+		}
+	}
+
+	// Values stored under plain string keys are not picked up
+	r := httptest.NewRequest("GET", "/api/channels", nil)
+	ctx := context.WithValue(r.Context(), "user_id", 1)
+	ctx = context.WithValue(ctx, "username", "admin")
+	ctx = context.WithValue(ctx, "role", "admin")
+	if id, name, role := getUserFromContext(r.WithContext(ctx)); id != 0 || name != "" || role != "" {
+		t.Errorf("string keyed context = (%d, %q, %q), want empty", id, name, role)
+	}
+}
+
+func TestChannelsSortAndPage(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"channel.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"name": "#help", "num_users": 12, "modes": "nt"},
+		{"name": "#Dev", "num_users": 30, "modes": "nt"},
+		{"name": "#chat", "num_users": 12, "modes": "nt"},
+		{"name": "#alpha", "num_users": 3, "modes": "nt"},
+	}}})
+
+	tests := []struct {
+		query    string
+		status   int
+		channels string
+	}{
+		{"", http.StatusOK, "#alpha,#chat,#Dev,#help"},
+		{"?order=desc", http.StatusOK, "#help,#Dev,#chat,#alpha"},
+		{"?sort=users", http.StatusOK, "#Dev,#chat,#help,#alpha"},
+		{"?sort=users&order=asc", http.StatusOK, "#alpha,#chat,#help,#Dev"},
+		{"?sort=users&limit=2", http.StatusOK, "#Dev,#chat"},
+		{"?sort=users&limit=2&offset=2", http.StatusOK, "#help,#alpha"},
+		{"?offset=4", http.StatusOK, ""},
+		{"?sort=topic", http.StatusBadRequest, ""},
+		{"?order=up", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/channels"+tt.query, nil)
+		r.Header.Set("X-API-Version", "2")
+		w := httptest.NewRecorder()
+		getChannelsHandler(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d %s, want %d", tt.query, w.Code, w.Body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var list ChannelList
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		names := make([]string, len(list.Channels))
+		for i, channel := range list.Channels {
+			names[i] = channel.Name
+		}
+		if list.Total != 4 || strings.Join(names, ",") != tt.channels {
+			t.Errorf("%s: total %d, channels %v; want 4, %s", tt.query, list.Total, names, tt.channels)
+		}
+	}
+
+	// Version 1 clients get the sorted channels as a bare array
+	w := httptest.NewRecorder()
+	getChannelsHandler(w, httptest.NewRequest("GET", "/api/channels?sort=users&limit=1", nil))
+	var channels []Channel
+	if err := json.NewDecoder(w.Body).Decode(&channels); err != nil {
+		t.Fatalf("decode version 1 list: %v", err)
+	}
+	if len(channels) != 4 || channels[0].Name != "#Dev" {
+		t.Errorf("version 1 list = %+v, want all 4 channels, #Dev first", channels)
+	}
+}
+
+func TestParseModeString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ntCHP 50:30d", "+ntCHP 50:30d"},
+		{"+lk  10   secret", "+lk 10 secret"},
+		{"nt", "+nt"},
+		{"+nt", "+nt"},
+		{"  iwx ", "+iwx"},
+		{"+", ""},
+		{"", ""},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := parseModeString(tt.in); got != tt.want {
+			t.Errorf("parseModeString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// User modes arrive one letter per element and render as one string
+	for _, tt := range []struct {
+		modes []string
+		want  string
+	}{
+		{[]string{"i", "w", "x"}, "+iwx"},
+		{[]string{}, ""},
+		{nil, ""},
+	} {
+		if got := toAPIUser(rpc.UserInfo{Nick: "x", Modes: tt.modes}, false).Modes; got != tt.want {
+			t.Errorf("user modes %q = %q, want %q", tt.modes, got, tt.want)
+		}
+	}
+}
+
+func TestWSUpdateIntervalFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 30 * time.Second},
+		{"10s", 10 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"1s", minWSUpdateInterval},
+		{"-10s", 30 * time.Second},
+		{"often", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Setenv("WS_UPDATE_INTERVAL", tt.value)
+		if got := loadConfig().WSUpdateInterval; got != tt.want {
+			t.Errorf("WS_UPDATE_INTERVAL=%q: interval %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWhoisSecurityDetailsNeedPermission(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"user.get": map[string]interface{}{"client": map[string]interface{}{
+		"nick":           "Valware",
+		"account":        "Valware",
+		"tls":            map[string]string{"cipher": "TLSv1.3", "certfp": "3c1f5a9e"},
+		"sasl_mechanism": "EXTERNAL",
+	}}})
+
+	tests := []struct {
+		name     string
+		role     string
+		perms    []string
+		redacted bool
+	}{
+		{"boss", "admin", nil, false},
+		{"auditor", "custom", []string{"users.view", "users.view_security"}, false},
+		{"watcher", "custom", []string{"users.view"}, true},
+		{"viewer", "viewer", nil, true},
+	}
+	for _, tt := range tests {
+		id := createTestUser(t, tt.name, tt.role, tt.perms...)
+		r := mux.SetURLVars(asUser("GET", "/api/users/Valware/whois", "", id, tt.name, tt.role), map[string]string{"nick": "Valware"})
+		w := httptest.NewRecorder()
+		getUserWhoisHandler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d %s", tt.name, w.Code, w.Body)
+		}
+
+		var whois UserWhois
+		if err := json.NewDecoder(w.Body).Decode(&whois); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if whois.TLS == nil || whois.TLS.Cipher != "TLSv1.3" {
+			t.Errorf("%s: tls = %+v, want the cipher shown", tt.name, whois.TLS)
+			continue
+		}
+		shown := whois.TLS.CertFP == "3c1f5a9e" && whois.SASLMechanism == "EXTERNAL"
+		hidden := whois.TLS.CertFP == "" && whois.SASLMechanism == ""
+		if whois.SecurityRedacted != tt.redacted || (tt.redacted && !hidden) || (!tt.redacted && !shown) {
+			t.Errorf("%s: security_redacted %t, certfp %q, sasl %q; want redacted %t",
+				tt.name, whois.SecurityRedacted, whois.TLS.CertFP, whois.SASLMechanism, tt.redacted)
+		}
+	}
+}
+
+func TestValidateOrigins(t *testing.T) {
+	tests := []struct {
+		origin string
+		valid  bool
+	}{
+		{"https://panel.example.net", true},
+		{"http://localhost:5173", true},
+		{"http://[::1]:3000", true},
+		{allowAllOrigins, true},
+		{"localhost:3000", false},
+		{"ftp://panel.example.net", false},
+		{"https://", false},
+		{"https://panel.example.net/", false},
+		{"https://panel.example.net/app", false},
+		{"https://panel.example.net?x=1", false},
+		{"https://panel.example.net#top", false},
+		{"https://user@panel.example.net", false},
+		{"https://panel.example.net:0", false},
+		{"https://panel.example.net:70000", false},
+	}
+	for _, tt := range tests {
+		if err := validateOrigins([]string{tt.origin}); (err == nil) != tt.valid {
+			t.Errorf("validateOrigins(%q) = %v, want valid %t", tt.origin, err, tt.valid)
+		}
+	}
+
+	// One bad entry fails the whole list, as it does the self-test
+	config = loadConfig()
+	config.AllowedOrigins = append(append([]string{}, defaultAllowedOrigins...), "https://panel.example.net/")
+	if err := validateOrigins(config.AllowedOrigins); err == nil {
+		t.Error("validateOrigins accepted a list with a bad entry")
+	}
+	if check := selfTestConfig(); check.Status != selfTestFail || !strings.Contains(check.Detail, "ALLOWED_ORIGINS") {
+		t.Errorf("self-test config check = %+v, want a failure naming ALLOWED_ORIGINS", check)
+	}
+}
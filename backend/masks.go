@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// maskLookupWorkers bounds concurrent channel.get calls for one lookup
+const maskLookupWorkers = 4
+
+// banMask is a parsed nick!user@host ban mask. Missing parts match anything.
+type banMask struct {
+	nick string
+	host string
+	cidr *net.IPNet
+}
+
+// AffectedChannel is a channel with members matching a ban mask
+type AffectedChannel struct {
+	Channel string `json:"channel"`
+	Matches int    `json:"matches"`
+}
+
+// AffectedChannelsResponse lists the channels a ban mask would hit
+type AffectedChannelsResponse struct {
+	Mask         string            `json:"mask"`
+	MatchedUsers int               `json:"matchedUsers"`
+	Channels     []AffectedChannel `json:"channels"`
+}
+
+// parseBanMask accepts nick!user@host, user@host or a bare host/IP/CIDR
+func parseBanMask(mask string) banMask {
+	parsed := banMask{nick: "*", host: mask}
+	if at := strings.LastIndex(mask, "@"); at >= 0 {
+		parsed.host = mask[at+1:]
+		if bang := strings.Index(mask[:at], "!"); bang >= 0 {
+			parsed.nick = mask[:bang]
+		}
+	}
+	if parsed.host == "" {
+		parsed.host = "*"
+	}
+	if _, cidr, err := net.ParseCIDR(parsed.host); err == nil {
+		parsed.cidr = cidr
+	}
+	return parsed
+}
+
+// matches reports whether the mask covers a user. The ident is not part of the
+// RPC user info, so the user part of the mask is not checked.
+func (m banMask) matches(user rpc.UserInfo) bool {
+	if !matchMask(m.nick, user.Nick) {
+		return false
+	}
+	if m.cidr != nil {
+		ip := net.ParseIP(user.IP)
+		return ip != nil && m.cidr.Contains(ip)
+	}
+	for _, host := range []string{user.Hostname, user.IP, user.CloakedHost, user.VHost} {
+		if host != "" && matchMask(m.host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// getMockChannelMembers returns the nicks in each mock channel
+func getMockChannelMembers() map[string][]string {
+	return map[string][]string{
+		"#general": {"Guest0", "Valware"},
+		"#help":    {"Guest0"},
+		"#opers":   {"Valware"},
+	}
+}
+
+// channelMembers fetches the member nicks of each channel, a few channels at a time
+func channelMembers(ctx context.Context, channels []string) (map[string][]string, error) {
+	if config.UseMockData || rpcClient == nil {
+		return getMockChannelMembers(), nil
+	}
+
+	members := make(map[string][]string, len(channels))
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	queue := make(chan string)
+
+	for i := 0; i < maskLookupWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for channel := range queue {
+				users, err := rpcClient.GetChannelUsers(ctx, channel)
+				mutex.Lock()
+				if err == nil {
+					for _, user := range users {
+						members[channel] = append(members[channel], user.Nick)
+					}
+				} else if code, _ := rpc.ErrorCode(err); code != rpc.ErrCodeNotFound && firstErr == nil {
+					// A channel emptied since it was listed is skipped; anything else fails the lookup
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, channel := range channels {
+		queue <- channel
+	}
+	close(queue)
+	wg.Wait()
+
+	return members, firstErr
+}
+
+// getAffectedChannelsHandler lists channels whose members match a ban mask,
+// so operators can see the impact of a network ban before adding it
+func getAffectedChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	mask := strings.TrimSpace(r.URL.Query().Get("mask"))
+	if mask == "" {
+		http.Error(w, "Mask is required", http.StatusBadRequest)
+		return
+	}
+	parsed := parseBanMask(mask)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	var rpcUsers []rpc.UserInfo
+	var channels []Channel
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+		channels = getMockChannels()
+	} else {
+		var err error
+		if rpcUsers, err = rpcClient.GetUsers(ctx); err != nil {
+			log.Printf("RPC error getting users for mask lookup: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+		rpcChannels, err := rpcClient.GetChannels(ctx)
+		if err != nil {
+			log.Printf("RPC error getting channels for mask lookup: %v", err)
+			writeRPCError(w, err, "Failed to get channels")
+			return
+		}
+		for _, rpcChannel := range rpcChannels {
+			channels = append(channels, toAPIChannel(rpcChannel))
+		}
+	}
+
+	response := AffectedChannelsResponse{Mask: mask, Channels: []AffectedChannel{}}
+
+	matched := make(map[string]bool)
+	for _, user := range rpcUsers {
+		if parsed.matches(user) {
+			matched[strings.ToLower(user.Nick)] = true
+		}
+	}
+	response.MatchedUsers = len(matched)
+	if len(matched) == 0 {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	names := []string{}
+	for _, channel := range filterHiddenChannels(r, channels) {
+		names = append(names, channel.Name)
+	}
+
+	members, err := channelMembers(ctx, names)
+	if err != nil {
+		log.Printf("RPC error getting channel members for mask lookup: %v", err)
+		writeRPCError(w, err, "Failed to get channel members")
+		return
+	}
+
+	for _, name := range names {
+		count := 0
+		for _, nick := range members[name] {
+			if matched[strings.ToLower(nick)] {
+				count++
+			}
+		}
+		if count > 0 {
+			response.Channels = append(response.Channels, AffectedChannel{Channel: name, Matches: count})
+		}
+	}
+
+	sort.Slice(response.Channels, func(i, j int) bool {
+		if response.Channels[i].Matches != response.Channels[j].Matches {
+			return response.Channels[i].Matches > response.Channels[j].Matches
+		}
+		return response.Channels[i].Channel < response.Channels[j].Channel
+	})
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestBanMaskMatches(t *testing.T) {
+	user := rpc.UserInfo{Nick: "Valware", Hostname: "valware.uk", IP: "192.0.2.10", CloakedHost: "Clk-4E7B12AA"}
+
+	tests := []struct {
+		mask string
+		want bool
+	}{
+		{"*@valware.uk", true},
+		{"*!*@*.uk", true},
+		{"Val*!*@*", true},
+		{"Guest*!*@*", false},
+		{"192.0.2.10", true},
+		{"192.0.2.0/24", true},
+		{"198.51.100.0/24", false},
+		{"*@Clk-4E7B12AA", true},
+		{"*@*.example", false},
+		{"ident@valware.uk", true}, // The ident is not known, so it is not checked
+	}
+	for _, tt := range tests {
+		if got := parseBanMask(tt.mask).matches(user); got != tt.want {
+			t.Errorf("%s matches %s = %t, want %t", tt.mask, user.Nick, got, tt.want)
+		}
+	}
+}
+
+func TestAffectedChannels(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	config.HideSecretChans = true
+	viewerID := createTestUser(t, "viewer1", "viewer")
+	adminID := createTestUser(t, "admin1", "admin")
+
+	// In the mock data Guest0 is in #general and #help, Valware in #general and
+	// #opers, which is secret
+	tests := []struct {
+		name     string
+		mask     string
+		userID   int
+		username string
+		matched  int
+		channels []AffectedChannel
+	}{
+		{"both users", "*@*", adminID, "admin1", 2,
+			[]AffectedChannel{{"#general", 2}, {"#help", 1}, {"#opers", 1}}},
+		{"secret channel hidden", "*@*", viewerID, "viewer1", 2,
+			[]AffectedChannel{{"#general", 2}, {"#help", 1}}},
+		{"by CIDR", "192.0.2.0/24", adminID, "admin1", 1,
+			[]AffectedChannel{{"#general", 1}, {"#opers", 1}}},
+		{"no match", "*@*.example", adminID, "admin1", 0, []AffectedChannel{}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		getAffectedChannelsHandler(w, asUser("GET", "/api/masks/affected-channels?mask="+url.QueryEscape(tt.mask), "", tt.userID, tt.username, "viewer"))
+		var resp AffectedChannelsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if resp.MatchedUsers != tt.matched || !slices.Equal(resp.Channels, tt.channels) {
+			t.Errorf("%s: %d users in %v, want %d in %v", tt.name, resp.MatchedUsers, resp.Channels, tt.matched, tt.channels)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getAffectedChannelsHandler(w, asUser("GET", "/api/masks/affected-channels?mask=", "", adminID, "admin1", "admin"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty mask = %d, want 400", w.Code)
+	}
+}
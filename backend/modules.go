@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// ServerModules lists the modules loaded on one server
+type ServerModules struct {
+	Server     string       `json:"server"`
+	Modules    []rpc.Module `json:"modules"`
+	ThirdParty int          `json:"thirdParty"`
+}
+
+func getMockModules() []rpc.Module {
+	return []rpc.Module{
+		{Name: "rpc/rpc", Version: "6.1.0", Description: "RPC module for remote management", Author: "UnrealIRCd Team", Permanent: true},
+		{Name: "chanmodes/floodprot", Version: "6.1.0", Description: "Channel Mode +f", Author: "UnrealIRCd Team"},
+		{Name: "geoip_classic", Version: "6.1.0", Description: "GEOIP using classic databases", Author: "UnrealIRCd Team"},
+		{Name: "third/showwhois", Version: "2.0", Description: "Notifies opers of WHOIS requests", Author: "Valware", ThirdParty: true},
+		{Name: "third/nopmchannel", Version: "1.2", Description: "Blocks private messages between channel members", Author: "Valware", ThirdParty: true},
+		{Name: "third/wwwstats", Version: "2.1.3", Description: "Provides data for network stats", Author: "k4be", ThirdParty: true},
+	}
+}
+
+// countPlugins returns how many of the modules are third-party, the panel's plugin count
+func countPlugins(modules []rpc.Module) int {
+	count := 0
+	for _, module := range modules {
+		if module.ThirdParty {
+			count++
+		}
+	}
+	return count
+}
+
+// countLocalPlugins counts the third-party modules on the server the panel is connected to
+func countLocalPlugins(ctx context.Context) int {
+	modules, err := rpcClient.GetModules(ctx, "")
+	if err != nil {
+		log.Printf("⚠️ Failed to count plugins: %v", err)
+		return 0
+	}
+	return countPlugins(modules)
+}
+
+// getServerModulesHandler lists the modules loaded on a server
+func getServerModulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	server := mux.Vars(r)["server"]
+	if !isValidServerName(server) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return
+	}
+
+	var modules []rpc.Module
+	if config.UseMockData || rpcClient == nil {
+		known := false
+		for _, s := range getMockServerLinks() {
+			known = known || strings.EqualFold(s.Name, server)
+		}
+		if !known {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+		modules = getMockModules()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		modules, err = rpcClient.GetModules(ctx, server)
+		if err != nil {
+			// A timeout here usually means the server is linked but did not answer
+			log.Printf("RPC error getting modules of %s: %v", server, err)
+			writeRPCError(w, err, "Failed to get modules from "+server)
+			return
+		}
+	}
+
+	if modules == nil {
+		modules = []rpc.Module{}
+	}
+	json.NewEncoder(w).Encode(ServerModules{
+		Server:     server,
+		Modules:    modules,
+		ThirdParty: countPlugins(modules),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+// getModules calls getServerModulesHandler for server
+func getModules(server string) *httptest.ResponseRecorder {
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/api/servers/x/modules", nil), map[string]string{"server": server})
+	w := httptest.NewRecorder()
+	getServerModulesHandler(w, r)
+	return w
+}
+
+func TestServerModulesMock(t *testing.T) {
+	config = loadConfig()
+	config.UseMockData = true
+
+	tests := []struct {
+		server string
+		want   int
+	}{
+		{"irc.valware.uk", http.StatusOK},
+		{"IRC2.valware.uk", http.StatusOK},
+		{"irc.example.net", http.StatusNotFound},
+		{"irc.*", http.StatusBadRequest},
+		{"irc.valware.uk,irc2.valware.uk", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := getModules(tt.server)
+		if w.Code != tt.want {
+			t.Errorf("modules of %q: status %d %s, want %d", tt.server, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		var resp ServerModules
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.Server != tt.server || len(resp.Modules) != len(getMockModules()) || resp.ThirdParty != 3 {
+			t.Errorf("modules of %q = %s with %d modules, %d third-party; want all mock modules, 3 third-party",
+				tt.server, resp.Server, len(resp.Modules), resp.ThirdParty)
+		}
+	}
+}
+
+func TestServerModulesOverRPC(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     interface{}
+		want       int
+		modules    int
+		thirdParty int
+	}{
+		{"modules", map[string]interface{}{"list": []map[string]interface{}{
+			{"name": "rpc/rpc", "permanent": true},
+			{"name": "third/showwhois", "third_party": true},
+		}}, http.StatusOK, 2, 1},
+		{"no modules", map[string]interface{}{}, http.StatusOK, 0, 0},
+		{"server not linked", &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Server not found"}, http.StatusNotFound, 0, 0},
+	}
+	for _, tt := range tests {
+		setupTestDB(t)
+		startFakeRPC(t, map[string]interface{}{"server.module_list": tt.result})
+
+		w := getModules("leaf.example.net")
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+		var resp ServerModules
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if resp.Modules == nil || len(resp.Modules) != tt.modules || resp.ThirdParty != tt.thirdParty {
+			t.Errorf("%s: %+v, want %d modules, %d third-party", tt.name, resp, tt.modules, tt.thirdParty)
+		}
+		if got := countLocalPlugins(context.Background()); got != tt.thirdParty {
+			t.Errorf("%s: plugin count %d, want %d", tt.name, got, tt.thirdParty)
+		}
+	}
+}
+
+func TestPluginCountWithoutModuleList(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{})
+
+	if got := countLocalPlugins(context.Background()); got != 0 {
+		t.Errorf("plugin count without server.module_list = %d, want 0", got)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// maxNameBanLength bounds name ban masks; nicks and channels are far shorter
+const maxNameBanLength = 64
+
+// nickSpecialChars are the non-alphanumeric characters allowed in nicks
+const nickSpecialChars = "[]\\`_^{|}-"
+
+// NameBanRequest is the body accepted when adding a name ban
+type NameBanRequest struct {
+	Name     string `json:"name"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"` // e.g. "1d", empty for permanent
+}
+
+// mockNameBans stands in for the server's QLINEs in mock data mode
+var mockNameBans = struct {
+	sync.Mutex
+	list []rpc.NameBan
+}{list: []rpc.NameBan{
+	{Name: "*Serv", Reason: "Reserved for services", SetBy: "-config-", SetAt: "2024-01-01T00:00:00.000Z"},
+	{Name: "#warez*", Reason: "No piracy channels", SetBy: "admin", SetAt: "2024-06-01T10:00:00.000Z"},
+}}
+
+// validateNameBanMask checks that name is a nick mask such as "*Serv" or a
+// channel mask such as "#warez*", returning an error message when it is not.
+// Masks of only wildcards are refused, as they would forbid every name.
+func validateNameBanMask(name string) string {
+	if name == "" {
+		return "Name is required"
+	}
+	if len(name) > maxNameBanLength {
+		return "Name must be at most 64 characters"
+	}
+	if strings.Trim(name, "#*?") == "" {
+		return "Name must not match every nick or channel"
+	}
+
+	if strings.HasPrefix(name, "#") {
+		for _, c := range name {
+			if c <= ' ' || c == ',' || c == 0x7f {
+				return "Channel masks may not contain spaces, commas or control characters"
+			}
+		}
+		return ""
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '*' || c == '?':
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9', c == '-':
+			if i == 0 {
+				return "Nicks may not start with a digit or '-'"
+			}
+		case strings.ContainsRune(nickSpecialChars, c):
+		default:
+			return "'" + string(c) + "' is not allowed in a nick; channel masks start with #"
+		}
+	}
+	return ""
+}
+
+func getNameBansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		mockNameBans.Lock()
+		list := append([]rpc.NameBan{}, mockNameBans.list...)
+		mockNameBans.Unlock()
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	list, err := rpcClient.GetNameBans(ctx)
+	if err != nil {
+		log.Printf("RPC error getting name bans: %v", err)
+		writeRPCError(w, err, "Failed to get name bans")
+		return
+	}
+	if list == nil {
+		list = []rpc.NameBan{}
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func addNameBanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req NameBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if msg := validateNameBanMask(req.Name); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if req.Duration == "" {
+		req.Duration = "0"
+	}
+	duration, err := parseUnrealDuration(req.Duration)
+	if err != nil {
+		http.Error(w, "Duration must be an UnrealIRCd time string such as 30d or 1h", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "No reason"
+	}
+
+	details := map[string]string{"reason": req.Reason, "duration": req.Duration}
+
+	if config.UseMockData || rpcClient == nil {
+		now := time.Now().UTC()
+		ban := rpc.NameBan{
+			Name:   req.Name,
+			Reason: req.Reason,
+			SetBy:  actorName(r),
+			SetAt:  now.Format(time.RFC3339),
+		}
+		if duration > 0 {
+			ban.ExpireAt = now.Add(duration).Format(time.RFC3339)
+			ban.DurationString = req.Duration
+		}
+
+		mockNameBans.Lock()
+		for _, existing := range mockNameBans.list {
+			if strings.EqualFold(existing.Name, req.Name) {
+				mockNameBans.Unlock()
+				http.Error(w, "Name ban already exists", http.StatusConflict)
+				return
+			}
+		}
+		mockNameBans.list = append(mockNameBans.list, ban)
+		mockNameBans.Unlock()
+
+		recordAudit(r, "name_ban.add", req.Name, details)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ban)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = rpcClient.AddNameBan(ctx, req.Name, req.Reason, req.Duration)
+	if err != nil {
+		log.Printf("RPC error adding name ban: %v", err)
+		writeRPCError(w, err, "Failed to add name ban")
+		return
+	}
+
+	recordAudit(r, "name_ban.add", req.Name, details)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deleteNameBanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Channel masks start with '#', so names travel as a query parameter
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		mockNameBans.Lock()
+		found := false
+		for i, ban := range mockNameBans.list {
+			if strings.EqualFold(ban.Name, name) {
+				mockNameBans.list = append(mockNameBans.list[:i], mockNameBans.list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		mockNameBans.Unlock()
+
+		if !found {
+			http.Error(w, "Name ban not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(r, "name_ban.del", name, nil)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.DelNameBan(ctx, name)
+	if err != nil {
+		log.Printf("RPC error removing name ban: %v", err)
+		writeRPCError(w, err, "Failed to remove name ban")
+		return
+	}
+
+	recordAudit(r, "name_ban.del", name, nil)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestValidateNameBanMask(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"*Serv", true},
+		{"Guest????", true},
+		{"[Bot]`^{|}_-", true},
+		{"#warez*", true},
+		{"#café", true},
+		{"", false},
+		{"*", false},
+		{"#*", false},
+		{"??", false},
+		{"1nick", false},
+		{"-nick", false},
+		{"bad.nick", false},
+		{"bad nick", false},
+		{"#bad name", false},
+		{"#a,b", false},
+		{strings.Repeat("a", maxNameBanLength), true},
+		{strings.Repeat("a", maxNameBanLength+1), false},
+	}
+	for _, tt := range tests {
+		if msg := validateNameBanMask(tt.name); (msg == "") != tt.valid {
+			t.Errorf("validateNameBanMask(%q) = %q, want valid %t", tt.name, msg, tt.valid)
+		}
+	}
+}
+
+func TestNameBanAddAndRemove(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	mockNameBans.Lock()
+	saved := append([]rpc.NameBan{}, mockNameBans.list...)
+	mockNameBans.list = nil
+	mockNameBans.Unlock()
+	t.Cleanup(func() {
+		mockNameBans.Lock()
+		mockNameBans.list = saved
+		mockNameBans.Unlock()
+	})
+
+	steps := []struct {
+		method string
+		arg    string // Body for POST, name for DELETE
+		want   int
+	}{
+		{"POST", `{"name":" #casino* ","reason":"Gambling"}`, http.StatusCreated},
+		{"POST", `{"name":"#CASINO*"}`, http.StatusConflict},
+		{"POST", `{"name":"Guest*","duration":"1d"}`, http.StatusCreated},
+		{"POST", `{"name":"Spam*","duration":"forever"}`, http.StatusBadRequest},
+		{"POST", `{"name":"*"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"DELETE", "#Casino*", http.StatusOK},
+		{"DELETE", "#casino*", http.StatusNotFound},
+		{"DELETE", " ", http.StatusBadRequest},
+	}
+	for _, tt := range steps {
+		w := httptest.NewRecorder()
+		if tt.method == "POST" {
+			addNameBanHandler(w, asUser("POST", "/api/name-bans", tt.arg, adminID, "boss", "admin"))
+		} else {
+			deleteNameBanHandler(w, asUser("DELETE", "/api/name-bans?name="+url.QueryEscape(tt.arg), "", adminID, "boss", "admin"))
+		}
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.arg, w.Code, w.Body, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getNameBansHandler(w, httptest.NewRequest("GET", "/api/name-bans", nil))
+	var list []rpc.NameBan
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode name bans: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "Guest*" || list[0].SetBy != "boss" || list[0].ExpireAt == "" || list[0].DurationString != "1d" {
+		t.Errorf("name bans = %+v, want the day-long Guest* ban set by boss", list)
+	}
+
+	if got := auditCount(t, "name_ban.add"); got != 2 {
+		t.Errorf("name_ban.add audit entries = %d, want 2", got)
+	}
+	if got := auditCount(t, "name_ban.del"); got != 1 {
+		t.Errorf("name_ban.del audit entries = %d, want 1", got)
+	}
+}
+
+func TestNameBanErrorsOverRPC(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	startFakeRPC(t, map[string]interface{}{
+		"name_ban.list": map[string]interface{}{},
+		"name_ban.add":  &rpc.RPCError{Code: rpc.ErrCodeAlreadyExists, Message: "A ban with that name already exists"},
+		"name_ban.del":  &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Ban not found"},
+	})
+
+	tests := []struct {
+		name string
+		call func(w http.ResponseWriter)
+		want int
+	}{
+		{"list without bans", func(w http.ResponseWriter) {
+			getNameBansHandler(w, httptest.NewRequest("GET", "/api/name-bans", nil))
+		}, http.StatusOK},
+		{"add an existing ban", func(w http.ResponseWriter) {
+			addNameBanHandler(w, asUser("POST", "/api/name-bans", `{"name":"*Serv"}`, adminID, "boss", "admin"))
+		}, http.StatusConflict},
+		{"remove a missing ban", func(w http.ResponseWriter) {
+			deleteNameBanHandler(w, asUser("DELETE", "/api/name-bans?name=Nobody", "", adminID, "boss", "admin"))
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.call(w)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getNameBansHandler(w, httptest.NewRequest("GET", "/api/name-bans", nil))
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("empty list = %s, want []", body)
+	}
+	if got := auditCount(t, "name_ban.add") + auditCount(t, "name_ban.del"); got != 0 {
+		t.Errorf("audit entries for failed changes = %d, want none", got)
+	}
+}
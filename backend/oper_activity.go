@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Where an oper action came from: the panel's RPC connection or an oper on IRC
+const (
+	operSourcePanel = "panel"
+	operSourceIRC   = "irc"
+)
+
+// maxOperActivityEntries bounds the oper_activity table; older rows are dropped
+const maxOperActivityEntries = 10000
+
+const (
+	defaultOperActivityLimit = 50
+	maxOperActivityLimit     = 500
+)
+
+// OperActivity is an oper login or oper command seen on the network
+type OperActivity struct {
+	ID        int       `json:"id"`
+	Oper      string    `json:"oper"`   // Nick of the oper, or the RPC client for panel actions
+	Source    string    `json:"source"` // "panel" or "irc"
+	Subsystem string    `json:"subsystem"`
+	EventID   string    `json:"event_id"`
+	Target    string    `json:"target"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (o OperActivity) MarshalJSON() ([]byte, error) {
+	type plain OperActivity
+	return marshalWithLocalTimes(plain(o))
+}
+
+// OperActivityResponse is a page of oper activity
+type OperActivityResponse struct {
+	Entries []OperActivity `json:"entries"`
+	Total   int            `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+}
+
+// isOperActivity reports whether a streamed event is an oper action. Server
+// bans expiring on their own are not.
+func isOperActivity(event rpc.Event) bool {
+	for _, source := range rpc.OperActivitySources {
+		if event.Subsystem == source {
+			return !strings.HasSuffix(event.EventID, "_EXPIRE")
+		}
+	}
+	return false
+}
+
+// newOperActivity extracts who did what to whom from a streamed event
+func newOperActivity(event rpc.Event) OperActivity {
+	activity := OperActivity{
+		Subsystem: event.Subsystem,
+		EventID:   event.EventID,
+		Message:   event.Message,
+		CreatedAt: parseRPCTimestamp(event.Timestamp),
+	}
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+
+	switch {
+	case event.Client != nil:
+		activity.Oper = event.Client.Name
+	case event.TKL != nil:
+		// set_by is a nick!user@host mask or a server name
+		activity.Oper, _, _ = strings.Cut(event.TKL.SetBy, "!")
+	}
+
+	switch {
+	case event.Victim != nil:
+		activity.Target = event.Victim.Name
+	case event.Channel != nil:
+		activity.Target = event.Channel.Name
+	case event.TKL != nil:
+		activity.Target = strings.TrimSpace(event.TKL.Type + " " + event.TKL.Name)
+	}
+
+	activity.Source = operSourceIRC
+	if isPanelRPCClient(activity.Oper) {
+		activity.Source = operSourcePanel
+	}
+	return activity
+}
+
+// isPanelRPCClient reports whether a client name is an RPC connection, which
+// the server names "RPC:<rpc-user>", or the panel's own RPC user
+func isPanelRPCClient(name string) bool {
+	if len(name) >= 4 && strings.EqualFold(name[:4], "RPC:") {
+		return true
+	}
+	return config.UnrealRPCUsername != "" && strings.EqualFold(name, config.UnrealRPCUsername)
+}
+
+// recordOperActivity stores a streamed oper action, dropping the oldest rows
+// beyond maxOperActivityEntries
+func recordOperActivity(event rpc.Event) {
+	activity := newOperActivity(event)
+
+	var id int64
+	err := db.QueryRow(
+		"INSERT INTO oper_activity (oper, source, subsystem, event_id, target, message, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id",
+		activity.Oper, activity.Source, activity.Subsystem, activity.EventID, activity.Target, activity.Message, activity.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		log.Printf("⚠️ Failed to record oper activity %s by %s: %v", activity.EventID, activity.Oper, err)
+		return
+	}
+
+	if id > maxOperActivityEntries {
+		if _, err := db.Exec("DELETE FROM oper_activity WHERE id <= ?", id-maxOperActivityEntries); err != nil {
+			log.Printf("⚠️ Failed to prune oper activity: %v", err)
+		}
+	}
+}
+
+// getOperActivityHandler returns a page of network-wide oper activity, newest
+// first, optionally filtered by oper nick (comma-separated) and source
+func getOperActivityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	limit := parseBoundedInt(query.Get("limit"), defaultOperActivityLimit, 1, maxOperActivityLimit)
+	offset := parseBoundedInt(query.Get("offset"), 0, 0, -1)
+
+	var conditions []string
+	var args []interface{}
+	if opers := splitList(query.Get("oper")); len(opers) > 0 {
+		conditions = append(conditions, "LOWER(oper) IN (?"+strings.Repeat(", ?", len(opers)-1)+")")
+		for _, oper := range opers {
+			args = append(args, strings.ToLower(oper))
+		}
+	}
+	switch source := query.Get("source"); source {
+	case "":
+	case operSourcePanel, operSourceIRC:
+		conditions = append(conditions, "source = ?")
+		args = append(args, source)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "source must be panel or irc", "field": "source"})
+		return
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	response, err := queryOperActivity(where, args, limit, offset)
+	if err != nil {
+		log.Printf("Failed to load oper activity: %v", err)
+		http.Error(w, "Failed to load oper activity", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryOperActivity loads a page of oper activity, newest first. where is
+// either empty or a " WHERE ..." clause using args as its placeholders.
+func queryOperActivity(where string, args []interface{}, limit, offset int) (OperActivityResponse, error) {
+	response := OperActivityResponse{Entries: []OperActivity{}, Limit: limit, Offset: offset}
+	if err := db.QueryRow("SELECT COUNT(*) FROM oper_activity"+where, args...).Scan(&response.Total); err != nil {
+		return response, fmt.Errorf("failed to count oper activity: %w", err)
+	}
+
+	rows, err := db.Query(
+		"SELECT id, oper, source, subsystem, event_id, target, message, created_at FROM oper_activity"+where+
+			" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return response, fmt.Errorf("failed to query oper activity: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry OperActivity
+		if err := rows.Scan(&entry.ID, &entry.Oper, &entry.Source, &entry.Subsystem, &entry.EventID, &entry.Target, &entry.Message, &entry.CreatedAt); err != nil {
+			return response, fmt.Errorf("failed to scan oper activity: %w", err)
+		}
+		response.Entries = append(response.Entries, entry)
+	}
+	return response, rows.Err()
+}
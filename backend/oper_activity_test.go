@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestNewOperActivity(t *testing.T) {
+	setupTestDB(t)
+	config.UnrealRPCUsername = "adminpanel"
+
+	tests := []struct {
+		name    string
+		event   rpc.Event
+		oper    string
+		target  string
+		source  string
+		counted bool
+	}{
+		{"kill by an oper",
+			rpc.Event{Subsystem: "kill", EventID: "KILL_COMMAND", Client: &rpc.EventClient{Name: "Valware"}, Victim: &rpc.EventClient{Name: "Spammer"}},
+			"Valware", "Spammer", operSourceIRC, true},
+		{"samode from the panel",
+			rpc.Event{Subsystem: "samode", EventID: "SAMODE_COMMAND", Client: &rpc.EventClient{Name: "RPC:adminpanel"}, Channel: &rpc.EventChannel{Name: "#help"}},
+			"RPC:adminpanel", "#help", operSourcePanel, true},
+		{"gline by mask",
+			rpc.Event{Subsystem: "tkl", EventID: "TKL_ADD", TKL: &rpc.EventTKL{Type: "gline", Name: "*@192.0.2.1", SetBy: "Valware!val@valware.uk"}},
+			"Valware", "gline *@192.0.2.1", operSourceIRC, true},
+		{"gline by the panel's RPC user",
+			rpc.Event{Subsystem: "tkl", EventID: "TKL_ADD", TKL: &rpc.EventTKL{Type: "gline", Name: "*@192.0.2.2", SetBy: "adminpanel"}},
+			"adminpanel", "gline *@192.0.2.2", operSourcePanel, true},
+		{"expired ban", rpc.Event{Subsystem: "tkl", EventID: "TKL_EXPIRE"}, "", "", "", false},
+		{"not an oper action", rpc.Event{Subsystem: "join", EventID: "LOCAL_CLIENT_JOIN"}, "", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := isOperActivity(tt.event); got != tt.counted {
+			t.Errorf("%s: isOperActivity = %t, want %t", tt.name, got, tt.counted)
+		}
+		if !tt.counted {
+			continue
+		}
+		activity := newOperActivity(tt.event)
+		if activity.Oper != tt.oper || activity.Target != tt.target || activity.Source != tt.source || activity.CreatedAt.IsZero() {
+			t.Errorf("%s: %+v, want oper %q, target %q, source %s", tt.name, activity, tt.oper, tt.target, tt.source)
+		}
+	}
+}
+
+func TestOperActivityFilters(t *testing.T) {
+	setupTestDB(t)
+	config.UnrealRPCUsername = "adminpanel"
+
+	for _, event := range []rpc.Event{
+		{Subsystem: "oper", EventID: "OPER_SUCCESS", Client: &rpc.EventClient{Name: "Valware"}},
+		{Subsystem: "kill", EventID: "KILL_COMMAND", Client: &rpc.EventClient{Name: "Valware"}, Victim: &rpc.EventClient{Name: "a"}},
+		{Subsystem: "kill", EventID: "KILL_COMMAND", Client: &rpc.EventClient{Name: "RPC:adminpanel"}, Victim: &rpc.EventClient{Name: "b"}},
+		{Subsystem: "sajoin", EventID: "SAJOIN_COMMAND", Client: &rpc.EventClient{Name: "Other"}, Victim: &rpc.EventClient{Name: "c"}},
+	} {
+		recordOperActivity(event)
+	}
+
+	tests := []struct {
+		query   string
+		want    int
+		total   int
+		targets string // Newest first
+	}{
+		{"", http.StatusOK, 4, "c,b,a,"},
+		{"?oper=valware", http.StatusOK, 2, "a,"},
+		{"?oper=Valware,other", http.StatusOK, 3, "c,a,"},
+		{"?source=panel", http.StatusOK, 1, "b"},
+		{"?source=irc&oper=valware", http.StatusOK, 2, "a,"},
+		{"?limit=1&offset=1", http.StatusOK, 4, "b"},
+		{"?source=bot", http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		getOperActivityHandler(w, httptest.NewRequest("GET", "/api/opers/activity"+tt.query, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.query, w.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		var resp OperActivityResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		var targets []string
+		for _, entry := range resp.Entries {
+			targets = append(targets, entry.Target)
+		}
+		if resp.Total != tt.total || strings.Join(targets, ",") != tt.targets {
+			t.Errorf("%s: total %d, targets %q; want %d, %q", tt.query, resp.Total, targets, tt.total, tt.targets)
+		}
+	}
+}
@@ -0,0 +1,935 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the shortest password accepted when setting a new one
+const minPasswordLength = 8
+
+// tokenScopePasswordChange marks tokens issued to accounts that must change
+// their password; authMiddleware only lets them reach changePasswordPath and
+// passwordStrengthPath, so they can check a candidate before submitting it,
+// and logoutPath
+const (
+	tokenScopePasswordChange = "password_change"
+	changePasswordPath       = "/api/auth/change-password"
+	passwordStrengthPath     = "/api/auth/password-strength"
+	logoutPath               = "/api/auth/logout"
+)
+
+// UniqueConflictError reports that a field must be unique but is taken
+type UniqueConflictError struct {
+	Field string
+}
+
+func (e *UniqueConflictError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Field)
+}
+
+// uniqueConflict turns a UNIQUE constraint violation on one of fields into a
+// UniqueConflictError naming the column. Other errors are returned unchanged.
+func uniqueConflict(err error, fields ...string) error {
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "unique constraint") && !strings.Contains(msg, "duplicate key") {
+		return err
+	}
+
+	for _, field := range fields {
+		if strings.Contains(msg, field) {
+			return &UniqueConflictError{Field: field}
+		}
+	}
+	return err
+}
+
+// hashPassword hashes a panel password with the configured BCRYPT_COST
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+}
+
+// createWebpanelUser hashes the password and inserts a new panel user. With
+// mustChange set the user has to change the password on first login.
+func createWebpanelUser(username, email, password, role string, permissions []string, mustChange bool) (*WebpanelUser, error) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	rawPermissions, err := json.Marshal(emptyIfNil(permissions))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &WebpanelUser{
+		Username:    username,
+		Email:       email,
+		Role:        role,
+		Permissions: string(rawPermissions),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Active:      true,
+		MustChange:  mustChange,
+	}
+
+	err = db.QueryRow(`
+		INSERT INTO webpanel_users (username, email, password_hash, role, permissions, created_at, updated_at, active, must_change_password)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, user.Username, user.Email, string(hashedPassword), user.Role, user.Permissions, now, now, true, mustChange).Scan(&user.ID)
+	if err != nil {
+		return nil, uniqueConflict(err, "username", "email")
+	}
+
+	return user, nil
+}
+
+// panelUserColumns are the webpanel_users columns returned by the API; the
+// password hash is never selected
+const panelUserColumns = "id, username, email, role, permissions, created_at, updated_at, last_login, active, must_change_password, totp_enabled"
+
+func scanPanelUser(row alertScanner) (*WebpanelUser, error) {
+	var user WebpanelUser
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.Permissions,
+		&user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.Active, &user.MustChange, &user.TOTPEnabled)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// canManageAdmins reports whether the acting user may create, change or
+// delete admin accounts. panel.users alone is not enough, or any holder
+// could make themselves an admin.
+func canManageAdmins(r *http.Request) bool {
+	_, _, role := getUserFromContext(r)
+	return role == adminRole
+}
+
+// queryRower is a database or a transaction
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// otherActiveAdmins counts active admins other than the given user
+func otherActiveAdmins(q queryRower, userID int) (int, error) {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM webpanel_users WHERE role = ? AND active = TRUE AND id != ?", adminRole, userID).Scan(&count)
+	return count, err
+}
+
+// rolePermissions returns the permissions a role grants. Roles that no longer
+// exist grant none.
+func rolePermissions(q queryRower, role string) ([]string, error) {
+	if role == userRole {
+		return userRolePermissions, nil
+	}
+
+	var raw string
+	err := q.QueryRow("SELECT permissions FROM webpanel_roles WHERE name = ?", role).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []string
+	if err := json.Unmarshal([]byte(raw), &permissions); err != nil {
+		return nil, fmt.Errorf("invalid permissions for role %s: %w", role, err)
+	}
+	return permissions, nil
+}
+
+// grantError checks that the acting user may hand out permissions, directly
+// or through a role. "*" is reserved to admins, and anything else must be
+// held by the actor, or a panel.users holder could grant themselves more.
+// It returns the reason the grant is refused, or "".
+func grantError(r *http.Request, permissions []string) (string, error) {
+	userID, _, _ := getUserFromContext(r)
+	held, err := getUserPermissions(userID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, permission := range permissions {
+		if permission == "*" {
+			if !canManageAdmins(r) {
+				return "Only admins can grant all permissions", nil
+			}
+			continue
+		}
+		if !permissionGranted(held, permission) {
+			return "Cannot grant " + permission + ", which you do not hold", nil
+		}
+	}
+	return "", nil
+}
+
+// roleGrantError is grantError for the permissions of a role
+func roleGrantError(r *http.Request, q queryRower, role string) (string, error) {
+	permissions, err := rolePermissions(q, role)
+	if err != nil {
+		return "", err
+	}
+	return grantError(r, permissions)
+}
+
+// writeUserConflict answers 409 when err is a taken username or email, returning true if it did
+func writeUserConflict(w http.ResponseWriter, err error) bool {
+	conflict, ok := err.(*UniqueConflictError)
+	if !ok {
+		return false
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": fmt.Sprintf("A user with this %s already exists", conflict.Field),
+		"field": conflict.Field,
+	})
+	return true
+}
+
+// getPanelUsersHandler lists every panel account, including deactivated ones
+func getPanelUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "panel.users") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	rows, err := db.Query("SELECT " + panelUserColumns + " FROM webpanel_users ORDER BY id")
+	if err != nil {
+		log.Printf("❌ Failed to query panel users: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []*WebpanelUser{}
+	for rows.Next() {
+		user, err := scanPanelUser(rows)
+		if err != nil {
+			log.Printf("❌ Failed to scan panel user: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load users"})
+			return
+		}
+		users = append(users, user)
+	}
+
+	json.NewEncoder(w).Encode(users)
+}
+
+func createPanelUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "panel.users") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Username    string   `json:"username"`
+		Email       string   `json:"email"`
+		Password    string   `json:"password"`
+		Role        string   `json:"role"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Username == "" || req.Email == "" || req.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Username, email and password are required"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = userRole
+	}
+	if !isKnownRole(req.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown role", "field": "role"})
+		return
+	}
+	if req.Role == adminRole && !canManageAdmins(r) {
+		http.Error(w, "Only admins can create admin accounts", http.StatusForbidden)
+		return
+	}
+	if unknown := unknownPermission(req.Permissions); unknown != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown permission " + unknown, "field": "permissions"})
+		return
+	}
+	refusal, err := grantError(r, req.Permissions)
+	if err == nil && refusal == "" {
+		refusal, err = roleGrantError(r, db, req.Role)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check permissions granted to %s: %v", req.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+	if msg := passwordPolicyError(req.Password, req.Username); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": "password"})
+		return
+	}
+
+	// The admin chose this password, so the user must replace it on first login
+	user, err := createWebpanelUser(req.Username, req.Email, req.Password, req.Role, req.Permissions, true)
+	if err != nil {
+		if writeUserConflict(w, err) {
+			return
+		}
+
+		log.Printf("❌ Failed to create panel user %s: %v", req.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
+		return
+	}
+
+	recordAudit(r, "panel_user.create", user.Username, map[string]string{"role": user.Role})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// updatePanelUserHandler changes the fields present in the body. Changing the
+// role or deactivating the account logs the user out everywhere, since their
+// tokens carry the old role.
+func updatePanelUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "panel.users") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Username    *string   `json:"username"`
+		Email       *string   `json:"email"`
+		Role        *string   `json:"role"`
+		Permissions *[]string `json:"permissions"`
+		Active      *bool     `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("❌ Failed to update panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := scanPanelUser(tx.QueryRow("SELECT "+panelUserColumns+" FROM webpanel_users WHERE id = ?", userID))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+		return
+	}
+	wasAdmin := user.Role == adminRole && user.Active
+	oldRole, oldActive, oldPermissions := user.Role, user.Active, user.Permissions
+
+	if req.Username != nil {
+		if user.Username = strings.TrimSpace(*req.Username); user.Username == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Username cannot be empty", "field": "username"})
+			return
+		}
+	}
+	if req.Email != nil {
+		if user.Email = strings.TrimSpace(*req.Email); user.Email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Email cannot be empty", "field": "email"})
+			return
+		}
+	}
+	if req.Role != nil {
+		if user.Role = *req.Role; !isKnownRole(user.Role) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown role", "field": "role"})
+			return
+		}
+	}
+	if req.Permissions != nil {
+		if unknown := unknownPermission(*req.Permissions); unknown != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown permission " + unknown, "field": "permissions"})
+			return
+		}
+		raw, _ := json.Marshal(emptyIfNil(*req.Permissions))
+		user.Permissions = string(raw)
+	}
+	if req.Active != nil {
+		user.Active = *req.Active
+	}
+
+	if (oldRole == adminRole || user.Role == adminRole) && !canManageAdmins(r) {
+		http.Error(w, "Only admins can change admin accounts", http.StatusForbidden)
+		return
+	}
+
+	// Only what the update adds is checked, so an account holding permissions
+	// the actor lacks can still be edited otherwise
+	var added []string
+	if req.Permissions != nil {
+		var had []string
+		json.Unmarshal([]byte(oldPermissions), &had)
+		held := make(map[string]bool, len(had))
+		for _, permission := range had {
+			held[permission] = true
+		}
+		for _, permission := range *req.Permissions {
+			if !held[permission] {
+				added = append(added, permission)
+			}
+		}
+	}
+	refusal, err := grantError(r, added)
+	if err == nil && refusal == "" && user.Role != oldRole {
+		refusal, err = roleGrantError(r, tx, user.Role)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check permissions granted to %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+	if wasAdmin && (user.Role != adminRole || !user.Active) {
+		others, err := otherActiveAdmins(tx, userID)
+		if err != nil {
+			log.Printf("❌ Failed to count admins: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+			return
+		}
+		if others == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Cannot remove the last active admin"})
+			return
+		}
+	}
+
+	loggedOut := user.Role != oldRole || user.Active != oldActive
+	epochBump := 0
+	if loggedOut {
+		epochBump = 1
+	}
+	user, err = scanPanelUser(tx.QueryRow(`
+		UPDATE webpanel_users
+		SET username = ?, email = ?, role = ?, permissions = ?, active = ?, token_epoch = token_epoch + ?, updated_at = ?
+		WHERE id = ?
+		RETURNING `+panelUserColumns,
+		user.Username, user.Email, user.Role, user.Permissions, user.Active, epochBump, time.Now(), userID,
+	))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		if writeUserConflict(w, uniqueConflict(err, "username", "email")) {
+			return
+		}
+		log.Printf("❌ Failed to update panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+		return
+	}
+
+	if loggedOut {
+		if err := revokeUserSessions(userID); err != nil {
+			log.Printf("⚠️ Failed to revoke sessions for %s: %v", user.Username, err)
+		}
+	}
+
+	recordAudit(r, "panel_user.update", user.Username, map[string]interface{}{
+		"role":   user.Role,
+		"active": user.Active,
+	})
+	json.NewEncoder(w).Encode(user)
+}
+
+// deletePanelUserHandler removes a panel account, its sessions and its
+// channel moderator grants. The last active admin cannot be deleted.
+func deletePanelUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "panel.users") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("❌ Failed to delete panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := scanPanelUser(tx.QueryRow("SELECT "+panelUserColumns+" FROM webpanel_users WHERE id = ?", userID))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
+		return
+	}
+
+	if user.Role == adminRole {
+		if !canManageAdmins(r) {
+			http.Error(w, "Only admins can delete admin accounts", http.StatusForbidden)
+			return
+		}
+		others, err := otherActiveAdmins(tx, userID)
+		if err != nil {
+			log.Printf("❌ Failed to count admins: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
+			return
+		}
+		if others == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Cannot delete the last active admin"})
+			return
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM channel_moderators WHERE user_id = ?", userID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM temporary_grants WHERE user_id = ?", userID)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM webpanel_users WHERE id = ?", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("❌ Failed to delete panel user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
+		return
+	}
+	wsHub.endUserSessions(userID)
+
+	recordAudit(r, "panel_user.delete", user.Username, map[string]string{"role": user.Role})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxBulkRoleChanges caps the size of one bulk role request
+const maxBulkRoleChanges = 500
+
+// BulkRoleChange is one entry of a bulk role request
+type BulkRoleChange struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// BulkRoleResult reports what happened to one entry of a bulk role request.
+// Status is "updated", "unchanged", "failed", or "not_applied" for valid
+// entries of a batch that was rolled back because another entry failed.
+type BulkRoleResult struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role"`
+	OldRole  string `json:"old_role,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// applyRoleChange makes one change of a bulk role request inside tx, filling
+// in the result. Entries are applied in order, so the last-admin guard counts
+// the admins left by the entries before it.
+func applyRoleChange(r *http.Request, tx *panelTx, change BulkRoleChange, result *BulkRoleResult) error {
+	fail := func(msg string) error {
+		result.Status = "failed"
+		result.Error = msg
+		return nil
+	}
+
+	if !isKnownRole(change.Role) {
+		return fail("Unknown role")
+	}
+	user, err := scanPanelUser(tx.QueryRow("SELECT "+panelUserColumns+" FROM webpanel_users WHERE id = ?", change.UserID))
+	if err == sql.ErrNoRows {
+		return fail("User not found")
+	}
+	if err != nil {
+		return err
+	}
+	result.Username = user.Username
+	result.OldRole = user.Role
+
+	if user.Role == change.Role {
+		result.Status = "unchanged"
+		return nil
+	}
+	if (user.Role == adminRole || change.Role == adminRole) && !canManageAdmins(r) {
+		return fail("Only admins can change admin accounts")
+	}
+	refusal, err := roleGrantError(r, tx, change.Role)
+	if err != nil {
+		return err
+	}
+	if refusal != "" {
+		return fail(refusal)
+	}
+	if user.Role == adminRole && user.Active {
+		others, err := otherActiveAdmins(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if others == 0 {
+			return fail("Cannot remove the last active admin")
+		}
+	}
+
+	_, err = tx.Exec("UPDATE webpanel_users SET role = ?, token_epoch = token_epoch + 1, updated_at = ? WHERE id = ?",
+		change.Role, time.Now(), user.ID)
+	if err != nil {
+		return err
+	}
+	result.Status = "updated"
+	return nil
+}
+
+// bulkRolePanelUsersHandler reassigns the roles of several panel accounts in
+// one transaction. Either every entry is applied or none is; the response
+// lists each entry's outcome either way. Users whose role changed are logged
+// out everywhere, as with a single update.
+func bulkRolePanelUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !hasPermission(r, "panel.users") {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	var changes []BulkRoleChange
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if len(changes) == 0 || len(changes) > maxBulkRoleChanges {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Between 1 and %d role changes are required", maxBulkRoleChanges),
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("❌ Failed to start bulk role update: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update roles"})
+		return
+	}
+	defer tx.Rollback()
+
+	results := make([]BulkRoleResult, len(changes))
+	seen := map[int]bool{}
+	failed := 0
+	for i, change := range changes {
+		results[i] = BulkRoleResult{UserID: change.UserID, Role: change.Role}
+		if seen[change.UserID] {
+			results[i].Status = "failed"
+			results[i].Error = "User listed more than once"
+		} else if err := applyRoleChange(r, tx, change, &results[i]); err != nil {
+			log.Printf("❌ Failed to change role of panel user %d: %v", change.UserID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update roles"})
+			return
+		}
+		seen[change.UserID] = true
+		if results[i].Status == "failed" {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		for i := range results {
+			if results[i].Status != "failed" {
+				results[i].Status = "not_applied"
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("%d of %d role changes failed; nothing was applied", failed, len(changes)),
+			"results": results,
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("❌ Failed to commit bulk role update: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update roles"})
+		return
+	}
+
+	updated := 0
+	for _, result := range results {
+		if result.Status != "updated" {
+			continue
+		}
+		updated++
+		if err := revokeUserSessions(result.UserID); err != nil {
+			log.Printf("⚠️ Failed to revoke sessions for %s: %v", result.Username, err)
+		}
+		recordAudit(r, "panel_user.update", result.Username, map[string]interface{}{
+			"role":     result.Role,
+			"old_role": result.OldRole,
+			"bulk":     true,
+		})
+	}
+	log.Printf("👥 Bulk role update: %d of %d users changed", updated, len(changes))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"updated": updated,
+		"results": results,
+	})
+}
+
+// generatePassword returns a random URL-safe password
+func generatePassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// resetPanelUserPasswordHandler sets a new password for a panel user and
+// bumps their token epoch so every existing session is logged out
+func resetPanelUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	generated := req.Password == ""
+	if generated {
+		if req.Password, err = generatePassword(); err != nil {
+			log.Printf("❌ Failed to generate password: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to generate password"})
+			return
+		}
+	} else if msg := passwordPolicyError(req.Password, ""); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": "password"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		log.Printf("❌ Failed to hash password: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to reset password"})
+		return
+	}
+
+	var username string
+	err = db.QueryRow(`
+		UPDATE webpanel_users
+		SET password_hash = ?, must_change_password = TRUE, token_epoch = token_epoch + 1, updated_at = ?
+		WHERE id = ?
+		RETURNING username
+	`, string(hashedPassword), time.Now(), userID).Scan(&username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+			return
+		}
+		log.Printf("❌ Failed to reset password for user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("⚠️ Failed to revoke sessions for %s: %v", username, err)
+	}
+
+	log.Printf("🔑 Password reset for %s, existing sessions invalidated", username)
+	recordAudit(r, "panel_user.reset_password", username, map[string]bool{"generated": generated})
+
+	// The admin knows the new password, so the user must replace it
+	response := map[string]interface{}{
+		"status":               "success",
+		"must_change_password": true,
+	}
+	if generated {
+		// Returned only once; it is not stored in plain text
+		response["generated_password"] = req.Password
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// changePasswordHandler lets the logged-in user replace their password. It
+// clears the must-change flag, logs out other sessions and returns a new token.
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, username, _ := getUserFromContext(r)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if msg := passwordPolicyError(req.NewPassword, username); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": "new_password"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "New password must differ from the current one", "field": "new_password"})
+		return
+	}
+
+	_, passwordHash, err := loadWebpanelUser("id = ?", userID)
+	if err != nil {
+		log.Printf("❌ Failed to load user %d for password change: %v", userID, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Current password is incorrect", "field": "current_password"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("❌ Failed to hash password: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to change password"})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE webpanel_users
+		SET password_hash = ?, must_change_password = FALSE, token_epoch = token_epoch + 1, updated_at = ?
+		WHERE id = ?
+	`, string(hashedPassword), time.Now(), userID)
+	if err != nil {
+		log.Printf("❌ Failed to change password for user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to change password"})
+		return
+	}
+
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("⚠️ Failed to revoke sessions for user %d: %v", userID, err)
+	}
+
+	// Issue a full-access token for the new epoch
+	user, _, err := loadWebpanelUser("id = ?", userID)
+	if err == nil {
+		var token string
+		if token, err = issueSession(user, r); err == nil {
+			log.Printf("🔑 User %s changed their password", user.Username)
+			recordAudit(r, "panel_user.change_password", user.Username, nil)
+			json.NewEncoder(w).Encode(LoginResponse{Success: true, User: user, Token: token})
+			return
+		}
+	}
+
+	// The password did change; the client just has to log in again
+	log.Printf("⚠️ Password changed for user %d but a new session could not be issued: %v", userID, err)
+	json.NewEncoder(w).Encode(LoginResponse{Success: true})
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPanelUsersCannotGrantBeyondOwnPermissions(t *testing.T) {
+	setupTestDB(t)
+	managerID := createTestUser(t, "manager", "user", "panel.users", "users.view")
+	targetID := createTestUser(t, "target", "user")
+
+	create := func(body string) int {
+		w := httptest.NewRecorder()
+		createPanelUserHandler(w, asUser("POST", "/api/panel-users", body, managerID, "manager", "user"))
+		return w.Code
+	}
+	update := func(id int, body string) int {
+		r := asUser("PUT", "/api/panel-users/"+strconv.Itoa(id), body, managerID, "manager", "user")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(id)})
+		w := httptest.NewRecorder()
+		updatePanelUserHandler(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"create with *", create(`{"username":"a","email":"a@x","password":"Correct-Horse-7","permissions":["*"]}`), http.StatusForbidden},
+		{"create with unheld permission", create(`{"username":"b","email":"b@x","password":"Correct-Horse-7","permissions":["server.manage"]}`), http.StatusForbidden},
+		{"create with role exceeding own", create(`{"username":"c","email":"c@x","password":"Correct-Horse-7","role":"operator"}`), http.StatusForbidden},
+		{"create with held permission", create(`{"username":"d","email":"d@x","password":"Correct-Horse-7","permissions":["users.view"]}`), http.StatusCreated},
+		{"escalate self with *", update(managerID, `{"permissions":["panel.users","users.view","*"]}`), http.StatusForbidden},
+		{"escalate self with unheld", update(managerID, `{"permissions":["panel.users","users.view","bans.manage"]}`), http.StatusForbidden},
+		{"assign role exceeding own", update(targetID, `{"role":"operator"}`), http.StatusForbidden},
+		{"grant held permission", update(targetID, `{"permissions":["users.view"]}`), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestBulkRoleCannotAssignRolesBeyondOwnPermissions(t *testing.T) {
+	setupTestDB(t)
+	managerID := createTestUser(t, "manager", "user", "panel.users", "channels.view", "users.view", "server.view", "logs.view")
+	targetID := createTestUser(t, "target", "user")
+
+	bulk := func(role string) int {
+		body := `[{"user_id":` + strconv.Itoa(targetID) + `,"role":"` + role + `"}]`
+		w := httptest.NewRecorder()
+		bulkRolePanelUsersHandler(w, asUser("POST", "/api/panel-users/bulk-role", body, managerID, "manager", "user"))
+		return w.Code
+	}
+
+	if code := bulk("operator"); code != http.StatusBadRequest {
+		t.Errorf("assigning operator without server.manage: status %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := bulk("viewer"); code != http.StatusOK {
+		t.Errorf("assigning viewer with all its permissions held: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestMustChangePasswordRestrictsToken(t *testing.T) {
+	setupTestDB(t)
+	if _, err := createWebpanelUser("kim", "kim@example.net", "Correct-Horse-7", "viewer", nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	routes := http.NewServeMux()
+	routes.Handle("/api/channels", ok)
+	routes.Handle(passwordStrengthPath, ok)
+	routes.HandleFunc(changePasswordPath, changePasswordHandler)
+	handler := authMiddleware(routes)
+
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	code, resp := login(t, LoginRequest{Username: "kim", Password: "Correct-Horse-7"})
+	if code != http.StatusOK || !resp.MustChangePassword {
+		t.Fatalf("login = %d, must change %t; want 200 with the flag", code, resp.MustChangePassword)
+	}
+	restricted := resp.Token
+
+	if w := call("GET", "/api/channels", restricted, ""); w.Code != http.StatusForbidden {
+		t.Errorf("other route with restricted token = %d, want 403", w.Code)
+	}
+	if w := call("POST", passwordStrengthPath, restricted, ""); w.Code != http.StatusOK {
+		t.Errorf("password strength with restricted token = %d, want 200", w.Code)
+	}
+
+	w := call("POST", changePasswordPath, restricted, `{"current_password": "Correct-Horse-7", "new_password": "Another-Horse-8"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password = %d %s", w.Code, w.Body)
+	}
+	var changed LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&changed); err != nil || changed.Token == "" {
+		t.Fatalf("change password response without a token: %v", err)
+	}
+
+	if w := call("GET", "/api/channels", changed.Token, ""); w.Code != http.StatusOK {
+		t.Errorf("other route with the new token = %d, want 200", w.Code)
+	}
+	if w := call("POST", passwordStrengthPath, restricted, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("restricted token after the change = %d, want 401", w.Code)
+	}
+
+	code, resp = login(t, LoginRequest{Username: "kim", Password: "Another-Horse-8"})
+	if code != http.StatusOK || resp.MustChangePassword {
+		t.Errorf("login after the change = %d, must change %t; want 200 without the flag", code, resp.MustChangePassword)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	setupTestDB(t)
+	id := createTestUser(t, "lee", "viewer")
+
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		field   string
+		changed bool
+	}{
+		{"wrong current password", `{"current_password":"Wrong-Horse-7","new_password":"Another-Horse-8"}`, http.StatusBadRequest, "current_password", false},
+		{"new password too short", `{"current_password":"Correct-Horse-7","new_password":"Short-1"}`, http.StatusBadRequest, "new_password", false},
+		{"success", `{"current_password":"Correct-Horse-7","new_password":"Another-Horse-8"}`, http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		changePasswordHandler(w, asUser("POST", changePasswordPath, tt.body, id, "lee", "viewer"))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body)
+			continue
+		}
+
+		var resp map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: decode response: %v", tt.name, err)
+		}
+		if tt.field != "" && resp["field"] != tt.field {
+			t.Errorf("%s: error field %v, want %s", tt.name, resp["field"], tt.field)
+		}
+		if token, _ := resp["token"].(string); tt.changed && token == "" {
+			t.Errorf("%s: no new token in %v", tt.name, resp)
+		}
+
+		_, err := authenticateUser("lee", "Another-Horse-8")
+		if changed := err == nil; changed != tt.changed {
+			t.Errorf("%s: password changed = %t, want %t", tt.name, changed, tt.changed)
+		}
+	}
+}
+
+func TestDefaultAdminMustChangePassword(t *testing.T) {
+	setupTestDB(t)
+
+	code, resp := login(t, LoginRequest{Username: "admin", Password: "admin"})
+	if code != http.StatusOK || !resp.MustChangePassword {
+		t.Errorf("default admin login = %d, must change %t; want 200 with the flag", code, resp.MustChangePassword)
+	}
+}
+
+func TestPasswordResetForcesChange(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	targetID := createTestUser(t, "mia", "viewer")
+
+	for _, body := range []string{`{}`, `{"password":"Reset-Horse-9"}`} {
+		r := asUser("POST", "/api/panel-users/"+strconv.Itoa(targetID)+"/reset-password", body, adminID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(targetID)})
+		w := httptest.NewRecorder()
+		resetPanelUserPasswordHandler(w, r)
+
+		var resp struct {
+			MustChange bool   `json:"must_change_password"`
+			Generated  string `json:"generated_password"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("reset with %s: status %d, %v", body, w.Code, err)
+		}
+		if !resp.MustChange {
+			t.Errorf("reset with %s: must_change_password false in the response", body)
+		}
+
+		password := resp.Generated
+		if password == "" {
+			password = "Reset-Horse-9"
+		}
+		code, login := login(t, LoginRequest{Username: "mia", Password: password})
+		if code != http.StatusOK || !login.MustChangePassword {
+			t.Errorf("login after reset with %s = %d, must change %t; want 200 with the flag", body, code, login.MustChangePassword)
+		}
+	}
+}
+
+func TestBulkRoleRollsBackOnLastAdmin(t *testing.T) {
+	setupTestDB(t)
+	bossID := createTestUser(t, "boss", "admin")
+	mollyID := createTestUser(t, "molly", "viewer")
+	var defaultAdminID int
+	if err := db.QueryRow("SELECT id FROM webpanel_users WHERE username = 'admin'").Scan(&defaultAdminID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each entry is fine alone; demoting the second admin after the first
+	// would leave none, so the whole batch must be refused
+	body, _ := json.Marshal([]BulkRoleChange{
+		{UserID: mollyID, Role: "operator"},
+		{UserID: defaultAdminID, Role: "viewer"},
+		{UserID: bossID, Role: "viewer"},
+	})
+	w := httptest.NewRecorder()
+	bulkRolePanelUsersHandler(w, asUser("POST", "/api/panel-users/bulk-role", string(body), bossID, "boss", "admin"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bulk role: status %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+
+	var resp struct {
+		Results []BulkRoleResult `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"not_applied", "not_applied", "failed"}
+	for i, result := range resp.Results {
+		if result.Status != want[i] {
+			t.Errorf("entry %d: status %q (%s), want %q", i, result.Status, result.Error, want[i])
+		}
+	}
+	if len(resp.Results) != len(want) {
+		t.Errorf("%d results, want %d", len(resp.Results), len(want))
+	}
+
+	for id, role := range map[int]string{mollyID: "viewer", defaultAdminID: "admin", bossID: "admin"} {
+		var got string
+		var epoch int
+		if err := db.QueryRow("SELECT role, token_epoch FROM webpanel_users WHERE id = ?", id).Scan(&got, &epoch); err != nil {
+			t.Fatal(err)
+		}
+		if got != role || epoch != 0 {
+			t.Errorf("user %d after the refused batch: role %s, token epoch %d; want %s untouched", id, got, epoch, role)
+		}
+	}
+}
+
+func TestPanelUserCRUD(t *testing.T) {
+	setupTestDB(t)
+	bossID := createTestUser(t, "boss", "admin")
+	var defaultAdminID int
+	if err := db.QueryRow("SELECT id FROM webpanel_users WHERE username = 'admin'").Scan(&defaultAdminID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every response body is checked for password hashes
+	call := func(handler http.HandlerFunc, method string, id int, body string) int {
+		r := asUser(method, "/api/panel-users/"+strconv.Itoa(id), body, bossID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(id)})
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if text := w.Body.String(); strings.Contains(text, "password_hash") || strings.Contains(text, "$2a$") {
+			t.Errorf("%s %d response exposes a password hash: %s", method, id, text)
+		}
+		return w.Code
+	}
+	var newID int
+	tests := []struct {
+		name string
+		got  func() int
+		want int
+	}{
+		{"list", func() int { return call(getPanelUsersHandler, "GET", 0, "") }, http.StatusOK},
+		{"create", func() int {
+			code := call(createPanelUserHandler, "POST", 0, `{"username":"nina","email":"nina@example.net","password":"Correct-Horse-7","role":"viewer"}`)
+			db.QueryRow("SELECT id FROM webpanel_users WHERE username = 'nina'").Scan(&newID)
+			return code
+		}, http.StatusCreated},
+		{"create without password", func() int {
+			return call(createPanelUserHandler, "POST", 0, `{"username":"omar","email":"omar@example.net"}`)
+		}, http.StatusBadRequest},
+		{"create with unknown role", func() int {
+			return call(createPanelUserHandler, "POST", 0, `{"username":"omar","email":"omar@example.net","password":"Correct-Horse-7","role":"wizard"}`)
+		}, http.StatusBadRequest},
+		{"create with weak password", func() int {
+			return call(createPanelUserHandler, "POST", 0, `{"username":"omar","email":"omar@example.net","password":"short"}`)
+		}, http.StatusBadRequest},
+		{"update", func() int {
+			return call(updatePanelUserHandler, "PUT", newID, `{"email":"nina@example.org","role":"operator"}`)
+		}, http.StatusOK},
+		{"update missing user", func() int { return call(updatePanelUserHandler, "PUT", 9999, `{"role":"viewer"}`) }, http.StatusNotFound},
+		{"list after changes", func() int { return call(getPanelUsersHandler, "GET", 0, "") }, http.StatusOK},
+		{"delete", func() int { return call(deletePanelUserHandler, "DELETE", newID, "") }, http.StatusNoContent},
+		{"delete again", func() int { return call(deletePanelUserHandler, "DELETE", newID, "") }, http.StatusNotFound},
+
+		// Once the default admin is deactivated, boss is the last active admin
+		{"deactivate the other admin", func() int {
+			return call(updatePanelUserHandler, "PUT", defaultAdminID, `{"active":false}`)
+		}, http.StatusOK},
+		{"demote the last admin", func() int { return call(updatePanelUserHandler, "PUT", bossID, `{"role":"viewer"}`) }, http.StatusBadRequest},
+		{"deactivate the last admin", func() int { return call(updatePanelUserHandler, "PUT", bossID, `{"active":false}`) }, http.StatusBadRequest},
+		{"delete the last admin", func() int { return call(deletePanelUserHandler, "DELETE", bossID, "") }, http.StatusBadRequest},
+		{"delete the inactive admin", func() int { return call(deletePanelUserHandler, "DELETE", defaultAdminID, "") }, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	var role string
+	var active bool
+	if err := db.QueryRow("SELECT role, active FROM webpanel_users WHERE id = ?", bossID).Scan(&role, &active); err != nil || role != adminRole || !active {
+		t.Errorf("last admin after refused changes: role %s, active %v, %v; want an active admin", role, active, err)
+	}
+}
+
+func TestDuplicateUsernameOrEmailConflicts(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	createTestUser(t, "taken", "viewer")
+	otherID := createTestUser(t, "other", "viewer")
+
+	tests := []struct {
+		name  string
+		id    int // 0 creates
+		body  string
+		field string
+	}{
+		{"create with taken username", 0, `{"username":"taken","email":"new@example.net","password":"Correct-Horse-7"}`, "username"},
+		{"create with taken email", 0, `{"username":"new","email":"taken@example.net","password":"Correct-Horse-7"}`, "email"},
+		{"rename to taken username", otherID, `{"username":"taken"}`, "username"},
+		{"change to taken email", otherID, `{"email":"taken@example.net"}`, "email"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		if tt.id == 0 {
+			createPanelUserHandler(w, asUser("POST", "/api/panel-users", tt.body, adminID, "boss", "admin"))
+		} else {
+			r := asUser("PUT", "/api/panel-users/"+strconv.Itoa(tt.id), tt.body, adminID, "boss", "admin")
+			updatePanelUserHandler(w, mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(tt.id)}))
+		}
+
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusConflict || resp["field"] != tt.field {
+			t.Errorf("%s: status %d, field %q; want %d on %s", tt.name, w.Code, resp["field"], http.StatusConflict, tt.field)
+		}
+	}
+}
+
+func TestUniqueConflictMatchesDriverErrors(t *testing.T) {
+	tests := []struct {
+		err   string
+		field string // "" when the error is passed through
+	}{
+		{"UNIQUE constraint failed: webpanel_users.username", "username"},
+		{"UNIQUE constraint failed: webpanel_users.email", "email"},
+		{`pq: duplicate key value violates unique constraint "webpanel_users_email_key"`, "email"},
+		{`pq: duplicate key value violates unique constraint "webpanel_users_username_key"`, "username"},
+		{"NOT NULL constraint failed: webpanel_users.email", ""},
+		{"UNIQUE constraint failed: sessions.jti", ""},
+	}
+	for _, tt := range tests {
+		err := uniqueConflict(errors.New(tt.err), "username", "email")
+		conflict, ok := err.(*UniqueConflictError)
+		switch {
+		case tt.field == "" && ok:
+			t.Errorf("%q: reported as a conflict on %s", tt.err, conflict.Field)
+		case tt.field != "" && (!ok || conflict.Field != tt.field):
+			t.Errorf("%q: %v, want a conflict on %s", tt.err, err, tt.field)
+		}
+	}
+}
+
+func TestPasswordResetRejectsBadRequests(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	targetID := strconv.Itoa(createTestUser(t, "mia", "viewer"))
+	_, session := login(t, LoginRequest{Username: "mia", Password: "Correct-Horse-7"})
+
+	tests := []struct {
+		name  string
+		id    string
+		body  string
+		want  int
+		field string
+	}{
+		{"invalid id", "mia", `{}`, http.StatusBadRequest, ""},
+		{"unknown user", "9999", `{}`, http.StatusNotFound, ""},
+		{"invalid body", targetID, `not json`, http.StatusBadRequest, ""},
+		{"weak password", targetID, `{"password":"short"}`, http.StatusBadRequest, "password"},
+		{"reset", targetID, `{"password":"Reset-Horse-9"}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		r := asUser("POST", "/api/panel-users/"+tt.id+"/reset-password", tt.body, adminID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": tt.id})
+		w := httptest.NewRecorder()
+		resetPanelUserPasswordHandler(w, r)
+
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %v, want %d", tt.name, w.Code, resp, tt.want)
+		}
+		if field, _ := resp["field"].(string); field != tt.field {
+			t.Errorf("%s: field %q, want %q", tt.name, field, tt.field)
+		}
+	}
+
+	// Only the last reset went through: the old password and session stop working
+	if code, _ := login(t, LoginRequest{Username: "mia", Password: "Correct-Horse-7"}); code != http.StatusUnauthorized {
+		t.Errorf("login with the old password = %d, want 401", code)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if w := authed(ok, "GET", "/api/channels", session.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("request with a session from before the reset = %d, want 401", w.Code)
+	}
+	if got := auditCount(t, "panel_user.reset_password"); got != 1 {
+		t.Errorf("panel_user.reset_password audit entries = %d, want 1", got)
+	}
+}
+
+func TestBcryptCost(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", bcrypt.DefaultCost},
+		{"12", 12},
+		{"1", bcrypt.MinCost},
+		{"40", bcrypt.MaxCost},
+		{"strong", bcrypt.DefaultCost},
+	}
+	for _, tt := range tests {
+		t.Setenv("BCRYPT_COST", tt.value)
+		if got := loadConfig().BcryptCost; got != tt.want {
+			t.Errorf("BCRYPT_COST=%q: cost %d, want %d", tt.value, got, tt.want)
+		}
+	}
+
+	// Accounts created and passwords hashed later both use the configured cost
+	setupTestDB(t)
+	config.BcryptCost = bcrypt.MinCost + 1
+	createTestUser(t, "kate", "viewer")
+	var hash []byte
+	if err := db.QueryRow("SELECT password_hash FROM webpanel_users WHERE username = 'kate'").Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if cost, err := bcrypt.Cost(hash); err != nil || cost != config.BcryptCost {
+		t.Errorf("stored hash cost = %d (%v), want %d", cost, err, config.BcryptCost)
+	}
+	hash, err := hashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, _ := bcrypt.Cost(hash); cost != config.BcryptCost {
+		t.Errorf("hashPassword cost = %d, want %d", cost, config.BcryptCost)
+	}
+}
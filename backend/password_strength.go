@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// minPasswordScore is the lowest score accepted when a password is set
+const minPasswordScore = 2
+
+// Password strength labels by score: 0-1 weak, 2 medium, 3-4 strong
+const (
+	passwordWeak   = "weak"
+	passwordMedium = "medium"
+	passwordStrong = "strong"
+)
+
+// commonPasswords are widely used passwords rejected regardless of length
+// and character mix. Candidates are compared lowercased and with trailing
+// digits and symbols removed, so "Password123!" counts as "password".
+var commonPasswords = map[string]bool{
+	"123456": true, "12345678": true, "123456789": true, "1234567890": true, "password": true,
+	"passw0rd": true, "qwerty": true, "qwertyuiop": true, "asdfghjkl": true, "abc": true,
+	"abcdef": true, "abcdefgh": true, "iloveyou": true, "admin": true, "administrator": true,
+	"welcome": true, "letmein": true, "monkey": true, "dragon": true, "football": true,
+	"baseball": true, "master": true, "sunshine": true, "princess": true, "shadow": true,
+	"superman": true, "trustno": true, "starwars": true, "whatever": true, "changeme": true,
+	"secret": true, "default": true, "login": true, "root": true, "toor": true, "test": true,
+	"guest": true, "unrealircd": true, "unreal": true, "ircop": true, "irc": true, "opers": true,
+}
+
+// PasswordStrength is the assessment of a candidate password
+type PasswordStrength struct {
+	Score      int      `json:"score"` // 0 (weakest) to 4
+	Strength   string   `json:"strength"`
+	Acceptable bool     `json:"acceptable"` // Whether the password would be accepted when set
+	Feedback   []string `json:"feedback"`
+}
+
+// evaluatePassword scores a password on its length and character classes,
+// and rejects common passwords and ones containing the username
+func evaluatePassword(password, username string) PasswordStrength {
+	result := PasswordStrength{Feedback: []string{}}
+	length := len([]rune(password))
+
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, symbol} {
+		if has {
+			classes++
+		}
+	}
+
+	score := 0
+	switch {
+	case length >= 16:
+		score = 3
+	case length >= 12:
+		score = 2
+	case length >= minPasswordLength:
+		score = 1
+	}
+	if length < 12 {
+		result.Feedback = append(result.Feedback, "Use 12 or more characters")
+	}
+
+	switch {
+	case classes >= 3:
+		score++
+	case classes <= 1:
+		score--
+		result.Feedback = append(result.Feedback, "Mix upper and lower case letters, digits and symbols")
+	default:
+		result.Feedback = append(result.Feedback, "Add another kind of character, such as a digit or symbol")
+	}
+
+	if isRepetitive(password) {
+		score--
+		result.Feedback = append(result.Feedback, "Avoid repeated characters and sequences like 1234 or abcd")
+	}
+
+	lowered := strings.ToLower(password)
+	if username != "" && len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+		score = 0
+		result.Feedback = append([]string{"Do not include your username"}, result.Feedback...)
+	}
+	base := strings.TrimRightFunc(lowered, func(c rune) bool { return !unicode.IsLetter(c) })
+	if commonPasswords[lowered] || commonPasswords[base] {
+		score = 0
+		result.Feedback = append([]string{"This is a commonly used password"}, result.Feedback...)
+	}
+
+	// Too short is a hard limit whatever else the password has going for it.
+	// Hard failures go first so they are what a rejected password reports.
+	if length < minPasswordLength {
+		score = 0
+		result.Feedback = append([]string{fmt.Sprintf("Use at least %d characters", minPasswordLength)}, result.Feedback...)
+	}
+
+	result.Score = max(0, min(4, score))
+	switch {
+	case result.Score >= 3:
+		result.Strength = passwordStrong
+	case result.Score == 2:
+		result.Strength = passwordMedium
+	default:
+		result.Strength = passwordWeak
+	}
+	result.Acceptable = result.Score >= minPasswordScore
+	return result
+}
+
+// isRepetitive reports whether a password is one character repeated or a
+// single ascending/descending run, e.g. "aaaaaaaa" or "12345678"
+func isRepetitive(password string) bool {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) < 3 {
+		return false
+	}
+	same, up, down := true, true, true
+	for i := 1; i < len(runes); i++ {
+		same = same && runes[i] == runes[i-1]
+		up = up && runes[i] == runes[i-1]+1
+		down = down && runes[i] == runes[i-1]-1
+	}
+	return same || up || down
+}
+
+// passwordPolicyError returns why a password may not be set, or "" if it may
+func passwordPolicyError(password, username string) string {
+	strength := evaluatePassword(password, username)
+	if strength.Acceptable {
+		return ""
+	}
+	return "Password is too weak: " + strength.Feedback[0]
+}
+
+// passwordStrengthHandler scores a candidate password without storing it
+func passwordStrengthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var req struct {
+		Password string `json:"password"`
+		Username string `json:"username"` // Defaults to the logged-in user
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if req.Username == "" {
+		req.Username = actorName(r)
+	}
+
+	json.NewEncoder(w).Encode(evaluatePassword(req.Password, req.Username))
+}
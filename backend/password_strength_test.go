@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	setupTestDB(t)
+	userID := createTestUser(t, "kate", "viewer")
+
+	tests := []struct {
+		name     string
+		body     string
+		score    int
+		strength string
+		feedback string // First feedback entry; "" expects none
+	}{
+		{"strong", `{"password":"Correct-Horse-7"}`, 3, passwordStrong, ""},
+		{"long, one kind of character", `{"password":"correcthorsebatterystaple"}`, 2, passwordMedium, "Mix upper and lower case letters, digits and symbols"},
+		{"too short", `{"password":"Ab1!"}`, 0, passwordWeak, "Use at least 8 characters"},
+		{"common", `{"password":"password"}`, 0, passwordWeak, "This is a commonly used password"},
+		{"common with a suffix", `{"password":"Password123!"}`, 0, passwordWeak, "This is a commonly used password"},
+		{"sequence", `{"password":"abcdefghijklmnop"}`, 1, passwordWeak, "Mix upper and lower case letters, digits and symbols"},
+		{"logged-in username", `{"password":"Kate-Horse-71"}`, 0, passwordWeak, "Do not include your username"},
+		{"given username", `{"password":"Correct-Horse-7","username":"horse"}`, 0, passwordWeak, "Do not include your username"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		passwordStrengthHandler(w, asUser("POST", "/api/auth/password-strength", tt.body, userID, "kate", "viewer"))
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: response may be cached", tt.name)
+		}
+		var result PasswordStrength
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+
+		first := ""
+		if len(result.Feedback) > 0 {
+			first = result.Feedback[0]
+		}
+		if result.Score != tt.score || result.Strength != tt.strength || first != tt.feedback ||
+			result.Acceptable != (tt.score >= minPasswordScore) {
+			t.Errorf("%s: %+v, want score %d (%s) with feedback %q", tt.name, result, tt.score, tt.strength, tt.feedback)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	passwordStrengthHandler(w, asUser("POST", "/api/auth/password-strength", "not json", userID, "kate", "viewer"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// userRole is the built-in role of new panel accounts. It is not stored in
+// webpanel_roles and grants userRolePermissions.
+const userRole = "user"
+
+// userRolePermissions are the read-only permissions of the built-in user role
+var userRolePermissions = []string{"channels.view", "users.view", "server.view"}
+
+// dashboardPermissions open the dashboard routes (network stats, services,
+// alerts, link latency); holding any one of them is enough
+var dashboardPermissions = []string{"channels.view", "users.view", "server.view"}
+
+// errPermissionsQuery wraps database failures while resolving permissions, as
+// opposed to bad data on the account
+var errPermissionsQuery = errors.New("failed to load user permissions")
+
+// getUserPermissions resolves the effective permissions of a panel user from
+// the permissions stored on their account plus those granted by their role
+// and by unexpired temporary grants
+func getUserPermissions(userID int) ([]string, error) {
+	var raw, roleRaw sql.NullString
+	var role string
+
+	err := db.QueryRow(`
+		SELECT u.permissions, u.role, r.permissions
+		FROM webpanel_users u LEFT JOIN webpanel_roles r ON r.name = u.role
+		WHERE u.id = ?
+	`, userID).Scan(&raw, &role, &roleRaw)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unknown user %d", userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermissionsQuery, err)
+	}
+
+	var permissions []string
+	if raw.Valid && raw.String != "" {
+		if err := json.Unmarshal([]byte(raw.String), &permissions); err != nil {
+			return nil, fmt.Errorf("invalid permissions for user %d: %w", userID, err)
+		}
+	}
+
+	// Users whose role no longer exists keep only their own permissions
+	if roleRaw.Valid && roleRaw.String != "" {
+		var rolePermissions []string
+		if err := json.Unmarshal([]byte(roleRaw.String), &rolePermissions); err != nil {
+			return nil, fmt.Errorf("invalid role permissions for user %d: %w", userID, err)
+		}
+		permissions = append(permissions, rolePermissions...)
+	} else if role == userRole {
+		permissions = append(permissions, userRolePermissions...)
+	}
+
+	granted, err := activeGrantPermissions(userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermissionsQuery, err)
+	}
+	permissions = append(permissions, granted...)
+
+	return permissions, nil
+}
+
+// unknownPermission returns the first permission that is not a known permission ID, or ""
+func unknownPermission(permissions []string) string {
+	known := make(map[string]bool)
+	for _, permission := range getMockPermissions() {
+		known[permission.ID] = true
+	}
+	for _, permission := range permissions {
+		if !known[permission] {
+			return permission
+		}
+	}
+	return ""
+}
+
+// permissionGranted checks if a permission list contains the permission or the "*" wildcard
+func permissionGranted(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == "*" || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePermission middleware lets a request through only if the user's
+// permissions, their own plus their role's, include the permission or "*".
+// Unlike requireRole the admin role gets no special treatment; it passes
+// because it holds "*".
+func requirePermission(permission string) func(http.Handler) http.Handler {
+	return requireAnyPermission(permission)
+}
+
+// requireAnyPermission is requirePermission for routes open to holders of any
+// one of several permissions. If the database is down and the user's
+// permissions were not resolved recently, the request fails with 503 rather
+// than a 403 the user could take for a lost permission.
+func requireAnyPermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			held, err := requestPermissions(r)
+			if errors.Is(err, errDBUnavailable) {
+				http.Error(w, "Authentication temporarily unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			for _, permission := range permissions {
+				if err == nil && permissionGranted(held, permission) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		})
+	}
+}
+
+// requestPermissions resolves the permissions of a request's user through the
+// session guard, so that read requests keep working through a database outage
+func requestPermissions(r *http.Request) ([]string, error) {
+	userID, _, _ := getUserFromContext(r)
+	permissions, err := sessions.userPermissions(userID, r)
+	if err != nil {
+		log.Printf("⚠️ Failed to resolve permissions for user %d: %v", userID, err)
+	}
+	return permissions, err
+}
+
+// hasPermission checks if the authenticated user of a request holds a permission
+func hasPermission(r *http.Request, permission string) bool {
+	permissions, err := requestPermissions(r)
+	return err == nil && permissionGranted(permissions, permission)
+}
+
+// userHasPermission checks if a panel user holds a permission
+func userHasPermission(userID int, permission string) bool {
+	permissions, err := getUserPermissions(userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to resolve permissions for user %d: %v", userID, err)
+		return false
+	}
+
+	return permissionGranted(permissions, permission)
+}
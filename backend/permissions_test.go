@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPermissionGranted(t *testing.T) {
+	tests := []struct {
+		held       []string
+		permission string
+		want       bool
+	}{
+		{[]string{"*"}, "channels.moderate", true},
+		{[]string{"users.view", "*"}, "panel.users", true},
+		{[]string{"channels.moderate"}, "channels.moderate", true},
+		{[]string{"channels.view"}, "channels.moderate", false},
+		{[]string{"channels.moderate"}, "channels.view", false},
+		{[]string{"channels.*"}, "channels.view", false},
+		{[]string{"Channels.View"}, "channels.view", false},
+		{nil, "channels.view", false},
+	}
+	for _, tt := range tests {
+		if got := permissionGranted(tt.held, tt.permission); got != tt.want {
+			t.Errorf("permissionGranted(%v, %q) = %t, want %t", tt.held, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestUserPermissionsCombineOwnAndRole(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.Exec("INSERT INTO webpanel_roles (name, description, permissions, created_at, updated_at) VALUES ('auditor', '', '[\"logs.view\"]', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		role     string
+		own      []string
+		want     []string
+	}{
+		{"auditor1", "auditor", []string{"bans.manage"}, []string{"bans.manage", "logs.view"}},
+		{"plain1", userRole, nil, userRolePermissions},
+		// A role that no longer exists grants nothing
+		{"orphan1", "deleted-role", []string{"users.view"}, []string{"users.view"}},
+	}
+	for _, tt := range tests {
+		id := createTestUser(t, tt.username, tt.role, tt.own...)
+		got, err := getUserPermissions(id)
+		if err != nil {
+			t.Fatalf("getUserPermissions(%s): %v", tt.username, err)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("permissions of %s = %v, want %v", tt.username, got, want)
+		}
+	}
+}
+
+func TestRequirePermissionNeedsExactPermission(t *testing.T) {
+	setupTestDB(t)
+	viewer := createTestUser(t, "viewer1", "custom", "channels.view")
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for permission, want := range map[string]int{
+		"channels.view":     http.StatusOK,
+		"channels.moderate": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		requirePermission(permission)(ok).ServeHTTP(w, asUser("GET", "/api/channels", "", viewer, "viewer1", "custom"))
+		if w.Code != want {
+			t.Errorf("channels.view holder through %s gate: status %d, want %d", permission, w.Code, want)
+		}
+	}
+}
+
+func TestBanRoutesNeedBanPermissions(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	viewer := createTestUser(t, "watcher1", "custom", "bans.view")
+	manager := createTestUser(t, "manager1", "custom", "bans.manage")
+	other := createTestUser(t, "other1", "custom", "users.view", "channels.moderate")
+	admin := createTestUser(t, "admin1", "admin")
+
+	// The same gates main puts on the ban routes
+	r := mux.NewRouter()
+	view := r.PathPrefix("").Subrouter()
+	view.Use(requirePermission("bans.view"))
+	view.HandleFunc("/api/server-bans", getServerBansHandler).Methods("GET")
+	manage := r.PathPrefix("").Subrouter()
+	manage.Use(requirePermission("bans.manage"))
+	manage.HandleFunc("/api/server-bans", addServerBanHandler).Methods("POST")
+	manage.HandleFunc("/api/server-bans", deleteServerBanHandler).Methods("DELETE")
+
+	// Allowed changes carry invalid input, so they get 400 without changing anything
+	tests := []struct {
+		userID int
+		name   string
+		method string
+		want   int
+	}{
+		{viewer, "watcher1", "GET", http.StatusOK},
+		{viewer, "watcher1", "POST", http.StatusForbidden},
+		{viewer, "watcher1", "DELETE", http.StatusForbidden},
+		{manager, "manager1", "GET", http.StatusForbidden},
+		{manager, "manager1", "POST", http.StatusBadRequest},
+		{manager, "manager1", "DELETE", http.StatusBadRequest},
+		{other, "other1", "GET", http.StatusForbidden},
+		{other, "other1", "POST", http.StatusForbidden},
+		{admin, "admin1", "GET", http.StatusOK},
+		{admin, "admin1", "DELETE", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, asUser(tt.method, "/api/server-bans", `{}`, tt.userID, tt.name, "custom"))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.name, tt.method, w.Code, tt.want)
+		}
+	}
+}
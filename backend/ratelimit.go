@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateBucket is a token bucket refilled at limit tokens per minute
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// maxRateBuckets is how many buckets a limiter keeps before dropping idle ones
+const maxRateBuckets = 10000
+
+// rateLimiter keeps a token bucket per key: a panel user ID for the role
+// quotas in ROLE_RATE_LIMITS, a client IP for logins.
+type rateLimiter[K comparable] struct {
+	mutex   sync.Mutex
+	buckets map[K]*rateBucket
+}
+
+func newRateLimiter[K comparable]() *rateLimiter[K] {
+	return &rateLimiter[K]{buckets: make(map[K]*rateBucket)}
+}
+
+var apiLimiter = newRateLimiter[int]()
+
+// allow takes a token from key's bucket, which holds up to burst tokens and
+// refills at perMinute. When it is empty it returns how long until the next
+// token is available.
+func (l *rateLimiter[K]) allow(key K, perMinute, burst int, now time.Time) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	capacity := float64(burst)
+	rate := float64(perMinute) / time.Minute.Seconds()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.pruneFull(capacity, rate, now)
+		}
+		bucket = &rateBucket{tokens: capacity, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// pruneFull drops the buckets that have refilled completely, as a new bucket
+// would start out the same. The caller holds the mutex.
+func (l *rateLimiter[K]) pruneFull(capacity, rate float64, now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*rate >= capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// roleRateLimit returns the requests per minute allowed for a role, or 0 for unlimited
+func roleRateLimit(role string) int {
+	if containsFold(config.RateLimitExempt, role) {
+		return 0
+	}
+	return liveSettings.get().RoleRateLimits[role]
+}
+
+// rateLimitMiddleware limits authenticated requests per user according to their role
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _, role := getUserFromContext(r)
+		limit := roleRateLimit(role)
+		if limit == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wait, ok := apiLimiter.allow(userID, limit, limit, time.Now()); !ok {
+			writeRateLimited(w, wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+var loginLimiter = newRateLimiter[string]()
+
+// loginRateLimitMiddleware limits login attempts per client IP according to
+// LOGIN_RATE_LIMIT and LOGIN_RATE_BURST, before any password is checked.
+// Account lockout only guards single usernames; this slows down guessing
+// across many of them.
+func loginRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.LoginRateLimit == 0 || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if wait, ok := loginLimiter.allow(ip, config.LoginRateLimit, config.LoginRateBurst, time.Now()); !ok {
+			log.Printf("🚫 Login rate limit exceeded for %s", ip)
+			writeRateLimited(w, wait)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRateLimited answers 429 with the seconds until the next request is allowed
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsPerKey(t *testing.T) {
+	limiter := newRateLimiter[string]()
+	now := time.Unix(1700000000, 0)
+
+	// A burst of 3, refilled at 6 per minute: one token every 10 seconds
+	for i := 0; i < 3; i++ {
+		if _, ok := limiter.allow("192.0.2.1", 6, 3, now); !ok {
+			t.Fatalf("request %d within the burst refused", i+1)
+		}
+	}
+	wait, ok := limiter.allow("192.0.2.1", 6, 3, now)
+	if ok || wait != 10*time.Second {
+		t.Errorf("request past the burst: allowed = %t, wait %v, want refused with 10s", ok, wait)
+	}
+	if _, ok := limiter.allow("192.0.2.2", 6, 3, now); !ok {
+		t.Error("another key was limited by the first one's requests")
+	}
+
+	if _, ok := limiter.allow("192.0.2.1", 6, 3, now.Add(10*time.Second)); !ok {
+		t.Error("request after a refill interval refused")
+	}
+	if _, ok := limiter.allow("192.0.2.1", 6, 3, now.Add(10*time.Second)); ok {
+		t.Error("one refill interval allowed more than one request")
+	}
+}
+
+// loginFrom sends a login request through the login rate limit from an address
+func loginFrom(handler http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/auth/login", nil)
+	r.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestLoginRateLimitPerClientIP(t *testing.T) {
+	config = loadConfig()
+	config.LoginRateLimit = 2
+	config.LoginRateBurst = 2
+	previous := loginLimiter
+	loginLimiter = newRateLimiter[string]()
+	t.Cleanup(func() { loginLimiter = previous })
+
+	handler := loginRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		if w := loginFrom(handler, "192.0.2.1:1234", ""); w.Code != http.StatusOK {
+			t.Fatalf("login %d within the burst: status %d", i+1, w.Code)
+		}
+	}
+	w := loginFrom(handler, "192.0.2.1:5678", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login past the burst: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+
+	if w := loginFrom(handler, "198.51.100.7:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("login from another IP: status %d, want 200", w.Code)
+	}
+}
+
+func TestLoginRateLimitBehindTrustedProxy(t *testing.T) {
+	config = loadConfig()
+	config.LoginRateLimit = 1
+	config.LoginRateBurst = 1
+	previous, previousProxies := loginLimiter, trustedProxies
+	loginLimiter = newRateLimiter[string]()
+	trustedProxies, _ = parseTrustedProxies([]string{"10.0.0.1"})
+	t.Cleanup(func() { loginLimiter, trustedProxies = previous, previousProxies })
+
+	handler := loginRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Clients behind the proxy are limited separately
+	if w := loginFrom(handler, "10.0.0.1:1234", "192.0.2.1"); w.Code != http.StatusOK {
+		t.Fatalf("first client through the proxy: status %d", w.Code)
+	}
+	if w := loginFrom(handler, "10.0.0.1:1234", "192.0.2.2"); w.Code != http.StatusOK {
+		t.Errorf("second client through the proxy: status %d, want 200", w.Code)
+	}
+	if w := loginFrom(handler, "10.0.0.1:1234", "192.0.2.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("first client again: status %d, want 429", w.Code)
+	}
+
+	// Anyone else cannot escape the limit by making up X-Forwarded-For
+	if w := loginFrom(handler, "203.0.113.9:1234", "192.0.2.3"); w.Code != http.StatusOK {
+		t.Fatalf("first direct login: status %d", w.Code)
+	}
+	if w := loginFrom(handler, "203.0.113.9:1234", "192.0.2.4"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("direct login with a new X-Forwarded-For: status %d, want 429", w.Code)
+	}
+}
+
+func TestRoleRateLimits(t *testing.T) {
+	setupTestDB(t)
+	config.RateLimitExempt = []string{"admin"}
+	settings := liveSettings.get()
+	settings.RoleRateLimits = map[string]int{"viewer": 2, "operator": 0, "admin": 1}
+	liveSettings.set(settings)
+	previous := apiLimiter
+	apiLimiter = newRateLimiter[int]()
+	t.Cleanup(func() { apiLimiter = previous })
+
+	handler := rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name    string
+		userID  int
+		role    string
+		allowed int // Of five requests; 5 means unlimited
+	}{
+		{"limited role", 1, "viewer", 2},
+		{"same role, another user", 2, "viewer", 2},
+		{"zero is unlimited", 3, "operator", 5},
+		{"role without a limit", 4, "custom", 5},
+		{"exempt role", 5, "admin", 5},
+	}
+	for _, tt := range tests {
+		allowed := 0
+		for i := 0; i < 5; i++ {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, asUser("GET", "/api/channels", "", tt.userID, "user", tt.role))
+			switch w.Code {
+			case http.StatusOK:
+				allowed++
+			case http.StatusTooManyRequests:
+				if w.Header().Get("Retry-After") == "" {
+					t.Errorf("%s: 429 without Retry-After", tt.name)
+				}
+			default:
+				t.Errorf("%s: status %d", tt.name, w.Code)
+			}
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d of 5 requests allowed, want %d", tt.name, allowed, tt.allowed)
+		}
+	}
+}
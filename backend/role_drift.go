@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Why a mapping in OPER_CLASS_ROLES is reported as orphaned
+const (
+	driftUnknownRole  = "unknown_role"   // The panel has no role of that name
+	driftClassOffline = "class_not_seen" // No online oper has the class
+)
+
+// UnmappedOperClass is an oper class in use on the network that OPER_CLASS_ROLES does not map
+type UnmappedOperClass struct {
+	Class string   `json:"class"`
+	Opers []string `json:"opers"` // Online opers with the class
+}
+
+// OrphanedRoleMapping is an OPER_CLASS_ROLES entry that does not match the
+// network or the panel
+type OrphanedRoleMapping struct {
+	Class  string `json:"class"`
+	Role   string `json:"role"`
+	Reason string `json:"reason"` // unknown_role or class_not_seen
+}
+
+// RoleDriftReport compares the oper classes of online opers with
+// OPER_CLASS_ROLES. The server only reports the classes of opers who are
+// online, so class_not_seen may just mean no oper of the class is connected.
+type RoleDriftReport struct {
+	Mapped           int                   `json:"mapped"` // Classes in use that map to a known role
+	UnmappedClasses  []UnmappedOperClass   `json:"unmapped_classes"`
+	OrphanedMappings []OrphanedRoleMapping `json:"orphaned_mappings"`
+}
+
+// operClassMembers groups online opers by oper class. Opers whose class the
+// server did not report are left out.
+func operClassMembers(users []rpc.UserInfo) map[string][]string {
+	classes := make(map[string][]string)
+	for _, user := range users {
+		if !user.IsOper || user.OperClass == "" {
+			continue
+		}
+		classes[user.OperClass] = append(classes[user.OperClass], user.Nick)
+	}
+	return classes
+}
+
+// buildRoleDrift reports oper classes without a mapping and mappings whose
+// class is not in use or whose role does not exist. Class names are compared
+// case-insensitively, as the server does.
+func buildRoleDrift(mapping map[string]string, classes map[string][]string, knownRole func(string) bool) RoleDriftReport {
+	report := RoleDriftReport{UnmappedClasses: []UnmappedOperClass{}, OrphanedMappings: []OrphanedRoleMapping{}}
+
+	mapped := make(map[string]string, len(mapping))
+	for class, role := range mapping {
+		mapped[strings.ToLower(class)] = role
+	}
+	online := make(map[string]bool, len(classes))
+	for class, opers := range classes {
+		online[strings.ToLower(class)] = true
+		role, ok := mapped[strings.ToLower(class)]
+		switch {
+		case !ok:
+			sorted := append([]string{}, opers...)
+			sort.Strings(sorted)
+			report.UnmappedClasses = append(report.UnmappedClasses, UnmappedOperClass{Class: class, Opers: sorted})
+		case knownRole(role):
+			report.Mapped++
+		}
+	}
+
+	for class, role := range mapping {
+		switch {
+		case !knownRole(role):
+			report.OrphanedMappings = append(report.OrphanedMappings, OrphanedRoleMapping{Class: class, Role: role, Reason: driftUnknownRole})
+		case !online[strings.ToLower(class)]:
+			report.OrphanedMappings = append(report.OrphanedMappings, OrphanedRoleMapping{Class: class, Role: role, Reason: driftClassOffline})
+		}
+	}
+
+	sort.Slice(report.UnmappedClasses, func(i, j int) bool {
+		return report.UnmappedClasses[i].Class < report.UnmappedClasses[j].Class
+	})
+	sort.Slice(report.OrphanedMappings, func(i, j int) bool {
+		return report.OrphanedMappings[i].Class < report.OrphanedMappings[j].Class
+	})
+	return report
+}
+
+// getRoleDriftHandler reports drift between the oper classes on the network
+// and the panel roles OPER_CLASS_ROLES maps them to
+func getRoleDriftHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var users []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		users = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		users, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting users for role drift: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(buildRoleDrift(config.OperClassRoles, operClassMembers(users), isKnownRole))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBuildRoleDrift(t *testing.T) {
+	knownRole := func(role string) bool { return role == "admin" || role == "viewer" }
+
+	tests := []struct {
+		name     string
+		mapping  map[string]string
+		classes  map[string][]string
+		mapped   int
+		unmapped []UnmappedOperClass
+		orphaned []OrphanedRoleMapping
+	}{
+		{
+			name:     "nothing configured or online",
+			unmapped: []UnmappedOperClass{},
+			orphaned: []OrphanedRoleMapping{},
+		},
+		{
+			name:     "every class mapped, compared case-insensitively",
+			mapping:  map[string]string{"NetAdmin": "admin", "helpop": "viewer"},
+			classes:  map[string][]string{"netadmin": {"Valware"}, "HelpOp": {"b", "a"}},
+			mapped:   2,
+			unmapped: []UnmappedOperClass{},
+			orphaned: []OrphanedRoleMapping{},
+		},
+		{
+			name:     "class in use without a mapping",
+			mapping:  map[string]string{"netadmin": "admin"},
+			classes:  map[string][]string{"netadmin": {"Valware"}, "locop": {"zed", "amy"}},
+			mapped:   1,
+			unmapped: []UnmappedOperClass{{Class: "locop", Opers: []string{"amy", "zed"}}},
+			orphaned: []OrphanedRoleMapping{},
+		},
+		{
+			name:     "mappings to a missing role or an unseen class",
+			mapping:  map[string]string{"netadmin": "root", "services": "admin"},
+			classes:  map[string][]string{"netadmin": {"Valware"}},
+			unmapped: []UnmappedOperClass{},
+			orphaned: []OrphanedRoleMapping{
+				{Class: "netadmin", Role: "root", Reason: driftUnknownRole},
+				{Class: "services", Role: "admin", Reason: driftClassOffline},
+			},
+		},
+	}
+	for _, tt := range tests {
+		report := buildRoleDrift(tt.mapping, tt.classes, knownRole)
+		if report.Mapped != tt.mapped {
+			t.Errorf("%s: mapped = %d, want %d", tt.name, report.Mapped, tt.mapped)
+		}
+		if !reflect.DeepEqual(report.UnmappedClasses, tt.unmapped) {
+			t.Errorf("%s: unmapped = %+v, want %+v", tt.name, report.UnmappedClasses, tt.unmapped)
+		}
+		if !reflect.DeepEqual(report.OrphanedMappings, tt.orphaned) {
+			t.Errorf("%s: orphaned = %+v, want %+v", tt.name, report.OrphanedMappings, tt.orphaned)
+		}
+	}
+}
+
+func TestRoleDriftHandler(t *testing.T) {
+	setupTestDB(t)
+	config.OperClassRoles = map[string]string{"netadmin": "admin", "services": "admin"}
+	startFakeRPC(t, map[string]interface{}{"user.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"nick": "Valware", "is_oper": true, "oper_class": "netadmin"},
+		{"nick": "helper", "is_oper": true, "oper_class": "locop"},
+		{"nick": "hidden", "is_oper": true},
+		{"nick": "user", "oper_class": "locop"},
+	}}})
+
+	w := httptest.NewRecorder()
+	getRoleDriftHandler(w, httptest.NewRequest("GET", "/api/admin/role-drift", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	var report RoleDriftReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	wantUnmapped := []UnmappedOperClass{{Class: "locop", Opers: []string{"helper"}}}
+	wantOrphaned := []OrphanedRoleMapping{{Class: "services", Role: "admin", Reason: driftClassOffline}}
+	if report.Mapped != 1 || !reflect.DeepEqual(report.UnmappedClasses, wantUnmapped) || !reflect.DeepEqual(report.OrphanedMappings, wantOrphaned) {
+		t.Errorf("report = %+v, want 1 mapped, %+v unmapped and %+v orphaned", report, wantUnmapped, wantOrphaned)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// adminRole is the built-in role with access to everything. It cannot be
+// renamed or deleted, since requireRole grants it every route by name.
+const adminRole = "admin"
+
+// Role represents a user role with permissions
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (r Role) MarshalJSON() ([]byte, error) {
+	type plain Role
+	return marshalWithLocalTimes(plain(r))
+}
+
+// RoleRequest is the body accepted when creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// defaultRoles are seeded into an empty roles table on first run
+func defaultRoles() []Role {
+	return []Role{
+		{
+			Name:        adminRole,
+			Description: "Full administrative access",
+			Permissions: []string{"*"},
+		},
+		{
+			Name:        "moderator",
+			Description: "Channel moderation and user management",
+			Permissions: []string{"channels.view", "channels.moderate", "users.view", "users.kick", "users.ban"},
+		},
+		{
+			Name:        "operator",
+			Description: "Server operations and advanced features",
+			Permissions: []string{"channels.view", "users.view", "server.view", "server.manage", "bans.view", "bans.manage"},
+		},
+		{
+			Name:        "viewer",
+			Description: "Read-only access to most features",
+			Permissions: []string{"channels.view", "users.view", "server.view", "logs.view"},
+		},
+	}
+}
+
+// seedDefaultRoles inserts the default roles if the roles table is empty
+func seedDefaultRoles() error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webpanel_roles").Scan(&count); err != nil {
+		return fmt.Errorf("failed to check role count: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, role := range defaultRoles() {
+		permissions, err := json.Marshal(role.Permissions)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(
+			"INSERT INTO webpanel_roles (name, description, permissions, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			role.Name, role.Description, string(permissions), now, now,
+		); err != nil {
+			return fmt.Errorf("failed to seed role %s: %w", role.Name, err)
+		}
+	}
+	log.Printf("Created %d default roles", len(defaultRoles()))
+	return nil
+}
+
+type roleScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRole(row roleScanner) (Role, error) {
+	var role Role
+	var permissions string
+	if err := row.Scan(&role.ID, &role.Name, &role.Description, &permissions, &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return role, err
+	}
+	if err := json.Unmarshal([]byte(permissions), &role.Permissions); err != nil {
+		return role, fmt.Errorf("invalid permissions for role %s: %w", role.Name, err)
+	}
+	role.Permissions = emptyIfNil(role.Permissions)
+	return role, nil
+}
+
+const roleColumns = "id, name, description, permissions, created_at, updated_at"
+
+// isKnownRole checks a role name against the stored roles and the built-in user role
+func isKnownRole(name string) bool {
+	if name == userRole {
+		return true
+	}
+	var id int
+	err := db.QueryRow("SELECT id FROM webpanel_roles WHERE name = ?", name).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("❌ Failed to look up role %s: %v", name, err)
+	}
+	return err == nil
+}
+
+// validateRole normalizes a role request, returning the offending field and an
+// error message when it is invalid
+func validateRole(req *RoleRequest) (string, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Permissions = emptyIfNil(req.Permissions)
+
+	if req.Name == "" {
+		return "name", "Name is required"
+	}
+	if req.Name == userRole {
+		// New accounts get the built-in user role and its userRolePermissions
+		return "name", "The user role is built in"
+	}
+
+	if unknown := unknownPermission(req.Permissions); unknown != "" {
+		return "permissions", "Unknown permission " + unknown
+	}
+	return "", ""
+}
+
+// decodeRoleRequest reads and validates a role request, writing a 400 response
+// and returning false when it is invalid
+func decodeRoleRequest(w http.ResponseWriter, r *http.Request) (RoleRequest, bool) {
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return req, false
+	}
+	if field, msg := validateRole(&req); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": msg, "field": field})
+		return req, false
+	}
+	return req, true
+}
+
+// writeRoleConflict answers 409 when err is a duplicate role name, returning true if it did
+func writeRoleConflict(w http.ResponseWriter, err error) bool {
+	if _, ok := uniqueConflict(err, "name").(*UniqueConflictError); !ok {
+		return false
+	}
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]string{"error": "A role with this name already exists", "field": "name"})
+	return true
+}
+
+func getRolesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rows, err := db.Query("SELECT " + roleColumns + " FROM webpanel_roles ORDER BY id")
+	if err != nil {
+		log.Printf("❌ Failed to query roles: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load roles"})
+		return
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			log.Printf("❌ Failed to scan role: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load roles"})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	json.NewEncoder(w).Encode(roles)
+}
+
+func createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	permissions, _ := json.Marshal(req.Permissions)
+	now := time.Now()
+	role, err := scanRole(db.QueryRow(
+		"INSERT INTO webpanel_roles (name, description, permissions, created_at, updated_at) VALUES (?, ?, ?, ?, ?)"+
+			" RETURNING "+roleColumns,
+		req.Name, req.Description, string(permissions), now, now,
+	))
+	if err != nil {
+		if writeRoleConflict(w, err) {
+			return
+		}
+		log.Printf("❌ Failed to create role %s: %v", req.Name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create role"})
+		return
+	}
+
+	recordAudit(r, "role.create", role.Name, map[string]interface{}{"permissions": role.Permissions})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(role)
+}
+
+// updateRoleHandler replaces a role's name, description and permissions.
+// Panel users holding a renamed role keep it under the new name.
+func updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid role ID"})
+		return
+	}
+
+	req, ok := decodeRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("❌ Failed to update role %d: %v", roleID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update role"})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow("SELECT name FROM webpanel_roles WHERE id = ?", roleID).Scan(&oldName)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load role %d: %v", roleID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update role"})
+		return
+	}
+	if oldName == adminRole && req.Name != adminRole {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The admin role cannot be renamed", "field": "name"})
+		return
+	}
+
+	permissions, _ := json.Marshal(req.Permissions)
+	role, err := scanRole(tx.QueryRow(
+		"UPDATE webpanel_roles SET name = ?, description = ?, permissions = ?, updated_at = ? WHERE id = ? RETURNING "+roleColumns,
+		req.Name, req.Description, string(permissions), time.Now(), roleID,
+	))
+	if err == nil && oldName != req.Name {
+		_, err = tx.Exec("UPDATE webpanel_users SET role = ? WHERE role = ?", req.Name, oldName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		if writeRoleConflict(w, err) {
+			return
+		}
+		log.Printf("❌ Failed to update role %d: %v", roleID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update role"})
+		return
+	}
+
+	details := map[string]interface{}{"permissions": role.Permissions}
+	if oldName != role.Name {
+		details["renamed_from"] = oldName
+	}
+	recordAudit(r, "role.update", role.Name, details)
+
+	json.NewEncoder(w).Encode(role)
+}
+
+// deleteRoleHandler removes a role that no panel user holds
+func deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	roleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid role ID"})
+		return
+	}
+
+	var name string
+	var holders int
+	err = db.QueryRow(
+		"SELECT name, (SELECT COUNT(*) FROM webpanel_users WHERE role = webpanel_roles.name) FROM webpanel_roles WHERE id = ?",
+		roleID,
+	).Scan(&name, &holders)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load role %d: %v", roleID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete role"})
+		return
+	}
+	if name == adminRole {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The admin role cannot be deleted"})
+		return
+	}
+	if holders > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Role is assigned to %d panel users", holders)})
+		return
+	}
+
+	// The holder check and the delete race with role assignment, so delete only if still unassigned
+	result, err := db.Exec(
+		"DELETE FROM webpanel_roles WHERE id = ? AND NOT EXISTS (SELECT 1 FROM webpanel_users WHERE role = ?)",
+		roleID, name,
+	)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Role was assigned while it was being deleted"})
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Failed to delete role %d: %v", roleID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete role"})
+		return
+	}
+
+	recordAudit(r, "role.delete", name, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
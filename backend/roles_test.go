@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSeededRolesPassReadRoutes(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.Exec("INSERT INTO webpanel_roles (name, description, permissions, created_at, updated_at) VALUES ('auditor', '', '[\"logs.view\"]', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	gates := map[string]http.Handler{
+		"dashboard":     requireAnyPermission(dashboardPermissions...)(ok),
+		"channels.view": requirePermission("channels.view")(ok),
+		"bans.view":     requirePermission("bans.view")(ok),
+	}
+
+	// Expected status per gate; roles that manage bans must be able to list them
+	tests := []struct {
+		role string
+		want map[string]int
+	}{
+		{userRole, map[string]int{"dashboard": http.StatusOK, "channels.view": http.StatusOK, "bans.view": http.StatusForbidden}},
+		{"moderator", map[string]int{"dashboard": http.StatusOK, "channels.view": http.StatusOK, "bans.view": http.StatusForbidden}},
+		{"operator", map[string]int{"dashboard": http.StatusOK, "channels.view": http.StatusOK, "bans.view": http.StatusOK}},
+		{"viewer", map[string]int{"dashboard": http.StatusOK, "channels.view": http.StatusOK, "bans.view": http.StatusForbidden}},
+		{"auditor", map[string]int{"dashboard": http.StatusForbidden, "channels.view": http.StatusForbidden, "bans.view": http.StatusForbidden}},
+	}
+	for _, tt := range tests {
+		id := createTestUser(t, "u-"+tt.role, tt.role)
+		for name, gate := range gates {
+			w := httptest.NewRecorder()
+			gate.ServeHTTP(w, asUser("GET", "/api/channels", "", id, "u-"+tt.role, tt.role))
+			if w.Code != tt.want[name] {
+				t.Errorf("role %s through %s gate: status %d, want %d", tt.role, name, w.Code, tt.want[name])
+			}
+		}
+	}
+}
+
+// roleID returns the ID of a stored role
+func roleID(t *testing.T, name string) int {
+	t.Helper()
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM webpanel_roles WHERE name = ?", name).Scan(&id); err != nil {
+		t.Fatalf("role %s: %v", name, err)
+	}
+	return id
+}
+
+func TestRoleCRUD(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+
+	call := func(handler http.HandlerFunc, method string, id int, body string) int {
+		r := asUser(method, "/api/roles/"+strconv.Itoa(id), body, adminID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(id)})
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name string
+		got  func() int
+		want int
+	}{
+		{"create", func() int {
+			return call(createRoleHandler, "POST", 0, `{"name":"helper","permissions":["users.view"]}`)
+		}, http.StatusCreated},
+		{"create duplicate", func() int {
+			return call(createRoleHandler, "POST", 0, `{"name":"helper","permissions":["channels.view"]}`)
+		}, http.StatusConflict},
+		{"create with unknown permission", func() int {
+			return call(createRoleHandler, "POST", 0, `{"name":"bogus","permissions":["users.fly"]}`)
+		}, http.StatusBadRequest},
+		{"create the built-in user role", func() int {
+			return call(createRoleHandler, "POST", 0, `{"name":"user"}`)
+		}, http.StatusBadRequest},
+		{"rename admin", func() int {
+			return call(updateRoleHandler, "PUT", roleID(t, adminRole), `{"name":"root","permissions":["*"]}`)
+		}, http.StatusConflict},
+		{"rename onto a taken name", func() int {
+			return call(updateRoleHandler, "PUT", roleID(t, "helper"), `{"name":"viewer"}`)
+		}, http.StatusConflict},
+		{"delete admin", func() int {
+			return call(deleteRoleHandler, "DELETE", roleID(t, adminRole), "")
+		}, http.StatusConflict},
+		{"delete assigned role", func() int {
+			createTestUser(t, "vera", "viewer")
+			return call(deleteRoleHandler, "DELETE", roleID(t, "viewer"), "")
+		}, http.StatusConflict},
+		{"delete unassigned role", func() int {
+			return call(deleteRoleHandler, "DELETE", roleID(t, "helper"), "")
+		}, http.StatusNoContent},
+		{"delete missing role", func() int {
+			return call(deleteRoleHandler, "DELETE", 9999, "")
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoleRenameCarriesHolders(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	holderID := createTestUser(t, "walt", "viewer")
+
+	id := roleID(t, "viewer")
+	r := asUser("PUT", "/api/roles/"+strconv.Itoa(id), `{"name":"observer","permissions":["channels.view"]}`, adminID, "boss", "admin")
+	r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(id)})
+	w := httptest.NewRecorder()
+	updateRoleHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: status %d %s", w.Code, w.Body)
+	}
+
+	var role string
+	if err := db.QueryRow("SELECT role FROM webpanel_users WHERE id = ?", holderID).Scan(&role); err != nil || role != "observer" {
+		t.Errorf("holder's role after rename = %q, %v, want observer", role, err)
+	}
+}
@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheTTLs are the read methods cached unless overridden with SetCacheTTLs
+var DefaultCacheTTLs = map[string]time.Duration{
+	"stats.get":    5 * time.Second,
+	"user.list":    5 * time.Second,
+	"channel.list": 5 * time.Second,
+	"channel.get":  5 * time.Second,
+	"server.list":  10 * time.Second,
+}
+
+type freshKey struct{}
+
+// Fresh marks ctx so that cached read methods skip any cached result and go
+// to the server. The fresh result still replaces the cached one.
+func Fresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// readVerbs are the method suffixes that do not change server state
+var readVerbs = map[string]bool{"list": true, "get": true, "info": true}
+
+// isReadMethod reports whether an RPC method only reads data, e.g. user.list
+func isReadMethod(method string) bool {
+	i := strings.LastIndex(method, ".")
+	return i >= 0 && readVerbs[method[i+1:]]
+}
+
+// IsReadMethod reports whether an RPC method only reads data, and so may be cached
+func IsReadMethod(method string) bool {
+	return isReadMethod(method)
+}
+
+// CacheStats reports how the RPC result cache is performing
+type CacheStats struct {
+	Hits    uint64            `json:"hits"`
+	Misses  uint64            `json:"misses"`
+	Shared  uint64            `json:"shared"` // Calls that waited on an identical in-flight call
+	Entries int               `json:"entries"`
+	TTLs    map[string]string `json:"ttls"`
+}
+
+type cacheEntry struct {
+	result  json.RawMessage
+	expires time.Time
+}
+
+type inflightCall struct {
+	done   chan struct{}
+	result json.RawMessage
+	err    error
+}
+
+// resultCache caches read-only RPC results keyed by method and params, and
+// collapses identical concurrent calls into one request
+type resultCache struct {
+	mutex    sync.Mutex
+	ttls     map[string]time.Duration
+	entries  map[string]cacheEntry
+	inflight map[string]*inflightCall
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	shared atomic.Uint64
+}
+
+func newResultCache(ttls map[string]time.Duration) *resultCache {
+	c := &resultCache{
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]*inflightCall),
+	}
+	c.setTTLs(ttls)
+	return c
+}
+
+// setTTLs replaces the per-method TTLs. Mutating methods are never cached.
+func (c *resultCache) setTTLs(ttls map[string]time.Duration) {
+	filtered := make(map[string]time.Duration, len(ttls))
+	for method, ttl := range ttls {
+		if !isReadMethod(method) {
+			log.Printf("⚠️ Not caching RPC method %s: it may change server state", method)
+			continue
+		}
+		if ttl > 0 {
+			filtered[method] = ttl
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ttls = filtered
+	c.entries = make(map[string]cacheEntry)
+}
+
+func (c *resultCache) ttl(method string) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ttls[method]
+}
+
+// clear drops every cached result, e.g. after a call that changed server state
+func (c *resultCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+// do returns a cached result for key or runs fetch once, sharing the result
+// with identical calls that arrive while it is in flight. A fresh call always
+// runs fetch itself, since an in-flight call may have started before the
+// caller asked for fresh data.
+func (c *resultCache) do(ctx context.Context, key string, ttl time.Duration, fresh bool, fetch func() (json.RawMessage, error)) (json.RawMessage, error) {
+	c.mutex.Lock()
+	if entry, ok := c.entries[key]; ok && !fresh && time.Now().Before(entry.expires) {
+		c.mutex.Unlock()
+		c.hits.Add(1)
+		return entry.result, nil
+	}
+
+	if call, ok := c.inflight[key]; ok && !fresh {
+		c.mutex.Unlock()
+		c.shared.Add(1)
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &inflightCall{done: make(chan struct{})}
+	if !fresh {
+		c.inflight[key] = call
+	}
+	c.mutex.Unlock()
+	c.misses.Add(1)
+
+	call.result, call.err = fetch()
+
+	c.mutex.Lock()
+	if !fresh {
+		delete(c.inflight, key)
+	}
+	if call.err == nil {
+		c.entries[key] = cacheEntry{result: call.result, expires: time.Now().Add(ttl)}
+	}
+	c.mutex.Unlock()
+	close(call.done)
+
+	return call.result, call.err
+}
+
+func (c *resultCache) stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Shared:  c.shared.Load(),
+		Entries: len(c.entries),
+		TTLs:    make(map[string]string, len(c.ttls)),
+	}
+	for method, ttl := range c.ttls {
+		stats.TTLs[method] = ttl.String()
+	}
+	return stats
+}
+
+// cacheKey identifies a call by its method and a hash of its params
+func cacheKey(method string, params interface{}) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return method + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// SetCacheTTLs replaces the per-method cache TTLs. A zero TTL disables caching for that method.
+func (c *RPCClient) SetCacheTTLs(ttls map[string]time.Duration) {
+	c.cache.setTTLs(ttls)
+}
+
+// CacheStats returns hit/miss counters for the RPC result cache
+func (c *RPCClient) CacheStats() CacheStats {
+	return c.cache.stats()
+}
+
+// cachedCall performs an RPC call through the result cache. Calls to methods
+// without a TTL go straight to the server, and a successful mutating call
+// empties the cache so later reads see its effect.
+func (c *RPCClient) cachedCall(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	ttl := c.cache.ttl(method)
+	if ttl <= 0 {
+		result, err := c.roundTrip(ctx, method, params)
+		if err == nil && !isReadMethod(method) {
+			c.cache.clear()
+		}
+		return result, err
+	}
+
+	key, err := cacheKey(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.cache.do(ctx, key, ttl, isFresh(ctx), func() (json.RawMessage, error) {
+		return c.roundTrip(ctx, method, params)
+	})
+}
@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newCountingServer starts a WebSocket RPC server that answers each request
+// with how many times its method has been called, and returns a client
+// connected to it
+func newCountingServer(t *testing.T) *RPCClient {
+	t.Helper()
+
+	var mutex sync.Mutex
+	counts := map[string]int{}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req RPCRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			mutex.Lock()
+			counts[req.Method]++
+			n := counts[req.Method]
+			mutex.Unlock()
+			if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": n}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	return client
+}
+
+func TestResultCache(t *testing.T) {
+	// Each step calls a method and expects the server's call count for it;
+	// a cached answer repeats the count of the call that filled the cache
+	type step struct {
+		ctx    context.Context
+		method string
+		sleep  time.Duration // Before the call
+		want   int
+	}
+	fresh := Fresh(context.Background())
+	plain := context.Background()
+
+	tests := []struct {
+		name  string
+		ttls  map[string]time.Duration
+		steps []step
+	}{
+		{"hit", DefaultCacheTTLs, []step{
+			{plain, "user.list", 0, 1},
+			{plain, "user.list", 0, 1},
+			{plain, "channel.list", 0, 1},
+		}},
+		{"ttl expiry", map[string]time.Duration{"user.list": 50 * time.Millisecond}, []step{
+			{plain, "user.list", 0, 1},
+			{plain, "user.list", 0, 1},
+			{plain, "user.list", 100 * time.Millisecond, 2},
+		}},
+		{"mutation clears", DefaultCacheTTLs, []step{
+			{plain, "user.list", 0, 1},
+			{plain, "user.kill", 0, 1},
+			{plain, "user.list", 0, 2},
+		}},
+		{"read without ttl is not cached", DefaultCacheTTLs, []step{
+			{plain, "user.get", 0, 1},
+			{plain, "user.get", 0, 2},
+		}},
+		{"fresh bypasses and refills", DefaultCacheTTLs, []step{
+			{plain, "user.list", 0, 1},
+			{fresh, "user.list", 0, 2},
+			{plain, "user.list", 0, 2},
+		}},
+		{"disabled", map[string]time.Duration{"user.list": 0}, []step{
+			{plain, "user.list", 0, 1},
+			{plain, "user.list", 0, 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newCountingServer(t)
+			client.SetCacheTTLs(tt.ttls)
+
+			for i, step := range tt.steps {
+				time.Sleep(step.sleep)
+				var got int
+				if err := client.call(step.ctx, step.method, nil, &got); err != nil {
+					t.Fatalf("step %d %s: %v", i, step.method, err)
+				}
+				if got != step.want {
+					t.Errorf("step %d %s: answered by call %d, want %d", i, step.method, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResultCacheStats(t *testing.T) {
+	client := newCountingServer(t)
+	for i := 0; i < 3; i++ {
+		client.call(context.Background(), "user.list", nil, nil)
+	}
+
+	stats := client.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("cache stats = %+v, want 2 hits, 1 miss and 1 entry", stats)
+	}
+	if stats.TTLs["user.list"] != "5s" {
+		t.Errorf("user.list TTL = %q, want 5s", stats.TTLs["user.list"])
+	}
+}
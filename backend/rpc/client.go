@@ -2,15 +2,21 @@ package rpc
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -24,11 +30,57 @@ type RPCClient struct {
 	conn       *websocket.Conn
 	socketConn net.Conn // For UNIX socket connections
 	mutex      sync.RWMutex
+	writeMutex sync.Mutex // Serializes writes; the WebSocket allows one writer at a time
 	reqID      int64
 	pending    map[int64]chan *RPCResponse
 	isSocket   bool // Track if we're using UNIX socket
+	closed     bool // Set by Disconnect to stop reconnection attempts
+	onState    func(connected bool, err error)
+	reconnects reconnectTracker
+	debug      atomic.Bool
+	caps       *Capabilities
+	cache      *resultCache
+	events     eventSubscription
+	calls      callTracker
 }
 
+const (
+	// maxSocketLineSize bounds a single newline-delimited JSON response on the UNIX socket
+	maxSocketLineSize = 16 * 1024 * 1024
+)
+
+// AuthError indicates that the RPC server rejected the configured credentials,
+// as opposed to a transport failure where the server could not be reached
+type AuthError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *AuthError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("RPC authentication failed (HTTP %d): %v", e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("RPC authentication failed: %v", e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// IsAuthError reports whether err is caused by rejected RPC credentials
+func IsAuthError(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr)
+}
+
+// errLineTooLong is returned by readSocketLine when a line exceeds maxSocketLineSize
+var errLineTooLong = errors.New("line exceeds maximum size")
+
+// ErrNotConnected is returned by calls made while there is no connection, for
+// example while the client is reconnecting, and by calls whose connection was
+// lost before the response arrived
+var ErrNotConnected = errors.New("not connected to UnrealIRCd RPC")
+
 // RPCRequest represents a JSON-RPC 2.0 request
 type RPCRequest struct {
 	JSONRPC string      `json:"jsonrpc"`
@@ -37,12 +89,15 @@ type RPCRequest struct {
 	ID      int64       `json:"id"`
 }
 
-// RPCResponse represents a JSON-RPC 2.0 response
+// RPCResponse represents a JSON-RPC 2.0 response. Server notifications
+// arrive in the same shape with Method and Params set instead.
 type RPCResponse struct {
 	JSONRPC string          `json:"jsonrpc"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *RPCError       `json:"error,omitempty"`
-	ID      int64           `json:"id"`
+	ID      ResponseID      `json:"id"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
 }
 
 // RPCError represents a JSON-RPC 2.0 error
@@ -52,6 +107,34 @@ type RPCError struct {
 	Data    string `json:"data,omitempty"`
 }
 
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// JSON-RPC and UnrealIRCd-specific error codes
+const (
+	ErrCodeParse            = -32700
+	ErrCodeInvalidRequest   = -32600
+	ErrCodeMethodNotFound   = -32601
+	ErrCodeInvalidParams    = -32602
+	ErrCodeInternal         = -32603
+	ErrCodeNotFound         = -1000
+	ErrCodeAlreadyExists    = -1001
+	ErrCodeInvalidName      = -1002
+	ErrCodeUserNotInChannel = -1003
+	ErrCodeTooManyEntries   = -1004
+	ErrCodeDenied           = -1005
+)
+
+// ErrorCode extracts the JSON-RPC error code from err, if it is an RPC error
+func ErrorCode(err error) (int, bool) {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code, true
+	}
+	return 0, false
+}
+
 // AuthParams for the auth.login method
 type AuthParams struct {
 	Username string `json:"username"`
@@ -70,8 +153,10 @@ type NetworkInfo struct {
 // UserInfo represents a user
 type UserInfo struct {
 	Nick        string   `json:"nick"`
-	Hostname    string   `json:"hostname"`
+	Hostname    string   `json:"hostname"` // Real (uncloaked) hostname
 	IP          string   `json:"ip"`
+	VHost       string   `json:"vhost"`
+	CloakedHost string   `json:"cloakedhost"`
 	Country     string   `json:"country"`
 	Account     string   `json:"account"`
 	Realname    string   `json:"realname"`
@@ -80,20 +165,155 @@ type UserInfo struct {
 	IsOper      bool     `json:"is_oper"`
 	OperClass   string   `json:"oper_class"`
 	Modes       []string `json:"modes"`
+	TLS         *TLSInfo `json:"tls,omitempty"`        // Only present for TLS connections
+	Reputation  *int     `json:"reputation,omitempty"` // Nil when the server has no reputation module
+
+	// Returned by user.get only
+	Channels       []string `json:"channels,omitempty"`
+	IdleSince      string   `json:"idle_since,omitempty"` // ISO timestamp of the user's last message
+	Away           string   `json:"away,omitempty"`       // Away message, empty when not away
+	SecurityGroups []string `json:"security-groups,omitempty"`
+	SASLMechanism  string   `json:"sasl_mechanism,omitempty"` // e.g. PLAIN or EXTERNAL; empty when not logged in via SASL or not reported
+}
+
+// TLSInfo describes the TLS session of a user's connection
+type TLSInfo struct {
+	Cipher string `json:"cipher"`
+	CertFP string `json:"certfp,omitempty"` // SHA256 fingerprint of the client certificate, if one was sent
+}
+
+// IsSecure reports whether the user is connected over TLS
+func (u UserInfo) IsSecure() bool {
+	return u.TLS != nil
 }
 
 // ChannelInfo represents a channel
 type ChannelInfo struct {
 	Name         string        `json:"name"`
-	UserCount    int           `json:"num_users"`     // Note: UnrealIRCd uses "num_users"
+	UserCount    int           `json:"num_users"` // Note: UnrealIRCd uses "num_users"
 	Topic        string        `json:"topic"`
 	CreationTime string        `json:"creation_time"` // Change to string to handle ISO format
 	TopicSetBy   string        `json:"topic_set_by"`
 	TopicSetAt   string        `json:"topic_set_at"`
-	Modes        string        `json:"modes"`         // UnrealIRCd returns this as a string, not []string
+	Modes        string        `json:"modes"` // UnrealIRCd returns this as a string, not []string
 	Users        []ChannelUser `json:"users,omitempty"`
 }
 
+// ServerInfo represents a server linked to the network
+type ServerInfo struct {
+	Name   string        `json:"name"`
+	ID     string        `json:"id"` // The server's SID, e.g. "001"
+	Server ServerDetails `json:"server"`
+}
+
+// ServerDetails holds the server-specific fields of a ServerInfo
+type ServerDetails struct {
+	Info     string `json:"info"`
+	NumUsers int    `json:"num_users"`
+	BootTime string `json:"boot_time"` // When the server started, ISO 8601
+	Uplink   string `json:"uplink"`
+	ULined   bool   `json:"ulined"` // Services servers are U-lined
+	Synced   bool   `json:"synced"`
+	LagMs    *int64 `json:"lag_ms,omitempty"` // Ping time to the uplink, when the server reports it
+}
+
+// Module is a module loaded on a server
+type Module struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Author      string `json:"author"`
+	ThirdParty  bool   `json:"third_party"` // Not shipped with UnrealIRCd
+	Permanent   bool   `json:"permanent"`
+}
+
+// RehashResult is the outcome of a rehash. Log holds the warnings and errors
+// UnrealIRCd reported while reading its configuration.
+type RehashResult struct {
+	Success bool             `json:"success"`
+	Log     []RehashLogEntry `json:"log"`
+}
+
+// RehashLogEntry is one line logged during a rehash
+type RehashLogEntry struct {
+	Level     string `json:"level"` // info, warn, error, ...
+	Subsystem string `json:"subsystem"`
+	EventID   string `json:"event_id"`
+	Message   string `json:"msg"`
+}
+
+// ThrottleSettings holds the connection throttle: at most Count connections per Period seconds
+type ThrottleSettings struct {
+	Count  int `json:"count"`
+	Period int `json:"period"`
+}
+
+// ServerBan is a network-wide ban (G-line, K-line, Z-line, ...)
+type ServerBan struct {
+	Type     string `json:"type"` // gline, kline, gzline, zline, ...
+	Name     string `json:"name"` // The banned mask, e.g. *@192.0.2.1
+	SetBy    string `json:"set_by"`
+	SetAt    string `json:"set_at"`
+	ExpireAt string `json:"expire_at,omitempty"` // Empty for permanent bans
+	Reason   string `json:"reason"`
+}
+
+// BanException is a server ban exception (ELINE)
+type BanException struct {
+	Name           string `json:"name"`            // The exempted mask, e.g. *@192.168.*
+	ExceptionTypes string `json:"exception_types"` // Ban types the mask is exempt from, e.g. "kGs"
+	Reason         string `json:"reason"`
+	SetBy          string `json:"set_by"`
+	SetAt          string `json:"set_at"`
+	ExpireAt       string `json:"expire_at,omitempty"`
+	DurationString string `json:"duration_string,omitempty"`
+}
+
+// NameBan is a forbidden nickname or channel name (QLINE)
+type NameBan struct {
+	Name           string `json:"name"` // The nick or channel mask, e.g. *Serv or #warez*
+	Reason         string `json:"reason"`
+	SetBy          string `json:"set_by"`
+	SetAt          string `json:"set_at"`
+	ExpireAt       string `json:"expire_at,omitempty"`
+	DurationString string `json:"duration_string,omitempty"`
+}
+
+// Spamfilter is a network-wide filter matched against messages and other user input
+type Spamfilter struct {
+	Name        string `json:"name"`                          // The match string or regex
+	MatchType   string `json:"match_type"`                    // simple or regex
+	Targets     string `json:"spamfilter_targets"`            // What is matched, e.g. "cpnN"
+	Action      string `json:"ban_action"`                    // e.g. block, kill, gline
+	BanDuration string `json:"ban_duration_string,omitempty"` // For actions that place a ban
+	Reason      string `json:"reason"`
+	SetBy       string `json:"set_by"`
+	SetAt       string `json:"set_at"`
+	Hits        int    `json:"hits"`
+}
+
+// DenyChannel is a forbidden channel name pattern (deny channel block)
+type DenyChannel struct {
+	Channel  string `json:"channel"`            // Channel mask, e.g. #*warez*
+	Reason   string `json:"reason"`             // Shown to users trying to join
+	Redirect string `json:"redirect,omitempty"` // Channel users are sent to instead
+	SetBy    string `json:"set_by,omitempty"`
+	SetAt    string `json:"set_at,omitempty"`
+}
+
+// RPCMethod describes an RPC method advertised by the server
+type RPCMethod struct {
+	Name    string `json:"name"`
+	Module  string `json:"module,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Capabilities describes the RPC methods the connected server advertises
+type Capabilities struct {
+	Methods    []RPCMethod `json:"methods"`
+	DetectedAt time.Time   `json:"detected_at"`
+}
+
 // ChannelUser represents a user in a channel
 type ChannelUser struct {
 	Nick   string   `json:"nick"`
@@ -101,6 +321,27 @@ type ChannelUser struct {
 	Joined int64    `json:"joined"`
 }
 
+// ChannelBan is an entry on one of a channel's lists: bans (+b), ban
+// exemptions (+e) or invite exceptions (+I)
+type ChannelBan struct {
+	Name  string `json:"name"` // The mask
+	SetBy string `json:"set_by"`
+	SetAt string `json:"set_at"`
+}
+
+// ChannelDetails is a channel's modes, members and lists
+type ChannelDetails struct {
+	Name             string        `json:"name"`
+	Modes            string        `json:"modes"`
+	Topic            string        `json:"topic,omitempty"`
+	TopicSetBy       string        `json:"topic_set_by,omitempty"`
+	TopicSetAt       string        `json:"topic_set_at,omitempty"`
+	Users            []ChannelUser `json:"users"`
+	Bans             []ChannelBan  `json:"bans"`
+	BanExemptions    []ChannelBan  `json:"ban_exemptions"`
+	InviteExceptions []ChannelBan  `json:"invite_exceptions"`
+}
+
 // NewRPCClient creates a new RPC client
 func NewRPCClient(url, username, password string) *RPCClient {
 	return &RPCClient{
@@ -108,6 +349,19 @@ func NewRPCClient(url, username, password string) *RPCClient {
 		username: username,
 		password: password,
 		pending:  make(map[int64]chan *RPCResponse),
+		cache:    newResultCache(DefaultCacheTTLs),
+	}
+}
+
+// SetDebug enables or disables debug logging
+func (c *RPCClient) SetDebug(enabled bool) {
+	c.debug.Store(enabled)
+}
+
+// debugf logs a message only when debug logging is enabled
+func (c *RPCClient) debugf(format string, args ...interface{}) {
+	if c.debug.Load() {
+		log.Printf("🐛 "+format, args...)
 	}
 }
 
@@ -115,20 +369,47 @@ func NewRPCClient(url, username, password string) *RPCClient {
 func (c *RPCClient) Connect(ctx context.Context) error {
 	log.Printf("🔌 Starting RPC connection process...")
 
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
 	// Check if it's a UNIX socket path
 	if c.url == "unix" || c.url == "" {
-		return c.connectUnixSocket(ctx)
+		if err := c.connectUnixSocket(ctx); err != nil {
+			return err
+		}
+		// The WebSocket sends credentials in its handshake; the socket logs in
+		// with its first request instead
+		return c.authenticateSocket(ctx)
 	}
 
 	// Try WebSocket connection
 	return c.connectWebSocket(ctx)
 }
 
+// authenticateSocket logs in over a freshly connected UNIX socket. Servers that
+// do not offer a login method trust the socket's file permissions instead.
+func (c *RPCClient) authenticateSocket(ctx context.Context) error {
+	err := c.authenticate(ctx)
+	if code, ok := ErrorCode(err); ok && code == ErrCodeMethodNotFound {
+		log.Printf("🔓 Server has no login method, relying on UNIX socket permissions")
+		return nil
+	}
+	return err
+}
+
 // connectUnixSocket connects via UNIX domain socket
 func (c *RPCClient) connectUnixSocket(ctx context.Context) error {
+	conn, err := c.dialUnixSocket(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.useSocket(conn)
+	c.mutex.Unlock()
+	return nil
+}
+
+// dialUnixSocket opens the UNIX socket. It does not take the mutex, so calls
+// fail fast with ErrNotConnected while it waits.
+func (c *RPCClient) dialUnixSocket(ctx context.Context) (net.Conn, error) {
 	socketPath := "/home/valerie/unrealircd/data/rpc.socket" // Adjust this path
 	log.Printf("🔌 Connecting to UNIX socket: %s", socketPath)
 
@@ -136,33 +417,51 @@ func (c *RPCClient) connectUnixSocket(ctx context.Context) error {
 	conn, err := d.DialContext(ctx, "unix", socketPath)
 	if err != nil {
 		log.Printf("❌ Failed to connect to UNIX socket: %v", err)
-		return fmt.Errorf("failed to connect to UNIX socket: %w", err)
+		return nil, fmt.Errorf("failed to connect to UNIX socket: %w", err)
 	}
 
 	log.Printf("✅ Connected to UNIX socket successfully!")
+	return conn, nil
+}
+
+// useSocket makes a dialed UNIX socket the client's connection and starts its
+// message handler. Callers hold the mutex.
+func (c *RPCClient) useSocket(conn net.Conn) {
 	c.socketConn = conn
 	c.isSocket = true
+	go c.handleSocketMessages(conn)
+}
+
+// connectWebSocket connects via WebSocket
+func (c *RPCClient) connectWebSocket(ctx context.Context) error {
+	conn, err := c.dialWebSocket(ctx)
+	if err != nil {
+		return err
+	}
 
-	// Start message handler for socket
-	go c.handleSocketMessages()
+	c.mutex.Lock()
+	c.useWebSocket(conn)
+	c.mutex.Unlock()
 
+	log.Printf("🎉 Successfully connected to UnrealIRCd RPC!")
 	return nil
 }
 
-// connectWebSocket connects via WebSocket
-func (c *RPCClient) connectWebSocket(ctx context.Context) error {
+// dialWebSocket opens the WebSocket to the RPC URL. It does not take the
+// mutex, so calls fail fast with ErrNotConnected during the handshake.
+func (c *RPCClient) dialWebSocket(ctx context.Context) (*websocket.Conn, error) {
 	log.Printf("📝 Parsing RPC URL: %s", c.url)
 
 	// Parse and validate URL
 	u, err := url.Parse(c.url)
 	if err != nil {
 		log.Printf("❌ Failed to parse URL: %v", err)
-		return fmt.Errorf("invalid RPC URL: %w", err)
+		return nil, fmt.Errorf("invalid RPC URL: %w", err)
 	}
 
-	log.Printf("   Scheme: %s", u.Scheme)
-	log.Printf("   Host: %s", u.Host)
-	log.Printf("   Path: %s", u.Path)
+	c.debugf("   Scheme: %s", u.Scheme)
+	c.debugf("   Host: %s", u.Host)
+	c.debugf("   Path: %s", u.Path)
 
 	// Ensure we're using the correct WebSocket scheme
 	originalScheme := u.Scheme
@@ -209,63 +508,161 @@ func (c *RPCClient) connectWebSocket(ctx context.Context) error {
 		log.Printf("   Error: %v", err)
 
 		if resp != nil {
-			log.Printf("📄 HTTP Response received:")
-			log.Printf("   Status: %s", resp.Status)
-			log.Printf("   Status Code: %d", resp.StatusCode)
-			log.Printf("   Headers:")
+			c.debugf("HTTP Response received:")
+			c.debugf("   Status: %s", resp.Status)
+			c.debugf("   Status Code: %d", resp.StatusCode)
+			c.debugf("   Headers:")
 			for key, values := range resp.Header {
 				for _, value := range values {
-					log.Printf("     %s: %s", key, value)
+					c.debugf("     %s: %s", key, value)
 				}
 			}
 		} else {
 			log.Printf("📄 No HTTP response received (connection likely refused)")
 		}
 
-		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+		if resp != nil && (resp.StatusCode == 401 || resp.StatusCode == 403) {
+			return nil, &AuthError{StatusCode: resp.StatusCode, Err: err}
+		}
+
+		return nil, fmt.Errorf("failed to connect to WebSocket: %w", err)
 	}
 
 	log.Printf("✅ WebSocket connection established in %v", duration)
+	return conn, nil
+}
+
+// useWebSocket makes a dialed WebSocket the client's connection and starts its
+// message handler. Callers hold the mutex.
+func (c *RPCClient) useWebSocket(conn *websocket.Conn) {
 	c.conn = conn
 	c.isSocket = false
 
-	// Start message handler
 	log.Printf("🎧 Starting message handler goroutine...")
-	go c.handleMessages()
-
-	log.Printf("🎉 Successfully connected to UnrealIRCd RPC!")
-	return nil
+	go c.handleMessages(conn)
 }
 
 // handleSocketMessages handles incoming messages from UNIX socket
-func (c *RPCClient) handleSocketMessages() {
-	scanner := bufio.NewScanner(c.socketConn)
-	for scanner.Scan() {
-		line := scanner.Text()
-		log.Printf("📨 Received from socket: %s", line)
+func (c *RPCClient) handleSocketMessages(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	var readErr error
+
+	for {
+		line, err := readSocketLine(reader, maxSocketLineSize)
+		if err == errLineTooLong {
+			log.Printf("⚠️ Skipping socket message larger than %d bytes", maxSocketLineSize)
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("❌ Socket read error: %v", err)
+			}
+			readErr = err
+			break
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		c.debugf("Received from socket: %s", line)
 
 		var response RPCResponse
-		if err := json.Unmarshal([]byte(line), &response); err != nil {
-			log.Printf("❌ Failed to unmarshal response: %v", err)
+		if err := json.Unmarshal(line, &response); err != nil {
+			c.debugf("Skipping malformed socket message: %v", err)
 			continue
 		}
 
 		// Handle the response
-		c.mutex.RLock()
-		ch, exists := c.pending[response.ID]
-		c.mutex.RUnlock()
-
-		if exists {
+		if ch, exists := c.takePending(response.ID); exists {
 			select {
 			case ch <- &response:
 			default:
 			}
+		} else if response.isEvent() {
+			c.dispatchEvent(&response)
+		} else if response.isParseError() {
+			logParseError(&response)
+		} else {
+			c.debugf("No pending request found for socket response ID %s", response.ID)
+		}
+	}
+
+	log.Printf("🏁 Socket message handler stopped")
+	conn.Close()
+
+	c.mutex.Lock()
+	current := c.socketConn == conn
+	if current {
+		c.socketConn = nil
+		c.failPending()
+	}
+	c.mutex.Unlock()
+
+	// A connection replaced or closed on purpose has nothing to reconnect
+	if current {
+		c.connectionLost(readErr)
+	}
+}
+
+// takePending removes and returns the channel of the call a response answers
+func (c *RPCClient) takePending(id ResponseID) (chan *RPCResponse, bool) {
+	reqID, ok := id.requestID()
+	if !ok {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch, exists := c.pending[reqID]
+	delete(c.pending, reqID)
+	return ch, exists
+}
+
+// isParseError reports whether a response is an error with a null id, which a
+// server sends when it could not read a request well enough to find its id
+func (m *RPCResponse) isParseError() bool {
+	return m.ID.IsNull() && m.Error != nil
+}
+
+// logParseError reports a null-id error. The call it belongs to cannot be
+// known, so that call is left to time out.
+func logParseError(response *RPCResponse) {
+	log.Printf("❌ RPC server could not parse a request (code %d: %s)", response.Error.Code, response.Error.Message)
+}
+
+// readSocketLine reads a single newline-terminated line of at most max bytes.
+// Oversized lines are consumed in full and reported as errLineTooLong so the
+// caller can carry on with the next line.
+func readSocketLine(reader *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if !tooLong {
+			if len(line)+len(chunk) > max {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		if !isPrefix {
+			break
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("❌ Socket scanner error: %v", err)
+	if tooLong {
+		return nil, errLineTooLong
 	}
+	return line, nil
 }
 
 // authenticate performs RPC authentication
@@ -283,85 +680,118 @@ func (c *RPCClient) authenticate(ctx context.Context) error {
 	err := c.call(ctx, "user.login", params, &result)
 	if err != nil {
 		log.Printf("❌ Login call failed: %v", err)
-		return fmt.Errorf("login failed: %w", err)
+		return &AuthError{Err: err}
 	}
 
 	log.Printf("✅ Authentication successful!")
-	log.Printf("📥 Login response: %s", string(result))
+	c.debugf("Login response: %s", string(result))
 	return nil
 }
 
 // handleMessages handles incoming WebSocket messages
-func (c *RPCClient) handleMessages() {
+func (c *RPCClient) handleMessages(conn *websocket.Conn) {
 	log.Printf("🎧 Message handler started")
+	var readErr error
 
 	for {
-		c.mutex.RLock()
-		conn := c.conn
-		c.mutex.RUnlock()
-
-		if conn == nil {
-			log.Printf("🛑 Connection is nil, stopping message handler")
-			break
-		}
-
-		log.Printf("👂 Waiting for message...")
+		c.debugf("Waiting for message...")
 
 		var response RPCResponse
 		err := conn.ReadJSON(&response)
 		if err != nil {
 			log.Printf("❌ RPC read error: %v", err)
 			log.Printf("🔍 Error type: %T", err)
+			readErr = err
 			break
 		}
 
-		log.Printf("📥 Received RPC response:")
-		log.Printf("   ID: %d", response.ID)
-		log.Printf("   JSONRPC: %s", response.JSONRPC)
-
 		if response.Error != nil {
-			log.Printf("   Error: Code=%d, Message=%s, Data=%s",
-				response.Error.Code, response.Error.Message, response.Error.Data)
+			c.debugf("Received RPC response ID %s: error code=%d, message=%s, data=%s",
+				response.ID, response.Error.Code, response.Error.Message, response.Error.Data)
 		} else {
-			log.Printf("   Result: %s", string(response.Result))
+			c.debugf("Received RPC response ID %s: %s", response.ID, string(response.Result))
 		}
 
 		// Handle response
-		c.mutex.Lock()
-		if ch, exists := c.pending[response.ID]; exists {
-			log.Printf("✅ Found pending request for ID %d, sending response", response.ID)
-			delete(c.pending, response.ID)
-			c.mutex.Unlock()
+		if ch, exists := c.takePending(response.ID); exists {
+			c.debugf("Found pending request for ID %s, sending response", response.ID)
 			ch <- &response
+		} else if response.isEvent() {
+			c.dispatchEvent(&response)
+		} else if response.isParseError() {
+			logParseError(&response)
 		} else {
-			log.Printf("⚠️  No pending request found for ID %d", response.ID)
-			c.mutex.Unlock()
+			log.Printf("⚠️  No pending request found for ID %s", response.ID)
 		}
 	}
 
 	log.Printf("🏁 Message handler stopped")
+	conn.Close()
+
+	c.mutex.Lock()
+	current := c.conn == conn
+	if current {
+		c.conn = nil
+		c.failPending()
+	}
+	c.mutex.Unlock()
+
+	// A connection replaced or closed on purpose has nothing to reconnect
+	if current {
+		c.connectionLost(readErr)
+	}
 }
 
-// call makes an RPC call
+// call makes an RPC call, served from the result cache for cacheable read methods
 func (c *RPCClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
-	log.Printf("📞 Making RPC call: %s", method)
+	raw, err := c.cachedCall(ctx, method, params)
+	if err != nil {
+		return err
+	}
+
+	if result != nil && raw != nil {
+		if err := json.Unmarshal(raw, result); err != nil {
+			log.Printf("❌ Failed to unmarshal %s result: %v", method, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// roundTrip sends a request to the server and waits for its raw result
+func (c *RPCClient) roundTrip(ctx context.Context, method string, params interface{}) (result json.RawMessage, err error) {
+	c.debugf("Making RPC call: %s", method)
+
+	start := time.Now()
+	defer func() {
+		attrs := []any{"method", method, "request_id", RequestID(ctx), "duration_ms", time.Since(start).Milliseconds()}
+		if err != nil {
+			slog.Warn("rpc call failed", append(attrs, "error", err.Error())...)
+			return
+		}
+		slog.Info("rpc call", attrs...)
+	}()
 
 	c.mutex.Lock()
 	c.reqID++
 	reqID := c.reqID
 
-	if c.conn == nil {
+	if c.conn == nil && c.socketConn == nil {
 		c.mutex.Unlock()
 		log.Printf("❌ Cannot make call: not connected")
-		return fmt.Errorf("not connected")
+		return nil, c.notConnectedError()
 	}
 
 	// Create response channel
 	respCh := make(chan *RPCResponse, 1)
 	c.pending[reqID] = respCh
-	log.Printf("📋 Created pending request with ID: %d", reqID)
+	c.debugf("Created pending request with ID: %d", reqID)
 	c.mutex.Unlock()
 
+	ctx, untrack := c.calls.track(ctx, reqID, method)
+	defer untrack()
+
 	// Create request
 	req := RPCRequest{
 		JSONRPC: "2.0",
@@ -370,67 +800,108 @@ func (c *RPCClient) call(ctx context.Context, method string, params interface{},
 		ID:      reqID,
 	}
 
-	// Log the request
-	reqJSON, _ := json.MarshalIndent(req, "", "  ")
-	log.Printf("📤 Sending request:\n%s", string(reqJSON))
+	if c.debug.Load() {
+		c.debugf("Sending request:\n%s", redactedRequest(req))
+	}
 
 	// Send request
-	c.mutex.RLock()
-	err := c.conn.WriteJSON(req)
-	c.mutex.RUnlock()
+	err = c.send(req)
 
 	if err != nil {
 		log.Printf("❌ Failed to send request: %v", err)
 		c.mutex.Lock()
 		delete(c.pending, reqID)
 		c.mutex.Unlock()
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	log.Printf("✅ Request sent, waiting for response...")
+	c.debugf("Request sent, waiting for response...")
 
 	// Wait for response
 	select {
-	case resp := <-respCh:
-		log.Printf("📥 Received response for request ID %d", reqID)
+	case resp, ok := <-respCh:
+		if !ok {
+			// The connection was lost or closed while waiting
+			log.Printf("❌ Connection lost before response to request ID %d", reqID)
+			return nil, c.notConnectedError()
+		}
+		c.debugf("Received response for request ID %d", reqID)
 
 		if resp.Error != nil {
 			log.Printf("❌ RPC returned error: Code=%d, Message=%s", resp.Error.Code, resp.Error.Message)
-			return fmt.Errorf("RPC error %d: %s", resp.Error.Code, resp.Error.Message)
-		}
-
-		if result != nil && resp.Result != nil {
-			log.Printf("🔄 Unmarshaling result into provided structure")
-			err := json.Unmarshal(resp.Result, result)
-			if err != nil {
-				log.Printf("❌ Failed to unmarshal result: %v", err)
-				return err
-			}
-			log.Printf("✅ Result unmarshaled successfully")
+			return nil, resp.Error
 		}
 
-		log.Printf("✅ RPC call completed successfully")
-		return nil
+		return resp.Result, nil
 
 	case <-ctx.Done():
 		log.Printf("⏰ Context cancelled for request ID %d", reqID)
 		c.mutex.Lock()
 		delete(c.pending, reqID)
 		c.mutex.Unlock()
-		return ctx.Err()
+		if cause := context.Cause(ctx); errors.Is(cause, ErrCallCancelled) {
+			return nil, cause
+		}
+		return nil, ctx.Err()
 
 	case <-time.After(30 * time.Second):
 		log.Printf("⏰ Request timeout for ID %d", reqID)
 		c.mutex.Lock()
 		delete(c.pending, reqID)
 		c.mutex.Unlock()
-		return fmt.Errorf("request timeout")
+		return nil, fmt.Errorf("request timeout")
+	}
+}
+
+// redactedRequest renders a request for the debug log with the values of
+// password parameters, such as user.login's, replaced
+func redactedRequest(req RPCRequest) string {
+	if raw, err := json.Marshal(req.Params); err == nil {
+		var params map[string]interface{}
+		if json.Unmarshal(raw, &params) == nil {
+			for key := range params {
+				if strings.Contains(strings.ToLower(key), "password") {
+					params[key] = "[REDACTED]"
+				}
+			}
+			req.Params = params
+		}
+	}
+
+	reqJSON, _ := json.MarshalIndent(req, "", "  ")
+	return string(reqJSON)
+}
+
+// send writes a request to the connected transport: a JSON message on the
+// WebSocket, or a newline-delimited JSON line on the UNIX socket
+func (c *RPCClient) send(req RPCRequest) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.isSocket {
+		if c.socketConn == nil {
+			return ErrNotConnected
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		// One Write per request, so a short write never interleaves with another request
+		_, err = c.socketConn.Write(append(data, '\n'))
+		return err
+	}
+
+	if c.conn == nil {
+		return ErrNotConnected
 	}
+	return c.conn.WriteJSON(req)
 }
 
 // GetNetworkInfo gets network statistics
 func (c *RPCClient) GetNetworkInfo(ctx context.Context) (*NetworkInfo, error) {
-	log.Printf("📊 Getting network info...")
+	c.debugf("Getting network info...")
 
 	var result struct {
 		Users    int   `json:"users"`
@@ -454,13 +925,13 @@ func (c *RPCClient) GetNetworkInfo(ctx context.Context) (*NetworkInfo, error) {
 		Uptime:      result.Uptime,
 	}
 
-	log.Printf("✅ Network info retrieved: %+v", networkInfo)
+	c.debugf("Network info retrieved: %+v", networkInfo)
 	return networkInfo, nil
 }
 
 // GetUsers gets the list of users
 func (c *RPCClient) GetUsers(ctx context.Context) ([]UserInfo, error) {
-	log.Printf("👥 Getting user list...")
+	c.debugf("Getting user list...")
 
 	var result struct {
 		List []UserInfo `json:"list"`
@@ -472,13 +943,41 @@ func (c *RPCClient) GetUsers(ctx context.Context) ([]UserInfo, error) {
 		return nil, err
 	}
 
-	log.Printf("✅ Retrieved %d users", len(result.List))
+	c.debugf("Retrieved %d users", len(result.List))
 	return result.List, nil
 }
 
+// GetUser gets the full details of one user, including the channels they are
+// in. Servers answer {"client": {...}}; a bare user object is accepted too.
+func (c *RPCClient) GetUser(ctx context.Context, nick string) (*UserInfo, error) {
+	c.debugf("Getting details for user: %s", nick)
+
+	var raw json.RawMessage
+	if err := c.call(ctx, "user.get", map[string]string{"nick": nick}, &raw); err != nil {
+		log.Printf("❌ Failed to get user: %v", err)
+		return nil, err
+	}
+
+	var wrapped struct {
+		Client *UserInfo `json:"client"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Client != nil {
+		return wrapped.Client, nil
+	}
+
+	var user UserInfo
+	if err := json.Unmarshal(raw, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetChannels gets the list of channels
 func (c *RPCClient) GetChannels(ctx context.Context) ([]ChannelInfo, error) {
-	log.Printf("📺 Getting channel list...")
+	c.debugf("Getting channel list...")
 
 	var result struct {
 		List []ChannelInfo `json:"list"`
@@ -490,13 +989,94 @@ func (c *RPCClient) GetChannels(ctx context.Context) ([]ChannelInfo, error) {
 		return nil, err
 	}
 
-	log.Printf("✅ Retrieved %d channels", len(result.List))
+	c.debugf("Retrieved %d channels", len(result.List))
+	return result.List, nil
+}
+
+// GetServers gets the list of linked servers
+func (c *RPCClient) GetServers(ctx context.Context) ([]ServerInfo, error) {
+	c.debugf("Getting server list...")
+
+	var result struct {
+		List []ServerInfo `json:"list"`
+	}
+
+	err := c.call(ctx, "server.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get servers: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d servers", len(result.List))
+	return result.List, nil
+}
+
+// GetModules gets the modules loaded on a server; an empty server means the
+// one the panel is connected to. Remote servers answer through the network,
+// so a server that does not respond fails the call.
+func (c *RPCClient) GetModules(ctx context.Context, server string) ([]Module, error) {
+	c.debugf("Getting modules of %s...", serverOrLocal(server))
+
+	var params interface{}
+	if server != "" {
+		params = map[string]string{"server": server}
+	}
+
+	var result struct {
+		List []Module `json:"list"`
+	}
+
+	err := c.call(ctx, "server.module_list", params, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get modules: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d modules", len(result.List))
 	return result.List, nil
 }
 
+// serverOrLocal names server in log lines
+func serverOrLocal(server string) string {
+	if server == "" {
+		return "the local server"
+	}
+	return server
+}
+
+// Rehash makes a server reload its configuration; an empty server means the
+// one the panel is connected to. Servers that only acknowledge the request
+// answer with a plain true, which gives a successful result without a log.
+func (c *RPCClient) Rehash(ctx context.Context, server string) (*RehashResult, error) {
+	log.Printf("🔁 Rehashing %s...", serverOrLocal(server))
+
+	var params interface{}
+	if server != "" {
+		params = map[string]string{"server": server}
+	}
+
+	var raw json.RawMessage
+	err := c.call(ctx, "server.rehash", params, &raw)
+	if err != nil {
+		log.Printf("❌ Failed to rehash: %v", err)
+		return nil, err
+	}
+
+	var result RehashResult
+	if err := json.Unmarshal(raw, &result.Success); err != nil {
+		if err := json.Unmarshal(raw, &result); err != nil {
+			log.Printf("❌ Failed to parse rehash result: %v", err)
+			return nil, err
+		}
+	}
+
+	log.Printf("✅ Rehash finished (success: %v, %d log lines)", result.Success, len(result.Log))
+	return &result, nil
+}
+
 // GetChannelUsers gets users in a specific channel
 func (c *RPCClient) GetChannelUsers(ctx context.Context, channel string) ([]ChannelUser, error) {
-	log.Printf("👥 Getting users for channel: %s", channel)
+	c.debugf("Getting users for channel: %s", channel)
 
 	params := map[string]string{"channel": channel}
 
@@ -510,7 +1090,7 @@ func (c *RPCClient) GetChannelUsers(ctx context.Context, channel string) ([]Chan
 		return nil, err
 	}
 
-	log.Printf("✅ Retrieved %d users for channel %s", len(result.Users), channel)
+	c.debugf("Retrieved %d users for channel %s", len(result.Users), channel)
 	return result.Users, nil
 }
 
@@ -534,9 +1114,71 @@ func (c *RPCClient) KickUser(ctx context.Context, channel, nick, reason string)
 	return nil
 }
 
-// BanUser bans a user from a channel
-func (c *RPCClient) BanUser(ctx context.Context, channel, mask, reason string) error {
-	log.Printf("🚫 Banning user %s from %s (reason: %s)", mask, channel, reason)
+// PartUser forcibly parts a user from a channel (SVSPART). An unknown nick
+// fails with ErrCodeNotFound and one not in the channel with
+// ErrCodeUserNotInChannel.
+func (c *RPCClient) PartUser(ctx context.Context, nick, channel, reason string) error {
+	log.Printf("🚪 Parting user %s from %s (reason: %s)", nick, channel, reason)
+
+	// The server accepts a part of a user who is not in the channel as a
+	// no-op, so check the membership first, bypassing the cache
+	user, err := c.GetUser(Fresh(ctx), nick)
+	if err != nil {
+		log.Printf("❌ Failed to part user: %v", err)
+		return err
+	}
+	inChannel := false
+	for _, name := range user.Channels {
+		if strings.EqualFold(name, channel) {
+			inChannel = true
+		}
+	}
+	if !inChannel {
+		log.Printf("❌ Failed to part user: %s is not in %s", nick, channel)
+		return &RPCError{Code: ErrCodeUserNotInChannel, Message: fmt.Sprintf("%s is not in %s", nick, channel)}
+	}
+
+	params := map[string]interface{}{
+		"nick":    nick,
+		"channel": channel,
+		"force":   true,
+	}
+	if reason != "" {
+		params["reason"] = reason
+	}
+
+	err = c.call(ctx, "user.part", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to part user: %v", err)
+		return err
+	}
+
+	log.Printf("✅ User parted successfully")
+	return nil
+}
+
+// KillUser disconnects a user from the network
+func (c *RPCClient) KillUser(ctx context.Context, nick, reason string) error {
+	log.Printf("💀 Killing user %s (reason: %s)", nick, reason)
+
+	params := map[string]string{
+		"nick":   nick,
+		"reason": reason,
+	}
+
+	err := c.call(ctx, "user.kill", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to kill user: %v", err)
+		return err
+	}
+
+	log.Printf("✅ User killed successfully")
+	return nil
+}
+
+// BanUser bans a user from a channel
+func (c *RPCClient) BanUser(ctx context.Context, channel, mask, reason string) error {
+	log.Printf("🚫 Banning user %s from %s (reason: %s)", mask, channel, reason)
 
 	params := map[string]string{
 		"channel": channel,
@@ -554,6 +1196,371 @@ func (c *RPCClient) BanUser(ctx context.Context, channel, mask, reason string) e
 	return nil
 }
 
+// GetChannel gets a channel's modes, members and lists
+func (c *RPCClient) GetChannel(ctx context.Context, channel string) (*ChannelDetails, error) {
+	c.debugf("Getting details for channel: %s", channel)
+
+	params := map[string]string{"channel": channel}
+
+	var result ChannelDetails
+	err := c.call(ctx, "channel.get", params, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get channel: %v", err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SetTopic sets a channel's topic; an empty topic clears it
+func (c *RPCClient) SetTopic(ctx context.Context, channel, topic string) error {
+	log.Printf("📝 Setting topic of %s to %q", channel, topic)
+
+	params := map[string]string{
+		"channel": channel,
+		"topic":   topic,
+	}
+
+	err := c.call(ctx, "channel.set_topic", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to set topic: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Topic set successfully")
+	return nil
+}
+
+// SetChannelMode sets modes on a channel, e.g. "-k+o" with parameters ["*", "nick"]
+func (c *RPCClient) SetChannelMode(ctx context.Context, channel, modes string, parameters []string) error {
+	log.Printf("⚙️ Setting mode %s %s on %s", modes, strings.Join(parameters, " "), channel)
+
+	params := map[string]string{
+		"channel":    channel,
+		"modes":      modes,
+		"parameters": strings.Join(parameters, " "),
+	}
+
+	err := c.call(ctx, "channel.set_mode", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to set channel mode: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Channel mode set successfully")
+	return nil
+}
+
+// GetServerBans gets the list of server bans
+func (c *RPCClient) GetServerBans(ctx context.Context) ([]ServerBan, error) {
+	c.debugf("Getting server bans...")
+
+	var result struct {
+		List []ServerBan `json:"list"`
+	}
+
+	err := c.call(ctx, "server_ban.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get server bans: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d server bans", len(result.List))
+	return result.List, nil
+}
+
+// AddServerBan adds a server ban. duration is an UnrealIRCd time string
+// such as "30d" or "1h"; "0" makes the ban permanent.
+func (c *RPCClient) AddServerBan(ctx context.Context, banType, mask, reason, duration string) error {
+	log.Printf("🔨 Adding %s on %s for %s", banType, mask, duration)
+
+	params := map[string]string{
+		"type":            banType,
+		"name":            mask,
+		"reason":          reason,
+		"duration_string": duration,
+	}
+
+	err := c.call(ctx, "server_ban.add", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to add server ban: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Server ban added successfully")
+	return nil
+}
+
+// RemoveServerBan removes a server ban
+func (c *RPCClient) RemoveServerBan(ctx context.Context, banType, mask string) error {
+	log.Printf("🔨 Removing %s on %s", banType, mask)
+
+	err := c.call(ctx, "server_ban.del", map[string]string{"type": banType, "name": mask}, nil)
+	if err != nil {
+		log.Printf("❌ Failed to remove server ban: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Server ban removed successfully")
+	return nil
+}
+
+// GetBanExceptions gets the list of server ban exceptions (ELINEs)
+func (c *RPCClient) GetBanExceptions(ctx context.Context) ([]BanException, error) {
+	c.debugf("Getting ban exceptions...")
+
+	var result struct {
+		List []BanException `json:"list"`
+	}
+
+	err := c.call(ctx, "server_ban_exception.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get ban exceptions: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d ban exceptions", len(result.List))
+	return result.List, nil
+}
+
+// AddBanException adds a server ban exception (ELINE). An empty duration means permanent.
+func (c *RPCClient) AddBanException(ctx context.Context, mask, types, reason, duration string) error {
+	log.Printf("🛡️ Adding ban exception %s (%s)", mask, types)
+
+	params := map[string]interface{}{
+		"name":            mask,
+		"exception_types": types,
+		"reason":          reason,
+	}
+	if duration != "" {
+		params["duration_string"] = duration
+	}
+
+	err := c.call(ctx, "server_ban_exception.add", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to add ban exception: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Ban exception added successfully")
+	return nil
+}
+
+// DeleteBanException removes a server ban exception (ELINE)
+func (c *RPCClient) DeleteBanException(ctx context.Context, mask string) error {
+	log.Printf("🛡️ Deleting ban exception %s", mask)
+
+	err := c.call(ctx, "server_ban_exception.del", map[string]string{"name": mask}, nil)
+	if err != nil {
+		log.Printf("❌ Failed to delete ban exception: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Ban exception deleted successfully")
+	return nil
+}
+
+// GetNameBans gets the list of name bans (QLINEs)
+func (c *RPCClient) GetNameBans(ctx context.Context) ([]NameBan, error) {
+	c.debugf("Getting name bans...")
+
+	var result struct {
+		List []NameBan `json:"list"`
+	}
+
+	err := c.call(ctx, "name_ban.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get name bans: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d name bans", len(result.List))
+	return result.List, nil
+}
+
+// AddNameBan forbids a nick or channel mask. duration is an UnrealIRCd time
+// string such as "1d"; "0" makes the ban permanent.
+func (c *RPCClient) AddNameBan(ctx context.Context, name, reason, duration string) error {
+	log.Printf("🚷 Adding name ban on %s for %s", name, duration)
+
+	params := map[string]string{
+		"name":            name,
+		"reason":          reason,
+		"duration_string": duration,
+	}
+
+	err := c.call(ctx, "name_ban.add", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to add name ban: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Name ban added successfully")
+	return nil
+}
+
+// DelNameBan removes a name ban
+func (c *RPCClient) DelNameBan(ctx context.Context, name string) error {
+	log.Printf("🚷 Removing name ban on %s", name)
+
+	err := c.call(ctx, "name_ban.del", map[string]string{"name": name}, nil)
+	if err != nil {
+		log.Printf("❌ Failed to remove name ban: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Name ban removed successfully")
+	return nil
+}
+
+// GetSpamfilters gets the list of spamfilters
+func (c *RPCClient) GetSpamfilters(ctx context.Context) ([]Spamfilter, error) {
+	c.debugf("Getting spamfilters...")
+
+	var result struct {
+		List []Spamfilter `json:"list"`
+	}
+
+	err := c.call(ctx, "spamfilter.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get spamfilters: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d spamfilters", len(result.List))
+	return result.List, nil
+}
+
+// AddSpamfilter adds a spamfilter. An empty BanDuration uses the server's default.
+func (c *RPCClient) AddSpamfilter(ctx context.Context, filter Spamfilter) error {
+	log.Printf("🧹 Adding spamfilter %s (%s, %s)", filter.Name, filter.MatchType, filter.Action)
+
+	params := map[string]string{
+		"name":               filter.Name,
+		"match_type":         filter.MatchType,
+		"spamfilter_targets": filter.Targets,
+		"ban_action":         filter.Action,
+		"reason":             filter.Reason,
+	}
+	if filter.BanDuration != "" {
+		params["ban_duration"] = filter.BanDuration
+	}
+
+	err := c.call(ctx, "spamfilter.add", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to add spamfilter: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Spamfilter added successfully")
+	return nil
+}
+
+// DelSpamfilter removes a spamfilter. The server identifies a spamfilter by its
+// match string, match type, targets and action together.
+func (c *RPCClient) DelSpamfilter(ctx context.Context, name, matchType, targets, action string) error {
+	log.Printf("🧹 Deleting spamfilter %s (%s, %s)", name, matchType, action)
+
+	params := map[string]string{
+		"name":               name,
+		"match_type":         matchType,
+		"spamfilter_targets": targets,
+		"ban_action":         action,
+	}
+
+	err := c.call(ctx, "spamfilter.del", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to delete spamfilter: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Spamfilter deleted successfully")
+	return nil
+}
+
+// GetDenyChannels gets the forbidden channel name patterns
+func (c *RPCClient) GetDenyChannels(ctx context.Context) ([]DenyChannel, error) {
+	c.debugf("Getting deny channel entries...")
+
+	var result struct {
+		List []DenyChannel `json:"list"`
+	}
+
+	err := c.call(ctx, "deny_channel.list", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get deny channel entries: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Retrieved %d deny channel entries", len(result.List))
+	return result.List, nil
+}
+
+// AddDenyChannel forbids a channel name pattern. An empty redirect sends users nowhere.
+func (c *RPCClient) AddDenyChannel(ctx context.Context, channel, reason, redirect string) error {
+	log.Printf("🚷 Adding deny channel entry %s", channel)
+
+	params := map[string]string{
+		"channel": channel,
+		"reason":  reason,
+	}
+	if redirect != "" {
+		params["redirect"] = redirect
+	}
+
+	err := c.call(ctx, "deny_channel.add", params, nil)
+	if err != nil {
+		log.Printf("❌ Failed to add deny channel entry: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Deny channel entry added successfully")
+	return nil
+}
+
+// DeleteDenyChannel removes a forbidden channel name pattern
+func (c *RPCClient) DeleteDenyChannel(ctx context.Context, channel string) error {
+	log.Printf("🚷 Deleting deny channel entry %s", channel)
+
+	err := c.call(ctx, "deny_channel.del", map[string]string{"channel": channel}, nil)
+	if err != nil {
+		log.Printf("❌ Failed to delete deny channel entry: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Deny channel entry deleted successfully")
+	return nil
+}
+
+// GetThrottle gets the server-wide connection throttle settings
+func (c *RPCClient) GetThrottle(ctx context.Context) (*ThrottleSettings, error) {
+	c.debugf("Getting connection throttle...")
+
+	var result ThrottleSettings
+	err := c.call(ctx, "throttle.get", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to get throttle: %v", err)
+		return nil, err
+	}
+
+	c.debugf("Throttle retrieved: %d connections per %ds", result.Count, result.Period)
+	return &result, nil
+}
+
+// SetThrottle updates the server-wide connection throttle settings
+func (c *RPCClient) SetThrottle(ctx context.Context, settings ThrottleSettings) error {
+	log.Printf("🚦 Setting connection throttle to %d connections per %ds", settings.Count, settings.Period)
+
+	err := c.call(ctx, "throttle.set", settings, nil)
+	if err != nil {
+		log.Printf("❌ Failed to set throttle: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Throttle updated successfully")
+	return nil
+}
+
 // SendLog sends a log message to UnrealIRCd (requires UnrealIRCd 6.1.8+)
 func (c *RPCClient) SendLog(ctx context.Context, message, level, subsystem, eventID string) error {
 	log.Printf("📝 Sending log message: %s (level: %s, subsystem: %s, event_id: %s)",
@@ -582,12 +1589,96 @@ func (c *RPCClient) SendCopilotLog(ctx context.Context) error {
 	return c.SendLog(ctx, "Co-pilot is the best", "info", "admin", "COPILOT_MESSAGE")
 }
 
+// DetectCapabilities queries rpc.info for the methods the server supports and remembers them
+func (c *RPCClient) DetectCapabilities(ctx context.Context) (*Capabilities, error) {
+	log.Printf("🔍 Detecting RPC capabilities...")
+
+	var result json.RawMessage
+	err := c.call(ctx, "rpc.info", nil, &result)
+	if err != nil {
+		log.Printf("❌ Failed to detect capabilities: %v", err)
+		return nil, err
+	}
+
+	caps, err := ParseCapabilities(result)
+	if err != nil {
+		log.Printf("❌ Failed to parse capabilities: %v", err)
+		return nil, err
+	}
+	caps.DetectedAt = time.Now()
+
+	c.mutex.Lock()
+	c.caps = caps
+	c.mutex.Unlock()
+
+	log.Printf("✅ Server advertises %d RPC methods", len(caps.Methods))
+	return caps, nil
+}
+
+// ParseCapabilities parses an rpc.info result into a sorted method list
+func ParseCapabilities(data []byte) (*Capabilities, error) {
+	var info struct {
+		Methods map[string]RPCMethod `json:"methods"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid rpc.info payload: %w", err)
+	}
+
+	methods := make([]RPCMethod, 0, len(info.Methods))
+	for name, method := range info.Methods {
+		if method.Name == "" {
+			method.Name = name
+		}
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+
+	return &Capabilities{Methods: methods}, nil
+}
+
+// Ping issues a minimal RPC call and returns the measured round-trip time
+func (c *RPCClient) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	_, err := c.roundTrip(ctx, "rpc.info", nil) // Never cached
+	rtt := time.Since(start)
+	if err != nil {
+		c.debugf("Ping failed after %v: %v", rtt, err)
+		return rtt, err
+	}
+
+	c.debugf("Ping round-trip %v", rtt)
+	return rtt, nil
+}
+
+// Capabilities returns the last detected capabilities, or nil if detection hasn't run
+func (c *RPCClient) Capabilities() *Capabilities {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.caps
+}
+
+// HasMethod reports whether the server advertises an RPC method. Before
+// capabilities are detected every method is assumed to be available.
+func (c *RPCClient) HasMethod(name string) bool {
+	caps := c.Capabilities()
+	if caps == nil {
+		return true
+	}
+
+	for _, method := range caps.Methods {
+		if method.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // IsConnected checks if the client is connected
 func (c *RPCClient) IsConnected() bool {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	connected := c.conn != nil
-	log.Printf("🔍 Connection status check: %t", connected)
+	connected := c.conn != nil || c.socketConn != nil
+	c.debugf("Connection status check: %t", connected)
 	return connected
 }
 
@@ -598,6 +1689,8 @@ func (c *RPCClient) Disconnect() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	c.closed = true
+
 	if c.conn != nil {
 		log.Printf("🔒 Closing WebSocket connection...")
 		c.conn.Close()
@@ -605,15 +1698,42 @@ func (c *RPCClient) Disconnect() {
 		log.Printf("✅ WebSocket connection closed")
 	}
 
+	if c.socketConn != nil {
+		log.Printf("🔒 Closing UNIX socket connection...")
+		c.socketConn.Close()
+		c.socketConn = nil
+		log.Printf("✅ UNIX socket connection closed")
+	}
+
 	// Close all pending channels
 	log.Printf("🧹 Cleaning up %d pending requests...", len(c.pending))
+	c.failPending()
+
+	log.Printf("✅ RPC client disconnected")
+}
+
+// failPending closes the channel of every call waiting for a response, so the
+// callers return ErrNotConnected at once instead of waiting out their timeout.
+// Callers hold the mutex.
+func (c *RPCClient) failPending() {
 	for id, ch := range c.pending {
-		log.Printf("   Closing pending request ID: %d", id)
+		c.debugf("Failing pending request ID %d", id)
 		close(ch)
 	}
 	c.pending = make(map[int64]chan *RPCResponse)
+}
 
-	log.Printf("✅ RPC client disconnected")
+// notConnectedError returns ErrNotConnected, noting a reconnect in progress
+func (c *RPCClient) notConnectedError() error {
+	status := c.reconnects.snapshot()
+	switch {
+	case !status.Reconnecting:
+		return ErrNotConnected
+	case status.Attempts == 0:
+		return fmt.Errorf("%w: reconnecting", ErrNotConnected)
+	default:
+		return fmt.Errorf("%w: reconnecting (%d failed attempts)", ErrNotConnected, status.Attempts)
+	}
 }
 
 // Helper function for basic auth
@@ -674,20 +1794,3 @@ func parseISOTime(isoTime string) int64 {
 
 	return t.Unix()
 }
-
-// parseModesString converts mode string to slice
-func parseModesString(modes string) []string {
-	if modes == "" {
-		return []string{}
-	}
-
-	// Split modes by spaces and filter out empty strings
-	parts := strings.Fields(modes)
-	if len(parts) == 0 {
-		return []string{}
-	}
-
-	// Return the first part which contains the actual modes
-	// Example: "ntCHP 50:30d" -> ["ntCHP", "50:30d"]
-	return parts
-}
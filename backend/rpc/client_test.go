@@ -0,0 +1,437 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newEchoServer starts a WebSocket RPC server answering every request with
+// an empty result, and returns a client connected to it
+func newEchoServer(t *testing.T) *RPCClient {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req RPCRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": json.RawMessage(`{}`)}
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	return client
+}
+
+// Run with -race: concurrent calls must never write to the WebSocket at once
+func TestConcurrentCallsOverWebSocket(t *testing.T) {
+	// Writers only overlap with more than one P, which small CI machines lack
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	client := newEchoServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	// Large enough that each request takes several frame writes
+	message := strings.Repeat("x", 64*1024)
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.call(ctx, "log.send", map[string]string{"msg": message}, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("call: %v", err)
+	}
+}
+
+func TestReadSocketLineSkipsOversizedLines(t *testing.T) {
+	input := strings.Repeat("x", 100) + "\n" + `{"ok":true}` + "\n"
+	reader := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	if _, err := readSocketLine(reader, 32); err != errLineTooLong {
+		t.Fatalf("oversized line: err = %v, want errLineTooLong", err)
+	}
+	line, err := readSocketLine(reader, 32)
+	if err != nil || string(line) != `{"ok":true}` {
+		t.Fatalf("next line = %q, %v; want the following line intact", line, err)
+	}
+}
+
+func TestSocketHandlerSurvivesOversizedAndMalformedLines(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+
+	client := NewRPCClient("unix", "", "")
+	lost := make(chan struct{}, 1)
+	client.SetStateHandler(func(connected bool, err error) {
+		if !connected {
+			select {
+			case lost <- struct{}{}:
+			default:
+			}
+		}
+	})
+	client.socketConn = clientSide
+	client.isSocket = true
+	go client.handleSocketMessages(clientSide)
+	defer client.Disconnect()
+
+	// The server answers the request only after a malformed line and a line
+	// over the size limit
+	go func() {
+		reader := bufio.NewReader(serverSide)
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req RPCRequest
+		json.Unmarshal(line, &req)
+
+		serverSide.Write([]byte("{not json\n"))
+		serverSide.Write([]byte(`{"jsonrpc":"2.0","id":0,"result":"` + strings.Repeat("x", maxSocketLineSize) + "\"}\n"))
+		reply, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]bool{"ok": true}})
+		serverSide.Write(append(reply, '\n'))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result struct {
+		OK bool `json:"ok"`
+	}
+	if err := client.call(ctx, "log.send", map[string]string{"msg": "hi"}, &result); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if !result.OK {
+		t.Error("response after the bad lines was not delivered")
+	}
+
+	// Only the end of the stream stops the handler, and that starts a reconnect
+	select {
+	case <-lost:
+		t.Fatal("connection reported lost while the socket was still open")
+	default:
+	}
+	serverSide.Close()
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Error("closed socket did not start a reconnect")
+	}
+}
+
+func TestRedactedRequestHidesLoginPassword(t *testing.T) {
+	req := RPCRequest{
+		JSONRPC: "2.0",
+		Method:  "user.login",
+		Params:  AuthParams{Username: "panel", Password: "hunter2"},
+		ID:      1,
+	}
+
+	got := redactedRequest(req)
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("redacted request leaks the password:\n%s", got)
+	}
+	if !strings.Contains(got, "[REDACTED]") || !strings.Contains(got, "panel") {
+		t.Errorf("redacted request = %s, want the username kept and the password redacted", got)
+	}
+	if pw, _ := req.Params.(AuthParams); pw.Password != "hunter2" {
+		t.Error("redactedRequest changed the request it was given")
+	}
+}
+
+func TestResponsesMatchedWithNumberStringAndNullIDs(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var req RPCRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			var id interface{} = req.ID
+			switch req.Method {
+			case "id.string":
+				id = strconv.FormatInt(req.ID, 10)
+			case "id.null":
+				// A parse error matches no call and must not break the one that follows
+				conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{"code": -32700, "message": "Parse error"}})
+			case "id.other":
+				id = map[string]int64{"n": req.ID}
+			}
+			result := map[string]string{"method": req.Method}
+			if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+
+	tests := []struct {
+		method  string
+		matched bool
+	}{
+		{"id.number", true},
+		{"id.string", true},
+		{"id.null", true},
+		{"id.other", false},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		var result map[string]string
+		err := client.call(ctx, tt.method, nil, &result)
+		cancel()
+
+		if tt.matched && (err != nil || result["method"] != tt.method) {
+			t.Errorf("%s: result %v, err %v; want the response to reach its call", tt.method, result, err)
+		}
+		if !tt.matched && err == nil {
+			t.Errorf("%s: an id of the wrong type answered the call", tt.method)
+		}
+	}
+}
+
+func TestResponseIDRequestID(t *testing.T) {
+	tests := []struct {
+		json   string
+		want   int64
+		ok     bool
+		isNull bool
+	}{
+		{`42`, 42, true, false},
+		{`"42"`, 42, true, false},
+		{`null`, 0, false, true},
+		{`"abc"`, 0, false, false},
+		{`1.5`, 0, false, false},
+		{`{"n":1}`, 0, false, false},
+	}
+	for _, tt := range tests {
+		var response RPCResponse
+		if err := json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":`+tt.json+`}`), &response); err != nil {
+			t.Fatalf("id %s: unmarshal: %v", tt.json, err)
+		}
+		got, ok := response.ID.requestID()
+		if got != tt.want || ok != tt.ok || response.ID.IsNull() != tt.isNull {
+			t.Errorf("id %s: requestID() = %d, %v, IsNull() = %v; want %d, %v, %v", tt.json, got, ok, response.ID.IsNull(), tt.want, tt.ok, tt.isNull)
+		}
+	}
+
+	var missing RPCResponse
+	json.Unmarshal([]byte(`{"jsonrpc":"2.0","result":{}}`), &missing)
+	if !missing.ID.IsNull() {
+		t.Error("a missing id should read as null")
+	}
+}
+
+// writeLine writes a message as one NDJSON line
+func writeLine(conn net.Conn, message interface{}) {
+	data, _ := json.Marshal(message)
+	conn.Write(append(data, '\n'))
+}
+
+func TestSocketRequestsAreNDJSONLines(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	t.Cleanup(func() { serverSide.Close() })
+
+	client := NewRPCClient("unix", "panel", "secret")
+	client.mutex.Lock()
+	client.useSocket(clientSide)
+	client.mutex.Unlock()
+	t.Cleanup(func() { client.Disconnect() })
+
+	// The server reads one request per line, refuses the login as servers
+	// without user.login do, then answers the next two calls in reverse order
+	lines := make(chan string, 3)
+	go func() {
+		reader := bufio.NewReader(serverSide)
+		var held []RPCRequest
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+			var req RPCRequest
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				return
+			}
+
+			if req.Method == "user.login" {
+				writeLine(serverSide, map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": ErrCodeMethodNotFound, "message": "Method not found"}})
+				continue
+			}
+			if held = append(held, req); len(held) < 2 {
+				continue
+			}
+			for i := len(held) - 1; i >= 0; i-- {
+				writeLine(serverSide, map[string]interface{}{"jsonrpc": "2.0", "id": held[i].ID, "result": map[string]string{"method": held[i].Method}})
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.authenticateSocket(ctx); err != nil {
+		t.Fatalf("authenticateSocket: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, method := range []string{"user.list", "channel.list"} {
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			var result map[string]string
+			if err := client.call(ctx, method, nil, &result); err != nil {
+				t.Errorf("%s: %v", method, err)
+			} else if result["method"] != method {
+				t.Errorf("%s got the response for %s", method, result["method"])
+			}
+		}(method)
+	}
+	wg.Wait()
+
+	close(lines)
+	count := 0
+	for line := range lines {
+		count++
+		var req map[string]interface{}
+		if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 || json.Unmarshal([]byte(line), &req) != nil {
+			t.Errorf("request %q is not a single JSON line", line)
+		} else if req["jsonrpc"] != "2.0" || req["method"] == "" {
+			t.Errorf("request %q is not a JSON-RPC request", line)
+		}
+	}
+	if count != 3 {
+		t.Errorf("server read %d lines, want the login and two calls", count)
+	}
+}
+
+func TestConnectReportsRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // Handshake reply; 0 closes the server first
+		auth   bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, true},
+		{"forbidden", http.StatusForbidden, true},
+		{"server error", http.StatusInternalServerError, false},
+		{"unreachable", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			t.Cleanup(server.Close)
+			if tt.status == 0 {
+				server.Close()
+			}
+
+			client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "wrong")
+			err := client.Connect(context.Background())
+			if err == nil {
+				client.Disconnect()
+				t.Fatal("Connect succeeded")
+			}
+			if IsAuthError(err) != tt.auth {
+				t.Errorf("IsAuthError(%v) = %v, want %v", err, !tt.auth, tt.auth)
+			}
+			var authErr *AuthError
+			if tt.auth && (!errors.As(err, &authErr) || authErr.StatusCode != tt.status) {
+				t.Errorf("error %v, want an AuthError with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestSocketLoginReportsRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply map[string]interface{}
+		auth  bool // false expects the login to succeed
+	}{
+		{"accepted", map[string]interface{}{"result": true}, false},
+		{"no login method", map[string]interface{}{"error": map[string]interface{}{"code": ErrCodeMethodNotFound, "message": "Method not found"}}, false},
+		{"rejected", map[string]interface{}{"error": map[string]interface{}{"code": ErrCodeInvalidParams, "message": "Invalid credentials"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientSide, serverSide := net.Pipe()
+			t.Cleanup(func() { serverSide.Close() })
+
+			client := NewRPCClient("unix", "panel", "secret")
+			client.mutex.Lock()
+			client.useSocket(clientSide)
+			client.mutex.Unlock()
+			t.Cleanup(func() { client.Disconnect() })
+
+			go func() {
+				line, err := bufio.NewReader(serverSide).ReadString('\n')
+				if err != nil {
+					return
+				}
+				var req RPCRequest
+				json.Unmarshal([]byte(line), &req)
+				reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+				for key, value := range tt.reply {
+					reply[key] = value
+				}
+				writeLine(serverSide, reply)
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := client.authenticateSocket(ctx)
+			if tt.auth != (err != nil) || IsAuthError(err) != tt.auth {
+				t.Errorf("authenticateSocket = %v, want auth error %v", err, tt.auth)
+			}
+		})
+	}
+}
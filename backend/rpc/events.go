@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// UserChannelEventSources are the log sources carrying user connects, quits
+// and nick changes and channel joins, parts and kicks
+var UserChannelEventSources = []string{"connect", "nick", "join", "part", "kick"}
+
+// OperActivitySources are the log sources carrying oper logins and commands:
+// kills, server bans, SA* commands, CHG* commands and oper overrides
+var OperActivitySources = []string{"oper", "kill", "tkl", "sajoin", "sapart", "samode", "chgcmds", "operoverride"}
+
+// Event is a server log event delivered to a log.subscribe subscription. Which
+// of the optional fields are set depends on the event.
+type Event struct {
+	Subsystem string        `json:"subsystem"` // The log source, e.g. "join"
+	EventID   string        `json:"event_id"`  // e.g. "LOCAL_CLIENT_JOIN"
+	Level     string        `json:"level"`
+	Message   string        `json:"msg"`
+	Timestamp string        `json:"timestamp"`
+	Client    *EventClient  `json:"client,omitempty"`  // The user the event is about, or the kicker
+	Victim    *EventClient  `json:"victim,omitempty"`  // The kicked user
+	Channel   *EventChannel `json:"channel,omitempty"` // For join, part and kick
+	Reason    string        `json:"reason,omitempty"`  // Quit, part or kick reason
+	NewNick   string        `json:"new_nick,omitempty"`
+	TKL       *EventTKL     `json:"tkl,omitempty"` // For server ban events
+}
+
+// EventClient is the client part of a log event
+type EventClient struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	User     *struct {
+		Username   string `json:"username"`
+		Realname   string `json:"realname"`
+		VHost      string `json:"vhost"`
+		Servername string `json:"servername"`
+		Account    string `json:"account"`
+	} `json:"user,omitempty"`
+}
+
+// EventTKL is the server ban part of a log event
+type EventTKL struct {
+	Type  string `json:"type_string"`
+	Name  string `json:"name"`
+	SetBy string `json:"set_by"`
+}
+
+// EventChannel is the channel part of a log event
+type EventChannel struct {
+	Name string `json:"name"`
+}
+
+// eventSubscription remembers the handler and sources so a reconnect can subscribe again
+type eventSubscription struct {
+	mutex   sync.RWMutex
+	handler func(Event)
+	sources []string
+}
+
+// SetEventHandler registers the function that receives subscribed events. It
+// runs on the connection's reader goroutine, so it must not block.
+func (c *RPCClient) SetEventHandler(handler func(Event)) {
+	c.events.mutex.Lock()
+	defer c.events.mutex.Unlock()
+	c.events.handler = handler
+}
+
+// Subscribe asks the server to stream log events from the given sources. The
+// subscription is renewed after every reconnect.
+func (c *RPCClient) Subscribe(ctx context.Context, sources []string) error {
+	c.events.mutex.Lock()
+	c.events.sources = sources
+	c.events.mutex.Unlock()
+
+	return c.subscribe(ctx, sources)
+}
+
+func (c *RPCClient) subscribe(ctx context.Context, sources []string) error {
+	var result json.RawMessage
+	if err := c.call(ctx, "log.subscribe", map[string]interface{}{"sources": sources}, &result); err != nil {
+		return err
+	}
+	log.Printf("📡 Subscribed to RPC events: %v", sources)
+	return nil
+}
+
+// resubscribe renews the event subscription on a new connection, if there is one
+func (c *RPCClient) resubscribe() {
+	c.events.mutex.RLock()
+	sources := c.events.sources
+	c.events.mutex.RUnlock()
+	if len(sources) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.subscribe(ctx, sources); err != nil {
+		log.Printf("❌ Failed to resubscribe to RPC events: %v", err)
+	}
+}
+
+// isEvent reports whether a message that answered no pending call is an
+// event: either a notification, which has a method, or a result streamed
+// under the ID of an earlier log.subscribe call
+func (m *RPCResponse) isEvent() bool {
+	return m.Method != "" || (m.Error == nil && len(m.Result) > 0)
+}
+
+// dispatchEvent decodes an event message and passes it to the handler
+func (c *RPCClient) dispatchEvent(msg *RPCResponse) {
+	c.events.mutex.RLock()
+	handler := c.events.handler
+	c.events.mutex.RUnlock()
+	if handler == nil {
+		return
+	}
+
+	payload := msg.Params
+	if len(payload) == 0 {
+		payload = msg.Result
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		c.debugf("Skipping malformed RPC event: %v", err)
+		return
+	}
+	if event.Subsystem == "" {
+		// A plain result nobody was waiting for, e.g. for a call that timed out
+		return
+	}
+	handler(event)
+}
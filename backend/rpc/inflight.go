@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCallCancelled is returned by a call cancelled with CancelCall
+var ErrCallCancelled = errors.New("RPC call cancelled")
+
+// InFlightCall describes a request sent to the server that has not been answered yet
+type InFlightCall struct {
+	ID        int64     `json:"id"` // The JSON-RPC request ID
+	Method    string    `json:"method"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type activeCall struct {
+	info   InFlightCall
+	cancel context.CancelCauseFunc
+}
+
+// callTracker records the calls waiting for a response so they can be listed and cancelled
+type callTracker struct {
+	mutex sync.Mutex
+	calls map[int64]*activeCall
+}
+
+// track registers a call and returns a context that CancelCall can cancel,
+// and the function that unregisters the call once it returns
+func (t *callTracker) track(ctx context.Context, id int64, method string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	t.mutex.Lock()
+	if t.calls == nil {
+		t.calls = make(map[int64]*activeCall)
+	}
+	t.calls[id] = &activeCall{
+		info:   InFlightCall{ID: id, Method: method, StartedAt: time.Now()},
+		cancel: cancel,
+	}
+	t.mutex.Unlock()
+
+	return ctx, func() {
+		t.mutex.Lock()
+		delete(t.calls, id)
+		t.mutex.Unlock()
+		cancel(nil)
+	}
+}
+
+// InFlight lists the calls waiting for a response, oldest first
+func (c *RPCClient) InFlight() []InFlightCall {
+	c.calls.mutex.Lock()
+	defer c.calls.mutex.Unlock()
+
+	calls := make([]InFlightCall, 0, len(c.calls.calls))
+	for _, call := range c.calls.calls {
+		calls = append(calls, call.info)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].ID < calls[j].ID
+	})
+	return calls
+}
+
+// CancelCall makes an in-flight call return ErrCallCancelled to its caller,
+// returning false if no call with that ID is waiting. The server is not told;
+// a late response is discarded.
+func (c *RPCClient) CancelCall(id int64) bool {
+	c.calls.mutex.Lock()
+	call, ok := c.calls.calls[id]
+	c.calls.mutex.Unlock()
+
+	if ok {
+		call.cancel(ErrCallCancelled)
+	}
+	return ok
+}
@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCancelHangingCall(t *testing.T) {
+	// The server never answers, like one stuck on a slow request
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- client.call(ctx, "server_ban.add", map[string]string{"name": "*@192.0.2.1"}, nil)
+	}()
+
+	var calls []InFlightCall
+	for deadline := time.Now().Add(5 * time.Second); len(calls) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("hanging call never listed as in flight")
+		}
+		time.Sleep(10 * time.Millisecond)
+		calls = client.InFlight()
+	}
+	if len(calls) != 1 || calls[0].Method != "server_ban.add" || calls[0].StartedAt.IsZero() {
+		t.Fatalf("in flight = %+v, want the server_ban.add call", calls)
+	}
+
+	if !client.CancelCall(calls[0].ID) {
+		t.Fatal("CancelCall did not find the call")
+	}
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrCallCancelled) {
+			t.Errorf("cancelled call returned %v, want ErrCallCancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled call did not return")
+	}
+
+	if left := client.InFlight(); len(left) != 0 {
+		t.Errorf("in flight after cancelling = %+v, want none", left)
+	}
+	if client.CancelCall(calls[0].ID) {
+		t.Error("CancelCall found a call that already returned")
+	}
+}
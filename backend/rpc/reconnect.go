@@ -0,0 +1,238 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reconnection backoff. Delays double from reconnectBaseDelay, with jitter so
+// several panels do not retry in step. After reconnectRetryBudget attempts the
+// client stops speeding up and settles into retrying every reconnectMaxDelay.
+const (
+	reconnectBaseDelay   = 1 * time.Second
+	reconnectMaxDelay    = 2 * time.Minute
+	reconnectRetryBudget = 8
+)
+
+// ReconnectStatus describes the client's attempts to restore a lost connection
+type ReconnectStatus struct {
+	Reconnecting    bool       // A reconnect loop is running
+	Attempts        int        // Failed attempts since the connection was lost
+	TotalAttempts   int64      // Attempts since the client was created
+	BudgetExhausted bool       // Retrying at the maximum interval
+	LastError       string     // Error of the most recent failed attempt
+	NextAttemptAt   *time.Time // When the next attempt is due, while reconnecting
+}
+
+// reconnectTracker guards the reconnect status
+type reconnectTracker struct {
+	mutex  sync.Mutex
+	status ReconnectStatus
+}
+
+// begin marks a reconnect loop as started, returning false if one already runs
+func (t *reconnectTracker) begin() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status.Reconnecting {
+		return false
+	}
+	t.status.Reconnecting = true
+	t.status.Attempts = 0
+	t.status.BudgetExhausted = false
+	return true
+}
+
+// waiting records when the next attempt is due
+func (t *reconnectTracker) waiting(attempt int, next time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status.BudgetExhausted = attempt >= reconnectRetryBudget
+	t.status.NextAttemptAt = &next
+}
+
+// attempted records the outcome of an attempt. Success ends the loop.
+func (t *reconnectTracker) attempted(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status.TotalAttempts++
+	t.status.NextAttemptAt = nil
+	if err == nil {
+		t.status.Reconnecting = false
+		t.status.Attempts = 0
+		t.status.BudgetExhausted = false
+		t.status.LastError = ""
+		return
+	}
+	t.status.Attempts++
+	t.status.LastError = err.Error()
+}
+
+// stop ends the loop without a successful attempt
+func (t *reconnectTracker) stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status.Reconnecting = false
+	t.status.NextAttemptAt = nil
+}
+
+func (t *reconnectTracker) snapshot() ReconnectStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := t.status
+	if status.NextAttemptAt != nil {
+		next := *status.NextAttemptAt
+		status.NextAttemptAt = &next
+	}
+	return status
+}
+
+// backoffDelay returns the wait before reconnect attempt n (from 0). random
+// returns a value in [0, 1); half of each delay is fixed and half is random.
+func backoffDelay(attempt int, random func() float64) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < reconnectRetryBudget {
+		delay = min(reconnectBaseDelay<<attempt, reconnectMaxDelay)
+	}
+	return delay/2 + time.Duration(random()*float64(delay/2))
+}
+
+// SetStateHandler registers a function called when the connection is lost
+// (connected false, with the cause), after each failed reconnect attempt and
+// once the connection is restored (connected true)
+func (c *RPCClient) SetStateHandler(handler func(connected bool, err error)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onState = handler
+}
+
+// ReconnectStatus returns the state of reconnection attempts
+func (c *RPCClient) ReconnectStatus() ReconnectStatus {
+	return c.reconnects.snapshot()
+}
+
+// notifyState calls the state handler, if any
+func (c *RPCClient) notifyState(connected bool, err error) {
+	c.mutex.RLock()
+	handler := c.onState
+	c.mutex.RUnlock()
+
+	if handler != nil {
+		handler(connected, err)
+	}
+}
+
+// connectionLost is called by a reader that stopped. Unless the client was
+// closed, it starts reconnecting; a loop that is already running is left to it.
+func (c *RPCClient) connectionLost(cause error) {
+	c.mutex.RLock()
+	closed := c.closed
+	c.mutex.RUnlock()
+	if closed {
+		return
+	}
+
+	if !c.reconnects.begin() {
+		return
+	}
+	log.Printf("🔌 RPC connection lost: %v", cause)
+	c.notifyState(false, cause)
+	go c.reconnect()
+}
+
+// reconnect re-establishes the connection, backing off between failed attempts
+func (c *RPCClient) reconnect() {
+	for attempt := 0; ; attempt++ {
+		delay := backoffDelay(attempt, rand.Float64)
+		c.reconnects.waiting(attempt, time.Now().Add(delay))
+		log.Printf("🔄 Reconnecting to RPC in %v (attempt %d)", delay.Round(time.Millisecond), attempt+1)
+		time.Sleep(delay)
+
+		c.mutex.RLock()
+		closed, isSocket := c.closed, c.isSocket
+		c.mutex.RUnlock()
+		if closed {
+			c.reconnects.stop()
+			log.Printf("🛑 Client closed, not reconnecting")
+			return
+		}
+
+		// Dial without the mutex, so calls fail fast with ErrNotConnected
+		// instead of waiting for the attempt; it is only taken to install the
+		// new connection
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var socketConn net.Conn
+		var conn *websocket.Conn
+		var err error
+		if isSocket {
+			socketConn, err = c.dialUnixSocket(ctx)
+		} else {
+			conn, err = c.dialWebSocket(ctx)
+		}
+
+		if err == nil && !c.installReconnected(socketConn, conn) {
+			cancel()
+			c.reconnects.stop()
+			log.Printf("🛑 Client closed while reconnecting, dropping the new connection")
+			return
+		}
+
+		if err == nil && isSocket {
+			if err = c.authenticateSocket(ctx); err != nil {
+				// Its reader stops and reports the loss, which this loop already handles
+				c.mutex.Lock()
+				if c.socketConn != nil {
+					c.socketConn.Close()
+					c.socketConn = nil
+				}
+				c.mutex.Unlock()
+			}
+		}
+		cancel()
+
+		c.reconnects.attempted(err)
+		c.notifyState(err == nil, err)
+		if err == nil {
+			log.Printf("✅ RPC connection restored after %d attempts", attempt+1)
+			c.resubscribe()
+			return
+		}
+		log.Printf("❌ RPC reconnect attempt %d failed: %v", attempt+1, err)
+	}
+}
+
+// installReconnected makes a connection dialed by the reconnect loop the
+// client's own. If the client was closed during the dial, the connection is
+// closed instead and false returned.
+func (c *RPCClient) installReconnected(socketConn net.Conn, conn *websocket.Conn) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		if socketConn != nil {
+			socketConn.Close()
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		return false
+	}
+
+	if socketConn != nil {
+		c.useSocket(socketConn)
+	} else {
+		c.useWebSocket(conn)
+	}
+	return true
+}
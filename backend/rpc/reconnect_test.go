@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectAfterDroppedConnection(t *testing.T) {
+	drop := make(chan struct{})
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	var connections atomic.Int32
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := connections.Add(1) == 1
+		if !first {
+			// Hold the reconnect's handshake open until the test has checked
+			// that calls do not wait for it
+			close(dialing)
+			<-release
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if first {
+			<-drop
+			return
+		}
+		for {
+			var req RPCRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": json.RawMessage(`{}`)}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewRPCClient("ws"+strings.TrimPrefix(server.URL, "http"), "panel", "secret")
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+
+	close(drop)
+	select {
+	case <-dialing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not try to reconnect")
+	}
+
+	// The reconnect is stuck in its handshake; calls must not wait for it
+	start := time.Now()
+	err := client.call(context.Background(), "log.send", nil, nil)
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("call during reconnect = %v, want ErrNotConnected", err)
+	}
+	if client.IsConnected() {
+		t.Error("IsConnected during reconnect = true")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call during reconnect took %v, want it to fail fast", elapsed)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.IsConnected() || client.ReconnectStatus().Reconnecting {
+		if time.Now().After(deadline) {
+			t.Fatalf("not reconnected: %+v", client.ReconnectStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.call(context.Background(), "log.send", nil, nil); err != nil {
+		t.Errorf("call after reconnect: %v", err)
+	}
+	if status := client.ReconnectStatus(); status.TotalAttempts != 1 || status.LastError != "" {
+		t.Errorf("status after reconnect = %+v, want one successful attempt", status)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	lowest := func() float64 { return 0 }
+	highest := func() float64 { return 0.999999 }
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{3, 4 * time.Second, 8 * time.Second},
+		{6, 32 * time.Second, 64 * time.Second},
+		{7, reconnectMaxDelay / 2, reconnectMaxDelay}, // 128s, capped
+		{reconnectRetryBudget, reconnectMaxDelay / 2, reconnectMaxDelay},
+		{100, reconnectMaxDelay / 2, reconnectMaxDelay}, // No overflow past the budget
+	}
+	for _, tt := range tests {
+		if got := backoffDelay(tt.attempt, lowest); got != tt.min {
+			t.Errorf("attempt %d with no jitter: %v, want %v", tt.attempt, got, tt.min)
+		}
+		if got := backoffDelay(tt.attempt, highest); got < tt.min || got >= tt.max {
+			t.Errorf("attempt %d with full jitter: %v, want in [%v, %v)", tt.attempt, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestReconnectTrackerCountsAttempts(t *testing.T) {
+	var tracker reconnectTracker
+	if !tracker.begin() {
+		t.Fatal("begin refused with no loop running")
+	}
+	if tracker.begin() {
+		t.Error("begin allowed a second loop")
+	}
+
+	failure := errors.New("connection refused")
+	for attempt := 0; attempt <= reconnectRetryBudget; attempt++ {
+		tracker.waiting(attempt, time.Now().Add(backoffDelay(attempt, func() float64 { return 0 })))
+		status := tracker.snapshot()
+		if status.BudgetExhausted != (attempt >= reconnectRetryBudget) || status.NextAttemptAt == nil {
+			t.Errorf("waiting for attempt %d: %+v", attempt, status)
+		}
+		tracker.attempted(failure)
+	}
+
+	status := tracker.snapshot()
+	want := reconnectRetryBudget + 1
+	if !status.Reconnecting || status.Attempts != want || status.TotalAttempts != int64(want) || status.LastError != failure.Error() || status.NextAttemptAt != nil {
+		t.Errorf("after %d failures: %+v", want, status)
+	}
+
+	tracker.attempted(nil)
+	status = tracker.snapshot()
+	if status.Reconnecting || status.Attempts != 0 || status.BudgetExhausted || status.LastError != "" || status.TotalAttempts != int64(want+1) {
+		t.Errorf("after success: %+v, want the loop ended and the failures cleared", status)
+	}
+}
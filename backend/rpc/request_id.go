@@ -0,0 +1,17 @@
+package rpc
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID tags ctx with the ID of the panel request it serves, so the
+// RPC calls made for the request can be matched to it in the logs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID ctx was tagged with, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
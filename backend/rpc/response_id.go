@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// ResponseID is the id of a JSON-RPC response. The spec allows a number, a
+// string or null; requests from this client always use numbers, but servers
+// and proxies may echo them back as strings. Null marks an error about a
+// request the server could not parse, and is also what a missing id decodes to.
+type ResponseID struct {
+	raw json.RawMessage // As received, nil for null or missing
+}
+
+// UnmarshalJSON keeps the id as received. An id of any other type than those
+// the spec allows is kept too, rather than failing the whole message; it just
+// never matches a request.
+func (id *ResponseID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		id.raw = nil
+		return nil
+	}
+	id.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON writes the id as it was received
+func (id ResponseID) MarshalJSON() ([]byte, error) {
+	if id.raw == nil {
+		return []byte("null"), nil
+	}
+	return id.raw, nil
+}
+
+// IsNull reports whether the id was null or missing
+func (id ResponseID) IsNull() bool {
+	return id.raw == nil
+}
+
+// requestID returns the numeric request ID the response answers, accepting
+// a number or a string holding one. False means it cannot be one of ours.
+func (id ResponseID) requestID() (int64, bool) {
+	if id.raw == nil {
+		return 0, false
+	}
+
+	text := string(id.raw)
+	var s string
+	if json.Unmarshal(id.raw, &s) == nil {
+		text = s
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	return n, err == nil
+}
+
+// String formats the id for logs
+func (id ResponseID) String() string {
+	if id.raw == nil {
+		return "null"
+	}
+	return string(id.raw)
+}
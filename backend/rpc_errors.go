@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Error codes for RPC failures that carry no JSON-RPC error code
+const (
+	rpcCodeTimeout     = "rpc_timeout"
+	rpcCodeUnavailable = "rpc_unavailable"
+	rpcCodeCancelled   = "rpc_cancelled"
+)
+
+// APIError is the structured error returned when an RPC call fails, so
+// clients can act on the server's error code instead of parsing text
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// rpcErrorStatus maps a JSON-RPC error code to the HTTP status returned to clients
+func rpcErrorStatus(code int) int {
+	switch code {
+	case rpc.ErrCodeInvalidParams, rpc.ErrCodeInvalidName:
+		return http.StatusBadRequest
+	case rpc.ErrCodeNotFound, rpc.ErrCodeUserNotInChannel:
+		return http.StatusNotFound
+	case rpc.ErrCodeAlreadyExists:
+		return http.StatusConflict
+	case rpc.ErrCodeMethodNotFound:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// rpcAPIError converts an RPC failure to its API error and HTTP status.
+// fallback is the message used when the server sent none, e.g. on a timeout.
+func rpcAPIError(err error, fallback string) (APIError, int) {
+	var rpcErr *rpc.RPCError
+	switch {
+	case errors.As(err, &rpcErr):
+		message := rpcErr.Message
+		if message == "" {
+			message = fallback
+		}
+		return APIError{Code: fmt.Sprintf("rpc_%d", rpcErr.Code), Message: message}, rpcErrorStatus(rpcErr.Code)
+	case errors.Is(err, rpc.ErrCallCancelled):
+		return APIError{Code: rpcCodeCancelled, Message: fallback + ": cancelled by an admin"}, http.StatusServiceUnavailable
+	case errors.Is(err, rpc.ErrNotConnected):
+		return APIError{Code: rpcCodeUnavailable, Message: fallback + ": " + err.Error()}, http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return APIError{Code: rpcCodeTimeout, Message: fallback}, http.StatusGatewayTimeout
+	default:
+		return APIError{Code: rpcCodeUnavailable, Message: fallback}, http.StatusBadGateway
+	}
+}
+
+// writeRPCError writes err as {"error": {"code": "rpc_-32602", "message": "..."}}
+func writeRPCError(w http.ResponseWriter, err error, fallback string) {
+	apiErr, status := rpcAPIError(err, fallback)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]APIError{"error": apiErr})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestRPCAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   APIError
+		status int
+	}{
+		{"invalid params", &rpc.RPCError{Code: rpc.ErrCodeInvalidParams, Message: "Invalid parameters"}, APIError{"rpc_-32602", "Invalid parameters"}, http.StatusBadRequest},
+		{"invalid name", &rpc.RPCError{Code: rpc.ErrCodeInvalidName, Message: "Invalid name"}, APIError{"rpc_-1002", "Invalid name"}, http.StatusBadRequest},
+		{"not found", &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Nickname not found"}, APIError{"rpc_-1000", "Nickname not found"}, http.StatusNotFound},
+		{"user not in channel", &rpc.RPCError{Code: rpc.ErrCodeUserNotInChannel, Message: "Not in channel"}, APIError{"rpc_-1003", "Not in channel"}, http.StatusNotFound},
+		{"already exists", &rpc.RPCError{Code: rpc.ErrCodeAlreadyExists, Message: "Ban already exists"}, APIError{"rpc_-1001", "Ban already exists"}, http.StatusConflict},
+		{"method not found", &rpc.RPCError{Code: rpc.ErrCodeMethodNotFound, Message: "Method not found"}, APIError{"rpc_-32601", "Method not found"}, http.StatusNotImplemented},
+		{"other server error", &rpc.RPCError{Code: rpc.ErrCodeInternal, Message: "Internal error"}, APIError{"rpc_-32603", "Internal error"}, http.StatusBadGateway},
+		{"error without message", &rpc.RPCError{Code: rpc.ErrCodeDenied}, APIError{"rpc_-1005", "Failed to ban"}, http.StatusBadGateway},
+		{"wrapped server error", fmt.Errorf("ban: %w", &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "No such ban"}), APIError{"rpc_-1000", "No such ban"}, http.StatusNotFound},
+		{"cancelled", rpc.ErrCallCancelled, APIError{rpcCodeCancelled, "Failed to ban: cancelled by an admin"}, http.StatusServiceUnavailable},
+		{"not connected", rpc.ErrNotConnected, APIError{rpcCodeUnavailable, "Failed to ban: " + rpc.ErrNotConnected.Error()}, http.StatusServiceUnavailable},
+		{"timeout", context.DeadlineExceeded, APIError{rpcCodeTimeout, "Failed to ban"}, http.StatusGatewayTimeout},
+		{"anything else", errors.New("broken pipe"), APIError{rpcCodeUnavailable, "Failed to ban"}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		got, status := rpcAPIError(tt.err, "Failed to ban")
+		if got != tt.want || status != tt.status {
+			t.Errorf("%s: %+v, %d; want %+v, %d", tt.name, got, status, tt.want, tt.status)
+		}
+
+		w := httptest.NewRecorder()
+		writeRPCError(w, tt.err, "Failed to ban")
+		var body map[string]APIError
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != tt.status || body["error"] != tt.want {
+			t.Errorf("%s: wrote %d %+v (%v); want %d %+v", tt.name, w.Code, body, err, tt.status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// panelEventEcho is how long a membership change made through the panel
+// suppresses the same change streamed back by the server, which would
+// otherwise reach clients twice
+const panelEventEcho = 10 * time.Second
+
+// NetworkUserEvent is a user connecting to, leaving or renaming on the
+// network, streamed from the server. The real host and IP are left out, as
+// they are in user lists for most roles.
+type NetworkUserEvent struct {
+	Nick     string    `json:"nick"`
+	NewNick  string    `json:"newNick,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Host     string    `json:"host,omitempty"` // The visible (virtual) host
+	Account  string    `json:"account,omitempty"`
+	Server   string    `json:"server,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (e NetworkUserEvent) MarshalJSON() ([]byte, error) {
+	type plain NetworkUserEvent
+	return marshalWithLocalTimes(plain(e))
+}
+
+// panelEchoes remembers recent membership changes made through the panel
+var panelEchoes = struct {
+	sync.Mutex
+	seen map[string]time.Time
+}{seen: make(map[string]time.Time)}
+
+func channelEventKey(event ChannelEvent) string {
+	return strings.ToLower(event.Channel + " " + event.Event + " " + event.Nick)
+}
+
+// notePanelChannelEvent records a change made through the panel
+func notePanelChannelEvent(event ChannelEvent) {
+	panelEchoes.Lock()
+	defer panelEchoes.Unlock()
+
+	now := time.Now()
+	for key, at := range panelEchoes.seen {
+		if now.Sub(at) > panelEventEcho {
+			delete(panelEchoes.seen, key)
+		}
+	}
+	panelEchoes.seen[channelEventKey(event)] = now
+}
+
+// isPanelEcho reports whether a streamed change was made through the panel,
+// consuming the record so later identical changes still get through
+func isPanelEcho(event ChannelEvent) bool {
+	panelEchoes.Lock()
+	defer panelEchoes.Unlock()
+
+	key := channelEventKey(event)
+	at, ok := panelEchoes.seen[key]
+	delete(panelEchoes.seen, key)
+	return ok && time.Since(at) <= panelEventEcho
+}
+
+// subscribeRPCEvents streams user and channel events from the server to
+// WebSocket clients, and oper activity to the oper_activity table, when the
+// server supports log subscriptions
+func subscribeRPCEvents(ctx context.Context) {
+	if !rpcClient.HasMethod("log.subscribe") {
+		log.Printf("ℹ️ RPC server has no log.subscribe; live user and channel events and oper activity are unavailable")
+		return
+	}
+
+	sources := append(append([]string{}, rpc.UserChannelEventSources...), rpc.OperActivitySources...)
+	rpcClient.SetEventHandler(onRPCEvent)
+	if err := rpcClient.Subscribe(ctx, sources); err != nil {
+		log.Printf("⚠️ Failed to subscribe to RPC events: %v", err)
+	}
+}
+
+// onRPCEvent forwards a streamed server event to WebSocket clients: network
+// connects, quits and nick changes to everyone as userJoin, userQuit and
+// userNick, and channel joins, parts and kicks as channelEvent messages to
+// clients subscribed to the channel. Oper activity is recorded.
+func onRPCEvent(event rpc.Event) {
+	if isOperActivity(event) {
+		recordOperActivity(event)
+		return
+	}
+
+	if event.Client == nil {
+		return
+	}
+
+	switch event.Subsystem {
+	case "connect":
+		switch {
+		case strings.HasSuffix(event.EventID, "_DISCONNECT"):
+			broadcastUserEvent("userQuit", event)
+		case strings.HasSuffix(event.EventID, "_CONNECT"):
+			broadcastUserEvent("userJoin", event)
+		}
+	case "nick":
+		if event.NewNick != "" {
+			broadcastUserEvent("userNick", event)
+		}
+	case "join", "part":
+		if event.Channel == nil {
+			return
+		}
+		forwardChannelEvent(ChannelEvent{
+			Channel: event.Channel.Name,
+			Event:   event.Subsystem,
+			Nick:    event.Client.Name,
+			Reason:  event.Reason,
+			Time:    parseRPCTimestamp(event.Timestamp),
+		})
+	case "kick":
+		if event.Channel == nil || event.Victim == nil {
+			return
+		}
+		forwardChannelEvent(ChannelEvent{
+			Channel: event.Channel.Name,
+			Event:   "kick",
+			Nick:    event.Victim.Name,
+			Actor:   event.Client.Name,
+			Reason:  event.Reason,
+			Time:    parseRPCTimestamp(event.Timestamp),
+		})
+	}
+}
+
+// forwardChannelEvent publishes a streamed channel event unless the panel already announced it
+func forwardChannelEvent(event ChannelEvent) {
+	if isPanelEcho(event) {
+		return
+	}
+	publishChannelEvent(event)
+}
+
+// broadcastUserEvent sends a network user event to every WebSocket client
+func broadcastUserEvent(kind string, event rpc.Event) {
+	data := NetworkUserEvent{
+		Nick:    event.Client.Name,
+		NewNick: event.NewNick,
+		Reason:  event.Reason,
+		Time:    parseRPCTimestamp(event.Timestamp),
+	}
+	if data.Time.IsZero() {
+		data.Time = time.Now()
+	}
+	if user := event.Client.User; user != nil {
+		data.Username = user.Username
+		data.Host = user.VHost
+		data.Account = user.Account
+		data.Server = user.Servername
+	}
+
+	wsEvents.publish(wsEvent{kind: kind}, data, func(c *wsClient) bool {
+		return true
+	})
+}
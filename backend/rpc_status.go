@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// RPC connection states reported by /health and /api/admin/rpc/status
+const (
+	rpcStateConnected    = "connected"
+	rpcStateAuthFailed   = "auth_failed"
+	rpcStateUnreachable  = "unreachable"
+	rpcStateReconnecting = "reconnecting"
+	rpcStateMock         = "mock"
+)
+
+// rpcAuthRemediation tells admins what to check when UnrealIRCd rejects the credentials
+const rpcAuthRemediation = "Check UNREAL_RPC_USERNAME and UNREAL_RPC_PASSWORD against the rpc-user block in unrealircd.conf, and that the rpc-user mask allows this host"
+
+// RPCStatus describes the outcome of the most recent RPC connection attempt
+type RPCStatus struct {
+	State       string    `json:"state"`
+	Connected   bool      `json:"connected"`
+	AuthFailed  bool      `json:"auth_failed"`
+	LastError   string    `json:"last_error,omitempty"`
+	Remediation string    `json:"remediation,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Reconnection after a lost connection, see rpc.ReconnectStatus
+	Reconnecting           bool       `json:"reconnecting"`
+	ReconnectAttempts      int        `json:"reconnect_attempts"`
+	ReconnectAttemptsTotal int64      `json:"reconnect_attempts_total"`
+	RetryBudgetExhausted   bool       `json:"retry_budget_exhausted"`
+	NextAttemptAt          *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (r RPCStatus) MarshalJSON() ([]byte, error) {
+	type plain RPCStatus
+	return marshalWithLocalTimes(plain(r))
+}
+
+// rpcStatusTracker guards the shared RPC status
+type rpcStatusTracker struct {
+	mutex  sync.RWMutex
+	status RPCStatus
+}
+
+var rpcStatus = &rpcStatusTracker{status: RPCStatus{State: rpcStateMock}}
+
+// set records a new RPC state and the error that caused it, if any
+func (t *rpcStatusTracker) set(state string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status = RPCStatus{
+		State:      state,
+		Connected:  state == rpcStateConnected,
+		AuthFailed: state == rpcStateAuthFailed,
+		UpdatedAt:  time.Now(),
+	}
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+	if state == rpcStateAuthFailed {
+		t.status.Remediation = rpcAuthRemediation
+	}
+}
+
+// snapshot returns a copy of the current RPC status
+func (t *rpcStatusTracker) snapshot() RPCStatus {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.status
+}
+
+// onRPCStateChange keeps the RPC status current while the client reconnects
+func onRPCStateChange(connected bool, err error) {
+	switch {
+	case connected:
+		rpcStatus.set(rpcStateConnected, nil)
+	case rpc.IsAuthError(err):
+		rpcStatus.set(rpcStateAuthFailed, err)
+	default:
+		rpcStatus.set(rpcStateUnreachable, err)
+	}
+}
+
+// currentRPCStatus returns the RPC status with the live connection and reconnect state
+func currentRPCStatus() RPCStatus {
+	status := rpcStatus.snapshot()
+	status.Connected = rpcClient != nil && rpcClient.IsConnected()
+	if rpcClient != nil {
+		reconnect := rpcClient.ReconnectStatus()
+		status.Reconnecting = reconnect.Reconnecting
+		status.ReconnectAttempts = reconnect.Attempts
+		status.ReconnectAttemptsTotal = reconnect.TotalAttempts
+		status.RetryBudgetExhausted = reconnect.BudgetExhausted
+		status.NextAttemptAt = reconnect.NextAttemptAt
+
+		// Rejected credentials stay the headline; they need an admin, not a retry
+		if reconnect.Reconnecting && status.State != rpcStateAuthFailed {
+			status.State = rpcStateReconnecting
+		}
+	}
+	return status
+}
+
+// getRPCStatusHandler reports the RPC connection state to admins
+func getRPCStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentRPCStatus())
+}
+
+// rpcPingTimeout caps how long /api/admin/rpc/ping waits for a reply
+const rpcPingTimeout = 3 * time.Second
+
+// RPCPing is the result of a single RPC round-trip measurement
+type RPCPing struct {
+	Success   bool    `json:"success"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+	Mock      bool    `json:"mock,omitempty"`
+}
+
+// getRPCPingHandler measures a fresh RPC round-trip. Results are never cached.
+func getRPCPingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if config.UseMockData || rpcClient == nil {
+		json.NewEncoder(w).Encode(RPCPing{Success: true, Mock: true})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rpcPingTimeout)
+	defer cancel()
+
+	rtt, err := rpcClient.Ping(ctx)
+	ping := RPCPing{
+		Success:   err == nil,
+		LatencyMs: float64(rtt.Microseconds()) / 1000,
+	}
+	if err != nil {
+		log.Printf("⚠️ RPC ping failed after %v: %v", rtt, err)
+		ping.Error = err.Error()
+	}
+
+	json.NewEncoder(w).Encode(ping)
+}
+
+// getRPCCacheStatsHandler reports RPC result cache hits and misses
+func getRPCCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if rpcClient == nil {
+		http.Error(w, "RPC is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rpcClient.CacheStats())
+}
+
+// getRPCInFlightHandler lists RPC calls still waiting for a response, oldest first
+func getRPCInFlightHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	calls := []rpc.InFlightCall{}
+	if rpcClient != nil {
+		calls = rpcClient.InFlight()
+	}
+	json.NewEncoder(w).Encode(calls)
+}
+
+// cancelRPCInFlightHandler makes a hanging RPC call return to its caller. The
+// server may still carry it out; only the panel stops waiting.
+func cancelRPCInFlightHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid call ID", http.StatusBadRequest)
+		return
+	}
+
+	if rpcClient == nil || !rpcClient.CancelCall(id) {
+		http.Error(w, "No such in-flight call", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("🛑 %s cancelled RPC call %d", actorName(r), id)
+	recordAudit(r, "rpc.cancel", strconv.FormatInt(id, 10), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
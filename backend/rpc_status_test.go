@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRPCStatusReportsAuthFailures(t *testing.T) {
+	saved := rpcStatus.snapshot()
+	t.Cleanup(func() {
+		rpcStatus.mutex.Lock()
+		rpcStatus.status = saved
+		rpcStatus.mutex.Unlock()
+	})
+
+	tests := []struct {
+		state       string
+		err         error
+		authFailed  bool
+		remediation bool
+	}{
+		{rpcStateAuthFailed, errors.New("RPC authentication failed (HTTP 401)"), true, true},
+		{rpcStateUnreachable, errors.New("connection refused"), false, false},
+		{rpcStateMock, nil, false, false},
+	}
+	for _, tt := range tests {
+		rpcStatus.set(tt.state, tt.err)
+
+		w := httptest.NewRecorder()
+		getRPCStatusHandler(w, httptest.NewRequest("GET", "/api/admin/rpc/status", nil))
+		var status RPCStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+
+		wantError := ""
+		if tt.err != nil {
+			wantError = tt.err.Error()
+		}
+		if status.State != tt.state || status.AuthFailed != tt.authFailed || status.LastError != wantError ||
+			(status.Remediation != "") != tt.remediation || status.Connected {
+			t.Errorf("status after %s = %+v", tt.state, status)
+		}
+	}
+}
+
+func TestRPCPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		results map[string]interface{} // nil uses the mock data
+		want    RPCPing
+	}{
+		{"mock data", nil, RPCPing{Success: true, Mock: true}},
+		{"reply", map[string]interface{}{"rpc.info": map[string]interface{}{}}, RPCPing{Success: true}},
+		{"error", map[string]interface{}{"rpc.info": &rpc.RPCError{Code: rpc.ErrCodeInternal, Message: "Internal error"}}, RPCPing{Error: "Internal error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.UseMockData = true
+			if tt.results != nil {
+				startFakeRPC(t, tt.results)
+			}
+
+			w := httptest.NewRecorder()
+			getRPCPingHandler(w, httptest.NewRequest("GET", "/api/admin/rpc/ping", nil))
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+			var ping RPCPing
+			if err := json.NewDecoder(w.Body).Decode(&ping); err != nil {
+				t.Fatalf("decode ping: %v", err)
+			}
+
+			if ping.Success != tt.want.Success || ping.Mock != tt.want.Mock || !strings.Contains(ping.Error, tt.want.Error) || (tt.want.Error == "") != (ping.Error == "") {
+				t.Errorf("ping = %+v, want %+v", ping, tt.want)
+			}
+			if tt.results != nil && ping.LatencyMs <= 0 {
+				t.Errorf("latency = %vms, want a measured round-trip", ping.LatencyMs)
+			}
+		})
+	}
+}
+
+func TestCancelInFlightCall(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"throttle.get": fakeNoReply{}})
+	adminID := createTestUser(t, "boss", "admin")
+
+	inFlight := func() []rpc.InFlightCall {
+		w := httptest.NewRecorder()
+		getRPCInFlightHandler(w, httptest.NewRequest("GET", "/api/admin/rpc/inflight", nil))
+		var calls []rpc.InFlightCall
+		if err := json.NewDecoder(w.Body).Decode(&calls); err != nil {
+			t.Fatalf("decode in-flight calls: %v", err)
+		}
+		return calls
+	}
+	cancel := func(id string) int {
+		r := asUser("DELETE", "/api/admin/rpc/inflight/"+id, "", adminID, "boss", "admin")
+		w := httptest.NewRecorder()
+		cancelRPCInFlightHandler(w, mux.SetURLVars(r, map[string]string{"id": id}))
+		return w.Code
+	}
+
+	hung := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		getThrottleHandler(w, httptest.NewRequest("GET", "/api/server/throttle", nil))
+		hung <- w
+	}()
+
+	var calls []rpc.InFlightCall
+	deadline := time.Now().Add(5 * time.Second)
+	for calls = inFlight(); len(calls) == 0; calls = inFlight() {
+		if time.Now().After(deadline) {
+			t.Fatal("the hanging call was never listed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(calls) != 1 || calls[0].Method != "throttle.get" || calls[0].StartedAt.IsZero() {
+		t.Fatalf("in-flight calls = %+v, want the throttle.get call", calls)
+	}
+	id := strconv.FormatInt(calls[0].ID, 10)
+
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{"x", http.StatusBadRequest},
+		{strconv.FormatInt(calls[0].ID+1000, 10), http.StatusNotFound},
+		{id, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := cancel(tt.id); got != tt.want {
+			t.Errorf("cancel %s = %d, want %d", tt.id, got, tt.want)
+		}
+	}
+
+	select {
+	case w := <-hung:
+		var body map[string]APIError
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != http.StatusServiceUnavailable || body["error"].Code != rpcCodeCancelled {
+			t.Errorf("cancelled request = %d %+v, want 503 %s", w.Code, body, rpcCodeCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cancelled request did not return")
+	}
+
+	if calls := inFlight(); len(calls) != 0 {
+		t.Errorf("in-flight calls after cancelling = %+v, want none", calls)
+	}
+	if got := cancel(id); got != http.StatusNotFound {
+		t.Errorf("cancelling again = %d, want 404", got)
+	}
+	if got := auditCount(t, "rpc.cancel"); got != 1 {
+		t.Errorf("rpc.cancel audit entries = %d, want 1", got)
+	}
+}
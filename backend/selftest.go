@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// minJWTSecretLength is the shortest JWT_SECRET the self-test accepts
+const minJWTSecretLength = 32
+
+// defaultJWTSecret was the JWT_SECRET used when none was configured. It is
+// public, so a panel still using it is refused like one without a secret.
+const defaultJWTSecret = "default-secret-change-me"
+
+// Outcomes of a self-test check
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+	selfTestSkip = "skip" // Not applicable to this configuration
+)
+
+// SelfTestCheck is the outcome of one self-test check
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // pass, fail or skip
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is printed by --selftest
+type SelfTestReport struct {
+	Passed bool            `json:"passed"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// runSelfTest checks the configuration, the database and the RPC connection,
+// writes the report to out and returns the process exit status: 0 when no
+// check failed, 1 otherwise. It does not start the HTTP server.
+func runSelfTest(out io.Writer) int {
+	report := SelfTestReport{Passed: true}
+	for _, check := range []func() SelfTestCheck{selfTestConfig, selfTestJWTSecret, selfTestDatabase, selfTestRPC} {
+		result := check()
+		if result.Status == selfTestFail {
+			report.Passed = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// selfTestConfig checks the settings that would otherwise only fail once the panel runs
+func selfTestConfig() SelfTestCheck {
+	check := SelfTestCheck{Name: "config"}
+
+	var problems []string
+	if _, err := listenAddress(config.BindAddress, config.Port); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateOrigins(config.AllowedOrigins); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseTrustedProxies(config.TrustedProxies); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if !config.UseMockData {
+		if config.UnrealRPCURL == "" || config.UnrealRPCUsername == "" {
+			problems = append(problems, "UNREAL_RPC_URL and UNREAL_RPC_USERNAME are required unless USE_MOCK_DATA is true")
+		} else if config.UnrealRPCURL != "unix" {
+			if u, err := url.Parse(config.UnrealRPCURL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("UNREAL_RPC_URL %q is not a ws:// or wss:// URL", config.UnrealRPCURL))
+			}
+		}
+	}
+	if config.GeoIPCountryCoords != "" {
+		if _, err := loadCountryCoords(config.GeoIPCountryCoords); err != nil {
+			problems = append(problems, fmt.Sprintf("GEOIP_COUNTRY_COORDS %s: %v", config.GeoIPCountryCoords, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		check.Status = selfTestFail
+		check.Detail = strings.Join(problems, "; ")
+		return check
+	}
+	check.Status = selfTestPass
+	return check
+}
+
+// selfTestJWTSecret checks that tokens are not signed with a guessable secret
+func selfTestJWTSecret() SelfTestCheck {
+	check := SelfTestCheck{Name: "jwt_secret", Status: selfTestFail}
+	switch {
+	case config.JWTSecret == "":
+		check.Detail = "JWT_SECRET is not set"
+	case config.JWTSecret == defaultJWTSecret:
+		check.Detail = "JWT_SECRET is the old default, so anyone can forge tokens"
+	case len(config.JWTSecret) < minJWTSecretLength:
+		check.Detail = fmt.Sprintf("JWT_SECRET is %d characters, use at least %d", len(config.JWTSecret), minJWTSecretLength)
+	default:
+		check.Status = selfTestPass
+	}
+	return check
+}
+
+// selfTestDatabase opens and migrates the database as startup would
+func selfTestDatabase() SelfTestCheck {
+	check := SelfTestCheck{Name: "database"}
+	if err := initDatabase(); err != nil {
+		check.Status = selfTestFail
+		check.Detail = err.Error()
+		return check
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		check.Status = selfTestFail
+		check.Detail = err.Error()
+		return check
+	}
+	check.Status = selfTestPass
+	return check
+}
+
+// selfTestRPC connects and logs in to the RPC server, then disconnects
+func selfTestRPC() SelfTestCheck {
+	check := SelfTestCheck{Name: "rpc"}
+	if config.UseMockData || config.UnrealRPCURL == "" || config.UnrealRPCUsername == "" {
+		check.Status = selfTestSkip
+		check.Detail = "mock data mode"
+		return check
+	}
+
+	client := rpc.NewRPCClient(config.UnrealRPCURL, config.UnrealRPCUsername, config.UnrealRPCPassword)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		check.Status = selfTestFail
+		check.Detail = err.Error()
+		if rpc.IsAuthError(err) {
+			check.Detail += ". " + rpcAuthRemediation
+		}
+		return check
+	}
+	client.Disconnect()
+
+	check.Status = selfTestPass
+	return check
+}
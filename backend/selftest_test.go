@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	goodSecret := strings.Repeat("s", minJWTSecretLength)
+
+	tests := []struct {
+		name   string
+		setup  func(dir string)
+		status map[string]string // Check name to status
+	}{
+		{"mock data", func(string) {},
+			map[string]string{"config": selfTestPass, "jwt_secret": selfTestPass, "database": selfTestPass, "rpc": selfTestSkip}},
+		{"no secret", func(string) { config.JWTSecret = "" },
+			map[string]string{"jwt_secret": selfTestFail}},
+		{"old default secret", func(string) { config.JWTSecret = defaultJWTSecret },
+			map[string]string{"jwt_secret": selfTestFail}},
+		{"short secret", func(string) { config.JWTSecret = "hunter2" },
+			map[string]string{"jwt_secret": selfTestFail}},
+		{"bad port", func(string) { config.Port = "http" },
+			map[string]string{"config": selfTestFail}},
+		{"missing RPC settings", func(string) { config.UseMockData = false; config.UnrealRPCURL = "" },
+			map[string]string{"config": selfTestFail, "rpc": selfTestSkip}},
+		{"unreachable RPC server", func(string) {
+			config.UseMockData = false
+			config.UnrealRPCURL = "ws://127.0.0.1:1/"
+			config.UnrealRPCUsername = "adminpanel"
+		}, map[string]string{"config": selfTestPass, "rpc": selfTestFail}},
+		{"unusable database", func(dir string) { config.DBDSN = filepath.Join(dir, "missing", "webpanel.db") },
+			map[string]string{"database": selfTestFail}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		config = loadConfig()
+		config.UseMockData = true
+		config.JWTSecret = goodSecret
+		config.DBDSN = filepath.Join(dir, "webpanel.db")
+		tt.setup(dir)
+
+		var out bytes.Buffer
+		code := runSelfTest(&out)
+		var report SelfTestReport
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatalf("%s: decode report: %v\n%s", tt.name, err, out.String())
+		}
+
+		failed := false
+		for _, check := range report.Checks {
+			failed = failed || check.Status == selfTestFail
+			if want, ok := tt.status[check.Name]; ok && check.Status != want {
+				t.Errorf("%s: %s check %s (%s), want %s", tt.name, check.Name, check.Status, check.Detail, want)
+			}
+		}
+		if len(report.Checks) != 4 || report.Passed == failed || (code == 0) == failed {
+			t.Errorf("%s: %d checks, passed %t, exit %d; want 4 checks and a result matching the checks", tt.name, len(report.Checks), report.Passed, code)
+		}
+	}
+}
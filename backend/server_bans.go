@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// ServerBan is a network-wide ban in API format. Times are Unix timestamps;
+// ExpireAt is 0 for permanent bans.
+type ServerBan struct {
+	Type     string `json:"type"`
+	Mask     string `json:"mask"`
+	SetBy    string `json:"setBy"`
+	SetAt    int64  `json:"setAt"`
+	ExpireAt int64  `json:"expireAt"`
+	Expires  string `json:"expires"` // e.g. "in 2h 5m", "never" or "expired"
+	Reason   string `json:"reason"`
+}
+
+// serverBanTypes are the ban types that can be added or removed through the panel
+var serverBanTypes = []string{"gline", "kline", "zline", "gzline"}
+
+// unrealDuration matches UnrealIRCd time strings: plain seconds or unit groups like 1d12h
+var unrealDuration = regexp.MustCompile(`^(\d+|(\d+[smhdw])+)$`)
+
+// ServerBanRequest is the body accepted when adding a server ban
+type ServerBanRequest struct {
+	Type     string `json:"type"`
+	Mask     string `json:"mask"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"` // e.g. "30d", empty or "0" for permanent
+}
+
+// mockServerBans stands in for the server's ban list in mock data mode
+var mockServerBans = struct {
+	sync.Mutex
+	list []rpc.ServerBan
+}{list: getMockServerBans()}
+
+func getMockServerBans() []rpc.ServerBan {
+	now := time.Now().UTC()
+	return []rpc.ServerBan{
+		{
+			Type:     "gline",
+			Name:     "*@198.51.100.23",
+			SetBy:    "Valware",
+			SetAt:    now.Add(-3 * time.Hour).Format(time.RFC3339),
+			ExpireAt: now.Add(21 * time.Hour).Format(time.RFC3339),
+			Reason:   "Spamming",
+		},
+		{
+			Type:   "kline",
+			Name:   "*@*.badisp.example",
+			SetBy:  "admin",
+			SetAt:  now.Add(-30 * 24 * time.Hour).Format(time.RFC3339),
+			Reason: "Abuse from this ISP",
+		},
+		{
+			Type:     "zline",
+			Name:     "203.0.113.0/24",
+			SetBy:    "Valware",
+			SetAt:    now.Add(-20 * time.Minute).Format(time.RFC3339),
+			ExpireAt: now.Add(40 * time.Minute).Format(time.RFC3339),
+			Reason:   "Connection flood",
+		},
+	}
+}
+
+// parseRPCTime parses an RPC timestamp to Unix seconds, 0 when empty or invalid
+func parseRPCTime(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// parseUnrealDuration parses an UnrealIRCd time string such as "30d", "1h30m"
+// or "3600". Zero means permanent.
+func parseUnrealDuration(value string) (time.Duration, error) {
+	if !unrealDuration.MatchString(value) {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	units := map[byte]time.Duration{
+		's': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+	}
+	var total time.Duration
+	n := 0
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+		} else {
+			total += time.Duration(n) * units[c]
+			n = 0
+		}
+	}
+	return total, nil
+}
+
+func isServerBanType(banType string) bool {
+	for _, t := range serverBanTypes {
+		if banType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeExpiry describes when something expires, relative to now
+func relativeExpiry(expireAt int64, now time.Time) string {
+	if expireAt == 0 {
+		return "never"
+	}
+	left := time.Unix(expireAt, 0).Sub(now)
+	if left <= 0 {
+		return "expired"
+	}
+
+	days := int(left.Hours()) / 24
+	hours := int(left.Hours()) % 24
+	minutes := int(left.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("in %dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("in %dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("in %dm", minutes)
+	default:
+		return "in less than a minute"
+	}
+}
+
+func toAPIServerBan(ban rpc.ServerBan, now time.Time) ServerBan {
+	expireAt := parseRPCTime(ban.ExpireAt)
+	return ServerBan{
+		Type:     ban.Type,
+		Mask:     ban.Name,
+		SetBy:    ban.SetBy,
+		SetAt:    parseRPCTime(ban.SetAt),
+		ExpireAt: expireAt,
+		Expires:  relativeExpiry(expireAt, now),
+		Reason:   ban.Reason,
+	}
+}
+
+func getServerBansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var rpcBans []rpc.ServerBan
+	if config.UseMockData || rpcClient == nil {
+		mockServerBans.Lock()
+		rpcBans = append([]rpc.ServerBan{}, mockServerBans.list...)
+		mockServerBans.Unlock()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		rpcBans, err = rpcClient.GetServerBans(ctx)
+		if err != nil {
+			log.Printf("RPC error getting server bans: %v", err)
+			writeRPCError(w, err, "Failed to get server bans")
+			return
+		}
+	}
+
+	now := time.Now()
+	bans := make([]ServerBan, len(rpcBans))
+	for i, ban := range rpcBans {
+		bans[i] = toAPIServerBan(ban, now)
+	}
+
+	json.NewEncoder(w).Encode(bans)
+}
+
+func addServerBanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ServerBanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	req.Mask = strings.TrimSpace(req.Mask)
+	if !isServerBanType(req.Type) {
+		http.Error(w, "Type must be one of "+strings.Join(serverBanTypes, ", "), http.StatusBadRequest)
+		return
+	}
+	if req.Mask == "" {
+		http.Error(w, "Mask is required", http.StatusBadRequest)
+		return
+	}
+	if req.Duration == "" {
+		req.Duration = "0"
+	}
+	duration, err := parseUnrealDuration(req.Duration)
+	if err != nil {
+		http.Error(w, "Duration must be an UnrealIRCd time string such as 30d or 1h", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "No reason"
+	}
+
+	details := map[string]string{"type": req.Type, "reason": req.Reason, "duration": req.Duration}
+
+	if config.UseMockData || rpcClient == nil {
+		now := time.Now().UTC()
+		ban := rpc.ServerBan{
+			Type:   req.Type,
+			Name:   req.Mask,
+			SetBy:  actorName(r),
+			SetAt:  now.Format(time.RFC3339),
+			Reason: req.Reason,
+		}
+		if duration > 0 {
+			ban.ExpireAt = now.Add(duration).Format(time.RFC3339)
+		}
+
+		mockServerBans.Lock()
+		for _, existing := range mockServerBans.list {
+			if existing.Type == req.Type && strings.EqualFold(existing.Name, req.Mask) {
+				mockServerBans.Unlock()
+				http.Error(w, "Server ban already exists", http.StatusConflict)
+				return
+			}
+		}
+		mockServerBans.list = append(mockServerBans.list, ban)
+		mockServerBans.Unlock()
+
+		recordAudit(r, "server_ban.add", req.Mask, details)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(toAPIServerBan(ban, now))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = rpcClient.AddServerBan(ctx, req.Type, req.Mask, req.Reason, req.Duration)
+	if err != nil {
+		log.Printf("RPC error adding server ban: %v", err)
+		writeRPCError(w, err, "Failed to add server ban")
+		return
+	}
+
+	recordAudit(r, "server_ban.add", req.Mask, details)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deleteServerBanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Masks routinely contain '/' (CIDR), so they travel as query parameters
+	banType := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("type")))
+	mask := strings.TrimSpace(r.URL.Query().Get("mask"))
+	if !isServerBanType(banType) {
+		http.Error(w, "Type must be one of "+strings.Join(serverBanTypes, ", "), http.StatusBadRequest)
+		return
+	}
+	if mask == "" {
+		http.Error(w, "Mask is required", http.StatusBadRequest)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		mockServerBans.Lock()
+		found := false
+		for i, ban := range mockServerBans.list {
+			if ban.Type == banType && strings.EqualFold(ban.Name, mask) {
+				mockServerBans.list = append(mockServerBans.list[:i], mockServerBans.list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		mockServerBans.Unlock()
+
+		if !found {
+			http.Error(w, "Server ban not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(r, "server_ban.del", mask, map[string]string{"type": banType})
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.RemoveServerBan(ctx, banType, mask)
+	if err != nil {
+		log.Printf("RPC error removing server ban: %v", err)
+		writeRPCError(w, err, "Failed to remove server ban")
+		return
+	}
+
+	recordAudit(r, "server_ban.del", mask, map[string]string{"type": banType})
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// countServerBans returns the number of server bans for the dashboard stats,
+// 0 when the list can't be fetched
+func countServerBans(ctx context.Context) int {
+	list, err := rpcClient.GetServerBans(ctx)
+	if err != nil {
+		log.Printf("⚠️ Failed to count server bans: %v", err)
+		return 0
+	}
+	return len(list)
+}
+
+// countMockServerBans returns the number of server bans in mock data mode
+func countMockServerBans() int {
+	mockServerBans.Lock()
+	defer mockServerBans.Unlock()
+	return len(mockServerBans.list)
+}
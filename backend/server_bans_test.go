@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestMockStatsCountServerBansAndExceptions(t *testing.T) {
+	stats := getMockNetworkStats()
+	if want := len(getMockServerBans()); stats.ServerBans != want {
+		t.Errorf("ServerBans = %d, want %d", stats.ServerBans, want)
+	}
+	if stats.ServerBanExceptions != len(mockELines.list) {
+		t.Errorf("ServerBanExceptions = %d, want %d", stats.ServerBanExceptions, len(mockELines.list))
+	}
+
+	// Bans and exceptions added in mock mode show up in the stats
+	mockServerBans.Lock()
+	saved := mockServerBans.list
+	mockServerBans.list = append(append([]rpc.ServerBan{}, saved...), rpc.ServerBan{Type: "gline", Name: "*@192.0.2.1"})
+	mockServerBans.Unlock()
+	mockELines.Lock()
+	savedELines := mockELines.list
+	mockELines.list = append(append([]rpc.BanException{}, savedELines...), rpc.BanException{Name: "*@192.0.2.2", ExceptionTypes: "k"})
+	mockELines.Unlock()
+	t.Cleanup(func() {
+		mockServerBans.Lock()
+		mockServerBans.list = saved
+		mockServerBans.Unlock()
+		mockELines.Lock()
+		mockELines.list = savedELines
+		mockELines.Unlock()
+	})
+
+	stats = getMockNetworkStats()
+	if want := len(saved) + 1; stats.ServerBans != want {
+		t.Errorf("ServerBans after add = %d, want %d", stats.ServerBans, want)
+	}
+	if want := len(savedELines) + 1; stats.ServerBanExceptions != want {
+		t.Errorf("ServerBanExceptions after add = %d, want %d", stats.ServerBanExceptions, want)
+	}
+}
+
+func TestParseUnrealDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"0", 0, false},
+		{"3600", time.Hour, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"2w1d", 15 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"1y", 0, true},
+		{"h", 0, true},
+		{"-5", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseUnrealDuration(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseUnrealDuration(%q) = %v, %v; want %v, error %t", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestServerBanAddAndRemove(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	mockServerBans.Lock()
+	saved := append([]rpc.ServerBan{}, mockServerBans.list...)
+	mockServerBans.Unlock()
+	t.Cleanup(func() {
+		mockServerBans.Lock()
+		mockServerBans.list = saved
+		mockServerBans.Unlock()
+	})
+
+	add := func(body string) int {
+		w := httptest.NewRecorder()
+		addServerBanHandler(w, asUser("POST", "/api/server-bans", body, adminID, "boss", "admin"))
+		return w.Code
+	}
+	remove := func(query string) int {
+		w := httptest.NewRecorder()
+		deleteServerBanHandler(w, asUser("DELETE", "/api/server-bans?"+query, "", adminID, "boss", "admin"))
+		return w.Code
+	}
+
+	adds := []struct {
+		body string
+		want int
+	}{
+		{`{"type":"gline","mask":"*@192.0.2.1","reason":"Spam","duration":"1d"}`, http.StatusCreated},
+		{`{"type":"GZLINE","mask":" 192.0.2.0/24 "}`, http.StatusCreated},
+		{`{"type":"gline","mask":"*@192.0.2.1"}`, http.StatusConflict},
+		{`{"type":"kline","mask":"*@192.0.2.1"}`, http.StatusCreated}, // Same mask, other type
+		{`{"type":"shun","mask":"*@192.0.2.9"}`, http.StatusBadRequest},
+		{`{"type":"gline","mask":""}`, http.StatusBadRequest},
+		{`{"type":"gline","mask":"*@192.0.2.9","duration":"forever"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range adds {
+		if got := add(tt.body); got != tt.want {
+			t.Errorf("add %s = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getServerBansHandler(w, httptest.NewRequest("GET", "/api/server-bans", nil))
+	var bans []ServerBan
+	if err := json.NewDecoder(w.Body).Decode(&bans); err != nil {
+		t.Fatalf("decode bans: %v", err)
+	}
+	if len(bans) != len(saved)+3 {
+		t.Fatalf("%d bans after adding, want %d", len(bans), len(saved)+3)
+	}
+	for _, ban := range bans {
+		switch ban.Mask {
+		case "*@192.0.2.1":
+			if ban.Type == "gline" && (ban.Reason != "Spam" || ban.SetBy != "boss" || ban.ExpireAt == 0) {
+				t.Errorf("timed gline = %+v", ban)
+			}
+		case "192.0.2.0/24":
+			if ban.Type != "gzline" || ban.Reason != "No reason" || ban.ExpireAt != 0 || ban.Expires != "never" {
+				t.Errorf("permanent gzline = %+v", ban)
+			}
+		}
+	}
+
+	removes := []struct {
+		query string
+		want  int
+	}{
+		{"type=gzline&mask=192.0.2.0%2F24", http.StatusOK},
+		{"type=gzline&mask=192.0.2.0%2F24", http.StatusNotFound},
+		{"type=kline&mask=*%40192.0.2.1", http.StatusOK},
+		{"type=gline&mask=*%40192.0.2.1", http.StatusOK},
+		{"type=shun&mask=*%40192.0.2.1", http.StatusBadRequest},
+		{"type=gline", http.StatusBadRequest},
+	}
+	for _, tt := range removes {
+		if got := remove(tt.query); got != tt.want {
+			t.Errorf("remove %s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+	if got := countMockServerBans(); got != len(saved) {
+		t.Errorf("%d bans after removing, want %d", got, len(saved))
+	}
+	if adds, dels := auditCount(t, "server_ban.add"), auditCount(t, "server_ban.del"); adds != 3 || dels != 3 {
+		t.Errorf("audit entries: %d adds, %d removals; want 3 each", adds, dels)
+	}
+}
+
+func TestServerBanErrorsOverRPC(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{
+		"server_ban.add": &rpc.RPCError{Code: rpc.ErrCodeAlreadyExists, Message: "Ban already exists"},
+		"server_ban.del": &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Ban not found"},
+	})
+	adminID := createTestUser(t, "boss", "admin")
+
+	w := httptest.NewRecorder()
+	addServerBanHandler(w, asUser("POST", "/api/server-bans", `{"type":"gline","mask":"*@192.0.2.1"}`, adminID, "boss", "admin"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("add of an existing ban = %d %s, want 409", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	deleteServerBanHandler(w, asUser("DELETE", "/api/server-bans?type=gline&mask=*%40192.0.2.1", "", adminID, "boss", "admin"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("removal of a missing ban = %d %s, want 404", w.Code, w.Body)
+	}
+	if got := auditCount(t, "server_ban.add") + auditCount(t, "server_ban.del"); got != 0 {
+		t.Errorf("%d audit entries for failed changes, want none", got)
+	}
+}
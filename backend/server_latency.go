@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// LinkLatency is the ping time of one server to its uplink
+type LinkLatency struct {
+	Server    string `json:"server"`
+	Uplink    string `json:"uplink"`
+	LatencyMs *int64 `json:"latencyMs"` // null when the server does not report it
+	High      bool   `json:"high"`
+}
+
+// LinkLatencyResponse lists server links with their latency. Available is
+// false when no server reports latency, as stock UnrealIRCd does not.
+type LinkLatencyResponse struct {
+	Available   bool          `json:"available"`
+	ThresholdMs int64         `json:"thresholdMs"`
+	HighLatency int           `json:"highLatency"`
+	Links       []LinkLatency `json:"links"`
+	Message     string        `json:"message,omitempty"`
+}
+
+// getMockServerLinks returns a small mock network with one slow link
+func getMockServerLinks() []rpc.ServerInfo {
+	lag := func(ms int64) *int64 { return &ms }
+	return []rpc.ServerInfo{
+		{Name: "irc.valware.uk", ID: "001", Server: rpc.ServerDetails{Info: "Valware's IRC server", NumUsers: 3, BootTime: "2024-06-01T12:00:00.000Z", Synced: true}},
+		{Name: "irc2.valware.uk", ID: "002", Server: rpc.ServerDetails{Info: "Second hub", NumUsers: 1, BootTime: "2024-06-05T08:30:00.000Z", Uplink: "irc.valware.uk", Synced: true, LagMs: lag(42)}},
+		{Name: "services.valware.uk", ID: "00S", Server: rpc.ServerDetails{Info: "Services", NumUsers: 2, BootTime: "2024-06-01T12:01:00.000Z", Uplink: "irc.valware.uk", ULined: true, Synced: true, LagMs: lag(3)}},
+		{Name: "far.valware.uk", ID: "003", Server: rpc.ServerDetails{Info: "Overseas leaf", NumUsers: 0, BootTime: "2024-06-09T15:00:00.000Z", Uplink: "irc2.valware.uk", Synced: true, LagMs: lag(870)}},
+	}
+}
+
+// evaluateLinkLatency reports the latency of every linked server, flagging
+// links at or above the threshold. Servers without an uplink (the one the
+// panel is connected to) have no link of their own and are left out.
+func evaluateLinkLatency(servers []rpc.ServerInfo, threshold time.Duration) LinkLatencyResponse {
+	response := LinkLatencyResponse{
+		ThresholdMs: threshold.Milliseconds(),
+		Links:       []LinkLatency{},
+	}
+
+	for _, server := range servers {
+		if server.Server.Uplink == "" {
+			continue
+		}
+		link := LinkLatency{
+			Server:    server.Name,
+			Uplink:    server.Server.Uplink,
+			LatencyMs: server.Server.LagMs,
+		}
+		if link.LatencyMs != nil {
+			response.Available = true
+			link.High = *link.LatencyMs >= response.ThresholdMs
+			if link.High {
+				response.HighLatency++
+			}
+		}
+		response.Links = append(response.Links, link)
+	}
+
+	// Slowest first, links without data last
+	sort.SliceStable(response.Links, func(i, j int) bool {
+		a, b := response.Links[i].LatencyMs, response.Links[j].LatencyMs
+		return a != nil && (b == nil || *a > *b)
+	})
+
+	if !response.Available {
+		response.Message = "The server does not report link latency"
+	}
+	return response
+}
+
+// getServerLatencyHandler returns each server link's latency
+func getServerLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		json.NewEncoder(w).Encode(evaluateLinkLatency(getMockServerLinks(), config.LinkLatencyWarn))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	servers, err := rpcClient.GetServers(ctx)
+	if err != nil {
+		log.Printf("RPC error getting server links: %v", err)
+		writeRPCError(w, err, "Failed to get server links")
+		return
+	}
+
+	json.NewEncoder(w).Encode(evaluateLinkLatency(servers, config.LinkLatencyWarn))
+}
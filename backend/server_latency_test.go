@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerLatency(t *testing.T) {
+	server := func(name, uplink string, lag interface{}) map[string]interface{} {
+		details := map[string]interface{}{"uplink": uplink}
+		if lag != nil {
+			details["lag_ms"] = lag
+		}
+		return map[string]interface{}{"name": name, "server": details}
+	}
+
+	tests := []struct {
+		name      string
+		servers   []map[string]interface{} // nil uses the mock data
+		available bool
+		high      int
+		links     []string // Server names, slowest first
+	}{
+		{"mock data", nil, true, 1, []string{"far.valware.uk", "irc2.valware.uk", "services.valware.uk"}},
+		{"mixed", []map[string]interface{}{
+			server("hub", "", nil),
+			server("quiet", "hub", nil),
+			server("fast", "hub", 5),
+			server("slow", "hub", 500),
+			server("edge", "hub", 200),
+		}, true, 2, []string{"slow", "edge", "fast", "quiet"}},
+		{"not reported", []map[string]interface{}{server("hub", "", nil), server("leaf", "hub", nil)}, false, 0, []string{"leaf"}},
+		{"single server", []map[string]interface{}{server("hub", "", nil)}, false, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			config.UseMockData = true
+			config.LinkLatencyWarn = 200 * time.Millisecond
+			if tt.servers != nil {
+				startFakeRPC(t, map[string]interface{}{"server.list": map[string]interface{}{"list": tt.servers}})
+			}
+
+			w := httptest.NewRecorder()
+			getServerLatencyHandler(w, httptest.NewRequest("GET", "/api/servers/latency", nil))
+			var resp LinkLatencyResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode latency: %v", err)
+			}
+
+			var links []string
+			for _, link := range resp.Links {
+				links = append(links, link.Server)
+			}
+			if resp.Available != tt.available || resp.HighLatency != tt.high || resp.ThresholdMs != 200 ||
+				strings.Join(links, ",") != strings.Join(tt.links, ",") || (resp.Message == "") != tt.available {
+				t.Errorf("response %+v with links %v, want available %t, %d high, links %v", resp, links, tt.available, tt.high, tt.links)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Server is one server linked to the network, for the network map
+type Server struct {
+	Name          string `json:"name"`
+	SID           string `json:"sid"`
+	Description   string `json:"description"`
+	Users         int    `json:"users"`
+	UptimeSeconds int64  `json:"uptimeSeconds"` // 0 when the server does not report its boot time
+	Uplink        string `json:"uplink"`        // "" for the server the panel is connected to
+	Services      bool   `json:"services"`
+	Synced        bool   `json:"synced"`
+}
+
+// isValidServerName reports whether name can be a server name, as opposed
+// to a mask or something with spaces in it
+func isValidServerName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " *?,")
+}
+
+// toAPIServer converts a server from the RPC server list
+func toAPIServer(server rpc.ServerInfo, now time.Time) Server {
+	s := Server{
+		Name:        server.Name,
+		SID:         server.ID,
+		Description: server.Server.Info,
+		Users:       server.Server.NumUsers,
+		Uplink:      server.Server.Uplink,
+		Services:    isServicesServer(server, config.ServicesServers),
+		Synced:      server.Server.Synced,
+	}
+	if booted := parseRPCTimestamp(server.Server.BootTime); !booted.IsZero() && booted.Before(now) {
+		s.UptimeSeconds = int64(now.Sub(booted).Seconds())
+	}
+	return s
+}
+
+// getServersHandler lists the servers linked to the network
+func getServersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var servers []rpc.ServerInfo
+	if config.UseMockData || rpcClient == nil {
+		servers = getMockServerLinks()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var err error
+		servers, err = rpcClient.GetServers(ctx)
+		if err != nil {
+			log.Printf("RPC error getting servers: %v", err)
+			writeRPCError(w, err, "Failed to get servers")
+			return
+		}
+	}
+
+	now := time.Now()
+	response := make([]Server, len(servers))
+	for i, server := range servers {
+		response[i] = toAPIServer(server, now)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// localServerTarget is the audit target for actions on the server the panel is connected to
+const localServerTarget = "(local)"
+
+// RehashResponse reports a rehash, with the configuration warnings and
+// errors the server logged while rehashing
+type RehashResponse struct {
+	Server  string               `json:"server"` // "" for the server the panel is connected to
+	Success bool                 `json:"success"`
+	Log     []rpc.RehashLogEntry `json:"log"`
+}
+
+// rehashServerHandler makes a server reload its configuration. Without a
+// server in the path the server the panel is connected to is rehashed.
+func rehashServerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	server, named := mux.Vars(r)["server"]
+	if named && !isValidServerName(server) {
+		http.Error(w, "Invalid server name", http.StatusBadRequest)
+		return
+	}
+
+	var result *rpc.RehashResult
+	if config.UseMockData || rpcClient == nil {
+		result = &rpc.RehashResult{
+			Success: true,
+			Log: []rpc.RehashLogEntry{
+				{Level: "warn", Subsystem: "config", EventID: "CONFIG_WARNING", Message: "unrealircd.conf:42: set::modes-on-connect: ignoring +z"},
+				{Level: "info", Subsystem: "config", EventID: "CONFIG_LOADED", Message: "Configuration loaded"},
+			},
+		}
+	} else {
+		// Rehashing a large configuration, or over a link, takes a while
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		var err error
+		result, err = rpcClient.Rehash(ctx, server)
+		if err != nil {
+			log.Printf("RPC error rehashing %q: %v", server, err)
+			writeRPCError(w, err, "Failed to rehash")
+			return
+		}
+	}
+
+	target := server
+	if target == "" {
+		target = localServerTarget
+	}
+	recordAudit(r, "server.rehash", target, map[string]interface{}{"success": result.Success})
+
+	response := RehashResponse{Server: server, Success: result.Success, Log: result.Log}
+	if response.Log == nil {
+		response.Log = []rpc.RehashLogEntry{}
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+
+	"github.com/gorilla/mux"
+)
+
+func TestToAPIServer(t *testing.T) {
+	config = loadConfig()
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		server   rpc.ServerInfo
+		expected []string // SERVICES_SERVERS
+		uptime   int64
+		services bool
+	}{
+		{"booted a day ago",
+			rpc.ServerInfo{Name: "irc.example.net", Server: rpc.ServerDetails{BootTime: "2024-06-09T12:00:00.000Z"}},
+			nil, 86400, false},
+		{"no boot time", rpc.ServerInfo{Name: "irc.example.net"}, nil, 0, false},
+		{"boot time ahead of our clock",
+			rpc.ServerInfo{Name: "irc.example.net", Server: rpc.ServerDetails{BootTime: "2024-06-10T12:05:00.000Z"}},
+			nil, 0, false},
+		{"U-lined", rpc.ServerInfo{Name: "services.example.net", Server: rpc.ServerDetails{ULined: true}}, nil, 0, true},
+		{"U-lined but not a configured services server",
+			rpc.ServerInfo{Name: "stats.example.net", Server: rpc.ServerDetails{ULined: true}},
+			[]string{"services.example.net"}, 0, false},
+		{"configured services server", rpc.ServerInfo{Name: "Services.Example.Net"}, []string{"services.example.net"}, 0, true},
+	}
+	for _, tt := range tests {
+		config.ServicesServers = tt.expected
+		got := toAPIServer(tt.server, now)
+		if got.UptimeSeconds != tt.uptime || got.Services != tt.services {
+			t.Errorf("%s: uptime %d, services %t; want %d, %t", tt.name, got.UptimeSeconds, got.Services, tt.uptime, tt.services)
+		}
+	}
+}
+
+func TestGetServersHandler(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"server.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"name": "irc.example.net", "id": "001", "server": map[string]interface{}{"info": "Hub", "num_users": 40, "synced": true}},
+		{"name": "services.example.net", "id": "00S", "server": map[string]interface{}{"info": "Services", "num_users": 3, "uplink": "irc.example.net", "ulined": true, "synced": true}},
+	}}})
+
+	w := httptest.NewRecorder()
+	getServersHandler(w, httptest.NewRequest("GET", "/api/servers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d %s", w.Code, w.Body)
+	}
+	var servers []Server
+	if err := json.NewDecoder(w.Body).Decode(&servers); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []Server{
+		{Name: "irc.example.net", SID: "001", Description: "Hub", Users: 40, Synced: true},
+		{Name: "services.example.net", SID: "00S", Description: "Services", Users: 3, Uplink: "irc.example.net", Services: true, Synced: true},
+	}
+	if len(servers) != len(want) {
+		t.Fatalf("servers = %+v, want %+v", servers, want)
+	}
+	for i := range want {
+		if servers[i] != want[i] {
+			t.Errorf("server %d = %+v, want %+v", i, servers[i], want[i])
+		}
+	}
+}
+
+func TestGetServersHandlerRPCError(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"server.list": &rpc.RPCError{Code: rpc.ErrCodeInternal, Message: "boom"}})
+
+	w := httptest.NewRecorder()
+	getServersHandler(w, httptest.NewRequest("GET", "/api/servers", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status %d %s, want %d", w.Code, w.Body, http.StatusBadGateway)
+	}
+}
+
+func TestRehashServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string // "" rehashes the local server
+		result  interface{}
+		want    int
+		success bool
+		logs    int
+		target  string // Audit target, "" when nothing is audited
+	}{
+		{"local, acknowledged only", "", true, http.StatusOK, true, 0, localServerTarget},
+		{"remote with warnings", "leaf.example.net", map[string]interface{}{
+			"success": true,
+			"log":     []map[string]string{{"level": "warn", "subsystem": "config", "event_id": "CONFIG_WARNING", "msg": "ignoring +z"}},
+		}, http.StatusOK, true, 1, "leaf.example.net"},
+		{"config errors", "leaf.example.net", map[string]interface{}{
+			"success": false,
+			"log":     []map[string]string{{"level": "error", "msg": "unknown block"}, {"level": "error", "msg": "rehash aborted"}},
+		}, http.StatusOK, false, 2, "leaf.example.net"},
+		{"server not linked", "gone.example.net", &rpc.RPCError{Code: rpc.ErrCodeNotFound, Message: "Server not found"}, http.StatusNotFound, false, 0, ""},
+		{"mask", "*.example.net", true, http.StatusBadRequest, false, 0, ""},
+	}
+	for _, tt := range tests {
+		setupTestDB(t)
+		adminID := createTestUser(t, "boss", "admin")
+		startFakeRPC(t, map[string]interface{}{"server.rehash": tt.result})
+
+		r := asUser("POST", "/api/servers/rehash", "", adminID, "boss", "admin")
+		if tt.server != "" {
+			r = mux.SetURLVars(r, map[string]string{"server": tt.server})
+		}
+		w := httptest.NewRecorder()
+		rehashServerHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+
+		if tt.want == http.StatusOK {
+			var resp RehashResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("%s: decode: %v", tt.name, err)
+			}
+			if resp.Server != tt.server || resp.Success != tt.success || resp.Log == nil || len(resp.Log) != tt.logs {
+				t.Errorf("%s: %+v, want server %q, success %t and %d log lines", tt.name, resp, tt.server, tt.success, tt.logs)
+			}
+		}
+
+		var targets []string
+		rows, err := db.Query("SELECT target FROM audit_log WHERE action = 'server.rehash'")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var target string
+			rows.Scan(&target)
+			targets = append(targets, target)
+		}
+		rows.Close()
+		if got := strings.Join(targets, ","); got != tt.target {
+			t.Errorf("%s: audited targets %q, want %q", tt.name, got, tt.target)
+		}
+	}
+}
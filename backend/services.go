@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Services health states
+const (
+	servicesReachable   = "reachable"
+	servicesUnreachable = "unreachable"
+)
+
+// ServicesHealth reports whether the services server (NickServ/ChanServ) is linked
+type ServicesHealth struct {
+	Status    string    `json:"status"`
+	Reachable bool      `json:"reachable"`
+	Servers   []string  `json:"servers"`
+	Online    int       `json:"online"`
+	Expected  int       `json:"expected"`
+	LatencyMs int64     `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (s ServicesHealth) MarshalJSON() ([]byte, error) {
+	type plain ServicesHealth
+	return marshalWithLocalTimes(plain(s))
+}
+
+// ServicesOnline formats the health as the "online/expected" network stat
+func (h ServicesHealth) ServicesOnline() string {
+	return fmt.Sprintf("%d/%d", h.Online, h.Expected)
+}
+
+func getMockServers() []rpc.ServerInfo {
+	return []rpc.ServerInfo{
+		{
+			Name: "irc.valware.uk",
+			Server: rpc.ServerDetails{
+				Info:   "Valware's IRC server",
+				Synced: true,
+			},
+		},
+	}
+}
+
+// checkServicesHealth looks for services in the server list and times the lookup
+func checkServicesHealth(ctx context.Context) ServicesHealth {
+	if config.UseMockData || rpcClient == nil {
+		return evaluateServices(getMockServers(), config.ServicesServers, 0)
+	}
+
+	start := time.Now()
+	servers, err := rpcClient.GetServers(ctx)
+	latency := time.Since(start)
+	if err != nil {
+		log.Printf("RPC error checking services: %v", err)
+		health := evaluateServices(nil, config.ServicesServers, latency)
+		health.Error = err.Error()
+		return health
+	}
+
+	return evaluateServices(servers, config.ServicesServers, latency)
+}
+
+// evaluateServices finds the services servers in a server list. When expected
+// names are configured only those count, otherwise every U-lined server does.
+func evaluateServices(servers []rpc.ServerInfo, expected []string, latency time.Duration) ServicesHealth {
+	health := ServicesHealth{
+		Servers:   []string{},
+		LatencyMs: latency.Milliseconds(),
+		CheckedAt: time.Now(),
+	}
+
+	for _, server := range servers {
+		if isServicesServer(server, expected) {
+			health.Servers = append(health.Servers, server.Name)
+		}
+	}
+
+	health.Online = len(health.Servers)
+	health.Expected = len(expected)
+	if health.Expected == 0 {
+		health.Expected = health.Online
+	}
+
+	health.Reachable = health.Online > 0
+	health.Status = servicesUnreachable
+	if health.Reachable {
+		health.Status = servicesReachable
+	}
+	return health
+}
+
+// isServicesServer reports whether server is a services server: one of the
+// expected names when any are configured, otherwise any U-lined server
+func isServicesServer(server rpc.ServerInfo, expected []string) bool {
+	if len(expected) > 0 {
+		return containsFold(expected, server.Name)
+	}
+	return server.Server.ULined
+}
+
+// containsFold reports whether list holds name, ignoring case
+func containsFold(list []string, name string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func getServicesHealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	json.NewEncoder(w).Encode(checkServicesHealth(ctx))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Auth keeps working through short database outages: the last successful
+// session check for each token and the permissions last resolved for each user
+// are remembered for sessionCacheTTL, and after dbBreakerThreshold consecutive
+// failures the database is not queried again for dbBreakerCooldown. Cached
+// results are only trusted for read requests.
+const (
+	sessionCacheTTL     = 30 * time.Second
+	sessionCacheMaxSize = 4096
+	dbBreakerThreshold  = 3
+	dbBreakerCooldown   = 10 * time.Second
+)
+
+// errDBUnavailable is returned when a session cannot be verified because the database is down
+var errDBUnavailable = errors.New("database unavailable")
+
+// sessionGuard caches recent successful session checks and permission
+// lookups, and trips a circuit breaker on repeated database failures
+type sessionGuard struct {
+	mutex       sync.Mutex
+	verified    map[string]time.Time        // jti -> when it was last verified active
+	permissions map[int]resolvedPermissions // user ID -> last resolved permissions
+	failures    int
+	openUntil   time.Time
+}
+
+// resolvedPermissions is a user's effective permissions and when they were looked up
+type resolvedPermissions struct {
+	list       []string
+	resolvedAt time.Time
+}
+
+var sessions = &sessionGuard{
+	verified:    make(map[string]time.Time),
+	permissions: make(map[int]resolvedPermissions),
+}
+
+// check verifies the session behind claims. When the database fails, a read
+// request is let through if the session was verified within the cache window.
+func (g *sessionGuard) check(claims *JWTClaims, r *http.Request) (bool, error) {
+	if g.breakerClosed() {
+		active, err := sessionActive(claims)
+		if err == nil {
+			g.recordSuccess(claims.ID, active)
+			return active, nil
+		}
+		g.recordFailure(err)
+	}
+
+	if isReadRequest(r) && g.recentlyVerified(claims.ID) {
+		return true, nil
+	}
+	return false, errDBUnavailable
+}
+
+// userPermissions resolves a user's effective permissions. When the database
+// fails, a read request gets the permissions resolved within the cache window.
+// Errors that are not an outage, such as an unknown user, are returned as is.
+func (g *sessionGuard) userPermissions(userID int, r *http.Request) ([]string, error) {
+	if g.breakerClosed() {
+		permissions, err := getUserPermissions(userID)
+		if err == nil {
+			g.recordPermissions(userID, permissions)
+			return permissions, nil
+		}
+		if !errors.Is(err, errPermissionsQuery) {
+			return nil, err
+		}
+		g.recordFailure(err)
+	}
+
+	if isReadRequest(r) {
+		if permissions, ok := g.recentPermissions(userID); ok {
+			return permissions, nil
+		}
+	}
+	return nil, errDBUnavailable
+}
+
+// breakerClosed reports whether the database may be queried
+func (g *sessionGuard) breakerClosed() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return time.Now().After(g.openUntil)
+}
+
+func (g *sessionGuard) recordSuccess(jti string, active bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.resetFailuresLocked()
+
+	if !active {
+		delete(g.verified, jti)
+		return
+	}
+
+	if len(g.verified) >= sessionCacheMaxSize {
+		g.pruneLocked()
+	}
+	g.verified[jti] = time.Now()
+}
+
+func (g *sessionGuard) recordPermissions(userID int, permissions []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.resetFailuresLocked()
+	if len(g.permissions) >= sessionCacheMaxSize {
+		g.pruneLocked()
+	}
+	g.permissions[userID] = resolvedPermissions{list: permissions, resolvedAt: time.Now()}
+}
+
+// resetFailuresLocked closes the breaker after a successful query; the caller holds the mutex
+func (g *sessionGuard) resetFailuresLocked() {
+	if g.failures >= dbBreakerThreshold {
+		log.Printf("✅ Database reachable again, session checks restored")
+	}
+	g.failures = 0
+}
+
+func (g *sessionGuard) recordFailure(err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.failures++
+	log.Printf("❌ Session check failed (%d in a row): %v", g.failures, err)
+	if g.failures >= dbBreakerThreshold {
+		g.openUntil = time.Now().Add(dbBreakerCooldown)
+		log.Printf("⚠️ Database circuit breaker open for %v", dbBreakerCooldown)
+	}
+}
+
+// forget drops a session from the cache, so a revoked token is not let
+// through on its cached result during a database outage
+func (g *sessionGuard) forget(jti string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.verified, jti)
+}
+
+func (g *sessionGuard) recentlyVerified(jti string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	verifiedAt, ok := g.verified[jti]
+	return ok && time.Since(verifiedAt) < sessionCacheTTL
+}
+
+func (g *sessionGuard) recentPermissions(userID int) ([]string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	resolved, ok := g.permissions[userID]
+	if !ok || time.Since(resolved.resolvedAt) >= sessionCacheTTL {
+		return nil, false
+	}
+	return resolved.list, true
+}
+
+// pruneLocked drops stale entries; the caller holds the mutex
+func (g *sessionGuard) pruneLocked() {
+	for jti, verifiedAt := range g.verified {
+		if time.Since(verifiedAt) >= sessionCacheTTL {
+			delete(g.verified, jti)
+		}
+	}
+	for userID, resolved := range g.permissions {
+		if time.Since(resolved.resolvedAt) >= sessionCacheTTL {
+			delete(g.permissions, userID)
+		}
+	}
+}
+
+// isReadRequest reports whether a request only reads data
+func isReadRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// freshSessionGuard gives the test an empty session guard with a closed breaker
+func freshSessionGuard(t *testing.T) {
+	t.Helper()
+
+	saved := sessions
+	sessions = &sessionGuard{
+		verified:    make(map[string]time.Time),
+		permissions: make(map[int]resolvedPermissions),
+	}
+	t.Cleanup(func() { sessions = saved })
+}
+
+func TestPermissionChecksDuringDatabaseOutage(t *testing.T) {
+	setupTestDB(t)
+	freshSessionGuard(t)
+
+	viewer := createTestUser(t, "viewer1", "viewer")
+	other := createTestUser(t, "viewer2", "viewer")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	view := requirePermission("channels.view")(ok)
+	moderate := requirePermission("channels.moderate")(ok)
+
+	serve := func(handler http.Handler, method string, userID int) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, asUser(method, "/api/channels", "", userID, "viewer", "viewer"))
+		return w.Code
+	}
+
+	if code := serve(view, "GET", viewer); code != http.StatusOK {
+		t.Fatalf("GET before outage = %d, want 200", code)
+	}
+	if code := serve(moderate, "GET", viewer); code != http.StatusForbidden {
+		t.Fatalf("GET without permission = %d, want 403", code)
+	}
+
+	// Take the database away
+	db.Close()
+
+	// Recently resolved permissions still serve reads, and still refuse what
+	// the user does not hold
+	if code := serve(view, "GET", viewer); code != http.StatusOK {
+		t.Errorf("GET during outage = %d, want 200 from cached permissions", code)
+	}
+	if code := serve(moderate, "GET", viewer); code != http.StatusForbidden {
+		t.Errorf("GET without permission during outage = %d, want 403", code)
+	}
+
+	// Writes and users without cached permissions get 503, not a misleading 403
+	if code := serve(view, "POST", viewer); code != http.StatusServiceUnavailable {
+		t.Errorf("POST during outage = %d, want 503", code)
+	}
+	if code := serve(view, "GET", other); code != http.StatusServiceUnavailable {
+		t.Errorf("GET for uncached user during outage = %d, want 503", code)
+	}
+
+	// Repeated failures open the breaker; cached reads keep working
+	if sessions.breakerClosed() {
+		t.Error("breaker still closed after repeated database failures")
+	}
+	if code := serve(view, "GET", viewer); code != http.StatusOK {
+		t.Errorf("GET with breaker open = %d, want 200 from cached permissions", code)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Strategies for logins that would exceed MAX_SESSIONS_PER_USER
+const (
+	sessionLimitReject = "reject"
+	sessionLimitEvict  = "evict"
+)
+
+// sessionTTL is how long a login session (and its JWT) stays valid
+const sessionTTL = 24 * time.Hour
+
+// errSessionLimit is returned by startSession when the reject strategy refuses a login
+var errSessionLimit = errors.New("too many active sessions")
+
+// sessionPurgeInterval is how often sessions past their expiry and refresh
+// grace period are deleted
+const sessionPurgeInterval = time.Hour
+
+// sessionMutex serializes the count-then-insert in startSession
+var sessionMutex sync.Mutex
+
+// newSessionID returns a random identifier used as the JWT jti
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// startSession records a new session for the user, enforcing the configured
+// concurrency limit by rejecting the login or revoking the oldest sessions
+func startSession(userID int, jti string, expiresAt time.Time, r *http.Request) error {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var evicted []string
+	if limit := config.MaxSessionsPerUser; limit > 0 {
+		rows, err := tx.Query(`
+			SELECT jti FROM sessions
+			WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+			ORDER BY created_at ASC
+		`, userID, now)
+		if err != nil {
+			return err
+		}
+
+		var active []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			active = append(active, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(active) >= limit {
+			if config.SessionLimitStrategy == sessionLimitReject {
+				return errSessionLimit
+			}
+
+			for _, id := range active[:len(active)-limit+1] {
+				if _, err := tx.Exec("UPDATE sessions SET revoked_at = ? WHERE jti = ?", now, id); err != nil {
+					return err
+				}
+				log.Printf("🔒 Evicted oldest session %s for user %d", id, userID)
+				evicted = append(evicted, id)
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO sessions (jti, user_id, created_at, expires_at, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, jti, userID, now, expiresAt, clientIP(r), r.UserAgent())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, id := range evicted {
+		wsHub.endSession(id)
+	}
+	return nil
+}
+
+// issueSession signs a JWT for the user and records its session
+func issueSession(user *WebpanelUser, r *http.Request) (string, error) {
+	token, claims, err := generateJWT(user)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	if err := startSession(user.ID, claims.ID, claims.ExpiresAt.Time, r); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sessionActive reports whether the session behind a JWT is known, unexpired and
+// not revoked, and that the token was issued in the user's current token epoch
+func sessionActive(claims *JWTClaims) (bool, error) {
+	return sessionUsable(claims, 0)
+}
+
+// sessionUsable is sessionActive, counting a session expired less than grace
+// ago as unexpired
+func sessionUsable(claims *JWTClaims, grace time.Duration) (bool, error) {
+	if claims.ID == "" {
+		return false, nil
+	}
+
+	var revokedAt *time.Time
+	var expiresAt time.Time
+	var epoch int
+	var userActive bool
+	err := db.QueryRow(`
+		SELECT s.revoked_at, s.expires_at, u.token_epoch, u.active
+		FROM sessions s
+		JOIN webpanel_users u ON u.id = s.user_id
+		WHERE s.jti = ?
+	`, claims.ID).Scan(&revokedAt, &expiresAt, &epoch, &userActive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to look up session: %w", err)
+	}
+
+	return revokedAt == nil && time.Now().Before(expiresAt.Add(grace)) && epoch == claims.Epoch && userActive, nil
+}
+
+// refreshTokenHandler exchanges a valid token, or one that expired less than
+// TOKEN_REFRESH_GRACE ago, for a new one with a fresh expiry. The old token's
+// session is revoked, so each token can be refreshed once.
+func refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	const bearerPrefix = "Bearer "
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, bearerPrefix) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Authorization header required"})
+		return
+	}
+
+	claims, err := validateJWT(authHeader[len(bearerPrefix):], jwt.WithLeeway(config.TokenRefreshGrace))
+	if err != nil {
+		log.Printf("Token refresh rejected: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Invalid or expired token"})
+		return
+	}
+
+	usable, err := sessionUsable(claims, config.TokenRefreshGrace)
+	if err != nil {
+		log.Printf("❌ Failed to check session for refresh: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Authentication temporarily unavailable"})
+		return
+	}
+	if !usable {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Session is no longer active"})
+		return
+	}
+
+	user, _, err := loadWebpanelUser("id = ?", claims.UserID)
+	if err != nil {
+		log.Printf("❌ Failed to load user %d for refresh: %v", claims.UserID, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Session is no longer active"})
+		return
+	}
+
+	// Revoke the old session before issuing the new one, so it does not count
+	// against the session limit and a second refresh of the same token fails
+	revoked, err := revokeSession(claims.ID)
+	if err == nil && !revoked {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Session is no longer active"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to revoke session for refresh: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Failed to refresh token"})
+		return
+	}
+
+	token, err := issueSession(user, r)
+	if err != nil {
+		log.Printf("❌ Failed to refresh session for %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LoginResponse{Success: false, Error: "Failed to refresh token"})
+		return
+	}
+
+	log.Printf("🔄 Refreshed token for %s", user.Username)
+	json.NewEncoder(w).Encode(LoginResponse{
+		Success:            true,
+		User:               user,
+		Token:              token,
+		MustChangePassword: user.MustChange,
+	})
+}
+
+// revokeSession revokes one session, reporting false if it was already revoked or unknown
+func revokeSession(jti string) (bool, error) {
+	result, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE jti = ? AND revoked_at IS NULL", time.Now(), jti)
+	if err != nil {
+		return false, err
+	}
+	sessions.forget(jti)
+	wsHub.endSession(jti)
+
+	revoked, err := result.RowsAffected()
+	return revoked > 0, err
+}
+
+// purgeSessions deletes sessions that expired longer ago than the refresh
+// grace period. Until then a revoked session's row is what keeps its token out.
+func purgeSessions() (int64, error) {
+	result, err := db.Exec("DELETE FROM sessions WHERE expires_at < ?", time.Now().Add(-config.TokenRefreshGrace))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// startSessionPurger purges old sessions now and then every sessionPurgeInterval
+func startSessionPurger() {
+	go func() {
+		ticker := time.NewTicker(sessionPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if purged, err := purgeSessions(); err != nil {
+				log.Printf("⚠️ Failed to purge expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("🧹 Purged %d expired sessions", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// logoutHandler revokes the session of the token used for the request, so the
+// token is refused from then on even though it has not expired
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jti, _ := r.Context().Value(sessionIDKey).(string)
+	if _, err := revokeSession(jti); err != nil {
+		log.Printf("❌ Failed to revoke session for %s: %v", actorName(r), err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to log out"})
+		return
+	}
+
+	log.Printf("👋 User %s logged out", actorName(r))
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// revokeUserSessions revokes every active session of a user, e.g. after a password change
+func revokeUserSessions(userID int) error {
+	_, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	wsHub.endUserSessions(userID)
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sessionOf returns whether the session behind a token is still active
+func sessionOf(t *testing.T, token string) bool {
+	t.Helper()
+
+	active, err := sessionActive(mustClaims(t, token))
+	if err != nil {
+		t.Fatalf("sessionActive: %v", err)
+	}
+	return active
+}
+
+func TestSessionLimitReject(t *testing.T) {
+	setupTestDB(t)
+	config.MaxSessionsPerUser = 2
+	config.SessionLimitStrategy = sessionLimitReject
+	createTestUser(t, "ivan", "viewer")
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		code, resp := login(t, LoginRequest{Username: "ivan", Password: "Correct-Horse-7"})
+		if code != http.StatusOK {
+			t.Fatalf("login %d = %d %s, want 200", i+1, code, resp.Error)
+		}
+		tokens = append(tokens, resp.Token)
+	}
+
+	code, resp := login(t, LoginRequest{Username: "ivan", Password: "Correct-Horse-7"})
+	if code != http.StatusTooManyRequests || resp.Token != "" {
+		t.Fatalf("login over the limit = %d with token %t, want 429 without one", code, resp.Token != "")
+	}
+	for i, token := range tokens {
+		if !sessionOf(t, token) {
+			t.Errorf("session %d was revoked by a rejected login", i+1)
+		}
+	}
+
+	// Logging out frees a slot
+	if _, err := revokeSession(mustClaims(t, tokens[0]).ID); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := login(t, LoginRequest{Username: "ivan", Password: "Correct-Horse-7"}); code != http.StatusOK {
+		t.Errorf("login after a logout = %d, want 200", code)
+	}
+}
+
+func TestSessionLimitEvictsOldest(t *testing.T) {
+	setupTestDB(t)
+	config.MaxSessionsPerUser = 2
+	config.SessionLimitStrategy = sessionLimitEvict
+	createTestUser(t, "judy", "viewer")
+
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		code, resp := login(t, LoginRequest{Username: "judy", Password: "Correct-Horse-7"})
+		if code != http.StatusOK {
+			t.Fatalf("login %d = %d %s, want 200", i+1, code, resp.Error)
+		}
+		tokens = append(tokens, resp.Token)
+	}
+
+	if sessionOf(t, tokens[0]) {
+		t.Error("oldest session still active after a login over the limit")
+	}
+	for i, token := range tokens[1:] {
+		if !sessionOf(t, token) {
+			t.Errorf("session %d was evicted, want only the oldest", i+2)
+		}
+	}
+}
+
+// mustClaims parses a token issued by the panel
+func mustClaims(t *testing.T, token string) *JWTClaims {
+	t.Helper()
+
+	claims, err := validateJWT(token)
+	if err != nil {
+		t.Fatalf("validate token: %v", err)
+	}
+	return claims
+}
+
+// authed sends a request with a bearer token through authMiddleware
+func authed(handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	authMiddleware(handler).ServeHTTP(w, r)
+	return w
+}
+
+func TestLoggedOutTokenRejected(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "kate", "viewer")
+	_, resp := login(t, LoginRequest{Username: "kate", Password: "Correct-Horse-7"})
+
+	routes := http.NewServeMux()
+	routes.Handle("/api/channels", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	routes.HandleFunc(logoutPath, logoutHandler)
+
+	if w := authed(routes, "GET", "/api/channels", resp.Token); w.Code != http.StatusOK {
+		t.Fatalf("request before logout = %d, want 200", w.Code)
+	}
+	if w := authed(routes, "POST", logoutPath, resp.Token); w.Code != http.StatusOK {
+		t.Fatalf("logout = %d, want 200", w.Code)
+	}
+	if w := authed(routes, "GET", "/api/channels", resp.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("request with a logged out token = %d, want 401", w.Code)
+	}
+}
+
+// refresh exchanges a token through refreshTokenHandler
+func refresh(t *testing.T, token string) (int, LoginResponse) {
+	t.Helper()
+
+	r := httptest.NewRequest("POST", "/api/auth/refresh", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	refreshTokenHandler(w, r)
+
+	var resp LoginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode refresh response: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestRefreshIssuesNewSession(t *testing.T) {
+	setupWSTest(t)
+	token, claims := loginForWS(t, "liam", "viewer", time.Hour)
+
+	code, resp := refresh(t, token)
+	if code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("refresh = %d %s, want 200 with a token", code, resp.Error)
+	}
+	if fresh := mustClaims(t, resp.Token); fresh.ID == claims.ID {
+		t.Error("refreshed token reuses the old jti")
+	}
+	if sessionOf(t, token) {
+		t.Error("old session still active after refresh")
+	}
+	if !sessionOf(t, resp.Token) {
+		t.Error("new session not active")
+	}
+	if code, _ := refresh(t, token); code != http.StatusUnauthorized {
+		t.Errorf("second refresh of the same token = %d, want 401", code)
+	}
+}
+
+func TestRefreshRespectsGracePeriod(t *testing.T) {
+	setupWSTest(t)
+	config.TokenRefreshGrace = time.Minute
+
+	recent, _ := loginForWS(t, "mona", "viewer", -30*time.Second)
+	stale, _ := loginForWS(t, "nick", "viewer", -2*time.Minute)
+	revoked, claims := loginForWS(t, "olga", "viewer", time.Hour)
+	if _, err := revokeSession(claims.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"expired within the grace period", recent, http.StatusOK},
+		{"expired beyond the grace period", stale, http.StatusUnauthorized},
+		{"revoked", revoked, http.StatusUnauthorized},
+		{"malformed", "not-a-jwt", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code, resp := refresh(t, tt.token); code != tt.want {
+			t.Errorf("refresh %s token = %d %s, want %d", tt.name, code, resp.Error, tt.want)
+		}
+	}
+}
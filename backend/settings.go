@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Upper bounds of the runtime settings
+const (
+	maxWSUpdateInterval = time.Hour
+	maxRPCCacheTTL      = 10 * time.Minute
+	maxRoleRateLimit    = 10000
+)
+
+// Runtime setting names, also the keys of the settings table
+const (
+	settingWSUpdateInterval = "ws_update_interval"
+	settingRPCCacheTTLs     = "rpc_cache_ttls"
+	settingRoleRateLimits   = "role_rate_limits"
+	settingReadOnly         = "read_only"
+)
+
+// PanelSettings are the settings that can be changed while the panel runs.
+// Maps are replaced, never modified, so copies can share them.
+type PanelSettings struct {
+	WSUpdateInterval time.Duration
+	RPCCacheTTLs     map[string]time.Duration // Overrides of rpc.DefaultCacheTTLs
+	RoleRateLimits   map[string]int
+	ReadOnly         bool
+}
+
+// MarshalJSON writes the settings by name, with durations such as "30s"
+func (s PanelSettings) MarshalJSON() ([]byte, error) {
+	values := make(map[string]interface{}, len(settingDefs))
+	for _, def := range settingDefs {
+		values[def.key] = def.encode(s)
+	}
+	return json.Marshal(values)
+}
+
+// settingDef reads and writes one runtime setting. decode validates the value
+// and stores it in s, leaving s untouched when it is invalid.
+type settingDef struct {
+	key    string
+	encode func(s PanelSettings) interface{}
+	decode func(raw json.RawMessage, s *PanelSettings) error
+}
+
+var settingDefs = []settingDef{
+	{
+		key:    settingWSUpdateInterval,
+		encode: func(s PanelSettings) interface{} { return s.WSUpdateInterval.String() },
+		decode: func(raw json.RawMessage, s *PanelSettings) error {
+			interval, err := decodeSettingDuration(raw, minWSUpdateInterval, maxWSUpdateInterval)
+			if err != nil {
+				return err
+			}
+			s.WSUpdateInterval = interval
+			return nil
+		},
+	},
+	{
+		key: settingRPCCacheTTLs,
+		encode: func(s PanelSettings) interface{} {
+			ttls := make(map[string]string, len(s.RPCCacheTTLs))
+			for method, ttl := range s.RPCCacheTTLs {
+				ttls[method] = ttl.String()
+			}
+			return ttls
+		},
+		decode: func(raw json.RawMessage, s *PanelSettings) error {
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return errors.New(`must be an object of RPC methods and durations, e.g. {"user.list": "5s"}`)
+			}
+			ttls := make(map[string]time.Duration, len(values))
+			for method, value := range values {
+				if !rpc.IsReadMethod(method) {
+					return fmt.Errorf("cannot cache %q: only list, get and info methods are cached", method)
+				}
+				ttl, err := decodeSettingDuration(value, 0, maxRPCCacheTTL)
+				if err != nil {
+					return fmt.Errorf("%s %v", method, err)
+				}
+				ttls[method] = ttl
+			}
+			s.RPCCacheTTLs = ttls
+			return nil
+		},
+	},
+	{
+		key:    settingRoleRateLimits,
+		encode: func(s PanelSettings) interface{} { return emptyIfNilMap(s.RoleRateLimits) },
+		decode: func(raw json.RawMessage, s *PanelSettings) error {
+			var limits map[string]int
+			if err := json.Unmarshal(raw, &limits); err != nil {
+				return errors.New(`must be an object of roles and requests per minute, e.g. {"viewer": 60}`)
+			}
+			for role, limit := range limits {
+				if strings.TrimSpace(role) == "" {
+					return errors.New("role names cannot be empty")
+				}
+				if limit < 0 || limit > maxRoleRateLimit {
+					return fmt.Errorf("%s must be between 0 (unlimited) and %d requests per minute", role, maxRoleRateLimit)
+				}
+			}
+			s.RoleRateLimits = limits
+			return nil
+		},
+	},
+	{
+		key:    settingReadOnly,
+		encode: func(s PanelSettings) interface{} { return s.ReadOnly },
+		decode: func(raw json.RawMessage, s *PanelSettings) error {
+			if err := json.Unmarshal(raw, &s.ReadOnly); err != nil {
+				return errors.New("must be true or false")
+			}
+			return nil
+		},
+	},
+}
+
+// findSettingDef returns the definition of a setting, or nil for an unknown name
+func findSettingDef(key string) *settingDef {
+	for i := range settingDefs {
+		if settingDefs[i].key == key {
+			return &settingDefs[i]
+		}
+	}
+	return nil
+}
+
+// decodeSettingDuration parses a duration string such as "30s" between min and max
+func decodeSettingDuration(raw json.RawMessage, min, max time.Duration) (time.Duration, error) {
+	var text string
+	err := json.Unmarshal(raw, &text)
+	var d time.Duration
+	if err == nil {
+		d, err = time.ParseDuration(text)
+	}
+	if err != nil || d < min || d > max {
+		return 0, fmt.Errorf("must be a duration between %v and %v, e.g. \"30s\"", min, max)
+	}
+	return d, nil
+}
+
+// emptyIfNilMap returns m, or an empty map so it encodes as {} rather than null
+func emptyIfNilMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return map[K]V{}
+	}
+	return m
+}
+
+// settingsStore holds the live settings. Subsystems read them on every use,
+// or wait on watch to pick up changes.
+type settingsStore struct {
+	mutex   sync.RWMutex
+	current PanelSettings
+	changed chan struct{}
+}
+
+var liveSettings = &settingsStore{changed: make(chan struct{})}
+
+// get returns the current settings
+func (s *settingsStore) get() PanelSettings {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.current
+}
+
+// watch returns a channel that is closed the next time the settings change
+func (s *settingsStore) watch() <-chan struct{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.changed
+}
+
+// set replaces the settings and notifies the watchers
+func (s *settingsStore) set(settings PanelSettings) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.current = settings
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// settingsFromConfig returns the settings given by the environment
+func settingsFromConfig(c *Config) PanelSettings {
+	return PanelSettings{
+		WSUpdateInterval: c.WSUpdateInterval,
+		RPCCacheTTLs:     c.RPCCacheTTLs,
+		RoleRateLimits:   c.RoleRateLimits,
+		ReadOnly:         c.ReadOnly,
+	}
+}
+
+// initSettings seeds the settings table from the environment and loads it.
+// Settings already in the table were set in the panel and win over the
+// environment, which only fills in settings not stored yet.
+func initSettings() error {
+	seed := settingsFromConfig(config)
+	now := time.Now()
+	for _, def := range settingDefs {
+		raw, _ := json.Marshal(def.encode(seed))
+		if _, err := db.Exec(
+			"INSERT INTO settings (key, value, updated_by, updated_at) VALUES (?, ?, ?, ?) ON CONFLICT (key) DO NOTHING",
+			def.key, string(raw), systemActor, now,
+		); err != nil {
+			return fmt.Errorf("failed to seed setting %s: %w", def.key, err)
+		}
+	}
+
+	rows, err := db.Query("SELECT key, value, updated_by FROM settings")
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := seed
+	for rows.Next() {
+		var key, value, updatedBy string
+		if err := rows.Scan(&key, &value, &updatedBy); err != nil {
+			return fmt.Errorf("failed to scan setting: %w", err)
+		}
+		def := findSettingDef(key)
+		if def == nil {
+			continue
+		}
+		if err := def.decode(json.RawMessage(value), &settings); err != nil {
+			log.Printf("⚠️ Ignoring stored setting %s=%s: %v", key, value, err)
+			continue
+		}
+		if updatedBy != systemActor {
+			if seeded, _ := json.Marshal(def.encode(seed)); string(seeded) != value {
+				log.Printf("⚙️ Using %s=%s set in the panel by %s, not the environment's %s", key, value, updatedBy, seeded)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	liveSettings.set(settings)
+	return nil
+}
+
+// getSettingsHandler returns the live settings
+func getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveSettings.get())
+}
+
+// updateSettingsHandler changes the settings given in the body, e.g.
+// {"ws_update_interval": "10s"}. Either every change applies or none does.
+func updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var changes map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil || len(changes) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Body must be an object of settings to change"})
+		return
+	}
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	previous := liveSettings.get()
+	next := previous
+	for _, key := range keys {
+		def := findSettingDef(key)
+		if def == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown setting: " + key, "field": key})
+			return
+		}
+		if err := def.decode(changes[key], &next); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": key + " " + err.Error(), "field": key})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err == nil {
+		now := time.Now()
+		for _, key := range keys {
+			raw, _ := json.Marshal(findSettingDef(key).encode(next))
+			if _, err = tx.Exec(
+				"INSERT INTO settings (key, value, updated_by, updated_at) VALUES (?, ?, ?, ?)"+
+					" ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_by = excluded.updated_by, updated_at = excluded.updated_at",
+				key, string(raw), actorName(r), now,
+			); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Failed to save settings: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to save settings"})
+		return
+	}
+
+	liveSettings.set(next)
+
+	details := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		def := findSettingDef(key)
+		details[key] = map[string]interface{}{"from": def.encode(previous), "to": def.encode(next)}
+	}
+	log.Printf("⚙️ %s changed settings %v", actorName(r), keys)
+	recordAudit(r, "settings.update", strings.Join(keys, ","), details)
+
+	json.NewEncoder(w).Encode(next)
+}
+
+// applyRPCCacheTTLs sets the RPC cache TTLs to the defaults with the
+// settings' overrides on top; a zero TTL disables a method
+func applyRPCCacheTTLs(settings PanelSettings) {
+	ttls := maps.Clone(rpc.DefaultCacheTTLs)
+	maps.Copy(ttls, settings.RPCCacheTTLs)
+	rpcClient.SetCacheTTLs(ttls)
+}
+
+// watchRPCCacheSettings reapplies the RPC cache TTLs whenever they change
+func watchRPCCacheSettings() {
+	go func() {
+		applied := liveSettings.get().RPCCacheTTLs
+		for {
+			changed := liveSettings.watch()
+			if current := liveSettings.get(); !maps.Equal(current.RPCCacheTTLs, applied) {
+				applied = current.RPCCacheTTLs
+				applyRPCCacheTTLs(current)
+				log.Printf("⚙️ RPC cache TTLs updated")
+			}
+			<-changed
+		}
+	}()
+}
+
+// readOnlyExempt are the API paths that still accept changes in read-only
+// mode: signing in and out, and turning read-only mode off again
+var readOnlyExempt = []string{"/api/auth/", "/api/admin/settings"}
+
+// readOnlyMiddleware turns away requests that change anything while the
+// read_only setting is on
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !liveSettings.get().ReadOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range readOnlyExempt {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The panel is in read-only mode"})
+	})
+}
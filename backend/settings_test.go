@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWSUpdateIntervalAppliesWithoutRestart(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+
+	settings := liveSettings.get()
+	settings.WSUpdateInterval = time.Hour
+	liveSettings.set(settings)
+
+	var polls atomic.Int32
+	hub := newHub(func() interface{} {
+		polls.Add(1)
+		return nil
+	})
+	client := &wsClient{send: make(chan interface{}, wsSendBuffer), dropped: make(chan struct{})}
+	hub.register(client)
+	t.Cleanup(func() { hub.unregister(client) })
+	hub.start()
+
+	w := httptest.NewRecorder()
+	updateSettingsHandler(w, asUser("PUT", "/api/admin/settings", `{"ws_update_interval":"5s"}`, adminID, "boss", "admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update settings: status %d %s", w.Code, w.Body)
+	}
+	if got := liveSettings.get().WSUpdateInterval; got != minWSUpdateInterval {
+		t.Fatalf("live interval = %v, want %v", got, minWSUpdateInterval)
+	}
+
+	// With the hour-long interval still in use nothing would arrive
+	select {
+	case <-client.send:
+	case <-time.After(minWSUpdateInterval + 2*time.Second):
+		t.Fatal("hub did not pick up the new interval")
+	}
+	if polls.Load() != 1 {
+		t.Errorf("hub polled %d times, want 1", polls.Load())
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// spamfilterTargets are the spamfilter target letters UnrealIRCd understands:
+// c=channel message p=private message n=private notice N=channel notice
+// P=part reason q=quit reason d=DCC a=away t=topic u=user (nick!user@host:realname)
+const spamfilterTargets = "cpnNPqdatu"
+
+// spamfilterMatchTypes are the ways a spamfilter's match string is applied
+var spamfilterMatchTypes = []string{"simple", "regex"}
+
+// SpamfilterRequest is the body accepted when adding a spamfilter
+type SpamfilterRequest struct {
+	Name        string `json:"name"`                   // The match string or regex
+	MatchType   string `json:"match_type"`             // simple (default) or regex
+	Targets     string `json:"targets"`                // e.g. "cpnN"
+	Action      string `json:"action"`                 // e.g. block, kill, gline
+	BanDuration string `json:"ban_duration,omitempty"` // e.g. "1d", for actions that place a ban
+	Reason      string `json:"reason"`
+}
+
+// mockSpamfilters stands in for the server's spamfilters in mock data mode
+var mockSpamfilters = struct {
+	sync.Mutex
+	list []rpc.Spamfilter
+}{list: []rpc.Spamfilter{
+	{
+		Name:        "*free bitcoin*",
+		MatchType:   "simple",
+		Targets:     "cpnN",
+		Action:      "block",
+		Reason:      "Spam",
+		SetBy:       "admin",
+		SetAt:       "2024-01-01T00:00:00.000Z",
+		BanDuration: "1d",
+		Hits:        12,
+	},
+}}
+
+// validateSpamfilterTargets checks that targets is a non-empty set of known
+// target letters without repeats, returning an error message when it is not
+func validateSpamfilterTargets(targets string) string {
+	if targets == "" {
+		return "Targets are required"
+	}
+	seen := make(map[rune]bool)
+	for _, t := range targets {
+		if !strings.ContainsRune(spamfilterTargets, t) {
+			return "Unknown spamfilter target '" + string(t) + "', valid targets are " + spamfilterTargets
+		}
+		if seen[t] {
+			return "Duplicate spamfilter target '" + string(t) + "'"
+		}
+		seen[t] = true
+	}
+	return ""
+}
+
+// validateSpamfilterMatchType checks the match type, returning an error message when it is unknown
+func validateSpamfilterMatchType(matchType string) string {
+	for _, known := range spamfilterMatchTypes {
+		if matchType == known {
+			return ""
+		}
+	}
+	return "Match type must be " + strings.Join(spamfilterMatchTypes, " or ")
+}
+
+// sameSpamfilter reports whether a spamfilter is the one identified by the
+// match string, match type, targets and action
+func sameSpamfilter(f rpc.Spamfilter, name, matchType, targets, action string) bool {
+	return f.Name == name && f.MatchType == matchType && f.Targets == targets && strings.EqualFold(f.Action, action)
+}
+
+func getSpamfiltersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		mockSpamfilters.Lock()
+		list := append([]rpc.Spamfilter{}, mockSpamfilters.list...)
+		mockSpamfilters.Unlock()
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	list, err := rpcClient.GetSpamfilters(ctx)
+	if err != nil {
+		log.Printf("RPC error getting spamfilters: %v", err)
+		writeRPCError(w, err, "Failed to get spamfilters")
+		return
+	}
+	if list == nil {
+		list = []rpc.Spamfilter{}
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func addSpamfilterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SpamfilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The match string is sent as-is: leading or trailing spaces can be part of it
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Match string is required", http.StatusBadRequest)
+		return
+	}
+	if req.MatchType == "" {
+		req.MatchType = "simple"
+	}
+	if msg := validateSpamfilterMatchType(req.MatchType); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := validateSpamfilterTargets(req.Targets); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	if req.Action == "" {
+		http.Error(w, "Action is required", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "No reason"
+	}
+
+	filter := rpc.Spamfilter{
+		Name:        req.Name,
+		MatchType:   req.MatchType,
+		Targets:     req.Targets,
+		Action:      req.Action,
+		BanDuration: req.BanDuration,
+		Reason:      req.Reason,
+	}
+	details := map[string]string{
+		"match_type": req.MatchType,
+		"targets":    req.Targets,
+		"action":     req.Action,
+		"duration":   req.BanDuration,
+		"reason":     req.Reason,
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		filter.SetBy = actorName(r)
+		filter.SetAt = time.Now().UTC().Format(time.RFC3339)
+
+		mockSpamfilters.Lock()
+		for _, f := range mockSpamfilters.list {
+			if sameSpamfilter(f, req.Name, req.MatchType, req.Targets, req.Action) {
+				mockSpamfilters.Unlock()
+				http.Error(w, "Spamfilter already exists", http.StatusConflict)
+				return
+			}
+		}
+		mockSpamfilters.list = append(mockSpamfilters.list, filter)
+		mockSpamfilters.Unlock()
+
+		recordAudit(r, "spamfilter.add", req.Name, details)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(filter)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.AddSpamfilter(ctx, filter)
+	if err != nil {
+		log.Printf("RPC error adding spamfilter: %v", err)
+		writeRPCError(w, err, "Failed to add spamfilter")
+		return
+	}
+
+	recordAudit(r, "spamfilter.add", req.Name, details)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deleteSpamfilterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Match strings routinely contain spaces and '/', so they travel as query parameters
+	query := r.URL.Query()
+	name := query.Get("name")
+	matchType := query.Get("match_type")
+	targets := query.Get("targets")
+	action := strings.ToLower(query.Get("action"))
+	if strings.TrimSpace(name) == "" || matchType == "" || targets == "" || action == "" {
+		http.Error(w, "name, match_type, targets and action are required", http.StatusBadRequest)
+		return
+	}
+
+	details := map[string]string{"match_type": matchType, "targets": targets, "action": action}
+
+	if config.UseMockData || rpcClient == nil {
+		mockSpamfilters.Lock()
+		found := false
+		for i, f := range mockSpamfilters.list {
+			if sameSpamfilter(f, name, matchType, targets, action) {
+				mockSpamfilters.list = append(mockSpamfilters.list[:i], mockSpamfilters.list[i+1:]...)
+				found = true
+				break
+			}
+		}
+		mockSpamfilters.Unlock()
+
+		if !found {
+			http.Error(w, "Spamfilter not found", http.StatusNotFound)
+			return
+		}
+
+		recordAudit(r, "spamfilter.del", name, details)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.DelSpamfilter(ctx, name, matchType, targets, action)
+	if err != nil {
+		log.Printf("RPC error deleting spamfilter: %v", err)
+		writeRPCError(w, err, "Failed to delete spamfilter")
+		return
+	}
+
+	recordAudit(r, "spamfilter.del", name, details)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// countSpamfilters returns the number of spamfilters on the network, or 0 if the server can't be asked
+func countSpamfilters(ctx context.Context) int {
+	list, err := rpcClient.GetSpamfilters(ctx)
+	if err != nil {
+		log.Printf("⚠️ Failed to count spamfilters: %v", err)
+		return 0
+	}
+	return len(list)
+}
+
+// countMockSpamfilters returns the number of spamfilters in mock data mode
+func countMockSpamfilters() int {
+	mockSpamfilters.Lock()
+	defer mockSpamfilters.Unlock()
+	return len(mockSpamfilters.list)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestValidateSpamfilterTargets(t *testing.T) {
+	tests := []struct {
+		targets string
+		valid   bool
+	}{
+		{"cpnN", true},
+		{"u", true},
+		{spamfilterTargets, true},
+		{"", false},
+		{"cx", false},
+		{"cc", false},
+		{"C", false},
+	}
+	for _, tt := range tests {
+		if msg := validateSpamfilterTargets(tt.targets); (msg == "") != tt.valid {
+			t.Errorf("validateSpamfilterTargets(%q) = %q, want valid %t", tt.targets, msg, tt.valid)
+		}
+	}
+}
+
+func TestSpamfilterAddAndRemove(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	mockSpamfilters.Lock()
+	saved := append([]rpc.Spamfilter{}, mockSpamfilters.list...)
+	mockSpamfilters.list = nil
+	mockSpamfilters.Unlock()
+	t.Cleanup(func() {
+		mockSpamfilters.Lock()
+		mockSpamfilters.list = saved
+		mockSpamfilters.Unlock()
+	})
+
+	del := func(name, matchType, targets, action string) string {
+		return url.Values{"name": {name}, "match_type": {matchType}, "targets": {targets}, "action": {action}}.Encode()
+	}
+
+	steps := []struct {
+		method string
+		arg    string // Body for POST, query for DELETE
+		want   int
+	}{
+		{"POST", `{"name":"*casino*","targets":"cp","action":"Block"}`, http.StatusCreated},
+		{"POST", `{"name":"*casino*","targets":"cp","action":"block"}`, http.StatusConflict},
+		{"POST", `{"name":"*casino*","match_type":"regex","targets":"cp","action":"block"}`, http.StatusCreated},
+		{"POST", `{"name":"^spam/[0-9]+ now$","match_type":"regex","targets":"u","action":"gline","ban_duration":"1d"}`, http.StatusCreated},
+		{"POST", `{"name":"  ","targets":"cp","action":"block"}`, http.StatusBadRequest},
+		{"POST", `{"name":"x","match_type":"glob","targets":"cp","action":"block"}`, http.StatusBadRequest},
+		{"POST", `{"name":"x","targets":"cz","action":"block"}`, http.StatusBadRequest},
+		{"POST", `{"name":"x","targets":"cp"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"DELETE", del("*casino*", "simple", "cp", "BLOCK"), http.StatusOK},
+		{"DELETE", del("*casino*", "simple", "cp", "block"), http.StatusNotFound},
+		{"DELETE", del("^spam/[0-9]+ now$", "regex", "u", "gline"), http.StatusOK},
+		{"DELETE", del("*casino*", "", "cp", "block"), http.StatusBadRequest},
+	}
+	for _, tt := range steps {
+		w := httptest.NewRecorder()
+		if tt.method == "POST" {
+			addSpamfilterHandler(w, asUser("POST", "/api/spamfilters", tt.arg, adminID, "boss", "admin"))
+		} else {
+			deleteSpamfilterHandler(w, asUser("DELETE", "/api/spamfilters?"+tt.arg, "", adminID, "boss", "admin"))
+		}
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.arg, w.Code, w.Body, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	getSpamfiltersHandler(w, httptest.NewRequest("GET", "/api/spamfilters", nil))
+	var list []rpc.Spamfilter
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode spamfilters: %v", err)
+	}
+	if len(list) != 1 || list[0].MatchType != "regex" || list[0].Name != "*casino*" || list[0].SetBy != "boss" {
+		t.Errorf("spamfilters = %+v, want the regex *casino* filter set by boss", list)
+	}
+
+	if got := auditCount(t, "spamfilter.add"); got != 3 {
+		t.Errorf("spamfilter.add audit entries = %d, want 3", got)
+	}
+	if got := auditCount(t, "spamfilter.del"); got != 2 {
+		t.Errorf("spamfilter.del audit entries = %d, want 2", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// statsRecountInterval is the minimum time between recounts, network-wide,
+// since each one bypasses the RPC cache and hits the IRC server directly
+const statsRecountInterval = 30 * time.Second
+
+var lastRecount = struct {
+	sync.Mutex
+	at time.Time
+}{}
+
+// reserveRecount claims the next recount slot, or returns how long to wait
+func reserveRecount(now time.Time) (time.Duration, bool) {
+	lastRecount.Lock()
+	defer lastRecount.Unlock()
+
+	if wait := lastRecount.at.Add(statsRecountInterval).Sub(now); wait > 0 {
+		return wait, false
+	}
+	lastRecount.at = now
+	return 0, true
+}
+
+// recountStatsHandler re-fetches network stats from the server, bypassing and
+// then refreshing the RPC cache
+func recountStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if wait, ok := reserveRecount(time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "A recount was run recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		json.NewEncoder(w).Encode(getMockNetworkStats())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(rpc.Fresh(r.Context()), 10*time.Second)
+	defer cancel()
+
+	networkInfo, err := rpcClient.GetNetworkInfo(ctx)
+	if err != nil {
+		log.Printf("RPC error recounting network stats: %v", err)
+		writeRPCError(w, err, "Failed to recount network stats")
+		return
+	}
+
+	log.Printf("📊 Network stats recounted by %s", actorName(r))
+	json.NewEncoder(w).Encode(networkStatsFromRPC(ctx, networkInfo))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecountIsRateLimited(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	setLast := func(at time.Time) {
+		lastRecount.Lock()
+		lastRecount.at = at
+		lastRecount.Unlock()
+	}
+	t.Cleanup(func() { setLast(time.Time{}) })
+
+	tests := []struct {
+		name  string
+		last  time.Duration // Since the previous recount; 0 means none
+		want  int
+		retry int
+	}{
+		{"first recount", 0, http.StatusOK, 0},
+		{"just ran", time.Second, http.StatusTooManyRequests, 29},
+		{"almost due", statsRecountInterval - 100*time.Millisecond, http.StatusTooManyRequests, 1},
+		{"due", statsRecountInterval, http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		if tt.last == 0 {
+			setLast(time.Time{})
+		} else {
+			setLast(time.Now().Add(-tt.last))
+		}
+
+		w := httptest.NewRecorder()
+		recountStatsHandler(w, asUser("POST", "/api/stats/recount", "", adminID, "boss", "admin"))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d %s, want %d", tt.name, w.Code, w.Body, tt.want)
+			continue
+		}
+		if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry != tt.retry {
+			t.Errorf("%s: Retry-After %d, want %d", tt.name, retry, tt.retry)
+		}
+	}
+
+	// A successful recount starts the interval again
+	w := httptest.NewRecorder()
+	recountStatsHandler(w, asUser("POST", "/api/stats/recount", "", adminID, "boss", "admin"))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("recount right after one = %d, want 429", w.Code)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxElevationDuration caps how long a temporary grant lasts
+const maxElevationDuration = 24 * time.Hour
+
+// grantExpiryInterval is how often expired grants are removed and audited.
+// Expired grants stop counting at once; this only tidies up after them.
+const grantExpiryInterval = time.Minute
+
+// systemActor is the audit username for actions the panel takes on its own
+const systemActor = "system"
+
+// TemporaryGrant adds permissions to a panel user until it expires
+type TemporaryGrant struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	Permissions []string  `json:"permissions"`
+	Reason      string    `json:"reason"`
+	GrantedBy   string    `json:"granted_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (g TemporaryGrant) MarshalJSON() ([]byte, error) {
+	type plain TemporaryGrant
+	return marshalWithLocalTimes(plain(g))
+}
+
+// activeGrantPermissions returns the permissions of a user's grants that have not expired at now
+func activeGrantPermissions(userID int, now time.Time) ([]string, error) {
+	rows, err := db.Query("SELECT permissions FROM temporary_grants WHERE user_id = ? AND expires_at > ?", userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load temporary grants: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to scan temporary grant: %w", err)
+		}
+		var granted []string
+		if err := json.Unmarshal([]byte(raw), &granted); err != nil {
+			return nil, fmt.Errorf("invalid temporary grant for user %d: %w", userID, err)
+		}
+		permissions = append(permissions, granted...)
+	}
+	return permissions, rows.Err()
+}
+
+// elevatePanelUserHandler grants a panel user extra permissions for a limited
+// time, e.g. during an incident. Body: {"permissions": [...], "duration": "2h", "reason": "..."}
+func elevatePanelUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Permissions []string `json:"permissions"`
+		Duration    string   `json:"duration"`
+		Reason      string   `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.Permissions) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "At least one permission is required", "field": "permissions"})
+		return
+	}
+	if unknown := unknownPermission(req.Permissions); unknown != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown permission: " + unknown, "field": "permissions"})
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 || duration > maxElevationDuration {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Duration must be between 1s and %s, e.g. \"2h\"", maxElevationDuration),
+			"field": "duration",
+		})
+		return
+	}
+
+	// A grant is meant to be reviewed by someone else, and may only hand out
+	// what the granter holds
+	if actorID, _, _ := getUserFromContext(r); actorID == userID {
+		http.Error(w, "Cannot elevate your own account", http.StatusForbidden)
+		return
+	}
+	refusal, err := grantError(r, req.Permissions)
+	if err != nil {
+		log.Printf("❌ Failed to check permissions granted to user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to grant permissions"})
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+
+	grant := TemporaryGrant{
+		UserID:      userID,
+		Permissions: req.Permissions,
+		Reason:      strings.TrimSpace(req.Reason),
+		GrantedBy:   actorName(r),
+		CreatedAt:   time.Now(),
+	}
+	grant.ExpiresAt = grant.CreatedAt.Add(duration)
+
+	err = db.QueryRow("SELECT username FROM webpanel_users WHERE id = ?", userID).Scan(&grant.Username)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+	if err == nil {
+		raw, _ := json.Marshal(grant.Permissions)
+		err = db.QueryRow(
+			"INSERT INTO temporary_grants (user_id, permissions, reason, granted_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id",
+			grant.UserID, string(raw), grant.Reason, grant.GrantedBy, grant.CreatedAt, grant.ExpiresAt,
+		).Scan(&grant.ID)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to grant temporary permissions to user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to grant permissions"})
+		return
+	}
+
+	log.Printf("⏫ %s granted %s %v until %s", grant.GrantedBy, grant.Username, grant.Permissions, grant.ExpiresAt.Format(time.RFC3339))
+	recordAudit(r, "panel_user.elevate", grant.Username, map[string]interface{}{
+		"grant_id":    grant.ID,
+		"permissions": grant.Permissions,
+		"duration":    duration.String(),
+		"expires_at":  grant.ExpiresAt,
+		"reason":      grant.Reason,
+	})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(grant)
+}
+
+// revokeGrantHandler ends a temporary grant before it expires
+func revokeGrantHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user ID"})
+		return
+	}
+	grantID, err := strconv.Atoi(mux.Vars(r)["grantId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid grant ID"})
+		return
+	}
+
+	var permissions string
+	var username sql.NullString
+	err = db.QueryRow(`
+		DELETE FROM temporary_grants WHERE id = ? AND user_id = ?
+		RETURNING permissions, (SELECT username FROM webpanel_users WHERE id = user_id)
+	`, grantID, userID).Scan(&permissions, &username)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Grant not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to revoke temporary grant %d: %v", grantID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to revoke grant"})
+		return
+	}
+
+	log.Printf("⏬ %s revoked temporary grant %d of %s", actorName(r), grantID, username.String)
+	recordAudit(r, "panel_user.elevate.revoke", username.String, map[string]interface{}{
+		"grant_id":    grantID,
+		"permissions": json.RawMessage(permissions),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expireGrants deletes the grants that expired by now, auditing each one
+func expireGrants(now time.Time) (int, error) {
+	rows, err := db.Query(`
+		DELETE FROM temporary_grants WHERE expires_at <= ?
+		RETURNING id, permissions, granted_by, (SELECT username FROM webpanel_users WHERE id = user_id)
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	type expiredGrant struct {
+		id          int
+		permissions string
+		grantedBy   string
+		username    sql.NullString
+	}
+	var expired []expiredGrant
+	for rows.Next() {
+		var grant expiredGrant
+		if err := rows.Scan(&grant.id, &grant.permissions, &grant.grantedBy, &grant.username); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, grant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Audited once the delete has finished, as SQLite allows one writer at a time
+	for _, grant := range expired {
+		writeAudit(0, systemActor, "panel_user.elevate.expire", grant.username.String, map[string]interface{}{
+			"grant_id":    grant.id,
+			"permissions": json.RawMessage(grant.permissions),
+			"granted_by":  grant.grantedBy,
+		})
+	}
+	return len(expired), nil
+}
+
+// startGrantExpiry removes expired grants now and then every grantExpiryInterval
+func startGrantExpiry() {
+	go func() {
+		ticker := time.NewTicker(grantExpiryInterval)
+		defer ticker.Stop()
+		for {
+			if expired, err := expireGrants(time.Now()); err != nil {
+				log.Printf("⚠️ Failed to expire temporary grants: %v", err)
+			} else if expired > 0 {
+				log.Printf("⏬ Expired %d temporary permission grants", expired)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// elevate grants permissions to a panel user as the given actor
+func elevate(t *testing.T, actorID int, actor, role string, userID int, body string) (int, TemporaryGrant) {
+	t.Helper()
+
+	r := asUser("POST", "/api/panel-users/"+strconv.Itoa(userID)+"/elevate", body, actorID, actor, role)
+	r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(userID)})
+	w := httptest.NewRecorder()
+	elevatePanelUserHandler(w, r)
+
+	var grant TemporaryGrant
+	if w.Code == http.StatusCreated {
+		if err := json.NewDecoder(w.Body).Decode(&grant); err != nil {
+			t.Fatalf("decode grant: %v", err)
+		}
+	}
+	return w.Code, grant
+}
+
+// auditCount counts the audit entries of an action
+func auditCount(t *testing.T, action string) int {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = ?", action).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestTemporaryGrantExpires(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	modID := createTestUser(t, "mod", "moderator")
+
+	if userHasPermission(modID, "bans.manage") {
+		t.Fatal("moderator holds bans.manage before any grant")
+	}
+	code, grant := elevate(t, adminID, "boss", "admin", modID, `{"permissions":["bans.manage"],"duration":"1h","reason":"incident"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("elevate: status %d", code)
+	}
+	if !userHasPermission(modID, "bans.manage") {
+		t.Error("granted permission not held during the window")
+	}
+
+	// Expired grants stop counting at once, before the scheduler removes them
+	if _, err := db.Exec("UPDATE temporary_grants SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Second), grant.ID); err != nil {
+		t.Fatal(err)
+	}
+	if userHasPermission(modID, "bans.manage") {
+		t.Error("permission still held after the grant expired")
+	}
+
+	expired, err := expireGrants(time.Now())
+	if err != nil || expired != 1 {
+		t.Fatalf("expireGrants = %d, %v; want 1", expired, err)
+	}
+	if got := auditCount(t, "panel_user.elevate.expire"); got != 1 {
+		t.Errorf("%d expiry audit entries, want 1", got)
+	}
+	if expired, _ := expireGrants(time.Now()); expired != 0 {
+		t.Errorf("second expireGrants removed %d grants, want 0", expired)
+	}
+}
+
+func TestTemporaryGrantRevoked(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	modID := createTestUser(t, "mod", "moderator")
+	otherID := createTestUser(t, "other", "moderator")
+
+	_, grant := elevate(t, adminID, "boss", "admin", modID, `{"permissions":["bans.manage"],"duration":"1h"}`)
+	revoke := func(userID, grantID int) int {
+		r := asUser("DELETE", "/api/panel-users/"+strconv.Itoa(userID)+"/elevate/"+strconv.Itoa(grantID), "", adminID, "boss", "admin")
+		r = mux.SetURLVars(r, map[string]string{"id": strconv.Itoa(userID), "grantId": strconv.Itoa(grantID)})
+		w := httptest.NewRecorder()
+		revokeGrantHandler(w, r)
+		return w.Code
+	}
+
+	if code := revoke(otherID, grant.ID); code != http.StatusNotFound {
+		t.Errorf("revoke through another user: status %d, want %d", code, http.StatusNotFound)
+	}
+	if !userHasPermission(modID, "bans.manage") {
+		t.Fatal("grant lost by a refused revoke")
+	}
+	if code := revoke(modID, grant.ID); code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d", code)
+	}
+	if userHasPermission(modID, "bans.manage") {
+		t.Error("permission still held after the grant was revoked")
+	}
+	if got := auditCount(t, "panel_user.elevate.revoke"); got != 1 {
+		t.Errorf("%d revoke audit entries, want 1", got)
+	}
+	if code := revoke(modID, grant.ID); code != http.StatusNotFound {
+		t.Errorf("revoke again: status %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestTemporaryGrantCannotEscalate(t *testing.T) {
+	setupTestDB(t)
+	adminID := createTestUser(t, "boss", "admin")
+	managerID := createTestUser(t, "manager", "user", "panel.users", "bans.view")
+	modID := createTestUser(t, "mod", "moderator")
+
+	tests := []struct {
+		name    string
+		actorID int
+		actor   string
+		role    string
+		userID  int
+		body    string
+		want    int
+	}{
+		{"admin elevates themselves", adminID, "boss", "admin", adminID, `{"permissions":["bans.manage"],"duration":"1h"}`, http.StatusForbidden},
+		{"grant a permission the granter lacks", managerID, "manager", "user", modID, `{"permissions":["bans.manage"],"duration":"1h"}`, http.StatusForbidden},
+		{"grant everything without being admin", managerID, "manager", "user", modID, `{"permissions":["*"],"duration":"1h"}`, http.StatusForbidden},
+		{"grant a permission the granter holds", managerID, "manager", "user", modID, `{"permissions":["bans.view"],"duration":"1h"}`, http.StatusCreated},
+		{"unknown permission", adminID, "boss", "admin", modID, `{"permissions":["bans.fly"],"duration":"1h"}`, http.StatusBadRequest},
+		{"longer than a day", adminID, "boss", "admin", modID, `{"permissions":["bans.manage"],"duration":"25h"}`, http.StatusBadRequest},
+		{"unknown user", adminID, "boss", "admin", 9999, `{"permissions":["bans.manage"],"duration":"1h"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code, _ := elevate(t, tt.actorID, tt.actor, tt.role, tt.userID, tt.body); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+	var grants int
+	if err := db.QueryRow("SELECT COUNT(*) FROM temporary_grants").Scan(&grants); err != nil || grants != 1 {
+		t.Errorf("%d grants stored, %v; want only the permitted one", grants, err)
+	}
+}
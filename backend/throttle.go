@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// Bounds accepted for connection throttle updates
+const (
+	maxThrottleCount  = 1000
+	maxThrottlePeriod = 86400
+)
+
+const throttleUnsupported = "Connection throttling is not exposed by this server's RPC"
+
+// mockThrottle stands in for the server's throttle settings in mock data mode
+var mockThrottle = struct {
+	sync.Mutex
+	settings rpc.ThrottleSettings
+}{settings: rpc.ThrottleSettings{Count: 3, Period: 60}}
+
+func getThrottleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if config.UseMockData || rpcClient == nil {
+		mockThrottle.Lock()
+		settings := mockThrottle.settings
+		mockThrottle.Unlock()
+		json.NewEncoder(w).Encode(settings)
+		return
+	}
+
+	if !rpcClient.HasMethod("throttle.get") {
+		http.Error(w, throttleUnsupported, http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	settings, err := rpcClient.GetThrottle(ctx)
+	if err != nil {
+		log.Printf("RPC error getting throttle: %v", err)
+		writeRPCError(w, err, "Failed to get throttle settings")
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+func updateThrottleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req rpc.ThrottleSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Count < 1 || req.Count > maxThrottleCount {
+		http.Error(w, "Count must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+	if req.Period < 1 || req.Period > maxThrottlePeriod {
+		http.Error(w, "Period must be between 1 and 86400 seconds", http.StatusBadRequest)
+		return
+	}
+
+	if config.UseMockData || rpcClient == nil {
+		mockThrottle.Lock()
+		previous := mockThrottle.settings
+		mockThrottle.settings = req
+		mockThrottle.Unlock()
+
+		recordAudit(r, "throttle.update", "", map[string]rpc.ThrottleSettings{"previous": previous, "new": req})
+		json.NewEncoder(w).Encode(req)
+		return
+	}
+
+	if !rpcClient.HasMethod("throttle.set") {
+		http.Error(w, throttleUnsupported, http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := rpcClient.SetThrottle(ctx, req)
+	if err != nil {
+		log.Printf("RPC error setting throttle: %v", err)
+		writeRPCError(w, err, "Failed to update throttle settings")
+		return
+	}
+
+	recordAudit(r, "throttle.update", "", map[string]rpc.ThrottleSettings{"new": req})
+	json.NewEncoder(w).Encode(req)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+func TestThrottleUpdates(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	adminID := createTestUser(t, "boss", "admin")
+
+	mockThrottle.Lock()
+	saved := mockThrottle.settings
+	mockThrottle.Unlock()
+	t.Cleanup(func() {
+		mockThrottle.Lock()
+		mockThrottle.settings = saved
+		mockThrottle.Unlock()
+	})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"count":5,"period":30}`, http.StatusOK},
+		{`{"count":0,"period":30}`, http.StatusBadRequest},
+		{`{"count":1001,"period":30}`, http.StatusBadRequest},
+		{`{"count":5,"period":0}`, http.StatusBadRequest},
+		{`{"count":5,"period":86401}`, http.StatusBadRequest},
+		{`{"count":1000,"period":86400}`, http.StatusOK},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		updateThrottleHandler(w, asUser("PUT", "/api/server/throttle", tt.body, adminID, "boss", "admin"))
+		if w.Code != tt.want {
+			t.Errorf("update %s: status %d %s, want %d", tt.body, w.Code, w.Body, tt.want)
+		}
+	}
+
+	// Only the valid updates took effect, and each was audited
+	w := httptest.NewRecorder()
+	getThrottleHandler(w, httptest.NewRequest("GET", "/api/server/throttle", nil))
+	var settings rpc.ThrottleSettings
+	if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+		t.Fatalf("decode throttle: %v", err)
+	}
+	if settings != (rpc.ThrottleSettings{Count: 1000, Period: 86400}) {
+		t.Errorf("throttle = %+v, want the last valid update", settings)
+	}
+	if got := auditCount(t, "throttle.update"); got != 2 {
+		t.Errorf("throttle.update audit entries = %d, want 2", got)
+	}
+}
+
+func TestThrottleOverRPC(t *testing.T) {
+	withThrottle := map[string]interface{}{
+		"throttle.get": map[string]int{"count": 4, "period": 20},
+		"throttle.set": map[string]interface{}{},
+	}
+	withoutThrottle := map[string]interface{}{
+		"rpc.info": map[string]interface{}{"methods": map[string]interface{}{"user.list": map[string]string{}}},
+	}
+
+	tests := []struct {
+		name    string
+		results map[string]interface{}
+		detect  bool
+		get     int
+		update  int
+	}{
+		{"supported", withThrottle, false, http.StatusOK, http.StatusOK},
+		{"not advertised", withoutThrottle, true, http.StatusNotImplemented, http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			startFakeRPC(t, tt.results)
+			if tt.detect {
+				if _, err := rpcClient.DetectCapabilities(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			adminID := createTestUser(t, "boss", "admin")
+
+			w := httptest.NewRecorder()
+			getThrottleHandler(w, httptest.NewRequest("GET", "/api/server/throttle", nil))
+			if w.Code != tt.get {
+				t.Errorf("get: status %d %s, want %d", w.Code, w.Body, tt.get)
+			}
+			if tt.get == http.StatusOK {
+				var settings rpc.ThrottleSettings
+				if err := json.NewDecoder(w.Body).Decode(&settings); err != nil || settings.Count != 4 || settings.Period != 20 {
+					t.Errorf("get = %+v (%v), want the server's settings", settings, err)
+				}
+			}
+
+			w = httptest.NewRecorder()
+			updateThrottleHandler(w, asUser("PUT", "/api/server/throttle", `{"count":5,"period":30}`, adminID, "boss", "admin"))
+			if w.Code != tt.update {
+				t.Errorf("update: status %d %s, want %d", w.Code, w.Body, tt.update)
+			}
+		})
+	}
+}
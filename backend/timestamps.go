@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	// Embedded zone database, so DISPLAY_TIMEZONE works on hosts without one
+	_ "time/tzdata"
+)
+
+// displayTimeFormat is how timestamps are shown in the display timezone
+const displayTimeFormat = "2006-01-02 15:04:05 MST"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// displayTime formats t in the configured display timezone
+func displayTime(t time.Time) string {
+	loc := time.UTC
+	if config != nil && config.DisplayLocation != nil {
+		loc = config.DisplayLocation
+	}
+	return t.In(loc).Format(displayTimeFormat)
+}
+
+// marshalWithLocalTimes marshals a struct with its time.Time and *time.Time
+// fields in UTC, and adds a display-timezone string next to each set one,
+// named after the field: "createdAt" gains "createdAtLocal" and "created_at"
+// gains "created_at_local", following the naming style of the struct.
+// v must be a struct without its own MarshalJSON.
+func marshalWithLocalTimes(v interface{}) ([]byte, error) {
+	value := reflect.New(reflect.TypeOf(v)).Elem()
+	value.Set(reflect.ValueOf(v))
+	typ := value.Type()
+
+	names := make([]string, typ.NumField())
+	snakeCase := false
+	for i := range names {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "-" || !typ.Field(i).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = typ.Field(i).Name
+		}
+		names[i] = name
+		snakeCase = snakeCase || strings.Contains(name, "_")
+	}
+
+	locals := map[string]string{}
+	var order []string
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+
+		field := value.Field(i)
+		var t time.Time
+		switch {
+		case field.Type() == timeType:
+			t = field.Interface().(time.Time)
+			if t.IsZero() {
+				continue
+			}
+			field.Set(reflect.ValueOf(t.UTC()))
+		case field.Type() == reflect.PointerTo(timeType):
+			if field.IsNil() {
+				continue
+			}
+			t = field.Elem().Interface().(time.Time).UTC()
+			field.Set(reflect.ValueOf(&t))
+		default:
+			continue
+		}
+
+		local := name + "Local"
+		if snakeCase {
+			local = name + "_local"
+		}
+		locals[local] = displayTime(t)
+		order = append(order, local)
+	}
+
+	data, err := json.Marshal(value.Interface())
+	if err != nil || len(order) == 0 {
+		return data, err
+	}
+
+	// Append the local fields inside the object, keeping the struct's field order
+	data = data[:len(data)-1]
+	for _, name := range order {
+		key, _ := json.Marshal(name)
+		val, _ := json.Marshal(locals[name])
+		data = append(data, ',')
+		data = append(data, key...)
+		data = append(data, ':')
+		data = append(data, val...)
+	}
+	return append(data, '}'), nil
+}
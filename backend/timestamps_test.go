@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMarshalWithLocalTimes(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = &Config{DisplayLocation: berlin}
+
+	at := time.Date(2024, 7, 1, 12, 30, 0, 0, time.FixedZone("EDT", -4*3600)) // 16:30 UTC
+
+	type camel struct {
+		Name      string     `json:"name"`
+		CreatedAt time.Time  `json:"createdAt"`
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+		UpdatedAt time.Time  `json:"updatedAt"`
+	}
+	type snake struct {
+		CreatedAt time.Time `json:"created_at"`
+		Hidden    time.Time `json:"-"`
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]string
+	}{
+		{"camel case with a pointer", camel{Name: "x", CreatedAt: at, ExpiresAt: &at}, map[string]string{
+			"name":           "x",
+			"createdAt":      "2024-07-01T16:30:00Z",
+			"createdAtLocal": "2024-07-01 18:30:00 CEST",
+			"expiresAt":      "2024-07-01T16:30:00Z",
+			"expiresAtLocal": "2024-07-01 18:30:00 CEST",
+			"updatedAt":      "0001-01-01T00:00:00Z", // Zero times get no local form
+		}},
+		{"snake case", snake{CreatedAt: at, Hidden: at}, map[string]string{
+			"created_at":       "2024-07-01T16:30:00Z",
+			"created_at_local": "2024-07-01 18:30:00 CEST",
+		}},
+	}
+	for _, tt := range tests {
+		data, err := marshalWithLocalTimes(tt.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got map[string]string
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %s is not a JSON object: %v", tt.name, data, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %s, want %v", tt.name, data, tt.want)
+		}
+		for key, want := range tt.want {
+			if got[key] != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, key, got[key], want)
+			}
+		}
+	}
+}
+
+func TestDisplayTimeDefaultsToUTC(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config = &Config{}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 3600))
+	if got := displayTime(at); got != "2024-01-02 02:04:05 UTC" {
+		t.Errorf("displayTime without a zone = %q, want UTC", got)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults every authenticator app supports.
+// Codes from one step either side of the current one are accepted to allow
+// for clock drift.
+const (
+	totpStep        = 30 * time.Second
+	totpDigits      = 6
+	totpSkew        = 1
+	totpSecretBytes = 20
+	totpModulus     = 1000000 // 10^totpDigits
+)
+
+// totpEncoding is the unpadded base32 used for secrets in otpauth URLs
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a random base32-encoded TOTP secret
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpCode computes the code for a time step (RFC 4226 HOTP over the step number)
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulus), nil
+}
+
+// matchTOTP returns the time step a code belongs to if it is valid at now
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	current := now.Unix() / int64(totpStep/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// useTOTPCode checks a code for a user with two-factor authentication and
+// marks its time step used, so a code cannot be replayed
+func useTOTPCode(user *WebpanelUser, code string, now time.Time) (bool, error) {
+	step, ok := matchTOTP(user.TOTPSecret, code, now)
+	if !ok {
+		return false, nil
+	}
+
+	result, err := db.Exec("UPDATE webpanel_users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, user.ID, step)
+	if err != nil {
+		return false, err
+	}
+	used, err := result.RowsAffected()
+	return used > 0, err
+}
+
+// totpURL builds the otpauth:// URL authenticator apps import, usually from a QR code
+func totpURL(username, secret string) string {
+	issuer := config.PanelName
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpStep/time.Second)))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+username) + "?" + query.Encode()
+}
+
+// loadCurrentUser loads the active account behind a request, writing an error response on failure
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) *WebpanelUser {
+	userID, _, _ := getUserFromContext(r)
+	user, _, err := loadWebpanelUser("id = ?", userID)
+	if err != nil {
+		log.Printf("❌ Failed to load user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to load user"})
+		return nil
+	}
+	return user
+}
+
+// decodeTOTPCode reads {"code": "123456"} from the request body, writing an error response on failure
+func decodeTOTPCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A two-factor code is required", "field": "code"})
+		return "", false
+	}
+	return req.Code, true
+}
+
+// setupTOTPHandler generates a new secret for the logged-in user. It takes
+// effect once a code from it is confirmed with verifyTOTPHandler.
+func setupTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	user := loadCurrentUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err == nil {
+		_, err = db.Exec("UPDATE webpanel_users SET totp_secret = ?, updated_at = ? WHERE id = ?", secret, time.Now(), user.ID)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to set up two-factor authentication for %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_url": totpURL(user.Username, secret),
+	})
+}
+
+// verifyTOTPHandler enables two-factor authentication once the user proves
+// their authenticator produces codes for the secret from setup
+func verifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	code, ok := decodeTOTPCode(w, r)
+	if !ok {
+		return
+	}
+	user := loadCurrentUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Set up two-factor authentication first"})
+		return
+	}
+
+	step, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid two-factor code", "field": "code"})
+		return
+	}
+
+	_, err := db.Exec("UPDATE webpanel_users SET totp_enabled = TRUE, totp_last_step = ?, updated_at = ? WHERE id = ?", step, time.Now(), user.ID)
+	if err != nil {
+		log.Printf("❌ Failed to enable two-factor authentication for %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	log.Printf("🔐 Two-factor authentication enabled for %s", user.Username)
+	recordAudit(r, "2fa.enable", user.Username, nil)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// disableTOTPHandler turns two-factor authentication off, given a current code
+func disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	code, ok := decodeTOTPCode(w, r)
+	if !ok {
+		return
+	}
+	user := loadCurrentUser(w, r)
+	if user == nil {
+		return
+	}
+	if !user.TOTPEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := useTOTPCode(user, code, time.Now())
+	if err == nil && !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid two-factor code", "field": "code"})
+		return
+	}
+	if err == nil {
+		_, err = db.Exec("UPDATE webpanel_users SET totp_enabled = FALSE, totp_secret = '', totp_last_step = 0, updated_at = ? WHERE id = ?", time.Now(), user.ID)
+	}
+	if err != nil {
+		log.Printf("❌ Failed to disable two-factor authentication for %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	log.Printf("🔓 Two-factor authentication disabled for %s", user.Username)
+	recordAudit(r, "2fa.disable", user.Username, nil)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
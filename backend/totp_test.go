@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 SHA1 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	// The RFC lists 8-digit codes; these are their last 6 digits
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := totpCode(rfcSecret, unix/int64(totpStep/time.Second))
+		if err != nil {
+			t.Fatalf("totpCode at %d: %v", unix, err)
+		}
+		if got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestMatchTOTPAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / int64(totpStep/time.Second)
+
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, err := totpCode(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := matchTOTP(rfcSecret, code[:3]+" "+code[3:], now)
+		if ok != want || (ok && step != current+offset) {
+			t.Errorf("code from step %+d: matched = %t at step %d, want %t", offset, ok, step, want)
+		}
+	}
+}
+
+func TestTOTPCodeCannotBeReplayed(t *testing.T) {
+	setupTestDB(t)
+	id := createTestUser(t, "alice", "viewer")
+	if _, err := db.Exec("UPDATE webpanel_users SET totp_secret = ?, totp_enabled = TRUE WHERE id = ?", rfcSecret, id); err != nil {
+		t.Fatal(err)
+	}
+	user, _, err := loadWebpanelUser("id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / int64(totpStep/time.Second)
+	code := func(step int64) string {
+		c, err := totpCode(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if ok, err := useTOTPCode(user, code(current), now); err != nil || !ok {
+		t.Fatalf("first use of a valid code = %t, %v, want accepted", ok, err)
+	}
+	if ok, _ := useTOTPCode(user, code(current), now); ok {
+		t.Error("the same code was accepted twice")
+	}
+	if ok, _ := useTOTPCode(user, code(current-1), now); ok {
+		t.Error("a code older than the last used one was accepted")
+	}
+	if ok, _ := useTOTPCode(user, code(current+1), now.Add(totpStep)); !ok {
+		t.Error("the next step's code was refused")
+	}
+}
+
+func TestLoginWithTwoFactorAuthentication(t *testing.T) {
+	setupTestDB(t)
+	id := createTestUser(t, "bob", "viewer")
+
+	w := httptest.NewRecorder()
+	setupTOTPHandler(w, asUser("POST", "/api/auth/2fa/setup", "", id, "bob", "viewer"))
+	var setup struct {
+		Secret string `json:"secret"`
+		URL    string `json:"otpauth_url"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&setup); err != nil || setup.Secret == "" {
+		t.Fatalf("setup: status %d, %v", w.Code, err)
+	}
+	if !strings.HasPrefix(setup.URL, "otpauth://totp/") || !strings.Contains(setup.URL, "secret="+setup.Secret) {
+		t.Errorf("otpauth URL %s does not carry the secret", setup.URL)
+	}
+
+	current := time.Now().Unix() / int64(totpStep/time.Second)
+	code := func(step int64) string {
+		c, err := totpCode(setup.Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Two-factor login is not required until a code confirms the setup
+	if status, _ := login(t, LoginRequest{Username: "bob", Password: "Correct-Horse-7"}); status != http.StatusOK {
+		t.Fatalf("login before verify: status %d, want 200", status)
+	}
+
+	w = httptest.NewRecorder()
+	verifyTOTPHandler(w, asUser("POST", "/api/auth/2fa/verify", `{"code":"000000x"}`, id, "bob", "viewer"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("verify with a wrong code: status %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	verifyTOTPHandler(w, asUser("POST", "/api/auth/2fa/verify", `{"code":"`+code(current)+`"}`, id, "bob", "viewer"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: status %d, want 200", w.Code)
+	}
+
+	status, resp := login(t, LoginRequest{Username: "bob", Password: "Correct-Horse-7"})
+	if status != http.StatusUnauthorized || !resp.TwoFactorRequired || resp.Error != "2fa_required" {
+		t.Errorf("login without a code: status %d, %+v, want 401 2fa_required", status, resp)
+	}
+
+	// The verify code's step is used up, so the login uses the next one
+	status, resp = login(t, LoginRequest{Username: "bob", Password: "Correct-Horse-7", TOTPCode: code(current)})
+	if status != http.StatusUnauthorized || resp.Token != "" {
+		t.Errorf("login replaying the verify code: status %d, want 401", status)
+	}
+	status, resp = login(t, LoginRequest{Username: "bob", Password: "Correct-Horse-7", TOTPCode: code(current + 1)})
+	if status != http.StatusOK || resp.Token == "" {
+		t.Errorf("login with a valid code: status %d, %+v, want 200 with a token", status, resp)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// wsSendBuffer is the number of queued messages a WebSocket client may have.
+// A client that falls this far behind is disconnected.
+const wsSendBuffer = 64
+
+// wsWriteTimeout bounds a single write to a WebSocket connection
+const wsWriteTimeout = 10 * time.Second
+
+// allowAllOrigins in ALLOWED_ORIGINS accepts every origin. For development only:
+// any web page could then open a WebSocket with a panel user's token.
+const allowAllOrigins = "*"
+
+// checkWSOrigin accepts a WebSocket upgrade from a page on the panel's own
+// host or on an origin in ALLOWED_ORIGINS. Browsers always send Origin, so a
+// request without one is not from a web page and cannot be forged by one.
+func checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == allowAllOrigins || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	log.Printf("🚫 Refused WebSocket upgrade from origin %s", origin)
+	return false
+}
+
+// wsDroppedClients counts clients disconnected for not keeping up with broadcasts
+var wsDroppedClients atomic.Int64
+
+// wsClient is a connected WebSocket client and its subscriptions. Broadcasts
+// only queue messages on send; the connection's own goroutine writes them, so
+// a slow client never holds up the others.
+type wsClient struct {
+	send      chan interface{}
+	dropped   chan struct{} // Closed when the client is disconnected for falling behind
+	closeOnce sync.Once
+	ended     chan struct{} // Closed when the client's session is revoked or expires
+	endOnce   sync.Once
+
+	userID     int
+	username   string
+	role       string // Panel role of the connected user
+	sessionID  string // jti of the token the client connected with
+	viewAudit  bool   // Holds logs.view, resolved at upgrade
+	viewHidden bool   // Holds channels.view_hidden, resolved at upgrade
+
+	// Holds channels.view, or else the channels it has moderator grants for,
+	// resolved at upgrade
+	viewChannels  bool
+	channelGrants map[string]bool
+
+	mutex        sync.RWMutex
+	auditActions map[string]bool // nil subscribes to every action
+	channels     map[string]bool // Lowercased channels subscribed to for membership events
+}
+
+// wsSubscribeMessage is sent by clients to scope the events they receive, e.g.
+// {"type":"subscribe","filter":{"actions":["ban","kill"]}} for audit events or
+// {"type":"subscribe","channel":"#foo"} for a channel's join/part/kick events.
+// A reconnecting client adds "last_event_id" to have the events it missed replayed.
+type wsSubscribeMessage struct {
+	Type        string `json:"type"`
+	Channel     string `json:"channel,omitempty"`
+	LastEventID *int64 `json:"last_event_id,omitempty"`
+	Filter      *struct {
+		Actions []string `json:"actions"`
+	} `json:"filter,omitempty"`
+}
+
+// ChannelEvent is a membership change on a channel
+type ChannelEvent struct {
+	Channel string    `json:"channel"`
+	Event   string    `json:"event"` // "join", "part", "kick"
+	Nick    string    `json:"nick"`
+	Actor   string    `json:"actor,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// MarshalJSON adds the display-timezone form of each timestamp
+func (c ChannelEvent) MarshalJSON() ([]byte, error) {
+	type plain ChannelEvent
+	return marshalWithLocalTimes(plain(c))
+}
+
+func newWSClient(userID int, username, role string) *wsClient {
+	return &wsClient{
+		send:     make(chan interface{}, wsSendBuffer),
+		dropped:  make(chan struct{}),
+		ended:    make(chan struct{}),
+		userID:   userID,
+		username: username,
+		role:     role,
+		channels: make(map[string]bool),
+	}
+}
+
+// enqueue queues a message for the client without blocking the caller. If the
+// buffer is full the client is dropped rather than sent an incomplete stream.
+func (c *wsClient) enqueue(msg interface{}) {
+	select {
+	case <-c.dropped:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		c.drop()
+	}
+}
+
+// drop marks the client for disconnection; its connection goroutine closes it
+func (c *wsClient) drop() {
+	c.closeOnce.Do(func() {
+		close(c.dropped)
+		total := wsDroppedClients.Add(1)
+		log.Printf("⚠️ WebSocket client %s fell %d messages behind, disconnecting (%d dropped so far)", c.username, wsSendBuffer, total)
+	})
+}
+
+// endSession marks the client for disconnection because its session is no
+// longer valid; its connection goroutine closes it
+func (c *wsClient) endSession() {
+	c.endOnce.Do(func() {
+		close(c.ended)
+		log.Printf("🔒 Closing WebSocket of %s, session ended", c.username)
+	})
+}
+
+// handleMessage processes a message sent by the client
+func (c *wsClient) handleMessage(data []byte) {
+	var msg wsSubscribeMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.enqueue(map[string]interface{}{"type": "error", "data": "invalid message"})
+		return
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		if msg.Channel != "" {
+			c.subscribeChannel(msg.Channel, msg.LastEventID)
+			return
+		}
+
+		if !c.viewAudit {
+			c.enqueue(map[string]interface{}{"type": "error", "data": "insufficient permissions"})
+			return
+		}
+
+		var actions []string
+		if msg.Filter != nil {
+			actions = msg.Filter.Actions
+		}
+		wsEvents.subscribe(c, func() {
+			c.setAuditFilter(actions)
+			c.enqueue(map[string]interface{}{
+				"type": "subscribed",
+				"data": map[string]interface{}{"actions": actions},
+			})
+		}, msg.LastEventID, func(event wsEvent) bool {
+			return event.kind == "audit" && c.wantsAudit(event.action)
+		})
+	case "unsubscribe":
+		if msg.Channel == "" {
+			c.enqueue(map[string]interface{}{"type": "error", "data": "channel required"})
+			return
+		}
+		c.mutex.Lock()
+		delete(c.channels, strings.ToLower(msg.Channel))
+		c.mutex.Unlock()
+		c.enqueue(map[string]interface{}{
+			"type": "unsubscribed",
+			"data": map[string]interface{}{"channel": msg.Channel},
+		})
+	default:
+		c.enqueue(map[string]interface{}{"type": "error", "data": "unknown message type"})
+	}
+}
+
+// subscribeChannel adds a channel to the client's subscriptions if the client may view it
+func (c *wsClient) subscribeChannel(channel string, lastEventID *int64) {
+	if !strings.HasPrefix(channel, "#") {
+		c.enqueue(map[string]interface{}{"type": "error", "data": "invalid channel name"})
+		return
+	}
+
+	if !c.mayViewChannel(channel) {
+		c.enqueue(map[string]interface{}{"type": "error", "data": "insufficient permissions"})
+		return
+	}
+
+	// Hidden channels are reported as missing, as in the REST API
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !c.viewHidden && isHiddenChannelName(ctx, channel) {
+		c.enqueue(map[string]interface{}{"type": "error", "data": "channel not found"})
+		return
+	}
+
+	wsEvents.subscribe(c, func() {
+		c.mutex.Lock()
+		c.channels[strings.ToLower(channel)] = true
+		c.mutex.Unlock()
+
+		c.enqueue(map[string]interface{}{
+			"type": "subscribed",
+			"data": map[string]interface{}{"channel": channel},
+		})
+	}, lastEventID, func(event wsEvent) bool {
+		return event.kind == "channelEvent" && strings.EqualFold(event.channel, channel)
+	})
+}
+
+// mayViewChannel reports whether the client may follow a channel's events
+func (c *wsClient) mayViewChannel(channel string) bool {
+	return c.viewChannels || c.channelGrants[strings.ToLower(channel)]
+}
+
+// wantsChannel reports whether the client is subscribed to a channel's events
+func (c *wsClient) wantsChannel(channel string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.channels[strings.ToLower(channel)]
+}
+
+// setAuditFilter limits audit events to the given actions; an empty list means all
+func (c *wsClient) setAuditFilter(actions []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(actions) == 0 {
+		c.auditActions = nil
+		return
+	}
+
+	c.auditActions = make(map[string]bool, len(actions))
+	for _, action := range actions {
+		c.auditActions[action] = true
+	}
+}
+
+// wantsAudit reports whether the client may see and is subscribed to an audit action
+func (c *wsClient) wantsAudit(action string) bool {
+	if !c.viewAudit {
+		return false
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.auditActions == nil || c.auditActions[action]
+}
+
+// broadcastAudit sends an audit entry to every client subscribed to its action
+func broadcastAudit(entry AuditEntry) {
+	wsEvents.publish(wsEvent{kind: "audit", action: entry.Action}, entry, func(c *wsClient) bool {
+		return c.wantsAudit(entry.Action)
+	})
+}
+
+// broadcastChannelEvent sends a membership change made through the panel to
+// clients subscribed to its channel
+func broadcastChannelEvent(event ChannelEvent) {
+	notePanelChannelEvent(event)
+	publishChannelEvent(event)
+}
+
+// publishChannelEvent sends a membership event to clients subscribed to its channel
+func publishChannelEvent(event ChannelEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	wsEvents.publish(wsEvent{kind: "channelEvent", channel: event.Channel}, event, func(c *wsClient) bool {
+		return c.wantsChannel(event.Channel)
+	})
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// drainAudit returns the audit actions queued for a client
+func drainAudit(c *wsClient) []string {
+	var actions []string
+	for {
+		select {
+		case msg := <-c.send:
+			m, ok := msg.(map[string]interface{})
+			if !ok || m["type"] != "audit" {
+				continue
+			}
+			actions = append(actions, m["data"].(AuditEntry).Action)
+		default:
+			return actions
+		}
+	}
+}
+
+func TestBroadcastAuditFiltersSubscribers(t *testing.T) {
+	filtered := newWSClient(1, "filtered", "admin")
+	filtered.viewAudit = true
+	filtered.setAuditFilter([]string{"ban"})
+
+	all := newWSClient(2, "all", "admin")
+	all.viewAudit = true
+
+	unprivileged := newWSClient(3, "viewer", "user")
+
+	for _, c := range []*wsClient{filtered, all, unprivileged} {
+		wsHub.register(c)
+		defer wsHub.unregister(c)
+	}
+
+	broadcastAudit(AuditEntry{Action: "ban"})
+	broadcastAudit(AuditEntry{Action: "kill"})
+
+	if got := drainAudit(filtered); len(got) != 1 || got[0] != "ban" {
+		t.Errorf("filtered subscriber got %v, want [ban]", got)
+	}
+	if got := drainAudit(all); len(got) != 2 {
+		t.Errorf("unfiltered subscriber got %v, want [ban kill]", got)
+	}
+	if got := drainAudit(unprivileged); len(got) != 0 {
+		t.Errorf("client without logs.view got %v, want nothing", got)
+	}
+}
+
+func TestSlowClientDroppedWithoutBlockingOthers(t *testing.T) {
+	slow := newWSClient(1, "slow", "admin")
+	slow.viewAudit = true
+	fast := newWSClient(2, "fast", "admin")
+	fast.viewAudit = true
+	for _, c := range []*wsClient{slow, fast} {
+		wsHub.register(c)
+		defer wsHub.unregister(c)
+	}
+
+	// The fast client reads each round of concurrent broadcasts before the
+	// next one starts; the slow one never reads and falls behind
+	droppedBefore := wsDroppedClients.Load()
+	const rounds, senders, perSender = 4, 4, wsSendBuffer / 8
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < perSender; j++ {
+					broadcastAudit(AuditEntry{Action: "ban"})
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := drainAudit(fast); len(got) != senders*perSender {
+			t.Fatalf("fast client got %d events in round %d, want %d", len(got), round, senders*perSender)
+		}
+	}
+
+	select {
+	case <-slow.dropped:
+	default:
+		t.Fatal("slow client was not dropped")
+	}
+	if got := wsDroppedClients.Load() - droppedBefore; got != 1 {
+		t.Errorf("dropped clients metric grew by %d, want 1", got)
+	}
+}
+
+func TestAuditReplayRequiresLogsView(t *testing.T) {
+	broadcastAudit(AuditEntry{Action: "ban"})
+	lastID := wsEvents.lastID - 1
+
+	c := newWSClient(3, "viewer", "user")
+	c.handleMessage([]byte(`{"type":"subscribe","last_event_id":` + strconv.FormatInt(lastID, 10) + `}`))
+
+	msg := <-c.send
+	if m := msg.(map[string]interface{}); m["type"] != "error" {
+		t.Fatalf("subscribe without logs.view got %v, want an error", m)
+	}
+	select {
+	case msg := <-c.send:
+		t.Fatalf("unexpected message after refused subscribe: %v", msg)
+	default:
+	}
+
+	c.viewAudit = true
+	c.handleMessage([]byte(`{"type":"subscribe","last_event_id":` + strconv.FormatInt(lastID, 10) + `}`))
+	<-c.send // subscribed
+	replay := (<-c.send).(map[string]interface{})["data"].(wsReplay)
+	if len(replay.Events) != 1 {
+		t.Errorf("replay with logs.view has %d events, want 1", len(replay.Events))
+	}
+}
+
+func TestChannelReplayDeliversMissedThenLiveEvents(t *testing.T) {
+	setupWSTest(t)
+
+	// The client saw the first event before disconnecting, then missed two,
+	// one of them on a channel it does not follow
+	publishChannelEvent(ChannelEvent{Channel: "#help", Event: "join", Nick: "seen"})
+	lastID := wsEvents.lastID
+	publishChannelEvent(ChannelEvent{Channel: "#help", Event: "join", Nick: "missed"})
+	publishChannelEvent(ChannelEvent{Channel: "#other", Event: "join", Nick: "elsewhere"})
+
+	c := newWSClient(1, "admin", "admin")
+	c.viewChannels = true
+	wsHub.register(c)
+	defer wsHub.unregister(c)
+
+	c.subscribeChannel("#Help", &lastID)
+	if msg := (<-c.send).(map[string]interface{}); msg["type"] != "subscribed" {
+		t.Fatalf("first message %v, want subscribed", msg)
+	}
+
+	replay := (<-c.send).(map[string]interface{})["data"].(wsReplay)
+	if !replay.Complete || replay.LastEventID != wsEvents.lastID {
+		t.Errorf("replay complete = %t, lastEventId = %d, want true, %d", replay.Complete, replay.LastEventID, wsEvents.lastID)
+	}
+	if len(replay.Events) != 1 {
+		t.Fatalf("replay has %d events, want 1", len(replay.Events))
+	}
+	missed := replay.Events[0].(map[string]interface{})
+	if missed["id"] != lastID+1 || missed["data"].(ChannelEvent).Nick != "missed" {
+		t.Errorf("replayed %v, want the missed #help join", missed)
+	}
+
+	publishChannelEvent(ChannelEvent{Channel: "#help", Event: "part", Nick: "live"})
+	select {
+	case msg := <-c.send:
+		live := msg.(map[string]interface{})
+		if live["type"] != "channelEvent" || live["data"].(ChannelEvent).Nick != "live" {
+			t.Errorf("live message %v, want the #help part", live)
+		}
+	default:
+		t.Fatal("live event after the replay was not delivered")
+	}
+	select {
+	case msg := <-c.send:
+		t.Errorf("unexpected message after the live event: %v", msg)
+	default:
+	}
+}
+
+func TestReplayIncompleteWhenEventsPruned(t *testing.T) {
+	c := newWSClient(1, "admin", "admin")
+	c.viewAudit = true
+
+	// An ID from before the buffer's oldest event cannot be replayed in full
+	broadcastAudit(AuditEntry{Action: "ban"})
+	wsEvents.mutex.Lock()
+	lastID := wsEvents.events[0].id - 2
+	wsEvents.mutex.Unlock()
+
+	c.handleMessage([]byte(`{"type":"subscribe","last_event_id":` + strconv.FormatInt(lastID, 10) + `}`))
+	<-c.send // subscribed
+	if replay := (<-c.send).(map[string]interface{})["data"].(wsReplay); replay.Complete {
+		t.Errorf("replay from before the buffer marked complete")
+	}
+}
+
+// dialPanelWS starts the WebSocket endpoint and connects to it with a token
+func dialPanelWS(t *testing.T, token string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := tryDialPanelWS(t, token)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return conn
+}
+
+// tryDialPanelWS is dialPanelWS for upgrades that may be refused, returning
+// the handshake response
+func tryDialPanelWS(t *testing.T, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(websocketHandler))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	if token != "" {
+		url += "?token=" + token
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func TestWebSocketUpgradeRequiresValidToken(t *testing.T) {
+	setupWSTest(t)
+	valid, _ := loginForWS(t, "ivan", "viewer", time.Hour)
+	revoked, claims := loginForWS(t, "judy", "viewer", time.Hour)
+	if _, err := revokeSession(claims.ID); err != nil {
+		t.Fatalf("revokeSession: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "not-a-jwt", http.StatusUnauthorized},
+		{"wrong signature", valid[:len(valid)-4] + "AAAA", http.StatusUnauthorized},
+		{"revoked", revoked, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		_, resp, err := tryDialPanelWS(t, tt.token)
+		if err == nil {
+			t.Errorf("%s token: upgrade accepted", tt.name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tt.want {
+			t.Errorf("%s token: dial failed with %v, want status %d", tt.name, err, tt.want)
+		}
+	}
+
+	if _, _, err := tryDialPanelWS(t, valid); err != nil {
+		t.Errorf("valid token refused: %v", err)
+	}
+}
+
+// loginForWS issues a session for a new user, returning its token and claims
+func loginForWS(t *testing.T, username, role string, expiresIn time.Duration) (string, *JWTClaims) {
+	t.Helper()
+
+	id := createTestUser(t, username, role)
+	jti, err := newSessionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &JWTClaims{
+		UserID:   id,
+		Username: username,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := startSession(id, jti, claims.ExpiresAt.Time, httptest.NewRequest("POST", "/api/auth/login", nil)); err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	return token, claims
+}
+
+// expectSessionEnded reads until the server closes the connection and checks
+// it was closed for the session
+func expectSessionEnded(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("connection ended with %v, want a session ended close", err)
+			}
+			return
+		}
+	}
+}
+
+func setupWSTest(t *testing.T) {
+	t.Helper()
+
+	setupTestDB(t)
+	config.UseMockData = true
+	jwtSecret = []byte("websocket-test-secret-0123456789abcdef")
+
+	// No test's first frames come from another test's stats
+	wsHub.snapshotMutex.Lock()
+	wsHub.snapshot = nil
+	wsHub.snapshotMutex.Unlock()
+}
+
+func TestWebSocketClosedWhenSessionRevoked(t *testing.T) {
+	setupWSTest(t)
+	token, claims := loginForWS(t, "alice", "viewer", time.Hour)
+	conn := dialPanelWS(t, token)
+
+	waitForSession(t, claims.ID, true)
+
+	if _, err := revokeSession(claims.ID); err != nil {
+		t.Fatalf("revokeSession: %v", err)
+	}
+	expectSessionEnded(t, conn)
+}
+
+func TestWebSocketClosedWhenUserSessionsRevoked(t *testing.T) {
+	setupWSTest(t)
+	token, claims := loginForWS(t, "bob", "viewer", time.Hour)
+	conn := dialPanelWS(t, token)
+
+	waitForSession(t, claims.ID, true)
+
+	if err := revokeUserSessions(claims.UserID); err != nil {
+		t.Fatalf("revokeUserSessions: %v", err)
+	}
+	expectSessionEnded(t, conn)
+}
+
+func TestWebSocketClosedWhenSessionRevokedElsewhere(t *testing.T) {
+	setupWSTest(t)
+	config.WSIdleTimeout = 200 * time.Millisecond
+	token, claims := loginForWS(t, "carol", "viewer", time.Hour)
+	conn := dialPanelWS(t, token)
+
+	// A revocation the hub never hears of, e.g. from another panel instance,
+	// is picked up when the session is re-checked on the next ping
+	if _, err := db.Exec("UPDATE sessions SET revoked_at = ? WHERE jti = ?", time.Now(), claims.ID); err != nil {
+		t.Fatal(err)
+	}
+	sessions.forget(claims.ID)
+	expectSessionEnded(t, conn)
+}
+
+func TestWebSocketClosedWhenTokenExpires(t *testing.T) {
+	setupWSTest(t)
+	token, _ := loginForWS(t, "dave", "viewer", 1500*time.Millisecond)
+	conn := dialPanelWS(t, token)
+	expectSessionEnded(t, conn)
+}
+
+// waitForSession waits until a client connected with a session is registered
+// with the hub, or with registered false until none is
+func waitForSession(t *testing.T, jti string, registered bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		found := false
+		wsHub.forEach(func(client *wsClient) {
+			found = found || client.sessionID == jti
+		})
+		if found == registered {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client for session %s registered = %t, want %t", jti, found, registered)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeToSecretChannelRefused(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	config.HideSecretChans = true
+
+	client := newWSClient(1, "viewer1", "viewer")
+	client.viewChannels = true
+	client.subscribeChannel("#opers", nil)
+
+	msg := (<-client.send).(map[string]interface{})
+	if msg["type"] != "error" || client.wantsChannel("#opers") {
+		t.Errorf("subscribing to a +s channel got %v, want channel not found", msg)
+	}
+}
+
+func TestSubscribeToSecretChannelWithViewHidden(t *testing.T) {
+	setupTestDB(t)
+	config.UseMockData = true
+	config.HideSecretChans = true
+
+	client := newWSClient(1, "watcher1", "custom")
+	client.viewChannels = true
+	client.viewHidden = true
+	client.subscribeChannel("#opers", nil)
+
+	if msg := (<-client.send).(map[string]interface{}); msg["type"] != "subscribed" {
+		t.Errorf("subscribing to a +s channel with channels.view_hidden got %v, want subscribed", msg)
+	}
+}
+
+func TestSubscribeChannelRequiresViewPermission(t *testing.T) {
+	setupWSTest(t)
+	if _, err := db.Exec("INSERT INTO webpanel_roles (name, description, permissions, created_at, updated_at) VALUES ('auditor', '', '[\"logs.view\"]', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An auditor without channels.view, moderating only #help
+	token, claims := loginForWS(t, "erin", "auditor", time.Hour)
+	if _, err := db.Exec("INSERT INTO channel_moderators (user_id, channel, created_at) VALUES (?, '#help', CURRENT_TIMESTAMP)", claims.UserID); err != nil {
+		t.Fatal(err)
+	}
+	conn := dialPanelWS(t, token)
+
+	reply := func(channel string) map[string]interface{} {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]string{"type": "subscribe", "channel": channel}); err != nil {
+			t.Fatalf("subscribe %s: %v", channel, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg map[string]interface{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read reply for %s: %v", channel, err)
+			}
+			if msg["type"] != "networkStats" {
+				return msg
+			}
+		}
+	}
+
+	if msg := reply("#HELP"); msg["type"] != "subscribed" {
+		t.Errorf("subscribe to granted channel got %v, want subscribed", msg)
+	}
+	if msg := reply("#general"); msg["type"] != "error" || msg["data"] != "insufficient permissions" {
+		t.Errorf("subscribe without channels.view got %v, want insufficient permissions", msg)
+	}
+}
+
+func TestIdleWebSocketClosedAfterTimeout(t *testing.T) {
+	setupWSTest(t)
+	config.WSIdleTimeout = 300 * time.Millisecond
+	token, claims := loginForWS(t, "grace", "viewer", time.Hour)
+
+	// The client never reads, so it never answers the server's pings
+	dialPanelWS(t, token)
+	waitForSession(t, claims.ID, true)
+
+	start := time.Now()
+	waitForSession(t, claims.ID, false)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle client closed after %v, want about %v", elapsed, config.WSIdleTimeout)
+	}
+}
+
+func TestResponsiveWebSocketKeptOpen(t *testing.T) {
+	setupWSTest(t)
+	config.WSIdleTimeout = 300 * time.Millisecond
+	token, claims := loginForWS(t, "heidi", "viewer", time.Hour)
+	conn := dialPanelWS(t, token)
+
+	// Reading answers pings; the connection outlives several idle windows
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !strings.Contains(err.Error(), "timeout") {
+				t.Fatalf("connection closed while answering pings: %v", err)
+			}
+			break
+		}
+	}
+	waitForSession(t, claims.ID, true)
+}
+
+func TestCheckWSOrigin(t *testing.T) {
+	config = loadConfig()
+
+	tests := []struct {
+		allowed []string
+		origin  string
+		host    string
+		want    bool
+	}{
+		{defaultAllowedOrigins, "http://localhost:5173", "localhost:8080", true},
+		{defaultAllowedOrigins, "HTTP://LOCALHOST:3000", "localhost:8080", true},
+		{defaultAllowedOrigins, "https://evil.example", "localhost:8080", false},
+		{defaultAllowedOrigins, "", "localhost:8080", true}, // Not a browser
+		{[]string{"https://panel.example.net"}, "https://panel.example.net", "api.example.net", true},
+		{[]string{"https://panel.example.net"}, "http://localhost:5173", "api.example.net", false},
+		{[]string{"https://panel.example.net"}, "https://api.example.net", "api.example.net", true}, // Same host
+		{[]string{"https://panel.example.net"}, "https://api.example.net:8443", "api.example.net", false},
+		{[]string{allowAllOrigins}, "https://evil.example", "localhost:8080", true},
+	}
+	for _, tt := range tests {
+		config.AllowedOrigins = tt.allowed
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkWSOrigin(r); got != tt.want {
+			t.Errorf("origin %q to %s, allowed %v: %t, want %t", tt.origin, tt.host, tt.allowed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"unrealircd-admin-panel/rpc"
+)
+
+// whoFilter tests one criterion against a user. It gets both the RPC record,
+// for the raw host and IP, and the listed user, whose modes have the hidden
+// letters removed so hidden modes cannot be probed through a filter.
+type whoFilter func(info rpc.UserInfo, user User) bool
+
+// whoFilterBuilders compiles each supported WHO field into a filter
+var whoFilterBuilders = map[string]func(value string) (whoFilter, error){
+	// nick: IRC mask, e.g. Guest*
+	"nick": func(value string) (whoFilter, error) {
+		return func(_ rpc.UserInfo, user User) bool { return matchMask(value, user.Nick) }, nil
+	},
+	// host: IRC mask matched against the hostname or IP; see whoDisplayHost
+	"host": func(value string) (whoFilter, error) {
+		return func(info rpc.UserInfo, _ User) bool {
+			return matchMask(value, info.Hostname) || matchMask(value, info.IP)
+		}, nil
+	},
+	// server: IRC mask, e.g. irc.*
+	"server": func(value string) (whoFilter, error) {
+		return func(_ rpc.UserInfo, user User) bool { return matchMask(value, user.ConnectedTo) }, nil
+	},
+	// account: IRC mask; "*" matches any logged-in user
+	"account": func(value string) (whoFilter, error) {
+		return func(_ rpc.UserInfo, user User) bool {
+			return user.Account != "" && matchMask(value, user.Account)
+		}, nil
+	},
+	// country: two-letter country code
+	"country": func(value string) (whoFilter, error) {
+		return func(_ rpc.UserInfo, user User) bool { return strings.EqualFold(value, user.Country) }, nil
+	},
+	// oper: true/false, or an oper class mask
+	"oper": func(value string) (whoFilter, error) {
+		if isOper, err := strconv.ParseBool(value); err == nil {
+			return func(_ rpc.UserInfo, user User) bool { return (user.Oper != "") == isOper }, nil
+		}
+		return func(_ rpc.UserInfo, user User) bool {
+			return user.Oper != "" && matchMask(value, user.Oper)
+		}, nil
+	},
+	// secure: true/false for TLS connections
+	"secure": func(value string) (whoFilter, error) {
+		secure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, whoError("secure must be true or false")
+		}
+		return func(_ rpc.UserInfo, user User) bool { return user.Secure == secure }, nil
+	},
+	// mode: letters the user must have ("+iw", or just "iw") and must not have ("-x")
+	"mode": parseWhoModes,
+}
+
+// whoError is a filter problem reported to the client as a 400
+type whoError string
+
+func (e whoError) Error() string { return string(e) }
+
+// whoFields lists the supported filter names for error messages
+func whoFields() string {
+	fields := make([]string, 0, len(whoFilterBuilders))
+	for field := range whoFilterBuilders {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+func parseWhoModes(value string) (whoFilter, error) {
+	var want, reject string
+	adding := true
+	for _, mode := range value {
+		switch {
+		case mode == '+':
+			adding = true
+		case mode == '-':
+			adding = false
+		case (mode >= 'a' && mode <= 'z') || (mode >= 'A' && mode <= 'Z'):
+			if adding {
+				want += string(mode)
+			} else {
+				reject += string(mode)
+			}
+		default:
+			return nil, whoError(fmt.Sprintf("Invalid mode letter '%c'", mode))
+		}
+	}
+	if want == "" && reject == "" {
+		return nil, whoError("mode must contain at least one mode letter")
+	}
+
+	return func(_ rpc.UserInfo, user User) bool {
+		for _, mode := range want {
+			if !strings.ContainsRune(user.Modes, mode) {
+				return false
+			}
+		}
+		return !strings.ContainsAny(user.Modes, reject)
+	}, nil
+}
+
+// whoDisplayHost compiles the host filter for panel users without
+// users.view_realhost. It only sees the host they are shown, so it cannot be
+// used to look up a user's real host or IP.
+func whoDisplayHost(value string) (whoFilter, error) {
+	return func(info rpc.UserInfo, _ User) bool {
+		return matchMask(value, buildUserHost(info, false).DisplayHost)
+	}, nil
+}
+
+// parseWhoFilters compiles the query into filters, rejecting unknown fields.
+// Repeating a field adds another criterion rather than an alternative.
+// Without showReal, host matches the displayed host rather than the real one.
+func parseWhoFilters(query url.Values, showReal bool) ([]whoFilter, error) {
+	var filters []whoFilter
+	for field, values := range query {
+		if field == "limit" || field == "offset" {
+			continue // Pagination for the version 2 envelope
+		}
+		build, ok := whoFilterBuilders[field]
+		if !ok {
+			return nil, whoError(fmt.Sprintf("Unknown filter '%s', supported filters are %s", field, whoFields()))
+		}
+		if field == "host" && !showReal {
+			build = whoDisplayHost
+		}
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, whoError(fmt.Sprintf("Filter '%s' needs a value", field))
+			}
+			filter, err := build(value)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
+
+// userListFilters are the WHO filters GET /api/users also accepts
+var userListFilters = []string{"server", "oper"}
+
+// parseUserListFilters compiles the user list's server and oper filters.
+// Other parameters, such as limit and offset, are left alone.
+func parseUserListFilters(query url.Values) ([]whoFilter, error) {
+	var filters []whoFilter
+	for _, field := range userListFilters {
+		for _, value := range query[field] {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, whoError(fmt.Sprintf("Filter '%s' needs a value", field))
+			}
+			filter, err := whoFilterBuilders[field](value)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
+
+// filterWho keeps the users matching every filter, in list form, showing
+// real hosts only with showReal
+func filterWho(rpcUsers []rpc.UserInfo, filters []whoFilter, showReal bool) []User {
+	matched := []User{}
+	for _, info := range rpcUsers {
+		user := userForList(toAPIUser(info, showReal))
+		ok := true
+		for _, filter := range filters {
+			if !filter(info, user) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, user)
+		}
+	}
+	return matched
+}
+
+// getUsersWhoHandler answers WHO-style queries combining filters with AND
+func getUsersWhoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	showReal := hasPermission(r, "users.view_realhost")
+	filters, err := parseWhoFilters(r.URL.Query(), showReal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rpcUsers []rpc.UserInfo
+	if config.UseMockData || rpcClient == nil {
+		rpcUsers = getMockUserInfos()
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rpcUsers, err = rpcClient.GetUsers(ctx)
+		if err != nil {
+			log.Printf("RPC error running WHO query: %v", err)
+			writeRPCError(w, err, "Failed to get users")
+			return
+		}
+	}
+
+	writeUsers(w, r, filterWho(rpcUsers, filters, showReal))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUserListsRedactRealHosts(t *testing.T) {
+	config = loadConfig()
+	users := getMockUserInfos()
+
+	for _, user := range filterWho(users, nil, false) {
+		if strings.Contains(user.HostIP, "127.0.0.1") || strings.Contains(user.HostIP, "192.0.2.10") {
+			t.Errorf("%s: hostIP %q shows the real IP without users.view_realhost", user.Nick, user.HostIP)
+		}
+	}
+	for _, user := range filterByReputation(users, 1000, false).Users {
+		if strings.Contains(user.HostIP, "192.0.2.10") {
+			t.Errorf("%s: reputation list shows the real IP without users.view_realhost", user.Nick)
+		}
+	}
+
+	shown := filterWho(users, nil, true)
+	if len(shown) == 0 || !strings.Contains(shown[0].HostIP, "127.0.0.1") {
+		t.Errorf("hostIP with users.view_realhost = %v, want the real host and IP", shown)
+	}
+}
+
+func TestWhoHostFilterNeedsRealHostPermission(t *testing.T) {
+	config = loadConfig()
+	users := getMockUserInfos()
+
+	count := func(query string, showReal bool) int {
+		values, _ := url.ParseQuery(query)
+		filters, err := parseWhoFilters(values, showReal)
+		if err != nil {
+			t.Fatalf("parseWhoFilters(%q): %v", query, err)
+		}
+		return len(filterWho(users, filters, showReal))
+	}
+
+	if n := count("host=192.0.2.*", false); n != 0 {
+		t.Errorf("real IP mask matched %d users without users.view_realhost, want 0", n)
+	}
+	if n := count("host=192.0.2.*", true); n != 1 {
+		t.Errorf("real IP mask matched %d users with users.view_realhost, want 1", n)
+	}
+	if n := count("host=Clk-4E7B*", false); n != 1 {
+		t.Errorf("cloaked host mask matched %d users, want 1", n)
+	}
+}
+
+func TestUsersListFiltersAndPages(t *testing.T) {
+	setupTestDB(t)
+	startFakeRPC(t, map[string]interface{}{"user.list": map[string]interface{}{"list": []map[string]interface{}{
+		{"nick": "alice", "server": "irc.example.net", "is_oper": true, "oper_class": "netadmin"},
+		{"nick": "bob", "server": "irc.example.net"},
+		{"nick": "carol", "server": "leaf.example.org", "is_oper": true, "oper_class": "locop"},
+		{"nick": "dave", "server": "leaf.example.org"},
+		{"nick": "erin", "server": "leaf.example.org"},
+	}}})
+
+	tests := []struct {
+		query  string
+		status int
+		total  int
+		nicks  string
+	}{
+		{"", http.StatusOK, 5, "alice,bob,carol,dave,erin"},
+		{"?server=leaf.*", http.StatusOK, 3, "carol,dave,erin"},
+		{"?oper=true", http.StatusOK, 2, "alice,carol"},
+		{"?oper=false&server=irc.*", http.StatusOK, 1, "bob"},
+		{"?oper=net*", http.StatusOK, 1, "alice"},
+		{"?server=leaf.*&limit=2", http.StatusOK, 3, "carol,dave"},
+		{"?server=leaf.*&limit=2&offset=2", http.StatusOK, 3, "erin"},
+		{"?offset=10", http.StatusOK, 5, ""},
+		{"?limit=0", http.StatusOK, 5, "alice"},
+		{"?limit=bogus", http.StatusOK, 5, "alice,bob,carol,dave,erin"},
+		{"?nick=alice", http.StatusOK, 5, "alice,bob,carol,dave,erin"}, // Only server and oper filter this list
+		{"?server=", http.StatusBadRequest, 0, ""},
+		{"?oper=%20", http.StatusBadRequest, 0, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/users"+tt.query, nil)
+		r.Header.Set("X-API-Version", "2")
+		w := httptest.NewRecorder()
+		getUsersHandler(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d %s, want %d", tt.query, w.Code, w.Body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+
+		var list UserList
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("%s: decode: %v", tt.query, err)
+		}
+		nicks := make([]string, len(list.Users))
+		for i, user := range list.Users {
+			nicks[i] = user.Nick
+		}
+		if list.Total != tt.total || strings.Join(nicks, ",") != tt.nicks {
+			t.Errorf("%s: total %d, users %v; want %d, %s", tt.query, list.Total, nicks, tt.total, tt.nicks)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Bounds of the buffer reconnecting WebSocket clients can replay from
+const (
+	wsReplayCapacity = 1000
+	wsReplayWindow   = 5 * time.Minute
+)
+
+// wsEvent is a broadcast event kept for replay
+type wsEvent struct {
+	id      int64
+	at      time.Time
+	kind    string // Message type: "audit", "channelEvent", "userJoin", "userQuit" or "userNick"
+	action  string // Audit action, for audit events
+	channel string // Channel, for channel events
+	msg     map[string]interface{}
+}
+
+// wsReplay is sent to a client that subscribes with a last_event_id. Complete
+// is false when some events after that ID are no longer buffered, in which
+// case the client should reload its state over the REST API.
+type wsReplay struct {
+	Events      []interface{} `json:"events"`
+	LastEventID int64         `json:"lastEventId"`
+	Complete    bool          `json:"complete"`
+}
+
+// eventLog numbers broadcast events and keeps the recent ones. Publishing and
+// subscribing share one lock, so a subscriber never sees an event both in its
+// replay and live, and never misses one between the two.
+type eventLog struct {
+	mutex  sync.Mutex
+	lastID int64
+	events []wsEvent
+}
+
+// IDs start from the startup time in milliseconds, so IDs from before a
+// restart are lower than every new one and show up as a gap on replay
+var wsEvents = &eventLog{lastID: time.Now().UnixMilli()}
+
+// publish assigns the event the next ID, buffers it and sends it to every
+// client for which wants returns true
+func (l *eventLog) publish(event wsEvent, data interface{}, wants func(c *wsClient) bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastID++
+	event.id = l.lastID
+	event.at = time.Now()
+	event.msg = map[string]interface{}{"type": event.kind, "id": event.id, "data": data}
+
+	l.prune(event.at)
+	l.events = append(l.events, event)
+
+	wsHub.forEach(func(client *wsClient) {
+		if wants(client) {
+			client.enqueue(event.msg)
+		}
+	})
+}
+
+// prune drops events past the capacity or the time window. Callers hold the lock.
+func (l *eventLog) prune(now time.Time) {
+	drop := 0
+	for drop < len(l.events) && (len(l.events)-drop >= wsReplayCapacity || now.Sub(l.events[drop].at) > wsReplayWindow) {
+		drop++
+	}
+	l.events = append(l.events[:0], l.events[drop:]...)
+}
+
+// subscribe runs update, which changes the client's subscription, and then,
+// when lastID is set, queues a replay of the buffered events after lastID that
+// match. Events published afterwards reach the client live.
+func (l *eventLog) subscribe(c *wsClient, update func(), lastID *int64, match func(event wsEvent) bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	update()
+	if lastID == nil {
+		return
+	}
+
+	// Buffered IDs are always a contiguous run ending at the latest ID, so nothing was
+	// lost if the client is current or the run starts right after its ID
+	l.prune(time.Now())
+	replay := wsReplay{Events: []interface{}{}, LastEventID: l.lastID}
+	replay.Complete = *lastID <= l.lastID &&
+		(*lastID == l.lastID || (len(l.events) > 0 && l.events[0].id <= *lastID+1))
+
+	for _, event := range l.events {
+		if event.id > *lastID && match(event) {
+			replay.Events = append(replay.Events, event.msg)
+		}
+	}
+
+	c.enqueue(map[string]interface{}{"type": "replay", "data": replay})
+}